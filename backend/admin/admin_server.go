@@ -1,25 +1,40 @@
 package admin
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/api"
+	"github.com/jrupac/goliath/backup"
+	"github.com/jrupac/goliath/digest"
+	"github.com/jrupac/goliath/epub"
 	"github.com/jrupac/goliath/fetch"
 	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/newsletter"
+	"github.com/jrupac/goliath/opml"
 	"github.com/jrupac/goliath/storage"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 	"net"
+	"net/mail"
+	"net/url"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 )
 
 var (
-	adminPort = flag.Int("adminPort", 9997, "Port of gRPC admin server.")
+	adminPort        = flag.Int("adminPort", 9997, "Port of gRPC admin server.")
+	accountChunkSize = flag.Int("accountChunkSize", 256<<10, "Size in bytes of chunks of streamed account archives.")
 )
 
 type server struct {
@@ -318,7 +333,12 @@ func (s *server) GetFeeds(_ context.Context, req *GetFeedsRequest) (*GetFeedsRes
 	}
 
 	for _, f := range feeds {
-		resp.Feeds = append(resp.Feeds, &GetFeedsResponse_Feed{Id: f.ID, Title: f.Title})
+		resp.Feeds = append(resp.Feeds, &GetFeedsResponse_Feed{
+			Id:            f.ID,
+			Title:         f.Title,
+			FetchFullText: f.FetchFullText,
+			Transformer:   f.Transformers,
+		})
 	}
 
 	return resp, nil
@@ -369,7 +389,8 @@ func (s *server) RemoveFeed(_ context.Context, req *RemoveFeedRequest) (*RemoveF
 }
 
 // EditFeed updates the requested feed for the requested user.
-// During the operation of adding a feed, fetching is paused and restarted.
+// During the operation of editing a feed, fetching is paused and restarted so
+// that fetchers pick up the new folder and title.
 func (s *server) EditFeed(_ context.Context, req *EditFeedRequest) (*EditFeedResponse, error) {
 	resp := &EditFeedResponse{}
 
@@ -379,39 +400,193 @@ func (s *server) EditFeed(_ context.Context, req *EditFeedRequest) (*EditFeedRes
 	if req.Id == 0 {
 		return nil, status.Error(codes.InvalidArgument, "must specify non-zero Feed ID")
 	}
+	if req.Folder == "" && req.CustomTitle == "" && !req.ClearCustomTitle {
+		return nil, status.Error(codes.InvalidArgument, "must specify Folder, CustomTitle, or ClearCustomTitle")
+	}
+	if req.CustomTitle != "" && req.ClearCustomTitle {
+		return nil, status.Error(codes.InvalidArgument, "cannot specify both CustomTitle and ClearCustomTitle")
+	}
 
 	user, err := s.db.GetUserByUsername(req.Username)
 	if err != nil {
 		return nil, status.Error(codes.NotFound, "could not find user")
 	}
 
-	folders, err := s.db.GetAllFoldersForUser(user)
-	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+	var folderId int64 = -1
+	if req.Folder != "" {
+		folders, err := s.db.GetAllFoldersForUser(user)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+
+		for _, f := range folders {
+			if f.Name == req.Folder {
+				folderId = f.ID
+				break
+			}
+		}
+		if folderId == -1 {
+			return nil, status.Error(codes.InvalidArgument, "could not find folder")
+		}
 	}
 
-	var folderId int64 = -1
-	for _, f := range folders {
-		if f.Name == req.Folder {
-			folderId = f.ID
-			break
+	fetch.Pause()
+	defer fetch.Resume()
+
+	if folderId != -1 {
+		err = s.db.UpdateFolderForFeedForUser(user, req.Id, folderId)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "internal error")
 		}
 	}
-	if folderId == -1 {
-		return nil, status.Error(codes.InvalidArgument, "could not find folder")
+
+	if req.CustomTitle != "" || req.ClearCustomTitle {
+		err = s.db.UpdateCustomTitleForFeedForUser(user, req.Id, req.CustomTitle)
+		if err != nil {
+			log.Warningf("while updating custom title for feed: %+v", err)
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+	}
+
+	return resp, nil
+}
+
+// SetFeedFetchFullText enables or disables full-text extraction at fetch time
+// for the requested feeds. Fetching is paused and restarted so that fetchers
+// pick up the new setting.
+func (s *server) SetFeedFetchFullText(_ context.Context, req *SetFeedFetchFullTextRequest) (*SetFeedFetchFullTextResponse, error) {
+	resp := &SetFeedFetchFullTextResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if len(req.FeedId) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify FeedId")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
 	}
 
 	fetch.Pause()
 	defer fetch.Resume()
 
-	err = s.db.UpdateFolderForFeedForUser(user, req.Id, folderId)
+	for _, id := range req.FeedId {
+		if err = s.db.UpdateFetchFullTextForFeedForUser(user, id, req.Enabled); err != nil {
+			log.Warningf("while updating full-text setting for feed %d: %+v", id, err)
+			return nil, status.Errorf(codes.Internal, "could not update feed")
+		}
+	}
+
+	return resp, nil
+}
+
+// GetTransformers lists the transformers that can be configured for feeds.
+func (s *server) GetTransformers(context.Context, *GetTransformersRequest) (*GetTransformersResponse, error) {
+	resp := &GetTransformersResponse{}
+	for _, t := range fetch.Transformers() {
+		resp.Transformers = append(resp.Transformers, &GetTransformersResponse_Transformer{
+			Name:        t.Name,
+			Description: t.Description,
+		})
+	}
+	return resp, nil
+}
+
+// SetFeedTransformers sets the ordered list of transformers for a feed.
+// Fetching is paused and restarted so that fetchers pick up the new setting.
+func (s *server) SetFeedTransformers(_ context.Context, req *SetFeedTransformersRequest) (*SetFeedTransformersResponse, error) {
+	resp := &SetFeedTransformersResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.FeedId == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify FeedId")
+	}
+	if err := fetch.ValidateTransformers(req.Transformer); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "internal error")
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+	if _, err = s.feedForUser(user, req.FeedId); err != nil {
+		return nil, err
+	}
+
+	fetch.Pause()
+	defer fetch.Resume()
+
+	if err = s.db.UpdateTransformersForFeedForUser(user, req.FeedId, req.Transformer); err != nil {
+		log.Warningf("while updating transformers for feed %d: %+v", req.FeedId, err)
+		return nil, status.Errorf(codes.Internal, "could not update feed")
 	}
 
 	return resp, nil
 }
 
+// PreviewFeedTransformers fetches a feed and returns the content of a sample
+// item before and after the given transformers, or those configured for the
+// feed, rewrite it.
+func (s *server) PreviewFeedTransformers(_ context.Context, req *PreviewFeedTransformersRequest) (*PreviewFeedTransformersResponse, error) {
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.FeedId == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify FeedId")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+	feed, err := s.feedForUser(user, req.FeedId)
+	if err != nil {
+		return nil, err
+	}
+
+	names := req.Transformer
+	if len(names) == 0 {
+		names = feed.Transformers
+	}
+	if err = fetch.ValidateTransformers(names); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	preview, err := fetch.PreviewTransformers(feed, names, req.Link)
+	if err != nil {
+		log.Warningf("while previewing transformers for feed %d: %+v", req.FeedId, err)
+		return nil, status.Errorf(codes.FailedPrecondition, "could not preview feed: %v", err)
+	}
+
+	return &PreviewFeedTransformersResponse{
+		Title:       preview.Title,
+		Link:        preview.Link,
+		Before:      preview.Before,
+		After:       preview.After,
+		Transformer: names,
+	}, nil
+}
+
+// feedForUser returns the user's feed with the given ID. Errors are returned
+// as gRPC status errors.
+func (s *server) feedForUser(u models.User, id int64) (models.Feed, error) {
+	feeds, err := s.db.GetAllFeedsForUser(u)
+	if err != nil {
+		log.Warningf("while retrieving feeds: %+v", err)
+		return models.Feed{}, status.Errorf(codes.Internal, "could not retrieve feeds")
+	}
+	for _, f := range feeds {
+		if f.ID == id {
+			return f, nil
+		}
+	}
+	return models.Feed{}, status.Errorf(codes.NotFound, "could not find feed")
+}
+
 // GetFeedMuteRegexes retrieves the current feed-specific mute regexes for a user.
 func (s *server) GetFeedMuteRegexes(_ context.Context, req *GetFeedMuteRegexesRequest) (*GetFeedMuteRegexesResponse, error) {
 	resp := &GetFeedMuteRegexesResponse{}
@@ -520,6 +695,984 @@ func (s *server) DeleteFeedMuteRegex(_ context.Context, req *DeleteFeedMuteRegex
 	return resp, nil
 }
 
+// GetRules retrieves the rules applied to new articles for a user.
+func (s *server) GetRules(_ context.Context, req *GetRulesRequest) (*GetRulesResponse, error) {
+	resp := &GetRulesResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	rules, err := s.db.GetRulesForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving rules for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve rules")
+	}
+
+	for _, r := range rules {
+		resp.Rules = append(resp.Rules, ruleToProto(r))
+	}
+
+	return resp, nil
+}
+
+// AddRule adds a rule applied to new articles for a user. The rule takes
+// effect on the next fetch of each feed.
+func (s *server) AddRule(_ context.Context, req *AddRuleRequest) (*AddRuleResponse, error) {
+	resp := &AddRuleResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	rule, err := ruleFromProto(req.Rule)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	resp.Id, err = s.db.InsertRuleForUser(user, rule)
+	if err != nil {
+		log.Warningf("while adding rule: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not insert rule")
+	}
+
+	return resp, nil
+}
+
+// DeleteRule deletes a rule for a user.
+func (s *server) DeleteRule(_ context.Context, req *DeleteRuleRequest) (*DeleteRuleResponse, error) {
+	resp := &DeleteRuleResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.Id == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify non-zero Id")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	if err = s.db.DeleteRuleForUser(user, req.Id); err != nil {
+		log.Warningf("while deleting rule: %+v", err)
+		return nil, status.Errorf(codes.NotFound, "could not delete rule")
+	}
+
+	return resp, nil
+}
+
+// TestRule evaluates a rule against a user's most recently retrieved articles
+// and returns the ones it matches. Article ages are measured from the time
+// each article was retrieved, as they would have been at fetch time.
+func (s *server) TestRule(_ context.Context, req *TestRuleRequest) (*TestRuleResponse, error) {
+	resp := &TestRuleResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	rule, err := ruleFromProto(req.Rule)
+	if err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 100
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	m, err := fetch.NewRuleMatcher(rule)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	articles, err := s.db.GetRecentArticlesForUser(user, limit)
+	if err != nil {
+		log.Warningf("while retrieving articles to test rule: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve articles")
+	}
+
+	resp.Tested = int32(len(articles))
+	for _, a := range articles {
+		if !m.Matches(a, a.Retrieved) {
+			continue
+		}
+		resp.Matched = append(resp.Matched, &TestRuleResponse_Article{
+			Id:     a.ID,
+			FeedId: a.FeedID,
+			Title:  a.Title,
+			Link:   a.Link,
+			Date:   a.Date.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+// ruleFromProto validates the given rule and converts it to a models.Rule.
+// Errors are returned as gRPC status errors.
+func ruleFromProto(r *Rule) (models.Rule, error) {
+	if r == nil {
+		return models.Rule{}, status.Errorf(codes.InvalidArgument, "must specify Rule")
+	}
+	if r.Name == "" {
+		return models.Rule{}, status.Errorf(codes.InvalidArgument, "must specify Name")
+	}
+
+	rule := models.Rule{
+		ID:   r.Id,
+		Name: r.Name,
+		Conditions: models.RuleConditions{
+			FeedIDs:      r.FeedId,
+			FolderIDs:    r.FolderId,
+			TitleRegex:   r.TitleRegex,
+			ContentRegex: r.ContentRegex,
+			LinkDomains:  r.LinkDomain,
+			AuthorRegex:  r.AuthorRegex,
+			Categories:   r.Category,
+		},
+		Actions: models.RuleActions{
+			Mute:          r.Mute,
+			MarkRead:      r.MarkRead,
+			Star:          r.Star,
+			Labels:        r.Label,
+			Priority:      r.Priority,
+			FetchFullText: r.FetchFullText,
+		},
+	}
+	if r.MinAge != "" {
+		age, err := time.ParseDuration(r.MinAge)
+		if err != nil || age < 0 {
+			return models.Rule{}, status.Errorf(codes.InvalidArgument, "invalid MinAge: %q", r.MinAge)
+		}
+		rule.Conditions.MinAge = age
+	}
+	if _, err := fetch.NewRuleMatcher(rule); err != nil {
+		return models.Rule{}, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	return rule, nil
+}
+
+func ruleToProto(r models.Rule) *Rule {
+	p := &Rule{
+		Id:            r.ID,
+		Name:          r.Name,
+		FeedId:        r.Conditions.FeedIDs,
+		FolderId:      r.Conditions.FolderIDs,
+		TitleRegex:    r.Conditions.TitleRegex,
+		ContentRegex:  r.Conditions.ContentRegex,
+		LinkDomain:    r.Conditions.LinkDomains,
+		AuthorRegex:   r.Conditions.AuthorRegex,
+		Category:      r.Conditions.Categories,
+		Mute:          r.Actions.Mute,
+		MarkRead:      r.Actions.MarkRead,
+		Star:          r.Actions.Star,
+		Label:         r.Actions.Labels,
+		Priority:      r.Actions.Priority,
+		FetchFullText: r.Actions.FetchFullText,
+	}
+	if r.Conditions.MinAge > 0 {
+		p.MinAge = r.Conditions.MinAge.String()
+	}
+	return p
+}
+
+// GetWebhooks retrieves the outgoing webhooks for a user. Secrets are not
+// returned.
+func (s *server) GetWebhooks(_ context.Context, req *GetWebhooksRequest) (*GetWebhooksResponse, error) {
+	resp := &GetWebhooksResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	webhooks, err := s.db.GetWebhooksForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving webhooks for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve webhooks")
+	}
+
+	for _, w := range webhooks {
+		resp.Webhooks = append(resp.Webhooks, &Webhook{
+			Id:       w.ID,
+			URL:      w.URL,
+			FeedId:   w.Filter.FeedIDs,
+			FolderId: w.Filter.FolderIDs,
+			Keyword:  w.Filter.Keywords,
+			RuleId:   w.Filter.RuleIDs,
+			Template: w.Template,
+		})
+	}
+
+	return resp, nil
+}
+
+// AddWebhook adds an outgoing webhook for a user. If no secret is given, a
+// random one is generated and returned.
+func (s *server) AddWebhook(_ context.Context, req *AddWebhookRequest) (*AddWebhookResponse, error) {
+	resp := &AddWebhookResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	w := req.Webhook
+	if w == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Webhook")
+	}
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify HTTP or HTTPS URL")
+	}
+	if w.Template != "" {
+		if _, err := fetch.ParseWebhookTemplate(w.Template); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid Template: %v", err)
+		}
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	webhook := models.Webhook{
+		URL:    w.URL,
+		Secret: w.Secret,
+		Filter: models.WebhookFilter{
+			FeedIDs:   w.FeedId,
+			FolderIDs: w.FolderId,
+			Keywords:  w.Keyword,
+			RuleIDs:   w.RuleId,
+		},
+		Template: w.Template,
+	}
+	if webhook.Secret == "" {
+		b := make([]byte, 32)
+		if _, err = rand.Read(b); err != nil {
+			log.Warningf("while generating webhook secret: %+v", err)
+			return nil, status.Errorf(codes.Internal, "could not generate secret")
+		}
+		webhook.Secret = hex.EncodeToString(b)
+	}
+
+	resp.Id, err = s.db.InsertWebhookForUser(user, webhook)
+	if err != nil {
+		log.Warningf("while adding webhook: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not insert webhook")
+	}
+	resp.Secret = webhook.Secret
+
+	return resp, nil
+}
+
+// DeleteWebhook deletes an outgoing webhook and its deliveries for a user.
+func (s *server) DeleteWebhook(_ context.Context, req *DeleteWebhookRequest) (*DeleteWebhookResponse, error) {
+	resp := &DeleteWebhookResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.Id == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify non-zero Id")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	if err = s.db.DeleteWebhookForUser(user, req.Id); err != nil {
+		log.Warningf("while deleting webhook: %+v", err)
+		return nil, status.Errorf(codes.NotFound, "could not delete webhook")
+	}
+
+	return resp, nil
+}
+
+// GetWebhookDeliveries retrieves the most recent webhook deliveries for a
+// user, optionally only those that were given up on.
+func (s *server) GetWebhookDeliveries(_ context.Context, req *GetWebhookDeliveriesRequest) (*GetWebhookDeliveriesResponse, error) {
+	resp := &GetWebhookDeliveriesResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 100
+	}
+	deliveryStatus := ""
+	if req.DeadOnly {
+		deliveryStatus = models.WebhookDeliveryDead
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	deliveries, err := s.db.GetWebhookDeliveriesForUser(user, deliveryStatus, limit)
+	if err != nil {
+		log.Warningf("while retrieving webhook deliveries for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve webhook deliveries")
+	}
+
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, &GetWebhookDeliveriesResponse_Delivery{
+			Id:           d.ID,
+			WebhookId:    d.WebhookID,
+			ArticleId:    d.ArticleID,
+			Status:       d.Status,
+			Attempts:     int32(d.Attempts),
+			ResponseCode: int32(d.ResponseCode),
+			Error:        d.Error,
+			Payload:      d.Payload,
+			Created:      d.Created.Unix(),
+			Updated:      d.Updated.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+// GetDigestSettings retrieves the email digest settings for a user.
+func (s *server) GetDigestSettings(_ context.Context, req *GetDigestSettingsRequest) (*GetDigestSettingsResponse, error) {
+	resp := &GetDigestSettingsResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	settings, err := s.db.GetDigestSettingsForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving digest settings for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve digest settings")
+	}
+	if settings.Email == "" {
+		return resp, nil
+	}
+
+	resp.Settings = &DigestSettings{
+		Enabled:     settings.Enabled,
+		Email:       settings.Email,
+		Time:        digest.FormatTimeOfDay(settings.TimeOfDay),
+		Timezone:    settings.Timezone,
+		WindowHours: int32(settings.WindowHours),
+		Label:       settings.Labels,
+		MarkRead:    settings.MarkRead,
+	}
+	for _, d := range settings.Weekdays {
+		resp.Settings.Weekday = append(resp.Settings.Weekday, d.String())
+	}
+	if !settings.LastSent.IsZero() {
+		resp.Settings.LastSent = settings.LastSent.Unix()
+	}
+
+	return resp, nil
+}
+
+// SetDigestSettings replaces the email digest settings for a user. The first
+// scheduled digest is sent at the next scheduled time.
+func (s *server) SetDigestSettings(_ context.Context, req *SetDigestSettingsRequest) (*SetDigestSettingsResponse, error) {
+	resp := &SetDigestSettingsResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	p := req.Settings
+	if p == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Settings")
+	}
+	if _, err := mail.ParseAddress(p.Email); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify valid Email")
+	}
+
+	settings := models.DigestSettings{
+		Enabled:     p.Enabled,
+		Email:       p.Email,
+		TimeOfDay:   7 * 60,
+		Timezone:    "UTC",
+		WindowHours: 24,
+		Labels:      p.Label,
+		MarkRead:    p.MarkRead,
+	}
+	if p.Time != "" {
+		t, err := digest.ParseTimeOfDay(p.Time)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		settings.TimeOfDay = t
+	}
+	for _, w := range p.Weekday {
+		d, err := digest.ParseWeekday(w)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+		}
+		settings.Weekdays = append(settings.Weekdays, d)
+	}
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid Timezone: %q", p.Timezone)
+		}
+		settings.Timezone = p.Timezone
+	}
+	if p.WindowHours < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify non-negative WindowHours")
+	} else if p.WindowHours > 0 {
+		settings.WindowHours = int(p.WindowHours)
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	if err = s.db.UpdateDigestSettingsForUser(user, settings); err != nil {
+		log.Warningf("while setting digest settings: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not set digest settings")
+	}
+
+	return resp, nil
+}
+
+// SendDigest sends an email digest to a user immediately, regardless of its
+// schedule or whether digests are enabled. It does not affect when the next
+// scheduled digest is sent.
+func (s *server) SendDigest(_ context.Context, req *SendDigestRequest) (*SendDigestResponse, error) {
+	resp := &SendDigestResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	settings, err := s.db.GetDigestSettingsForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving digest settings for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve digest settings")
+	}
+	if settings.Email == "" {
+		return nil, status.Errorf(codes.FailedPrecondition, "digest settings are not set")
+	}
+
+	n, err := digest.Send(s.db, user, settings, time.Now())
+	if errors.Is(err, digest.ErrNotConfigured) {
+		return nil, status.Errorf(codes.FailedPrecondition, "%v", err)
+	} else if err != nil {
+		log.Warningf("while sending digest: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not send digest")
+	}
+	resp.Count = int32(n)
+
+	return resp, nil
+}
+
+// GetStorySettings returns the settings for stories of near-duplicate
+// articles for a user.
+func (s *server) GetStorySettings(_ context.Context, req *GetStorySettingsRequest) (*GetStorySettingsResponse, error) {
+	resp := &GetStorySettingsResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	settings, err := s.db.GetStorySettingsForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving story settings for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve story settings")
+	}
+	resp.Settings = &StorySettings{
+		Group:    settings.Group,
+		MarkRead: settings.MarkRead,
+	}
+
+	return resp, nil
+}
+
+// SetStorySettings replaces the settings for stories of near-duplicate
+// articles for a user.
+func (s *server) SetStorySettings(_ context.Context, req *SetStorySettingsRequest) (*SetStorySettingsResponse, error) {
+	resp := &SetStorySettingsResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.Settings == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Settings")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	settings := models.StorySettings{
+		Group:    req.Settings.Group,
+		MarkRead: req.Settings.MarkRead,
+	}
+	if err = s.db.UpdateStorySettingsForUser(user, settings); err != nil {
+		log.Warningf("while setting story settings: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not set story settings")
+	}
+
+	return resp, nil
+}
+
+// CreateNewsletterAddress generates a new address at which the user receives
+// newsletters.
+func (s *server) CreateNewsletterAddress(_ context.Context, req *CreateNewsletterAddressRequest) (*CreateNewsletterAddressResponse, error) {
+	resp := &CreateNewsletterAddressResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	token, err := newsletter.NewToken()
+	if err != nil {
+		log.Warningf("while generating newsletter token: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not generate address")
+	}
+
+	if err = s.db.InsertNewsletterAddressForUser(user, token); err != nil {
+		log.Warningf("while inserting newsletter address: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not persist address")
+	}
+
+	resp.Token = token
+	resp.Address = newsletter.Address(token)
+	return resp, nil
+}
+
+// GetNewsletterAddresses lists all newsletter addresses for a user.
+func (s *server) GetNewsletterAddresses(_ context.Context, req *GetNewsletterAddressesRequest) (*GetNewsletterAddressesResponse, error) {
+	resp := &GetNewsletterAddressesResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	addrs, err := s.db.GetNewsletterAddressesForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving newsletter addresses for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve addresses")
+	}
+
+	for _, a := range addrs {
+		resp.Addresses = append(resp.Addresses, &NewsletterAddress{
+			Address: newsletter.Address(a.Token),
+			Token:   a.Token,
+			Created: a.Created.Unix(),
+		})
+	}
+
+	return resp, nil
+}
+
+// DeleteNewsletterAddress deletes a newsletter address. Feeds of newsletters
+// already received at the address are kept.
+func (s *server) DeleteNewsletterAddress(_ context.Context, req *DeleteNewsletterAddressRequest) (*DeleteNewsletterAddressResponse, error) {
+	resp := &DeleteNewsletterAddressResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	token, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(req.Token)), "@")
+	if token == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Token")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	if err = s.db.DeleteNewsletterAddressForUser(user, token); err != nil {
+		log.Warningf("while deleting newsletter address: %+v", err)
+		return nil, status.Errorf(codes.NotFound, "could not delete address")
+	}
+
+	return resp, nil
+}
+
+// CreateStarredFeedToken generates a new token granting access to a private
+// Atom feed of the user's saved articles.
+func (s *server) CreateStarredFeedToken(_ context.Context, req *CreateStarredFeedTokenRequest) (*CreateStarredFeedTokenResponse, error) {
+	resp := &CreateStarredFeedTokenResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	t := models.StarredFeedToken{}
+	if req.Folder != "" {
+		folders, err := s.db.GetAllFoldersForUser(user)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "internal error")
+		}
+		for _, f := range folders {
+			if f.Name == req.Folder {
+				t.FolderID = f.ID
+				break
+			}
+		}
+		if t.FolderID == 0 {
+			return nil, status.Error(codes.InvalidArgument, "could not find folder")
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		log.Warningf("while generating starred feed token: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not generate token")
+	}
+	t.Token = hex.EncodeToString(b)
+
+	if err = s.db.InsertStarredFeedTokenForUser(user, t); err != nil {
+		log.Warningf("while inserting starred feed token: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not persist token")
+	}
+
+	resp.Token = t.Token
+	resp.Path = api.StarredFeedPath + t.Token
+	return resp, nil
+}
+
+// GetStarredFeedTokens lists all starred feed tokens for a user.
+func (s *server) GetStarredFeedTokens(_ context.Context, req *GetStarredFeedTokensRequest) (*GetStarredFeedTokensResponse, error) {
+	resp := &GetStarredFeedTokensResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	tokens, err := s.db.GetStarredFeedTokensForUser(user)
+	if err != nil {
+		log.Warningf("while retrieving starred feed tokens for user: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not retrieve tokens")
+	}
+
+	folders, err := s.db.GetAllFoldersForUser(user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	folderNames := map[int64]string{}
+	for _, f := range folders {
+		folderNames[f.ID] = f.Name
+	}
+
+	for _, t := range tokens {
+		resp.Tokens = append(resp.Tokens, &StarredFeedToken{
+			Token:   t.Token,
+			Folder:  folderNames[t.FolderID],
+			Created: t.Created.Unix(),
+			Path:    api.StarredFeedPath + t.Token,
+		})
+	}
+
+	return resp, nil
+}
+
+// RevokeStarredFeedToken deletes a starred feed token so that the associated
+// feed URL no longer works.
+func (s *server) RevokeStarredFeedToken(_ context.Context, req *RevokeStarredFeedTokenRequest) (*RevokeStarredFeedTokenResponse, error) {
+	resp := &RevokeStarredFeedTokenResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if req.Token == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Token")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	if err = s.db.DeleteStarredFeedTokenForUser(user, req.Token); err != nil {
+		log.Warningf("while revoking starred feed token: %+v", err)
+		return nil, status.Errorf(codes.NotFound, "could not revoke token")
+	}
+
+	return resp, nil
+}
+
+// ImportOpml imports the given OPML document for a user. Newly created feeds
+// are fetched immediately without pausing fetching of other feeds.
+func (s *server) ImportOpml(ctx context.Context, req *ImportOpmlRequest) (*ImportOpmlResponse, error) {
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if len(req.Opml) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Opml")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	p, err := opml.Parse(bytes.NewReader(req.Opml))
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid OPML: %v", err)
+	}
+
+	report, err := s.db.ImportOpmlForUser(user, p)
+	if err != nil {
+		log.Warningf("while importing OPML: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not import OPML")
+	}
+	log.Infof("Imported OPML for %s: %s", user, report)
+
+	if err = fetch.StartFeeds(ctx, s.db, user, report.CreatedFeedIDs()); err != nil {
+		log.Warningf("while starting fetch of imported feeds: %+v", err)
+	}
+
+	return toImportOpmlResponse(report), nil
+}
+
+// ExportOpml exports all folders and feeds for a user as an OPML document.
+func (s *server) ExportOpml(_ context.Context, req *ExportOpmlRequest) (*ExportOpmlResponse, error) {
+	resp := &ExportOpmlResponse{}
+
+	if req.Username == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	o, err := s.db.ExportOpmlForUser(user)
+	if err != nil {
+		log.Warningf("while fetching feeds to export: %+v", err)
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+
+	var buf bytes.Buffer
+	if err = opml.Write(o, &buf); err != nil {
+		log.Warningf("while exporting OPML: %+v", err)
+		return nil, status.Errorf(codes.Internal, "could not export OPML")
+	}
+	resp.Opml = buf.Bytes()
+
+	return resp, nil
+}
+
+// ExportAccount streams an archive of a user's account.
+func (s *server) ExportAccount(req *ExportAccountRequest, stream grpc.ServerStreamingServer[ExportAccountResponse]) error {
+	if req.Username == "" {
+		return status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	w := bufio.NewWriterSize(exportAccountWriter{stream}, *accountChunkSize)
+	if err = backup.Export(s.db, user, w); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Warningf("while exporting account: %+v", err)
+		return status.Errorf(codes.Internal, "could not export account")
+	}
+
+	return nil
+}
+
+// ImportAccount restores an archive streamed by the client into a user's
+// account. The first message must specify the user.
+func (s *server) ImportAccount(stream grpc.ClientStreamingServer[ImportAccountRequest, ImportAccountResponse]) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "must send archive")
+	}
+	if first.Username == "" {
+		return status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+
+	user, err := s.db.GetUserByUsername(first.Username)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	report, err := backup.Import(s.db, user, &importAccountReader{stream: stream, buf: first.Data})
+	if err != nil {
+		log.Warningf("while importing account: %+v", err)
+		return status.Errorf(codes.InvalidArgument, "could not import account: %v", err)
+	}
+	log.Infof("Imported account for %s: %s", user, report)
+
+	if err = fetch.StartFeeds(stream.Context(), s.db, user, report.Subscriptions.CreatedFeedIDs()); err != nil {
+		log.Warningf("while starting fetch of imported feeds: %+v", err)
+	}
+
+	return stream.SendAndClose(&ImportAccountResponse{
+		Subscriptions:   toImportOpmlResponse(report.Subscriptions),
+		CreatedArticles: int64(report.CreatedArticles),
+		UpdatedArticles: int64(report.UpdatedArticles),
+		SkippedArticles: int64(report.SkippedArticles),
+		Favicons:        int64(report.Favicons),
+		MuteWords:       int64(report.MuteWords),
+	})
+}
+
+// ExportEpub streams an EPUB book with a user's articles.
+func (s *server) ExportEpub(req *ExportEpubRequest, stream grpc.ServerStreamingServer[ExportEpubResponse]) error {
+	if req.Username == "" {
+		return status.Errorf(codes.InvalidArgument, "must specify Username")
+	}
+	if !req.Saved && req.Label == "" && len(req.FolderId) == 0 {
+		return status.Errorf(codes.InvalidArgument, "must specify Saved, Label or FolderId")
+	}
+
+	user, err := s.db.GetUserByUsername(req.Username)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "could not find user")
+	}
+
+	articles := models.ArticleStream{Saved: req.Saved, Label: req.Label, FolderIDs: req.FolderId}
+	if req.Days > 0 {
+		articles.Since = time.Now().AddDate(0, 0, -int(req.Days))
+	}
+
+	w := bufio.NewWriterSize(exportEpubWriter{stream}, *accountChunkSize)
+	if err = epub.Export(stream.Context(), s.db, user, articles, req.Title, w); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Warningf("while exporting EPUB: %+v", err)
+		return status.Errorf(codes.Internal, "could not export EPUB")
+	}
+
+	return nil
+}
+
+// exportAccountWriter sends each write as a single message on the stream.
+type exportAccountWriter struct {
+	stream grpc.ServerStreamingServer[ExportAccountResponse]
+}
+
+func (w exportAccountWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&ExportAccountResponse{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// exportEpubWriter sends each write as a single message on the stream.
+type exportEpubWriter struct {
+	stream grpc.ServerStreamingServer[ExportEpubResponse]
+}
+
+func (w exportEpubWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&ExportEpubResponse{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// importAccountReader reads the archive from the data of successive messages
+// on the stream.
+type importAccountReader struct {
+	stream grpc.ClientStreamingServer[ImportAccountRequest, ImportAccountResponse]
+	buf    []byte
+}
+
+func (r *importAccountReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func toImportOpmlResponse(report opml.ImportReport) *ImportOpmlResponse {
+	return &ImportOpmlResponse{
+		CreatedFeeds:   toOpmlImportFeeds(report.CreatedFeeds),
+		MergedFeeds:    toOpmlImportFeeds(report.MergedFeeds),
+		SkippedFeeds:   toOpmlImportFeeds(report.SkippedFeeds),
+		CreatedFolders: toOpmlImportFolders(report.CreatedFolders),
+		MergedFolders:  toOpmlImportFolders(report.MergedFolders),
+		SkippedFolders: toOpmlImportFolders(report.SkippedFolders),
+	}
+}
+
+func toOpmlImportFeeds(feeds []opml.ReportFeed) []*OpmlImportFeed {
+	var ret []*OpmlImportFeed
+	for _, f := range feeds {
+		ret = append(ret, &OpmlImportFeed{Id: f.ID, Title: f.Title, URL: f.URL, Folder: f.Folder, Reason: f.Reason})
+	}
+	return ret
+}
+
+func toOpmlImportFolders(folders []opml.ReportFolder) []*OpmlImportFolder {
+	var ret []*OpmlImportFolder
+	for _, f := range folders {
+		ret = append(ret, &OpmlImportFolder{Id: f.ID, Name: f.Name, Reason: f.Reason})
+	}
+	return ret
+}
+
 func newServer(d storage.Database) AdminServiceServer {
 	s := &server{db: d}
 	return s
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+const (
+	// StarredFeedPath is the path prefix under which starred Atom feeds are
+	// served. The token is the final path component.
+	StarredFeedPath = "/starred/"
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+)
+
+var (
+	starredFeedMaxItems = flag.Int("starredFeedMaxItems", 100, "Maximum number of entries in a starred articles Atom feed.")
+)
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"feed"`
+	Xmlns     string      `xml:"xmlns,attr"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     atomText    `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Content   atomText    `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// StarredFeedHandler returns a handler that serves a user's saved articles as
+// an Atom 1.0 feed. Requests are authenticated solely by the token in the URL,
+// so that the feed can be subscribed to from other readers.
+func StarredFeedHandler(d storage.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, StarredFeedPath)
+		if token == "" || strings.Contains(token, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		user, t, err := d.GetUserByStarredFeedToken(token)
+		if err != nil {
+			log.Warningf("Rejected starred feed request with unknown token")
+			http.NotFound(w, r)
+			return
+		}
+
+		feed, err := buildStarredFeed(d, user, t, selfURL(r))
+		if err != nil {
+			log.Warningf("while building starred feed for %s: %s", user, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "private, max-age=300")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(xml.Header))
+		enc := xml.NewEncoder(w)
+		enc.Indent("", "  ")
+		if err := enc.Encode(feed); err != nil {
+			log.Warningf("Failed to encode starred feed: %s", err)
+		}
+	}
+}
+
+func buildStarredFeed(d storage.Database, u models.User, t models.StarredFeedToken, self string) (atomFeed, error) {
+	articles, err := d.GetSavedArticlesForUser(u, t.FolderID, *starredFeedMaxItems)
+	if err != nil {
+		return atomFeed{}, fmt.Errorf("failed to fetch saved articles: %w", err)
+	}
+
+	feeds, err := d.GetAllFeedsForUser(u)
+	if err != nil {
+		return atomFeed{}, fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+	feedMap := map[int64]models.Feed{}
+	for _, f := range feeds {
+		feedMap[f.ID] = f
+	}
+
+	title := fmt.Sprintf("Starred articles for %s", u.Username)
+	id := fmt.Sprintf("urn:goliath:starred:%s", u.UserId)
+	if t.FolderID != 0 {
+		folders, err := d.GetAllFoldersForUser(u)
+		if err != nil {
+			return atomFeed{}, fmt.Errorf("failed to fetch folders: %w", err)
+		}
+		for _, f := range folders {
+			if f.ID == t.FolderID {
+				title = fmt.Sprintf("Starred articles in %s for %s", f.Name, u.Username)
+				break
+			}
+		}
+		id = fmt.Sprintf("%s:%d", id, t.FolderID)
+	}
+
+	// The feed is considered updated when its most recent entry was; an empty
+	// feed has not changed since the token was created.
+	updated := t.Created
+	var entries []atomEntry
+	for _, a := range articles {
+		entryUpdated := articleUpdated(a)
+		if entryUpdated.After(updated) {
+			updated = entryUpdated
+		}
+
+		entry := atomEntry{
+			ID:      fmt.Sprintf("urn:goliath:article:%d", a.ID),
+			Title:   atomText{Type: "html", Body: a.Title},
+			Updated: entryUpdated.UTC().Format(time.RFC3339),
+			Content: atomText{Type: "html", Body: a.GetContents(true)},
+		}
+		if !a.Date.IsZero() {
+			entry.Published = a.Date.UTC().Format(time.RFC3339)
+		}
+		if a.Link != "" {
+			entry.Links = append(entry.Links, atomLink{Rel: "alternate", Type: "text/html", Href: a.Link})
+		}
+		if f, ok := feedMap[a.FeedID]; ok {
+			entry.Author = &atomPerson{Name: f.Title, URI: f.Link}
+		}
+		entries = append(entries, entry)
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	return atomFeed{
+		Xmlns:     atomNamespace,
+		ID:        id,
+		Title:     title,
+		Updated:   updated.UTC().Format(time.RFC3339),
+		Author:    atomPerson{Name: u.Username},
+		Generator: "Goliath",
+		Links:     []atomLink{{Rel: "self", Type: "application/atom+xml", Href: self}},
+		Entries:   entries,
+	}, nil
+}
+
+// articleUpdated returns the time at which the article last changed from the
+// perspective of a subscriber to the starred feed, which is when it was saved.
+func articleUpdated(a models.Article) time.Time {
+	for _, t := range []time.Time{a.SavedAt, a.Date, a.Retrieved} {
+		if !t.IsZero() {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func selfURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+}
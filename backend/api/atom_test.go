@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestStarredFeedHandler(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice", Key: "key"}
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	published := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	saved := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	newMockDB := func(folderID int64) *storage.MockDB {
+		return &storage.MockDB{
+			OnGetUserByStarredFeedToken: func(token string) (models.User, models.StarredFeedToken, error) {
+				if token != "secret" {
+					return models.User{}, models.StarredFeedToken{}, errors.New("could not find token")
+				}
+				return user, models.StarredFeedToken{Token: token, FolderID: folderID, Created: created}, nil
+			},
+			OnGetSavedArticlesForUser: func(u models.User, folderId int64, limit int) ([]models.Article, error) {
+				if folderId != folderID {
+					t.Errorf("expected folder %d, got %d", folderID, folderId)
+				}
+				return []models.Article{
+					{ID: 1, FeedID: 10, Title: "Parsed", Content: "<p>content</p>", Parsed: "<p>full</p>", Link: "http://example.com/1", Date: published, SavedAt: saved},
+					{ID: 2, FeedID: 10, Title: "Unsaved time", Summary: "summary", Date: published},
+				}, nil
+			},
+			OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+				return []models.Feed{{ID: 10, Title: "Example", Link: "http://example.com"}}, nil
+			},
+			OnGetAllFoldersForUser: func(u models.User) ([]models.Folder, error) {
+				return []models.Folder{{ID: 5, Name: "Tech"}}, nil
+			},
+		}
+	}
+
+	t.Run("unknown token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/starred/bogus", nil)
+
+		StarredFeedHandler(newMockDB(0))(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+	})
+
+	t.Run("renders saved articles", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/starred/secret", nil)
+
+		StarredFeedHandler(newMockDB(0))(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+			t.Errorf("unexpected content type: %s", ct)
+		}
+
+		var feed atomFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("failed to parse feed: %s", err)
+		}
+		if feed.XMLName.Space != atomNamespace {
+			t.Errorf("unexpected namespace: %s", feed.XMLName.Space)
+		}
+		if feed.Updated != saved.Format(time.RFC3339) {
+			t.Errorf("expected feed updated %s, got %s", saved.Format(time.RFC3339), feed.Updated)
+		}
+		if len(feed.Entries) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(feed.Entries))
+		}
+
+		first := feed.Entries[0]
+		if first.Content.Body != "<p>full</p>" {
+			t.Errorf("expected parsed content, got %q", first.Content.Body)
+		}
+		if first.Updated != saved.Format(time.RFC3339) {
+			t.Errorf("expected entry updated to be save time, got %s", first.Updated)
+		}
+		if first.Published != published.Format(time.RFC3339) {
+			t.Errorf("unexpected published time: %s", first.Published)
+		}
+		if first.Author == nil || first.Author.Name != "Example" {
+			t.Errorf("expected feed title as author, got %+v", first.Author)
+		}
+
+		second := feed.Entries[1]
+		if second.Updated != published.Format(time.RFC3339) {
+			t.Errorf("expected entry updated to fall back to date, got %s", second.Updated)
+		}
+		if second.Content.Body != "summary" {
+			t.Errorf("expected summary content, got %q", second.Content.Body)
+		}
+	})
+
+	t.Run("label feed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/starred/secret", nil)
+
+		StarredFeedHandler(newMockDB(5))(w, req)
+
+		var feed atomFeed
+		if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+			t.Fatalf("failed to parse feed: %s", err)
+		}
+		if !strings.Contains(feed.Title, "Tech") {
+			t.Errorf("expected folder name in title, got %q", feed.Title)
+		}
+	})
+}
@@ -2,11 +2,20 @@ package api
 
 import (
 	"flag"
+	"fmt"
+	"github.com/jrupac/goliath/auth"
+	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/goliath/storage"
+	"html"
 	"net/http"
+	"strings"
 	"time"
 )
 
+// greaderSessionCookie is the cookie in which the frontend stores its GReader
+// authentication token.
+const greaderSessionCookie = "goliath_token"
+
 var (
 	serveParsedArticles = flag.Bool("serveParsedArticles", false, "If true, serve parsed article content.")
 )
@@ -30,3 +39,58 @@ type Api interface {
 	returnError(http.ResponseWriter, string, error)
 	returnSuccess(http.ResponseWriter, apiResponse)
 }
+
+// authenticateRequest authenticates a request to an endpoint outside of the
+// Fever and GReader APIs. Requests may use a GReader authorization header, the
+// GReader session cookie set by the frontend, or Fever credentials. The
+// returned status is http.StatusOK on success.
+func authenticateRequest(d storage.Database, r *http.Request) (models.User, int) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		if c, err := r.Cookie(greaderSessionCookie); err == nil && c.Value != "" {
+			authHeader = "GoogleLogin auth=" + c.Value
+		}
+	}
+	if authHeader != "" {
+		return GReader{d: d}.authenticate(authHeader)
+	}
+
+	if user, authStatus := (Fever{}).handleAuth(d, r); authStatus == 1 {
+		return user, http.StatusOK
+	}
+	return models.User{}, http.StatusUnauthorized
+}
+
+// servesArchive returns true if the archived copies of saved articles can be
+// served in response to the request. Their images are only served with the
+// session cookie of the frontend, so other clients get the original content.
+func servesArchive(d storage.Database, r *http.Request) bool {
+	_, err := auth.VerifyCookie(d, r)
+	return err == nil
+}
+
+// articleContents returns the content of the article served to clients, or
+// its archived copy if `archived` is set. If the article is the first of a
+// story, the other sources of the story are listed after it.
+func articleContents(a models.Article, archived bool) string {
+	content := a.GetContents(*serveParsedArticles)
+	if archived {
+		content = a.GetArchivedContents(*serveParsedArticles)
+	}
+	if len(a.Sources) == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	b.WriteString(content)
+	b.WriteString("<hr><p>Also covered by:</p><ul>")
+	for _, s := range a.Sources {
+		fmt.Fprintf(&b, `<li><a href="%s">%s</a>`, html.EscapeString(s.Link), html.EscapeString(s.FeedTitle))
+		if s.Title != "" {
+			fmt.Fprintf(&b, ": %s", html.EscapeString(s.Title))
+		}
+		b.WriteString("</li>")
+	}
+	b.WriteString("</ul>")
+	return b.String()
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/epub"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+// EpubExportHandler returns a handler that responds with an EPUB book of the
+// authenticated user's articles. The articles are selected by the query
+// parameters "saved", "label" and "folder" (a folder ID, which may be
+// repeated), at least one of which must be given, and optionally limited to
+// those retrieved in the last "days" days. The book's title may be given as
+// "title".
+func EpubExportHandler(d storage.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, status := authenticateRequest(d, r)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		s, err := parseArticleStream(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Render the whole book to a temporary file first so that failures result
+		// in an error status without holding the book in memory.
+		f, err := os.CreateTemp("", "goliath-*.epub")
+		if err != nil {
+			log.Warningf("Failed to create temporary EPUB file: %s", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer func() {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+		}()
+
+		if err = epub.Export(r.Context(), d, user, s, r.FormValue("title"), f); err != nil {
+			log.Warningf("while exporting EPUB for %s: %s", user, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		size, err := f.Seek(0, io.SeekCurrent)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			log.Warningf("Failed to read EPUB for %s: %s", user, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("goliath-%s.epub", time.Now().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/epub+zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		if _, err = io.Copy(w, f); err != nil {
+			log.Warningf("Failed to write EPUB for %s: %s", user, err)
+		}
+	}
+}
+
+// parseArticleStream returns the articles selected by the query parameters of
+// an EPUB export request.
+func parseArticleStream(r *http.Request, now time.Time) (models.ArticleStream, error) {
+	var s models.ArticleStream
+	if v := r.FormValue("saved"); v != "" {
+		saved, err := strconv.ParseBool(v)
+		if err != nil {
+			return s, fmt.Errorf("invalid saved: %q", v)
+		}
+		s.Saved = saved
+	}
+	s.Label = r.FormValue("label")
+	for _, v := range r.Form["folder"] {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return s, fmt.Errorf("invalid folder: %q", v)
+		}
+		s.FolderIDs = append(s.FolderIDs, id)
+	}
+	if v := r.FormValue("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			return s, fmt.Errorf("invalid days: %q", v)
+		}
+		s.Since = now.AddDate(0, 0, -days)
+	}
+
+	if !s.Saved && s.Label == "" && len(s.FolderIDs) == 0 {
+		return s, fmt.Errorf("must select saved, label or folder")
+	}
+	return s, nil
+}
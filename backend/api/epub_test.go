@@ -0,0 +1,67 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestEpubExportHandler(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice", Key: "key"}
+
+	var stream *models.ArticleStream
+	d := &storage.MockDB{
+		OnGetUserByKey: func(key string) (models.User, error) {
+			if key == "key" {
+				return user, nil
+			}
+			return models.User{}, errors.New("could not find user")
+		},
+		OnGetArticlesInStreamForUser: func(u models.User, s models.ArticleStream, limit int) ([]models.Article, error) {
+			stream = &s
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"unauthenticated", "saved=1", http.StatusUnauthorized},
+		{"no selection", "api_key=key", http.StatusBadRequest},
+		{"invalid folder", "api_key=key&folder=tech", http.StatusBadRequest},
+		{"invalid days", "api_key=key&saved=1&days=-1", http.StatusBadRequest},
+		{"success", "api_key=key&label=later&folder=1&folder=2&days=7", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream = nil
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/export/epub?"+tt.query, nil)
+
+			EpubExportHandler(d)(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status != http.StatusOK {
+				if stream != nil {
+					t.Error("expected no articles to be exported")
+				}
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/epub+zip" {
+				t.Errorf("unexpected content type: %q", ct)
+			}
+			if stream == nil || stream.Label != "later" || !slices.Equal(stream.FolderIDs, []int64{1, 2}) || stream.Since.IsZero() {
+				t.Errorf("unexpected stream: %+v", stream)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/events"
+	"github.com/jrupac/goliath/storage"
+)
+
+var (
+	eventKeepaliveInterval = flag.Duration("eventKeepaliveInterval", 30*time.Second,
+		"Interval between keepalive comments sent on idle event streams.")
+)
+
+// EventsHandler returns a handler that streams new article and mark events for
+// the authenticated user as Server-Sent Events.
+func EventsHandler(d storage.Database, hub *events.Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, status := authenticateRequest(d, r)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		// The server-wide write timeout would otherwise terminate the stream.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			log.Warningf("Failed to clear write deadline for event stream: %s", err)
+		}
+
+		sub := hub.Subscribe(user)
+		defer sub.Cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			log.Warningf("Failed to flush event stream for %s: %s", user, err)
+			return
+		}
+
+		ticker := time.NewTicker(*eventKeepaliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+			case e, ok := <-sub.C:
+				if !ok {
+					// The hub disconnected this subscriber; the client is expected to
+					// reconnect and resynchronize.
+					return
+				}
+				if err := writeEvent(w, e); err != nil {
+					log.V(2).Infof("Failed to write event for %s: %s", user, err)
+					return
+				}
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
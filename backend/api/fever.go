@@ -6,6 +6,7 @@ import (
 	"fmt"
 	log "github.com/golang/glog"
 	"github.com/jrupac/goliath/auth"
+	"github.com/jrupac/goliath/events"
 	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/goliath/storage"
 	"github.com/jrupac/goliath/utils"
@@ -39,6 +40,41 @@ type itemType struct {
 	IsSaved     int64  `json:"is_saved"`
 	IsRead      int64  `json:"is_read"`
 	CreatedTime int64  `json:"created_on_time"`
+	// Enclosures is an extension to the Fever API for media files attached to
+	// the item.
+	Enclosures []enclosureType `json:"enclosures,omitempty"`
+	// Categories and CommentsURL are extensions to the Fever API for metadata
+	// of the feed item.
+	Categories  []string `json:"categories,omitempty"`
+	CommentsURL string   `json:"comments_url,omitempty"`
+	// ThumbnailURL is an extension to the Fever API for the lead image of the
+	// item.
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	// WordCount, ReadingTime (in seconds) and Language are extensions to the
+	// Fever API for sorting and filtering by article length.
+	WordCount   int    `json:"word_count,omitempty"`
+	ReadingTime int64  `json:"reading_time,omitempty"`
+	Language    string `json:"language,omitempty"`
+	// Sources is an extension to the Fever API for the other articles of the
+	// story this item is the first of.
+	Sources []sourceType `json:"sources,omitempty"`
+	// IsPriority is an extension to the Fever API for items moved to priority
+	// by rules.
+	IsPriority int64 `json:"is_priority,omitempty"`
+}
+
+type enclosureType struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Length   int64  `json:"length"`
+	Duration int64  `json:"duration"`
+}
+
+type sourceType struct {
+	ID     int64  `json:"id"`
+	FeedID int64  `json:"feed_id"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
 }
 
 type feedType struct {
@@ -74,11 +110,12 @@ func init() {
 
 // Fever is an implementation of the Fever API.
 type Fever struct {
+	hub *events.Hub
 }
 
 // FeverHandler returns a new Fever handler.
-func FeverHandler(d storage.Database) http.HandlerFunc {
-	return Fever{}.Handler(d)
+func FeverHandler(d storage.Database, hub *events.Hub) http.HandlerFunc {
+	return Fever{hub: hub}.Handler(d)
 }
 
 // Handler returns a handler function that implements the Fever API.
@@ -319,19 +356,45 @@ func (a Fever) handleItems(d storage.Database, u models.User, resp *responseType
 	if err != nil {
 		return &apiError{err, true}
 	}
+	archived := servesArchive(d, r)
 	// Make an empty (not nil) slice because their JSON encodings are different.
 	items := make([]itemType, 0)
 	for _, a := range articles {
 		i := itemType{
-			ID:          a.ID,
-			FeedID:      a.FeedID,
-			Title:       a.Title,
-			Author:      "",
-			HTML:        a.GetContents(*serveParsedArticles),
-			URL:         a.Link,
-			IsSaved:     0,
-			IsRead:      0,
-			CreatedTime: a.Date.Unix(),
+			ID:           a.ID,
+			FeedID:       a.FeedID,
+			Title:        a.Title,
+			Author:       strings.Join(a.Authors, ", "),
+			HTML:         articleContents(a, archived),
+			URL:          a.Link,
+			IsSaved:      0,
+			IsRead:       0,
+			CreatedTime:  a.Date.Unix(),
+			Categories:   a.Categories,
+			CommentsURL:  a.CommentsURL,
+			ThumbnailURL: a.Thumbnail,
+			WordCount:    a.WordCount,
+			ReadingTime:  int64(a.ReadingTime.Seconds()),
+			Language:     a.Language,
+		}
+		if a.Priority {
+			i.IsPriority = 1
+		}
+		for _, e := range a.Enclosures {
+			i.Enclosures = append(i.Enclosures, enclosureType{
+				URL:      e.URL,
+				MimeType: e.Type,
+				Length:   e.Length,
+				Duration: int64(e.Duration.Seconds()),
+			})
+		}
+		for _, s := range a.Sources {
+			i.Sources = append(i.Sources, sourceType{
+				ID:     s.ArticleID,
+				FeedID: s.FeedID,
+				Title:  s.Title,
+				URL:    s.Link,
+			})
 		}
 		items = append(items, i)
 	}
@@ -398,14 +461,17 @@ func (a Fever) handleMark(d storage.Database, u models.User, _ *responseType, r
 		if err = d.MarkArticleForUser(u, id, as); err != nil {
 			return &apiError{err, true}
 		}
+		a.hub.PublishMark(u, as, events.Event{ArticleIDs: []int64{id}})
 	case "feed":
 		if _, err = d.MarkFeedForUser(u, id, as); err != nil {
 			return &apiError{err, true}
 		}
+		a.hub.PublishMark(u, as, events.Event{FeedID: id})
 	case "group":
 		if _, err = d.MarkFolderForUser(u, id, as); err != nil {
 			return &apiError{err, true}
 		}
+		a.hub.PublishMark(u, as, events.Event{FolderID: id})
 	default:
 		return &apiError{fmt.Errorf("malformed 'mark' value: %s", r.FormValue("mark")), false}
 	}
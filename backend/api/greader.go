@@ -10,6 +10,7 @@ import (
 	"time"
 
 	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/events"
 	"github.com/jrupac/goliath/fetch"
 	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/goliath/storage"
@@ -24,6 +25,7 @@ const (
 	unreadStreamId         string = "user/-/state/com.google/kept-unread"
 	starredStreamId        string = "user/-/state/com.google/starred"
 	broadcastStreamId      string = "user/-/state/com.google/broadcast"
+	priorityStreamId       string = "user/-/label/Priority"
 	invalidPostTokenHeader string = "X-Reader-Google-Bad-Token"
 )
 
@@ -44,12 +46,13 @@ func init() {
 
 // GReader is an implementation of the GReader API.
 type GReader struct {
-	d storage.Database
+	d   storage.Database
+	hub *events.Hub
 }
 
 // GReaderHandler returns a new GReader handler.
-func GReaderHandler(d storage.Database) http.HandlerFunc {
-	return GReader{d}.Handler()
+func GReaderHandler(d storage.Database, hub *events.Hub) http.HandlerFunc {
+	return GReader{d, hub}.Handler()
 }
 
 // Handler returns a handler function that implements the GReader API.
@@ -124,6 +127,8 @@ func (a GReader) route(w http.ResponseWriter, r *http.Request) {
 		a.withAuth(w, r, a.markAllAsRead)
 	case "/greader/ext/parse-full-article":
 		a.withAuth(w, r, a.handleParseFullArticle)
+	case "/greader/ext/playback-position":
+		a.withAuth(w, r, a.handlePlaybackPosition)
 	default:
 		log.Warningf("Got unexpected route: %s", r.URL.String())
 		dump, err := httputil.DumpRequest(r, true)
@@ -270,6 +275,12 @@ func (a GReader) handleStreamItemIds(w http.ResponseWriter, r *http.Request, use
 			a.returnError(w, http.StatusInternalServerError)
 			return
 		}
+	case priorityStreamId:
+		articles, err = a.d.GetArticleMetaWithFilterForUser(user, models.StreamFilterPriority, limit, sinceId)
+		if err != nil {
+			a.returnError(w, http.StatusInternalServerError)
+			return
+		}
 	case readStreamId:
 		// Never return read items to the client, it's just simpler
 		// Only support excluding read items
@@ -352,30 +363,58 @@ func (a GReader) handleStreamItemsContents(w http.ResponseWriter, r *http.Reques
 		Updated: time.Now().Unix(),
 	}
 
+	archived := servesArchive(a.d, r)
 	for _, article := range articles {
+		categories := []string{
+			readingListStreamId,
+			greaderFeedId(article.FeedID),
+			greaderFolderId(article.FolderID),
+		}
+		for _, label := range article.Labels {
+			categories = append(categories, greaderLabelId(label))
+		}
+		if article.Priority {
+			categories = append(categories, priorityStreamId)
+		}
+		// Categories of the feed item are included as-is, as Google Reader did.
+		categories = append(categories, article.Categories...)
+		var replies []greaderCanonical
+		if article.CommentsURL != "" {
+			replies = []greaderCanonical{{Href: article.CommentsURL}}
+		}
+		var visual *greaderVisual
+		if article.Thumbnail != "" {
+			visual = &greaderVisual{Url: article.Thumbnail}
+		}
+		// The other sources of a story are its alternate links.
+		alternate := []greaderCanonical{{Href: article.Link}}
+		for _, source := range article.Sources {
+			alternate = append(alternate, greaderCanonical{Href: source.Link})
+		}
 		streamItemContents.Items = append(streamItemContents.Items, greaderItemContent{
 			CrawlTimeMsec: strconv.FormatInt(article.Date.UnixMilli(), 10),
 			TimestampUsec: strconv.FormatInt(article.Date.UnixMicro(), 10),
 			Id:            greaderArticleId(article.ID),
-			Categories: []string{
-				readingListStreamId,
-				greaderFeedId(article.FeedID),
-				greaderFolderId(article.FolderID),
-			},
-			Title:     article.Title,
-			Published: article.Date.Unix(),
+			Categories:    categories,
+			Title:         article.Title,
+			Author:        strings.Join(article.Authors, ", "),
+			Published:     article.Date.Unix(),
 			Canonical: []greaderCanonical{
 				{Href: article.Link},
 			},
-			Alternate: []greaderCanonical{
-				{Href: article.Link},
-			},
+			Alternate: alternate,
 			Summary: greaderContent{
-				Content: article.GetContents(*serveParsedArticles),
+				Content: articleContents(article, archived),
 			},
 			Origin: greaderOrigin{
 				StreamId: greaderFeedId(article.FeedID),
 			},
+			Enclosure:   greaderEnclosures(article.Enclosures),
+			Replies:     replies,
+			Visual:      visual,
+			WordCount:   article.WordCount,
+			ReadingTime: int64(article.ReadingTime.Seconds()),
+			Language:    article.Language,
 		})
 	}
 
@@ -460,6 +499,8 @@ func (a GReader) handleEditTag(w http.ResponseWriter, r *http.Request, user mode
 		}
 	}
 
+	a.hub.PublishMark(user, mark, events.Event{ArticleIDs: articleIds})
+
 	switch mark {
 	case models.MarkActionRead:
 		hour, day := readActivityLabels()
@@ -502,6 +543,7 @@ func (a GReader) markAllAsRead(w http.ResponseWriter, r *http.Request, user mode
 			a.returnError(w, http.StatusInternalServerError)
 			return
 		}
+		a.hub.PublishMark(user, models.MarkActionRead, events.Event{FolderID: folderId})
 		hour, day := readActivityLabels()
 		articlesMarkedReadMetric.WithLabelValues(user.Username, "folder", hour, day).Add(float64(n))
 	} else if feedStr := r.Form.Get("s"); feedStr != "" {
@@ -518,6 +560,7 @@ func (a GReader) markAllAsRead(w http.ResponseWriter, r *http.Request, user mode
 			a.returnError(w, http.StatusInternalServerError)
 			return
 		}
+		a.hub.PublishMark(user, models.MarkActionRead, events.Event{FeedID: feedId})
 		hour, day := readActivityLabels()
 		articlesMarkedReadMetric.WithLabelValues(user.Username, "feed", hour, day).Add(float64(n))
 	} else {
@@ -531,58 +574,62 @@ func (a GReader) markAllAsRead(w http.ResponseWriter, r *http.Request, user mode
 }
 
 func (a GReader) withAuth(w http.ResponseWriter, r *http.Request, handler func(http.ResponseWriter, *http.Request, models.User)) {
+	user, status := a.authenticate(r.Header.Get("Authorization"))
+	if status != http.StatusOK {
+		a.returnError(w, status)
+		return
+	}
+
+	handler(w, r, user)
+}
+
+// authenticate validates the given authorization header value and returns the
+// associated user. The returned status is http.StatusOK on success.
+func (a GReader) authenticate(authHeader string) (models.User, int) {
 	// Header should be in format:
 	//   Authorization: GoogleLogin auth=<token>
-	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		log.Warningf("Missing authorization header")
-		a.returnError(w, http.StatusUnauthorized)
-		return
+		return models.User{}, http.StatusUnauthorized
 	}
 
 	authFields := strings.Fields(authHeader)
 	if len(authFields) != 2 || !strings.EqualFold(authFields[0], "GoogleLogin") {
 		log.Warningf("Invalid authorization header: %s", authHeader)
-		a.returnError(w, http.StatusBadRequest)
-		return
+		return models.User{}, http.StatusBadRequest
 	}
 
 	authStr, tokenStr, found := strings.Cut(authFields[1], "=")
 	if !found {
 		log.Warningf("Invalid authorization header: %s", authHeader)
-		a.returnError(w, http.StatusBadRequest)
-		return
+		return models.User{}, http.StatusBadRequest
 	}
 
 	if !strings.EqualFold(authStr, "auth") {
 		log.Warningf("Invalid authorization header: %s", authHeader)
-		a.returnError(w, http.StatusBadRequest)
-		return
+		return models.User{}, http.StatusBadRequest
 	}
 
 	username, token, err := extractAuthToken(tokenStr)
 	if err != nil {
 		log.Warningf("Invalid authorization header: %s", authHeader)
-		a.returnError(w, http.StatusBadRequest)
-		return
+		return models.User{}, http.StatusBadRequest
 	}
 
 	user, err := a.d.GetUserByUsername(username)
 	if err != nil {
 		log.Warningf("Failed to find user: %s", username)
-		a.returnError(w, http.StatusUnauthorized)
-		return
+		return models.User{}, http.StatusUnauthorized
 	}
 
 	if !validateAuthToken(token, username, user.HashPass) {
 		log.Warningf("Invalid token for user: %s", username)
-		a.returnError(w, http.StatusUnauthorized)
-		return
+		return models.User{}, http.StatusUnauthorized
 	}
 
 	InitUserMetrics(user.Username)
 
-	handler(w, r, user)
+	return user, http.StatusOK
 }
 
 func greaderArticleId(articleId int64) string {
@@ -598,6 +645,26 @@ func greaderFolderId(folderId int64) string {
 	return fmt.Sprintf("user/-/label/%d", folderId)
 }
 
+// greaderLabelId returns the stream ID of a label assigned to articles by
+// rules.
+func greaderLabelId(label string) string {
+	return "user/-/label/" + label
+}
+
+func greaderEnclosures(enclosures []models.Enclosure) []greaderEnclosure {
+	var ret []greaderEnclosure
+	for _, e := range enclosures {
+		ret = append(ret, greaderEnclosure{
+			Href:     e.URL,
+			Type:     e.Type,
+			Length:   e.Length,
+			Duration: int64(e.Duration.Seconds()),
+			Position: int64(e.Position.Seconds()),
+		})
+	}
+	return ret
+}
+
 func (a GReader) validateLoginForm(r *http.Request) (string, int) {
 	token := ""
 
@@ -703,21 +770,15 @@ func (a GReader) handleParseFullArticle(w http.ResponseWriter, r *http.Request,
 	}
 
 	// Fetch and parse the URL.
-	parsedContent, err := fetch.ExtractFullText(r.Context(), article.Link)
+	sanitizedContent, err := fetch.ExtractSanitizedFullText(r.Context(), article.Link)
 	if err != nil {
 		log.Warningf("Failed to extract full text for article %d (%s): %s", id, article.Link, err)
 		a.returnError(w, http.StatusBadGateway)
 		return
 	}
 
-	// Rewrite relative URLs/images and proxy them using the article's URL as base.
-	rewrittenContent := fetch.ProcessHTMLContent(article.Link, parsedContent)
-
-	// Sanitize content using the fetch package policy.
-	sanitizedContent := fetch.SanitizeBody(rewrittenContent)
-
 	// Persist the sanitized parsed content to CockroachDB.
-	err = a.d.UpdateArticleParsedContentForUser(user, id, sanitizedContent)
+	err = a.d.UpdateArticleParsedContentForUser(user, id, sanitizedContent, fetch.AnalyzeText(sanitizedContent))
 	if err != nil {
 		log.Warningf("Failed to persist parsed article content to DB: %s", err)
 		a.returnError(w, http.StatusInternalServerError)
@@ -726,3 +787,68 @@ func (a GReader) handleParseFullArticle(w http.ResponseWriter, r *http.Request,
 
 	a.returnSuccess(w, parseFullArticleResponse{Content: sanitizedContent})
 }
+
+// handlePlaybackPosition saves where the user stopped playing an enclosure so
+// that playback can be resumed later. The enclosure is identified by the
+// article ID ("i") and its URL ("href"), which defaults to the first audio or
+// video enclosure of the article. The position ("p") is in seconds.
+func (a GReader) handlePlaybackPosition(w http.ResponseWriter, r *http.Request, user models.User) {
+	err := r.ParseForm()
+	if err != nil {
+		a.returnError(w, http.StatusBadRequest)
+		return
+	}
+
+	postToken := r.Form.Get("T")
+	if !validatePostToken(postToken) {
+		a.returnInvalidPostToken(w, postToken)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Form.Get("i"), 16, 64)
+	if err != nil {
+		log.Warningf("Invalid article ID: %s", r.Form.Get("i"))
+		a.returnError(w, http.StatusBadRequest)
+		return
+	}
+
+	position, err := strconv.ParseFloat(r.Form.Get("p"), 64)
+	if err != nil || position < 0 {
+		log.Warningf("Invalid playback position: %s", r.Form.Get("p"))
+		a.returnError(w, http.StatusBadRequest)
+		return
+	}
+
+	href := r.Form.Get("href")
+	if href == "" {
+		articles, err := a.d.GetArticlesForUser(user, []int64{id})
+		if err != nil {
+			log.Warningf("Failed to retrieve article: %s", err)
+			a.returnError(w, http.StatusInternalServerError)
+			return
+		}
+		for _, article := range articles {
+			for _, e := range article.Enclosures {
+				if e.Playable() {
+					href = e.URL
+					break
+				}
+			}
+		}
+		if href == "" {
+			log.Warningf("No playable enclosure found for article %d", id)
+			a.returnError(w, http.StatusNotFound)
+			return
+		}
+	}
+
+	err = a.d.UpdateEnclosurePositionForUser(user, id, href, time.Duration(position*float64(time.Second)))
+	if err != nil {
+		log.Warningf("Failed to save playback position: %s", err)
+		a.returnError(w, http.StatusNotFound)
+		return
+	}
+
+	_, _ = w.Write([]byte("OK"))
+	a.returnSuccess(w, nil)
+}
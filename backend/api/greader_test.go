@@ -1,11 +1,13 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jrupac/goliath/fetch"
 	"github.com/jrupac/goliath/models"
@@ -58,7 +60,7 @@ func TestHandleParseFullArticle(t *testing.T) {
 	}
 
 	var savedParsedContent string
-	mockDB.OnUpdateArticleParsedContentForUser = func(u models.User, articleID int64, parsed string) error {
+	mockDB.OnUpdateArticleParsedContentForUser = func(u models.User, articleID int64, parsed string, stats models.TextStats) error {
 		if articleID == 12345 {
 			savedParsedContent = parsed
 		}
@@ -104,3 +106,212 @@ func TestHandleParseFullArticle(t *testing.T) {
 		t.Errorf("saved parsed content did not have image resolved (expected %q): %s", expectedImg, savedParsedContent)
 	}
 }
+
+func TestHandlePlaybackPosition(t *testing.T) {
+	type saved struct {
+		id       int64
+		url      string
+		position time.Duration
+	}
+	var got []saved
+
+	mockDB := &storage.MockDB{
+		OnGetArticlesForUser: func(u models.User, ids []int64) ([]models.Article, error) {
+			return []models.Article{{
+				ID: 12345,
+				Enclosures: []models.Enclosure{
+					{URL: "http://example.com/cover.jpg", Type: "image/jpeg"},
+					{URL: "http://example.com/episode.mp3", Type: "audio/mpeg"},
+				},
+			}}, nil
+		},
+		OnUpdateEnclosurePositionForUser: func(u models.User, articleID int64, url string, position time.Duration) error {
+			got = append(got, saved{articleID, url, position})
+			return nil
+		},
+	}
+	greader := GReader{d: mockDB}
+
+	tests := []struct {
+		name   string
+		form   url.Values
+		status int
+		want   *saved
+	}{
+		{
+			name:   "defaults to first playable enclosure",
+			form:   url.Values{"T": {"post_token"}, "i": {"3039"}, "p": {"90.5"}},
+			status: http.StatusOK,
+			want:   &saved{12345, "http://example.com/episode.mp3", 90500 * time.Millisecond},
+		},
+		{
+			name:   "explicit enclosure",
+			form:   url.Values{"T": {"post_token"}, "i": {"3039"}, "p": {"10"}, "href": {"http://example.com/other.mp3"}},
+			status: http.StatusOK,
+			want:   &saved{12345, "http://example.com/other.mp3", 10 * time.Second},
+		},
+		{
+			name:   "invalid position",
+			form:   url.Values{"T": {"post_token"}, "i": {"3039"}, "p": {"-1"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing article",
+			form:   url.Values{"T": {"post_token"}, "p": {"10"}},
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			req := httptest.NewRequest("POST", "/greader/ext/playback-position", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+
+			greader.handlePlaybackPosition(w, req, models.User{UserId: "test-user"})
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.want == nil {
+				if len(got) != 0 {
+					t.Errorf("expected no saved position, got %+v", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0] != *tt.want {
+				t.Errorf("expected %+v, got %+v", *tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleStreamItemsContentsStorySources(t *testing.T) {
+	mockDB := &storage.MockDB{
+		OnGetArticlesForUser: func(u models.User, ids []int64) ([]models.Article, error) {
+			return []models.Article{{
+				ID:      12345,
+				Title:   "Acme launches rocket skates",
+				Link:    "https://example.com/skates",
+				Content: "<p>Press release</p>",
+				StoryID: 12345,
+				Sources: []models.StorySource{
+					{ArticleID: 12346, FeedID: 2, FeedTitle: "News & Views", Title: "Rocket skates", Link: "https://news.example.com/skates"},
+				},
+			}}, nil
+		},
+	}
+	greader := GReader{d: mockDB}
+
+	form := url.Values{"T": {"post_token"}, "i": {"3039"}}
+	req := httptest.NewRequest("POST", "/greader/reader/api/0/stream/items/contents", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	greader.handleStreamItemsContents(w, req, models.User{UserId: "test-user"})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		`"alternate":[{"href":"https://example.com/skates"},{"href":"https://news.example.com/skates"}]`,
+		`<a href=\"https://news.example.com/skates\">News &amp; Views</a>: Rocket skates`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected response to contain %s, got %s", expected, body)
+		}
+	}
+}
+
+func TestHandleStreamItemsContentsArchived(t *testing.T) {
+	mockDB := &storage.MockDB{
+		OnGetArticlesForUser: func(u models.User, ids []int64) ([]models.Article, error) {
+			return []models.Article{{
+				ID:       12345,
+				Link:     "https://example.com/post",
+				Content:  `<img src="https://example.com/a.png">`,
+				Archived: `<img src="/archive/12345/0123abcd.png">`,
+				Saved:    true,
+			}}, nil
+		},
+		OnGetUserByKey: func(key string) (models.User, error) {
+			if key != "session" {
+				return models.User{}, fmt.Errorf("unknown key")
+			}
+			return models.User{UserId: "test-user"}, nil
+		},
+	}
+	greader := GReader{d: mockDB}
+
+	testCases := []struct {
+		name     string
+		cookie   bool
+		expected string
+	}{
+		{"frontend gets archived copy", true, "/archive/12345/0123abcd.png"},
+		{"other clients get original content", false, "https://example.com/a.png"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"T": {"post_token"}, "i": {"3039"}}
+			req := httptest.NewRequest("POST", "/greader/reader/api/0/stream/items/contents", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tc.cookie {
+				req.AddCookie(&http.Cookie{Name: "goliath", Value: "session"})
+			}
+			w := httptest.NewRecorder()
+
+			greader.handleStreamItemsContents(w, req, models.User{UserId: "test-user"})
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), tc.expected) {
+				t.Errorf("expected response to contain %s, got %s", tc.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestPriorityStream(t *testing.T) {
+	mockDB := &storage.MockDB{
+		OnGetArticleMetaWithFilterForUser: func(u models.User, filter models.StreamFilter, limit int, sinceID int64) ([]models.ArticleMeta, error) {
+			if filter != models.StreamFilterPriority {
+				t.Errorf("expected priority filter, got %d", filter)
+			}
+			return []models.ArticleMeta{{ID: 12345, FeedID: 1, FolderID: 2}}, nil
+		},
+		OnGetArticlesForUser: func(u models.User, ids []int64) ([]models.Article, error) {
+			return []models.Article{{ID: 12345, Title: "Urgent", Link: "https://example.com/urgent", Priority: true}}, nil
+		},
+	}
+	greader := GReader{d: mockDB}
+	user := models.User{UserId: "test-user"}
+
+	req := httptest.NewRequest("GET", "/greader/reader/api/0/stream/items/ids?s="+url.QueryEscape(priorityStreamId), nil)
+	w := httptest.NewRecorder()
+	greader.handleStreamItemIds(w, req, user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"id":"12345"`) {
+		t.Errorf("expected priority article in stream, got %s", body)
+	}
+
+	form := url.Values{"T": {"post_token"}, "i": {"3039"}}
+	req = httptest.NewRequest("POST", "/greader/reader/api/0/stream/items/contents", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	greader.handleStreamItemsContents(w, req, user)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"`+priorityStreamId+`"`) {
+		t.Errorf("expected priority category, got %s", body)
+	}
+}
@@ -44,6 +44,21 @@ type greaderContent struct {
 	Content   string `json:"content"`
 }
 
+// greaderEnclosure is a media file attached to an item. Duration and
+// position, in seconds, are extensions for resuming playback.
+type greaderEnclosure struct {
+	Href     string `json:"href"`
+	Type     string `json:"type,omitempty"`
+	Length   int64  `json:"length,omitempty"`
+	Duration int64  `json:"duration,omitempty"`
+	Position int64  `json:"position,omitempty"`
+}
+
+// greaderVisual is the lead image of an item.
+type greaderVisual struct {
+	Url string `json:"url"`
+}
+
 type greaderOrigin struct {
 	StreamId string `json:"streamId"`
 	Title    string `json:"title"`
@@ -56,11 +71,20 @@ type greaderItemContent struct {
 	Id            string             `json:"id"`
 	Categories    []string           `json:"categories"`
 	Title         string             `json:"title"`
+	Author        string             `json:"author,omitempty"`
 	Published     int64              `json:"published"`
 	Canonical     []greaderCanonical `json:"canonical"`
 	Alternate     []greaderCanonical `json:"alternate"`
 	Summary       greaderContent     `json:"summary"`
 	Origin        greaderOrigin      `json:"origin"`
+	Enclosure     []greaderEnclosure `json:"enclosure,omitempty"`
+	Replies       []greaderCanonical `json:"replies,omitempty"`
+	Visual        *greaderVisual     `json:"visual,omitempty"`
+	// WordCount, ReadingTime (in seconds) and Language are extensions for
+	// sorting and filtering by article length.
+	WordCount   int    `json:"wordCount,omitempty"`
+	ReadingTime int64  `json:"readingTime,omitempty"`
+	Language    string `json:"language,omitempty"`
 }
 
 type greaderItemRef struct {
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/fetch"
+	"github.com/jrupac/goliath/opml"
+	"github.com/jrupac/goliath/storage"
+)
+
+var (
+	maxOpmlImportBytes = flag.Int64("maxOpmlImportBytes", 10<<20, "Maximum size in bytes of an uploaded OPML file.")
+)
+
+// OpmlImportHandler returns a handler that imports an uploaded OPML document
+// for the authenticated user and responds with a JSON import report. The
+// document may be sent as the request body or as the "file" field of a
+// multipart form.
+func OpmlImportHandler(d storage.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Limit the body before authenticating since that may parse the form.
+		r.Body = http.MaxBytesReader(w, r.Body, *maxOpmlImportBytes)
+
+		user, status := authenticateRequest(d, r)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		var body io.Reader = r.Body
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			f, _, err := r.FormFile("file")
+			if err != nil {
+				log.Warningf("Failed to read uploaded OPML file: %s", err)
+				http.Error(w, "missing OPML file", http.StatusBadRequest)
+				return
+			}
+			defer f.Close()
+			body = f
+		}
+
+		p, err := opml.Parse(body)
+		if err != nil {
+			log.Warningf("Failed to parse uploaded OPML for %s: %s", user, err)
+			http.Error(w, "invalid OPML", http.StatusBadRequest)
+			return
+		}
+
+		report, err := d.ImportOpmlForUser(user, p)
+		if err != nil {
+			log.Warningf("while importing OPML for %s: %s", user, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Infof("Imported OPML for %s: %s", user, report)
+
+		if err = fetch.StartFeeds(r.Context(), d, user, report.CreatedFeedIDs()); err != nil {
+			log.Warningf("while starting fetch of imported feeds for %s: %s", user, err)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(report); err != nil {
+			log.Warningf("Failed to encode response JSON: %s", err)
+		}
+	}
+}
+
+// OpmlExportHandler returns a handler that responds with the authenticated
+// user's folders and feeds as an OPML document.
+func OpmlExportHandler(d storage.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		user, status := authenticateRequest(d, r)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		o, err := d.ExportOpmlForUser(user)
+		if err != nil {
+			log.Warningf("while fetching feeds to export for %s: %s", user, err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="goliath.opml"`)
+		w.WriteHeader(http.StatusOK)
+		if err = opml.Write(o, w); err != nil {
+			log.Warningf("Failed to write OPML for %s: %s", user, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/opml"
+	"github.com/jrupac/goliath/storage"
+)
+
+const testOpml = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Test</title></head>
+  <body>
+    <outline text="Tech">
+      <outline type="rss" text="Example" xmlUrl="http://example.com/feed"/>
+    </outline>
+  </body>
+</opml>`
+
+func TestOpmlImportHandler(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice", Key: "key"}
+
+	newMockDB := func(imported **opml.Opml) *storage.MockDB {
+		return &storage.MockDB{
+			OnGetUserByKey: func(key string) (models.User, error) {
+				if key == "key" {
+					return user, nil
+				}
+				return models.User{}, errors.New("could not find user")
+			},
+			OnImportOpmlForUser: func(u models.User, o *opml.Opml) (opml.ImportReport, error) {
+				*imported = o
+				return opml.ImportReport{
+					MergedFeeds:    []opml.ReportFeed{{Title: "Example", URL: "http://example.com/feed", Folder: "Tech"}},
+					CreatedFolders: []opml.ReportFolder{{ID: 2, Name: "Tech"}},
+				}, nil
+			},
+		}
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		var imported *opml.Opml
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/opml/import", strings.NewReader(testOpml))
+
+		OpmlImportHandler(newMockDB(&imported))(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", w.Code)
+		}
+		if imported != nil {
+			t.Error("expected nothing to be imported")
+		}
+	})
+
+	t.Run("raw body", func(t *testing.T) {
+		var imported *opml.Opml
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/opml/import?api_key=key", strings.NewReader(testOpml))
+
+		OpmlImportHandler(newMockDB(&imported))(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if imported == nil || len(imported.Folders.Folders) != 1 || imported.Folders.Folders[0].Name != "Tech" {
+			t.Fatalf("unexpected imported OPML: %+v", imported)
+		}
+
+		var report opml.ImportReport
+		if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+			t.Fatalf("failed to decode report: %s", err)
+		}
+		if len(report.MergedFeeds) != 1 || len(report.CreatedFolders) != 1 {
+			t.Errorf("unexpected report: %+v", report)
+		}
+	})
+
+	t.Run("multipart upload", func(t *testing.T) {
+		var imported *opml.Opml
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "feeds.opml")
+		_, _ = fw.Write([]byte(testOpml))
+		_ = mw.Close()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/opml/import?api_key=key", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		OpmlImportHandler(newMockDB(&imported))(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		if imported == nil {
+			t.Fatal("expected OPML to be imported")
+		}
+	})
+
+	t.Run("invalid OPML", func(t *testing.T) {
+		var imported *opml.Opml
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/opml/import?api_key=key", strings.NewReader("not xml"))
+
+		OpmlImportHandler(newMockDB(&imported))(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestOpmlExportHandler(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice", Key: "key"}
+	db := &storage.MockDB{
+		OnGetUserByKey: func(key string) (models.User, error) {
+			if key == "key" {
+				return user, nil
+			}
+			return models.User{}, errors.New("could not find user")
+		},
+		OnExportOpmlForUser: func(u models.User) (*opml.Opml, error) {
+			return &opml.Opml{
+				Folders: models.Folder{
+					Name: models.RootFolder,
+					Folders: []models.Folder{{
+						Name: "Tech",
+						Feed: []models.Feed{{Title: "Example", URL: "http://example.com/feed"}},
+					}},
+				},
+			}, nil
+		},
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/opml/export?api_key=key", nil)
+
+	OpmlExportHandler(db)(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	p, err := opml.Parse(w.Body)
+	if err != nil {
+		t.Fatalf("failed to parse exported OPML: %s", err)
+	}
+	if len(p.Folders.Folders) != 1 || len(p.Folders.Folders[0].Feed) != 1 {
+		t.Errorf("unexpected exported OPML: %+v", p.Folders)
+	}
+}
@@ -0,0 +1,302 @@
+// Package archive keeps offline copies of saved articles.
+//
+// When an article is saved, a snapshot of its best content is taken and every
+// image it references is downloaded into a directory of the article under
+// the archive directory. The snapshot, with its images rewritten to point at
+// the local copies, is stored as the article's archived content and is served
+// to the frontend in place of its content. The local copies are served by
+// Handler, which requires the frontend's session cookie, so other clients get
+// the original content.
+//
+// Saved articles are kept by GC, and the archived copy is dropped when the
+// article is unsaved, at which point its images are removed on the next run.
+package archive
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/jrupac/goliath/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	archiveDir           = flag.String("archiveDir", "", "Directory to store offline copies of the images of saved articles in. Saved articles are not archived if not set.")
+	archiveInterval      = flag.Duration("archiveInterval", time.Minute, "Interval between checks for saved articles to archive.")
+	archiveMaxImages     = flag.Int("archiveMaxImages", 100, "Maximum number of images downloaded for a single archived article.")
+	archiveMaxImageBytes = flag.Int64("archiveMaxImageBytes", 20<<20, "Maximum size in bytes of an image downloaded for an archived article.")
+)
+
+// pathPrefix is the path under which the local copies of images are served.
+const pathPrefix = "/archive/"
+
+// batchSize is the maximum number of articles archived per user in one run.
+const batchSize = 50
+
+var (
+	archivedArticlesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "archived_articles_total",
+			Help: "Total number of saved articles archived by result: success or failure.",
+		},
+		[]string{"result"},
+	)
+	archivedImagesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "archived_images_total",
+			Help: "Total number of images of saved articles archived by result: success or failure.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(archivedArticlesMetric)
+	prometheus.MustRegister(archivedImagesMetric)
+}
+
+// archiver archives saved articles into a directory.
+type archiver struct {
+	d      storage.Database
+	dir    string
+	client *http.Client
+}
+
+// Start periodically archives newly saved articles and removes the images of
+// articles that are no longer archived until the given context is canceled.
+func Start(ctx context.Context, d storage.Database) {
+	if *archiveDir == "" {
+		log.Infof("No archive directory configured, not archiving saved articles.")
+		return
+	}
+
+	log.Infof("Starting archiver of saved articles.")
+	a := &archiver{d: d, dir: *archiveDir, client: utils.NewSafeClient(30 * time.Second)}
+	tick := time.After(0)
+
+	for {
+		select {
+		case <-tick:
+			a.run(ctx)
+			tick = time.After(*archiveInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run archives the saved articles of each user that are not archived yet and
+// removes the images of articles that are no longer archived.
+func (a *archiver) run(ctx context.Context) {
+	users, err := a.d.GetAllUsers()
+	if err != nil {
+		log.Warningf("Failed to query all users: %s", err)
+		return
+	}
+
+	for _, u := range users {
+		articles, err := a.d.GetUnarchivedSavedArticlesForUser(u, batchSize)
+		if err != nil {
+			log.Warningf("while retrieving saved articles to archive for %s: %s", u, err)
+			continue
+		}
+		for _, article := range articles {
+			if ctx.Err() != nil {
+				return
+			}
+			if err = a.archive(ctx, u, article); err != nil {
+				log.Warningf("Failed to archive article %d for %s: %s", article.ID, u, err)
+				archivedArticlesMetric.WithLabelValues("failure").Inc()
+				continue
+			}
+			archivedArticlesMetric.WithLabelValues("success").Inc()
+		}
+
+		if err = a.sweep(u); err != nil {
+			log.Warningf("while removing stale archives for %s: %s", u, err)
+		}
+	}
+}
+
+func (a *archiver) articleDir(u models.User, articleID int64) string {
+	return filepath.Join(a.dir, string(u.UserId), strconv.FormatInt(articleID, 10))
+}
+
+// archive downloads the images of the article and stores its content with the
+// images rewritten to the local copies. Images that cannot be downloaded keep
+// pointing at their origin.
+func (a *archiver) archive(ctx context.Context, u models.User, article models.Article) error {
+	content := article.GetContents(true)
+	dir := a.articleDir(u, article.ID)
+
+	if content != "" {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(content))
+		if err != nil {
+			return fmt.Errorf("failed to parse content: %w", err)
+		}
+		base, _ := url.Parse(article.Link)
+
+		local := map[string]string{}
+		doc.Find("img[src]").Each(func(_ int, s *goquery.Selection) {
+			src, _ := s.Attr("src")
+			target := imageURL(base, src)
+			if target == "" {
+				return
+			}
+			path, ok := local[target]
+			if !ok {
+				if len(local) >= *archiveMaxImages {
+					return
+				}
+				name, err := a.download(ctx, dir, target)
+				if err != nil {
+					log.V(2).Infof("Not archiving image %s of article %d: %s", target, article.ID, err)
+					archivedImagesMetric.WithLabelValues("failure").Inc()
+				} else {
+					path = fmt.Sprintf("%s%d/%s", pathPrefix, article.ID, name)
+					archivedImagesMetric.WithLabelValues("success").Inc()
+				}
+				local[target] = path
+			}
+			if path != "" {
+				s.SetAttr("src", path)
+				// Other sources would still be loaded from the origin.
+				s.RemoveAttr("srcset")
+				s.ParentFiltered("picture").Find("source").Remove()
+			}
+		})
+
+		if content, err = doc.Find("body").Html(); err != nil {
+			return fmt.Errorf("failed to render content: %w", err)
+		}
+	}
+
+	if err := a.d.UpdateArticleArchiveForUser(u, article.ID, content); err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+	log.V(2).Infof("Archived article %d for %s", article.ID, u)
+	return nil
+}
+
+// imageURL returns the absolute URL of the origin of an image, resolving it
+// against the article's link and unwrapping image proxy URLs. An empty string
+// is returned for images that are not fetched over HTTP.
+func imageURL(base *url.URL, src string) string {
+	u, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u, err = url.Parse(cache.OriginURL(u.String())); err != nil {
+		return ""
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
+
+// download stores the image at the given URL in the directory and returns the
+// name of its file, which is derived from the URL.
+func (a *archiver) download(ctx context.Context, dir string, target string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("non-200 status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > *archiveMaxImageBytes {
+		return "", fmt.Errorf("image is too large: %d bytes", resp.ContentLength)
+	}
+
+	br := bufio.NewReaderSize(resp.Body, cache.SniffLen)
+	_, mediaType := cache.DetectContentType(resp.Header.Get("Content-Type"), br)
+	ext, ok := cache.ImageExtension(mediaType)
+	if !ok {
+		return "", fmt.Errorf("unsupported content type: %s", mediaType)
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	f, err := os.CreateTemp(dir, ".image-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create image file: %w", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	n, err := io.Copy(f, io.LimitReader(br, *archiveMaxImageBytes+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write image: %w", err)
+	}
+	if n > *archiveMaxImageBytes {
+		return "", fmt.Errorf("image is larger than %d bytes", *archiveMaxImageBytes)
+	}
+
+	h := sha256.Sum256([]byte(target))
+	name := hex.EncodeToString(h[:16]) + ext
+	if err = os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		return "", fmt.Errorf("failed to store image: %w", err)
+	}
+	return name, nil
+}
+
+// sweep removes the directories of the user's articles that are no longer
+// archived, which happens when they are unsaved.
+func (a *archiver) sweep(u models.User) error {
+	entries, err := os.ReadDir(filepath.Join(a.dir, string(u.UserId)))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	ids, err := a.d.GetArchivedArticleIdsForUser(u)
+	if err != nil {
+		return err
+	}
+	archived := map[string]bool{}
+	for _, id := range ids {
+		archived[strconv.FormatInt(id, 10)] = true
+	}
+
+	for _, e := range entries {
+		if archived[e.Name()] {
+			continue
+		}
+		log.V(2).Infof("Removing archived images of article %s for %s", e.Name(), u)
+		if err = os.RemoveAll(filepath.Join(a.dir, string(u.UserId), e.Name())); err != nil {
+			log.Warningf("Failed to remove archived images: %s", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+// pngHeader is enough of a PNG file for its type to be detected.
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"
+
+func TestImageURL(t *testing.T) {
+	base, _ := url.Parse("http://example.com/posts/1")
+
+	testCases := []struct {
+		name     string
+		src      string
+		expected string
+	}{
+		{"absolute", "https://cdn.example.com/a.png", "https://cdn.example.com/a.png"},
+		{"relative", "/images/a.png", "http://example.com/images/a.png"},
+		{"proxied", "https://goliath.example.com/cache?sig=abc&url=http%3A%2F%2Fexample.com%2Fa.png", "http://example.com/a.png"},
+		{"data URI", "data:image/gif;base64,R0lGOD", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := imageURL(base, tc.src); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestArchive(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.png":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, pngHeader)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html></html>")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer backend.Close()
+
+	u := models.User{UserId: "user"}
+	var stored string
+	d := &storage.MockDB{
+		OnUpdateArticleArchiveForUser: func(_ models.User, id int64, archived string) error {
+			if id != 7 {
+				t.Errorf("expected article 7, got %d", id)
+			}
+			stored = archived
+			return nil
+		},
+	}
+	dir := t.TempDir()
+	a := &archiver{d: d, dir: dir, client: backend.Client()}
+
+	article := models.Article{
+		ID:      7,
+		Link:    backend.URL + "/post",
+		Content: "<p>content</p>",
+		Parsed: `<p><img src="/a.png" srcset="/a.png 2x"><img src="` + backend.URL + `/a.png">` +
+			`<img src="/page"><img src="/missing.png"></p>`,
+	}
+	if err := a.archive(context.Background(), u, article); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "user", "7"))
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), ".png") {
+		t.Fatalf("expected one archived image, got %v", entries)
+	}
+	local := "/archive/7/" + entries[0].Name()
+	expected := `<p><img src="` + local + `"/><img src="` + local + `"/>` +
+		`<img src="/page"/><img src="/missing.png"/></p>`
+	if stored != expected {
+		t.Errorf("expected archive %q, got %q", expected, stored)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"1", "2"} {
+		if err := os.MkdirAll(filepath.Join(dir, "user", id), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d := &storage.MockDB{
+		OnGetArchivedArticleIdsForUser: func(models.User) ([]int64, error) {
+			return []int64{1}, nil
+		},
+	}
+	a := &archiver{d: d, dir: dir}
+
+	if err := a.sweep(models.User{UserId: "user"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "user", "1")); err != nil {
+		t.Errorf("expected archived article to be kept: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "user", "2")); !os.IsNotExist(err) {
+		t.Errorf("expected unarchived article to be removed: %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := *archiveDir
+	*archiveDir = dir
+	defer func() { *archiveDir = oldDir }()
+
+	if err := os.MkdirAll(filepath.Join(dir, "user", "7"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "user", "7", "abc.png"), []byte(pngHeader), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &storage.MockDB{
+		OnGetUserByKey: func(key string) (models.User, error) {
+			if key != "key" {
+				return models.User{}, fmt.Errorf("unknown key")
+			}
+			return models.User{UserId: "user"}, nil
+		},
+	}
+	h := Handler(d)
+
+	testCases := []struct {
+		name   string
+		path   string
+		cookie bool
+		status int
+	}{
+		{"serves image", "/archive/7/abc.png", true, http.StatusOK},
+		{"requires authentication", "/archive/7/abc.png", false, http.StatusUnauthorized},
+		{"missing image", "/archive/7/def.png", true, http.StatusNotFound},
+		{"invalid article", "/archive/../abc.png", true, http.StatusNotFound},
+		{"invalid name", "/archive/7/..%2Fabc.png", true, http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.path, nil)
+			if tc.cookie {
+				req.AddCookie(&http.Cookie{Name: "goliath", Value: "key"})
+			}
+			rr := httptest.NewRecorder()
+
+			h(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rr.Code)
+			}
+			if rr.Code == http.StatusOK && rr.Header().Get("Content-Type") != "image/png" {
+				t.Errorf("expected image content type, got %q", rr.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
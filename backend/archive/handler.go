@@ -0,0 +1,74 @@
+package archive
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/auth"
+	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+// imageNamePattern matches the names of archived image files.
+var imageNamePattern = regexp.MustCompile(`^[0-9a-f]+\.[a-z]+$`)
+
+// Handler returns an HTTP handler that serves the local copies of the images
+// of the authenticated user's archived articles at
+// "/archive/<article ID>/<file>".
+func Handler(d storage.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *archiveDir == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		user, err := auth.VerifyCookie(d, r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path, ok := localPath(user, r.URL.Path)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.V(2).Infof("Serving archived image %s for %s", r.URL.Path, user)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", cache.ContentSecurityPolicy)
+		// Archived images never change, since they are named by their URL.
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		http.ServeFile(w, r, path)
+	}
+}
+
+// ReadImage returns the local copy of an image of one of the user's archived
+// articles given its URL path in the archived content, and whether it exists.
+func ReadImage(u models.User, urlPath string) ([]byte, bool) {
+	path, ok := localPath(u, urlPath)
+	if !ok {
+		return nil, false
+	}
+	b, err := os.ReadFile(path)
+	return b, err == nil
+}
+
+// localPath returns the path of the file of an archived image of the user
+// given its URL path, or false if the URL path is not that of an image.
+func localPath(u models.User, urlPath string) (string, bool) {
+	if *archiveDir == "" || !strings.HasPrefix(urlPath, pathPrefix) {
+		return "", false
+	}
+	id, name, ok := strings.Cut(strings.TrimPrefix(urlPath, pathPrefix), "/")
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil || !ok || !imageNamePattern.MatchString(name) {
+		return "", false
+	}
+	return filepath.Join(*archiveDir, string(u.UserId), id, name), true
+}
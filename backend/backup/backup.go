@@ -0,0 +1,201 @@
+// Package backup exports a user's account to an archive and restores it.
+//
+// An archive is a gzipped tar file with the following entries, in order:
+//
+//	manifest.json       format version and export metadata
+//	subscriptions.opml  folders and feeds, including per-feed settings
+//	preferences.json    user-level preferences such as mute words
+//	favicons.jsonl      one line per favicon, mapping a feed to a file
+//	favicons/<n>        raw favicon images
+//	articles/<n>.jsonl  one line per article with its read and saved state
+//
+// Feeds are referred to by URL so that archives can be restored into another
+// instance where internal identifiers differ.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/opml"
+	"github.com/jrupac/goliath/storage"
+)
+
+// Version is the archive format version written by Export. Import accepts
+// archives of this version and older.
+const Version = 1
+
+const (
+	manifestFile      = "manifest.json"
+	subscriptionsFile = "subscriptions.opml"
+	preferencesFile   = "preferences.json"
+	faviconsFile      = "favicons.jsonl"
+	faviconsDir       = "favicons/"
+	articlesDir       = "articles/"
+)
+
+type manifest struct {
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	Username string    `json:"username"`
+}
+
+type preferences struct {
+	MuteWords []string `json:"mute_words"`
+}
+
+type favicon struct {
+	FeedURL string `json:"feed_url"`
+	MIME    string `json:"mime"`
+	File    string `json:"file"`
+}
+
+type article struct {
+	FeedURL string    `json:"feed_url"`
+	Title   string    `json:"title"`
+	Summary string    `json:"summary,omitempty"`
+	Content string    `json:"content,omitempty"`
+	Parsed  string    `json:"parsed,omitempty"`
+	Link    string    `json:"link,omitempty"`
+	Read    bool      `json:"read"`
+	Saved   bool      `json:"saved"`
+	Date    time.Time `json:"date"`
+}
+
+// Export writes an archive of the given user's account to the given writer.
+// Entries are written as they are read from the database, so only a single
+// feed's articles are held in memory at a time.
+func Export(d storage.Database, u models.User, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+
+	writeEntry := func(name string, b []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(b)
+		return err
+	}
+	writeJSON := func(name string, v any) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return writeEntry(name, b)
+	}
+
+	if err := writeJSON(manifestFile, manifest{Version: Version, Created: now, Username: u.Username}); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	o, err := d.ExportOpmlForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+	var buf bytes.Buffer
+	if err = opml.Write(o, &buf); err != nil {
+		return fmt.Errorf("failed to encode subscriptions: %w", err)
+	}
+	if err = writeEntry(subscriptionsFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write subscriptions: %w", err)
+	}
+
+	muteWords, err := d.GetMuteWordsForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get mute words: %w", err)
+	}
+	if err = writeJSON(preferencesFile, preferences{MuteWords: muteWords}); err != nil {
+		return fmt.Errorf("failed to write preferences: %w", err)
+	}
+
+	feeds, err := d.GetAllFeedsForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+
+	// Favicons are stored as "<mime>;base64,<data>".
+	favicons, err := d.GetAllFaviconsForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get favicons: %w", err)
+	}
+	var index []favicon
+	images := map[string][]byte{}
+	for _, f := range feeds {
+		encoded, ok := favicons[f.ID]
+		if !ok {
+			continue
+		}
+		mime, data, ok := strings.Cut(encoded, ";base64,")
+		if !ok {
+			continue
+		}
+		img, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			continue
+		}
+		name := fmt.Sprintf("%s%d", faviconsDir, len(index))
+		index = append(index, favicon{FeedURL: f.URL, MIME: mime, File: name})
+		images[name] = img
+	}
+	buf.Reset()
+	enc := json.NewEncoder(&buf)
+	for _, fav := range index {
+		if err = enc.Encode(fav); err != nil {
+			return fmt.Errorf("failed to encode favicon index: %w", err)
+		}
+	}
+	if err = writeEntry(faviconsFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write favicon index: %w", err)
+	}
+	for _, fav := range index {
+		if err = writeEntry(fav.File, images[fav.File]); err != nil {
+			return fmt.Errorf("failed to write favicon: %w", err)
+		}
+	}
+
+	for i, f := range feeds {
+		articles, err := d.GetArticlesForFeedForUser(u, f.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get articles for feed %d: %w", f.ID, err)
+		}
+		if len(articles) == 0 {
+			continue
+		}
+
+		buf.Reset()
+		for _, a := range articles {
+			err = enc.Encode(article{
+				FeedURL: f.URL,
+				Title:   a.Title,
+				Summary: a.Summary,
+				Content: a.Content,
+				Parsed:  a.Parsed,
+				Link:    a.Link,
+				Read:    a.Read,
+				Saved:   a.Saved,
+				Date:    a.Date,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to encode article %d: %w", a.ID, err)
+			}
+		}
+		if err = writeEntry(fmt.Sprintf("%s%d.jsonl", articlesDir, i), buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to write articles: %w", err)
+		}
+	}
+
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
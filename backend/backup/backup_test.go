@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/opml"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestExportImport(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice"}
+	date := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	icon := []byte("\x89PNG")
+	feed := models.Feed{ID: 10, FolderID: 1, Title: "Example", URL: "http://example.com/feed"}
+
+	src := &storage.MockDB{
+		OnExportOpmlForUser: func(u models.User) (*opml.Opml, error) {
+			return &opml.Opml{
+				Folders: models.Folder{Name: models.RootFolder, Feed: []models.Feed{feed}},
+			}, nil
+		},
+		OnGetMuteWordsForUser: func(u models.User) ([]string, error) {
+			return []string{"spoiler"}, nil
+		},
+		OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+			return []models.Feed{feed}, nil
+		},
+		OnGetAllFaviconsForUser: func(u models.User) (map[int64]string, error) {
+			return map[int64]string{10: "image/png;base64," + base64.StdEncoding.EncodeToString(icon)}, nil
+		},
+		OnGetArticlesForFeedForUser: func(u models.User, feedID int64) ([]models.Article, error) {
+			return []models.Article{
+				{ID: 1, FeedID: 10, Title: "Read", Link: "http://example.com/1", Read: true, Date: date},
+				{ID: 2, FeedID: 10, Title: "Saved", Link: "http://example.com/2", Saved: true, Date: date},
+				{ID: 3, FeedID: 10, Title: "Unread", Link: "http://example.com/3", Date: date},
+			}, nil
+		},
+	}
+
+	var archive bytes.Buffer
+	if err := Export(src, user, &archive); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	// The restored account already has the third article, read.
+	restored := models.Feed{ID: 20, FolderID: 2, Title: "Example", URL: "http://example.com/feed"}
+	var importedFeeds []models.Feed
+	var muteWords []string
+	marks := map[int64][]models.MarkAction{}
+	dst := &storage.MockDB{
+		OnImportOpmlForUser: func(u models.User, o *opml.Opml) (opml.ImportReport, error) {
+			importedFeeds = o.Folders.Feed
+			return opml.ImportReport{CreatedFeeds: []opml.ReportFeed{{ID: 20, URL: restored.URL}}}, nil
+		},
+		OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+			return []models.Feed{restored}, nil
+		},
+		OnGetArticlesForFeedForUser: func(u models.User, feedID int64) ([]models.Article, error) {
+			return []models.Article{{ID: 100, FeedID: 20, Link: "http://example.com/3", Read: true}}, nil
+		},
+		OnUpdateMuteWordsForUser: func(u models.User, words []string) error {
+			muteWords = words
+			return nil
+		},
+		OnMarkArticleForUser: func(u models.User, id int64, mark models.MarkAction) error {
+			marks[id] = append(marks[id], mark)
+			return nil
+		},
+	}
+
+	report, err := Import(dst, user, bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to import: %s", err)
+	}
+
+	if len(importedFeeds) != 1 || importedFeeds[0].URL != feed.URL {
+		t.Errorf("unexpected imported subscriptions: %+v", importedFeeds)
+	}
+	if len(muteWords) != 1 || muteWords[0] != "spoiler" {
+		t.Errorf("unexpected mute words: %v", muteWords)
+	}
+	if !dst.InsertFaviconForUserCalled {
+		t.Errorf("expected favicon to be restored")
+	}
+
+	if len(dst.InsertedArticles) != 2 {
+		t.Fatalf("expected 2 inserted articles, got %d", len(dst.InsertedArticles))
+	}
+	for _, a := range dst.InsertedArticles {
+		if a.FeedID != restored.ID || a.FolderID != restored.FolderID {
+			t.Errorf("expected article in restored feed, got %+v", a)
+		}
+		if !a.Date.Equal(date) {
+			t.Errorf("expected date %s, got %s", date, a.Date)
+		}
+	}
+	if !dst.InsertedArticles[0].Read || dst.InsertedArticles[1].Read {
+		t.Errorf("expected read state to be restored: %+v", dst.InsertedArticles)
+	}
+	// The mock assigns IDs in insertion order, so the saved article is 2.
+	if len(marks[2]) != 1 || marks[2][0] != models.MarkActionSaved {
+		t.Errorf("expected saved article to be marked saved, got %v", marks)
+	}
+	if len(marks[100]) != 1 || marks[100][0] != models.MarkActionUnread {
+		t.Errorf("expected existing article to be marked unread, got %v", marks)
+	}
+
+	want := ImportReport{
+		Subscriptions:   report.Subscriptions,
+		CreatedArticles: 2,
+		UpdatedArticles: 1,
+		Favicons:        1,
+		MuteWords:       1,
+	}
+	if report.String() != want.String() {
+		t.Errorf("expected report %s, got %s", want, report)
+	}
+}
+
+func TestImportRejectsInvalidArchives(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice"}
+
+	archive := func(entries map[string]any) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, v := range entries {
+			b, _ := json.Marshal(v)
+			_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b))})
+			_, _ = tw.Write(b)
+		}
+		_ = tw.Close()
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not gzip", []byte("not an archive"), "invalid archive"},
+		{"missing manifest", archive(map[string]any{preferencesFile: preferences{}}), "missing manifest"},
+		{"newer version", archive(map[string]any{manifestFile: manifest{Version: Version + 1}}), "unsupported archive version"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Import(&storage.MockDB{}, user, bytes.NewReader(tc.data))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+}
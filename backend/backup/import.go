@@ -0,0 +1,316 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/opml"
+	"github.com/jrupac/goliath/storage"
+)
+
+// maxLineSize bounds the size of a single JSON line, which holds one article.
+const maxLineSize = 16 << 20
+
+// ImportReport summarizes the result of restoring an archive.
+type ImportReport struct {
+	Subscriptions opml.ImportReport
+	// CreatedArticles did not exist before the import.
+	CreatedArticles int
+	// UpdatedArticles already existed and had their read or saved state
+	// restored.
+	UpdatedArticles int
+	// SkippedArticles belong to feeds that are not part of the account.
+	SkippedArticles int
+	Favicons        int
+	MuteWords       int
+}
+
+func (r ImportReport) String() string {
+	return fmt.Sprintf("%s; articles: %d created, %d updated, %d skipped; %d favicons; %d mute words",
+		r.Subscriptions, r.CreatedArticles, r.UpdatedArticles, r.SkippedArticles, r.Favicons, r.MuteWords)
+}
+
+// Import restores an archive written by Export into the given user's account.
+// Existing folders, feeds and articles are merged rather than duplicated, so
+// importing the same archive more than once has no further effect.
+func Import(d storage.Database, u models.User, r io.Reader) (ImportReport, error) {
+	imp := importer{d: d, u: u}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return imp.report, fmt.Errorf("invalid archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	for first := true; ; first = false {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return imp.report, fmt.Errorf("invalid archive: %w", err)
+		}
+
+		if first && hdr.Name != manifestFile {
+			return imp.report, errors.New("invalid archive: missing manifest")
+		}
+
+		switch {
+		case hdr.Name == manifestFile:
+			err = imp.readManifest(tr)
+		case hdr.Name == subscriptionsFile:
+			err = imp.importSubscriptions(tr)
+		case hdr.Name == preferencesFile:
+			err = imp.importPreferences(tr)
+		case hdr.Name == faviconsFile:
+			err = imp.readFaviconIndex(tr)
+		case strings.HasPrefix(hdr.Name, faviconsDir):
+			err = imp.importFavicon(hdr.Name, tr)
+		case strings.HasPrefix(hdr.Name, articlesDir):
+			err = imp.importArticles(tr)
+		default:
+			log.Warningf("Skipping unknown archive entry: %s", hdr.Name)
+		}
+		if err != nil {
+			return imp.report, fmt.Errorf("failed to import %s: %w", hdr.Name, err)
+		}
+	}
+
+	return imp.report, nil
+}
+
+type importer struct {
+	d      storage.Database
+	u      models.User
+	report ImportReport
+	// feeds maps URLs of the user's feeds to the feed.
+	feeds map[string]models.Feed
+	// favicons maps archive entry names to the favicon stored in them.
+	favicons map[string]favicon
+	// existing maps feed IDs to the user's articles in that feed by link.
+	existing map[int64]map[string]models.Article
+}
+
+func (imp *importer) readManifest(r io.Reader) error {
+	var m manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return err
+	}
+	if m.Version < 1 || m.Version > Version {
+		return fmt.Errorf("unsupported archive version %d", m.Version)
+	}
+	log.Infof("Importing archive of %s created at %s", m.Username, m.Created)
+	return nil
+}
+
+func (imp *importer) importSubscriptions(r io.Reader) error {
+	o, err := opml.Parse(r)
+	if err != nil {
+		return err
+	}
+	imp.report.Subscriptions, err = imp.d.ImportOpmlForUser(imp.u, o)
+	if err != nil {
+		return err
+	}
+	// Reload feeds to pick up the ones that were just created.
+	imp.feeds = nil
+	return nil
+}
+
+func (imp *importer) importPreferences(r io.Reader) error {
+	var p preferences
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return err
+	}
+	if len(p.MuteWords) == 0 {
+		return nil
+	}
+	if err := imp.d.UpdateMuteWordsForUser(imp.u, p.MuteWords); err != nil {
+		return err
+	}
+	imp.report.MuteWords = len(p.MuteWords)
+	return nil
+}
+
+func (imp *importer) readFaviconIndex(r io.Reader) error {
+	imp.favicons = map[string]favicon{}
+	return readLines(r, func(line []byte) error {
+		var f favicon
+		if err := json.Unmarshal(line, &f); err != nil {
+			return err
+		}
+		imp.favicons[f.File] = f
+		return nil
+	})
+}
+
+func (imp *importer) importFavicon(name string, r io.Reader) error {
+	fav, ok := imp.favicons[name]
+	if !ok {
+		log.Warningf("Skipping favicon not in index: %s", name)
+		return nil
+	}
+	feed, ok, err := imp.feed(fav.FeedURL)
+	if err != nil || !ok {
+		return err
+	}
+
+	img, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err = imp.d.InsertFaviconForUser(imp.u, feed.FolderID, feed.ID, fav.MIME, img); err != nil {
+		return err
+	}
+	imp.report.Favicons++
+	return nil
+}
+
+func (imp *importer) importArticles(r io.Reader) error {
+	return readLines(r, func(line []byte) error {
+		var a article
+		if err := json.Unmarshal(line, &a); err != nil {
+			return err
+		}
+		return imp.importArticle(a)
+	})
+}
+
+func (imp *importer) importArticle(a article) error {
+	feed, ok, err := imp.feed(a.FeedURL)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		imp.report.SkippedArticles++
+		return nil
+	}
+
+	existing, err := imp.existingArticles(feed.ID)
+	if err != nil {
+		return err
+	}
+	if e, ok := existing[a.Link]; ok && a.Link != "" {
+		updated := false
+		if e.Read != a.Read {
+			mark := models.MarkActionUnread
+			if a.Read {
+				mark = models.MarkActionRead
+			}
+			if err = imp.d.MarkArticleForUser(imp.u, e.ID, mark); err != nil {
+				return err
+			}
+			updated = true
+		}
+		if e.Saved != a.Saved {
+			if err = imp.markSaved(e.ID, a.Saved); err != nil {
+				return err
+			}
+			updated = true
+		}
+		if updated {
+			imp.report.UpdatedArticles++
+		}
+		return nil
+	}
+
+	id, err := imp.d.InsertArticleForUser(imp.u, models.Article{
+		FeedID:    feed.ID,
+		FolderID:  feed.FolderID,
+		Title:     a.Title,
+		Summary:   a.Summary,
+		Content:   a.Content,
+		Parsed:    a.Parsed,
+		Link:      a.Link,
+		Read:      a.Read,
+		Date:      a.Date,
+		Retrieved: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if id == 0 {
+		// An identical article already exists.
+		return nil
+	}
+	if a.Saved {
+		// Mark rather than insert as saved so that the save time is recorded.
+		if err = imp.markSaved(id, true); err != nil {
+			return err
+		}
+	}
+	if a.Link != "" {
+		existing[a.Link] = models.Article{ID: id, Read: a.Read, Saved: a.Saved}
+	}
+	imp.report.CreatedArticles++
+	return nil
+}
+
+func (imp *importer) markSaved(id int64, saved bool) error {
+	mark := models.MarkActionUnsaved
+	if saved {
+		mark = models.MarkActionSaved
+	}
+	return imp.d.MarkArticleForUser(imp.u, id, mark)
+}
+
+// feed returns the user's feed with the given URL and whether it exists.
+func (imp *importer) feed(url string) (models.Feed, bool, error) {
+	if imp.feeds == nil {
+		feeds, err := imp.d.GetAllFeedsForUser(imp.u)
+		if err != nil {
+			return models.Feed{}, false, err
+		}
+		imp.feeds = map[string]models.Feed{}
+		for _, f := range feeds {
+			imp.feeds[f.URL] = f
+		}
+	}
+	f, ok := imp.feeds[url]
+	return f, ok, nil
+}
+
+func (imp *importer) existingArticles(feedID int64) (map[string]models.Article, error) {
+	if imp.existing == nil {
+		imp.existing = map[int64]map[string]models.Article{}
+	}
+	if m, ok := imp.existing[feedID]; ok {
+		return m, nil
+	}
+
+	articles, err := imp.d.GetArticlesForFeedForUser(imp.u, feedID)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]models.Article{}
+	for _, a := range articles {
+		if a.Link != "" {
+			m[a.Link] = a
+		}
+	}
+	imp.existing[feedID] = m
+	return m, nil
+}
+
+func readLines(r io.Reader, fn func([]byte) error) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for s.Scan() {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(s.Bytes()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
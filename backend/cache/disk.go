@@ -0,0 +1,351 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	entriesDir = "entries"
+	blobsDir   = "blobs"
+	tmpDir     = "tmp"
+	// sweepInterval is the minimum interval between scans for expired entries.
+	sweepInterval = time.Minute
+)
+
+// cachedResponse is the part of a proxied response kept in the cache besides
+// its body.
+type cachedResponse struct {
+	URL          string `json:"url"`
+	Blob         string `json:"blob"`
+	ContentType  string `json:"content_type,omitempty"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	// ContentRange is set for partial content of streamed media.
+	ContentRange string    `json:"content_range,omitempty"`
+	Stored       time.Time `json:"stored"`
+}
+
+type diskEntry struct {
+	key  string
+	resp cachedResponse
+}
+
+type blobInfo struct {
+	size int64
+	refs int
+}
+
+// diskCache is a content-addressed cache of proxied responses on disk. Each
+// body is stored once under the SHA-256 hash of its content and is referenced
+// by one entry per URL with the response headers. Entries older than the
+// maximum age are dropped, and the least recently used entries are evicted
+// when the bodies exceed the maximum size.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu        sync.Mutex
+	lru       *list.List // of *diskEntry, most recently used first
+	entries   map[string]*list.Element
+	blobs     map[string]*blobInfo
+	size      int64
+	lastSweep time.Time
+}
+
+// newDiskCache opens the cache in the given directory, creating it if needed,
+// and loads the entries already stored there.
+func newDiskCache(dir string, maxBytes int64, maxAge time.Duration) (*diskCache, error) {
+	for _, d := range []string{entriesDir, blobsDir, tmpDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+
+	c := &diskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		lru:      list.New(),
+		entries:  map[string]*list.Element{},
+		blobs:    map[string]*blobInfo{},
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictLocked(time.Now())
+	return c, nil
+}
+
+// load reads the entries in the cache directory, most recently used first by
+// the modification time of their files, and removes anything not referenced.
+func (c *diskCache) load() error {
+	tmp, _ := os.ReadDir(filepath.Join(c.dir, tmpDir))
+	for _, f := range tmp {
+		_ = os.Remove(filepath.Join(c.dir, tmpDir, f.Name()))
+	}
+
+	files, err := os.ReadDir(filepath.Join(c.dir, entriesDir))
+	if err != nil {
+		return fmt.Errorf("failed to read cache entries: %w", err)
+	}
+
+	type loaded struct {
+		e    *diskEntry
+		used time.Time
+	}
+	var all []loaded
+	for _, f := range files {
+		path := filepath.Join(c.dir, entriesDir, f.Name())
+		key, ok := strings.CutSuffix(f.Name(), ".json")
+		info, err := f.Info()
+		if !ok || err != nil {
+			_ = os.Remove(path)
+			continue
+		}
+		b, err := os.ReadFile(path)
+		var resp cachedResponse
+		if err == nil {
+			err = json.Unmarshal(b, &resp)
+		}
+		if err != nil || resp.Blob == "" {
+			log.Warningf("Removing invalid image cache entry %s: %v", path, err)
+			_ = os.Remove(path)
+			continue
+		}
+		all = append(all, loaded{&diskEntry{key: key, resp: resp}, info.ModTime()})
+	}
+	// Sort by last use so that the list is most recently used first.
+	sort.Slice(all, func(i, j int) bool { return all[i].used.After(all[j].used) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, l := range all {
+		b, ok := c.blobs[l.e.resp.Blob]
+		if !ok {
+			info, err := os.Stat(c.blobPath(l.e.resp.Blob))
+			if err != nil {
+				_ = os.Remove(c.entryPath(l.e.key))
+				continue
+			}
+			b = &blobInfo{size: info.Size()}
+			c.blobs[l.e.resp.Blob] = b
+			c.size += b.size
+		}
+		b.refs++
+		c.entries[l.e.key] = c.lru.PushBack(l.e)
+	}
+
+	blobs, _ := os.ReadDir(filepath.Join(c.dir, blobsDir))
+	for _, f := range blobs {
+		if _, ok := c.blobs[f.Name()]; !ok {
+			_ = os.Remove(filepath.Join(c.dir, blobsDir, f.Name()))
+		}
+	}
+	return nil
+}
+
+func (c *diskCache) entryPath(key string) string {
+	return filepath.Join(c.dir, entriesDir, key+".json")
+}
+
+func (c *diskCache) blobPath(blob string) string {
+	return filepath.Join(c.dir, blobsDir, blob)
+}
+
+func urlKey(url string) string {
+	h := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(h[:])
+}
+
+// open returns the cached response for the given URL and its body, which the
+// caller must close. The entry is marked as most recently used.
+func (c *diskCache) open(url string) (cachedResponse, *os.File, bool) {
+	key := urlKey(url)
+	now := time.Now()
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.mu.Unlock()
+		return cachedResponse{}, nil, false
+	}
+	e := elem.Value.(*diskEntry)
+	if c.expired(e, now) {
+		c.removeLocked(elem)
+		c.mu.Unlock()
+		return cachedResponse{}, nil, false
+	}
+	c.lru.MoveToFront(elem)
+	resp := e.resp
+	c.mu.Unlock()
+
+	// The modification time of the entry is its last use across restarts.
+	_ = os.Chtimes(c.entryPath(key), now, now)
+
+	// The body may have been evicted since the lookup, which is a miss.
+	f, err := os.Open(c.blobPath(resp.Blob))
+	if err != nil {
+		return cachedResponse{}, nil, false
+	}
+	return resp, f, true
+}
+
+func (c *diskCache) expired(e *diskEntry, now time.Time) bool {
+	return c.maxAge > 0 && now.Sub(e.resp.Stored) > c.maxAge
+}
+
+// removeLocked removes an entry and its body if no other entry refers to it.
+func (c *diskCache) removeLocked(elem *list.Element) {
+	e := c.lru.Remove(elem).(*diskEntry)
+	delete(c.entries, e.key)
+	_ = os.Remove(c.entryPath(e.key))
+
+	b := c.blobs[e.resp.Blob]
+	b.refs--
+	if b.refs == 0 {
+		delete(c.blobs, e.resp.Blob)
+		c.size -= b.size
+		_ = os.Remove(c.blobPath(e.resp.Blob))
+	}
+}
+
+// evictLocked removes expired entries and then the least recently used
+// entries until the cache fits in its maximum size.
+func (c *diskCache) evictLocked(now time.Time) {
+	if now.Sub(c.lastSweep) >= sweepInterval {
+		c.lastSweep = now
+		for elem := c.lru.Front(); elem != nil; {
+			next := elem.Next()
+			if c.expired(elem.Value.(*diskEntry), now) {
+				c.removeLocked(elem)
+			}
+			elem = next
+		}
+	}
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// create returns a writer for the body of a response to store for the given
+// URL. The response is only stored once the writer is committed.
+func (c *diskCache) create(url string, resp cachedResponse) (*cacheWriter, error) {
+	f, err := os.CreateTemp(filepath.Join(c.dir, tmpDir), "body-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %w", err)
+	}
+	resp.URL = url
+	return &cacheWriter{c: c, f: f, h: sha256.New(), resp: resp}, nil
+}
+
+// store stores a response with the given body for the given URL.
+func (c *diskCache) store(url string, resp cachedResponse, body []byte) error {
+	cw, err := c.create(url, resp)
+	if err != nil {
+		return err
+	}
+	_, _ = cw.Write(body)
+	return cw.commit()
+}
+
+// cacheWriter writes the body of a response to the cache. Writes never fail so
+// that it can be used with io.TeeReader; instead, the response is not stored
+// if writing fails or the body is too large to be cached.
+type cacheWriter struct {
+	c    *diskCache
+	f    *os.File
+	h    hash.Hash
+	n    int64
+	err  error
+	resp cachedResponse
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return len(p), nil
+	}
+	cw.n += int64(len(p))
+	if cw.n > cw.c.maxBytes {
+		cw.err = errors.New("response is larger than the cache")
+		return len(p), nil
+	}
+	if _, err := cw.f.Write(p); err != nil {
+		cw.err = err
+		return len(p), nil
+	}
+	cw.h.Write(p)
+	return len(p), nil
+}
+
+// abort discards the response.
+func (cw *cacheWriter) abort() {
+	_ = cw.f.Close()
+	_ = os.Remove(cw.f.Name())
+}
+
+// commit stores the response, replacing any entry for the same URL, and evicts
+// entries as needed.
+func (cw *cacheWriter) commit() error {
+	defer cw.abort()
+	if cw.err != nil {
+		return cw.err
+	}
+	if err := cw.f.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	c := cw.c
+	key := urlKey(cw.resp.URL)
+	cw.resp.Blob = hex.EncodeToString(cw.h.Sum(nil))
+	cw.resp.Stored = time.Now()
+	b, err := json.Marshal(cw.resp)
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	blob, ok := c.blobs[cw.resp.Blob]
+	if !ok {
+		if err = os.Rename(cw.f.Name(), c.blobPath(cw.resp.Blob)); err != nil {
+			return fmt.Errorf("failed to store cache file: %w", err)
+		}
+		blob = &blobInfo{size: cw.n}
+		c.blobs[cw.resp.Blob] = blob
+		c.size += blob.size
+	}
+	blob.refs++
+	e := &diskEntry{key: key, resp: cw.resp}
+	c.entries[key] = c.lru.PushFront(e)
+
+	if err = os.WriteFile(c.entryPath(key), b, 0644); err != nil {
+		c.removeLocked(c.entries[key])
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	c.evictLocked(cw.resp.Stored)
+	return nil
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func put(t *testing.T, c *diskCache, url, body string) {
+	t.Helper()
+	cw, err := c.create(url, cachedResponse{ContentType: "image/png"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, _ = io.WriteString(cw, body)
+	if err = cw.commit(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func get(c *diskCache, url string) (string, bool) {
+	_, f, ok := c.open(url)
+	if !ok {
+		return "", false
+	}
+	defer func() { _ = f.Close() }()
+	b, _ := io.ReadAll(f)
+	return string(b), true
+}
+
+func TestDiskCache(t *testing.T) {
+	t.Run("stores and loads responses", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := newDiskCache(dir, 100, time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		put(t, c, "http://example.com/a.png", "aaaa")
+		if body, ok := get(c, "http://example.com/a.png"); !ok || body != "aaaa" {
+			t.Errorf("expected cached body, got %q (%t)", body, ok)
+		}
+		if _, ok := get(c, "http://example.com/b.png"); ok {
+			t.Errorf("expected miss for unknown URL")
+		}
+
+		c, err = newDiskCache(dir, 100, time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cached, f, ok := c.open("http://example.com/a.png")
+		if !ok {
+			t.Fatalf("expected entry to be loaded from disk")
+		}
+		_ = f.Close()
+		if cached.ContentType != "image/png" || cached.URL != "http://example.com/a.png" {
+			t.Errorf("unexpected entry: %+v", cached)
+		}
+	})
+
+	t.Run("stores identical bodies once", func(t *testing.T) {
+		dir := t.TempDir()
+		c, _ := newDiskCache(dir, 100, time.Hour)
+
+		put(t, c, "http://example.com/a.png", "same")
+		put(t, c, "http://example.com/b.png", "same")
+
+		blobs, _ := os.ReadDir(filepath.Join(dir, blobsDir))
+		if len(blobs) != 1 || c.size != 4 {
+			t.Errorf("expected one body of 4 bytes, got %d bodies of %d bytes", len(blobs), c.size)
+		}
+
+		c.mu.Lock()
+		c.removeLocked(c.entries[urlKey("http://example.com/a.png")])
+		c.mu.Unlock()
+		if body, ok := get(c, "http://example.com/b.png"); !ok || body != "same" {
+			t.Errorf("expected body to be kept while referenced, got %q (%t)", body, ok)
+		}
+	})
+
+	t.Run("evicts least recently used", func(t *testing.T) {
+		c, _ := newDiskCache(t.TempDir(), 10, time.Hour)
+
+		put(t, c, "http://example.com/a.png", "aaaa")
+		put(t, c, "http://example.com/b.png", "bbbb")
+		get(c, "http://example.com/a.png")
+		put(t, c, "http://example.com/c.png", "cccc")
+
+		if _, ok := get(c, "http://example.com/b.png"); ok {
+			t.Errorf("expected least recently used entry to be evicted")
+		}
+		for _, url := range []string{"http://example.com/a.png", "http://example.com/c.png"} {
+			if _, ok := get(c, url); !ok {
+				t.Errorf("expected %s to be cached", url)
+			}
+		}
+		if c.size != 8 {
+			t.Errorf("expected size of 8, got %d", c.size)
+		}
+	})
+
+	t.Run("expires old entries", func(t *testing.T) {
+		c, _ := newDiskCache(t.TempDir(), 100, time.Hour)
+
+		put(t, c, "http://example.com/a.png", "aaaa")
+		c.entries[urlKey("http://example.com/a.png")].Value.(*diskEntry).resp.Stored = time.Now().Add(-2 * time.Hour)
+
+		if _, ok := get(c, "http://example.com/a.png"); ok {
+			t.Errorf("expected expired entry to be a miss")
+		}
+		if c.size != 0 {
+			t.Errorf("expected expired entry to be removed, size is %d", c.size)
+		}
+	})
+
+	t.Run("does not store bodies larger than the cache", func(t *testing.T) {
+		c, _ := newDiskCache(t.TempDir(), 4, time.Hour)
+
+		cw, _ := c.create("http://example.com/a.png", cachedResponse{})
+		_, _ = io.WriteString(cw, "too large")
+		if err := cw.commit(); err == nil {
+			t.Errorf("expected error")
+		}
+		if _, ok := get(c, "http://example.com/a.png"); ok {
+			t.Errorf("expected large body not to be cached")
+		}
+	})
+}
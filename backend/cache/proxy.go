@@ -1,28 +1,115 @@
 package cache
 
 import (
+	"bufio"
+	"flag"
+	"fmt"
 	"html"
 	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/golang/glog"
 	"github.com/jrupac/goliath/utils"
 )
 
+var (
+	imageCacheDir      = flag.String("imageCacheDir", "", "Directory to cache proxied images in. Images are not cached if not set.")
+	imageCacheMaxBytes = flag.Int64("imageCacheMaxBytes", 1<<30, "Maximum total size in bytes of cached images.")
+	imageCacheMaxAge   = flag.Duration("imageCacheMaxAge", 30*24*time.Hour, "Maximum age of cached images.")
+	imageProxyMaxBytes = flag.Int64("imageProxyMaxBytes", 20<<20, "Maximum size in bytes of a proxied image.")
+)
+
+// defaultCacheControl is sent to clients if the origin did not limit how long
+// its response may be cached. The proxy requires authentication, so responses
+// must not be cached by shared caches.
+const defaultCacheControl = "private, max-age=86400"
+
+// ContentSecurityPolicy prevents proxied or archived content from running
+// scripts (e.g., in SVG images) if it is opened directly, since it is served
+// from the same origin as the application.
+const ContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; sandbox"
+
+// cacheEndpoint is the last element of the path of image proxy URLs.
+const cacheEndpoint = "cache"
+
+// SniffLen is the number of bytes used to detect the content type of a
+// response if the origin did not send a specific one. Readers passed to
+// DetectContentType must buffer at least this many bytes.
+const SniffLen = 512
+
 type imageProxy struct {
 	Client *http.Client
+	// MediaClient fetches streamed media, which may take arbitrarily long.
+	MediaClient *http.Client
+	cache       *diskCache
 }
 
 // NewImageProxy returns an HTTP handler that serves as a reverse image
 // proxy for the given request. Cookie verification is already handled by the
-// time the request arrives here.
+// time the request arrives here, and only URLs signed with SignURL are
+// proxied. Images are fetched with SSRF protection and, if a cache directory
+// is set, cached on disk. Requests with a "stream" parameter are proxied as
+// media instead, see serveStream.
 func NewImageProxy() http.Handler {
+	return newImageProxy()
+}
+
+func newImageProxy() *imageProxy {
 	return &imageProxy{
-		Client: &http.Client{
-			Timeout: 5 * time.Second,
-		},
+		Client:      utils.NewSafeClient(5 * time.Second),
+		MediaClient: utils.NewSafeClient(0),
+		cache:       sharedDiskCache(),
+	}
+}
+
+var (
+	diskCacheOnce sync.Once
+	diskCacheErr  error
+	diskCacheInst *diskCache
+
+	defaultProxyOnce sync.Once
+	defaultProxy     *imageProxy
+)
+
+// sharedDiskCache returns the cache of proxied images if a cache directory is
+// set. There is a single cache per process since it tracks the size of its
+// directory in memory.
+func sharedDiskCache() *diskCache {
+	if *imageCacheDir == "" {
+		return nil
+	}
+	diskCacheOnce.Do(func() {
+		diskCacheInst, diskCacheErr = newDiskCache(*imageCacheDir, *imageCacheMaxBytes, *imageCacheMaxAge)
+		if diskCacheErr != nil {
+			log.Warningf("Not caching proxied images: %s", diskCacheErr)
+		}
+	})
+	return diskCacheInst
+}
+
+// FetchImage returns the image at the given URL and its content type from the
+// cache of the image proxy, or from its origin with the same checks as
+// proxied images, in which case it is cached.
+func FetchImage(target string) ([]byte, string, error) {
+	defaultProxyOnce.Do(func() { defaultProxy = newImageProxy() })
+	b, cached, err := defaultProxy.original(OriginURL(target))
+	return b, cached.ContentType, err
+}
+
+// OriginURL returns the URL proxied by the given image proxy URL, or the URL
+// itself if it does not point at the proxy.
+func OriginURL(proxied string) string {
+	u, err := url.Parse(proxied)
+	if err != nil || !strings.HasSuffix(u.Path, "/"+cacheEndpoint) || u.Query().Get("url") == "" {
+		return proxied
 	}
+	return u.Query().Get("url")
 }
 
 // AuthErrorRedirect redirects the user to the original proxied URL with a HTTP
@@ -47,41 +134,302 @@ func (p *imageProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	target := html.UnescapeString(val)
+	if !validSignature(target, r.URL.Query().Get("sig")) {
+		// Links in articles fetched before proxy URLs were signed, or signed with
+		// another key, are not proxied but still load from the origin.
+		log.V(2).Infof("Redirecting request with invalid signature to origin: %s", target)
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	if r.URL.Query().Has("stream") {
+		p.serveStream(w, r, target)
+		return
+	}
 
-	// TODO: Check cache here.
+	width, quality, err := variantParams(r.URL.Query())
+	if err != nil {
+		log.Warningf("Invalid proxy request for %s: %s", target, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if width > 0 {
+		p.serveVariant(w, r, target, width, quality)
+		return
+	}
+
+	if p.cache != nil {
+		if cached, f, ok := p.cache.open(target); ok {
+			defer func() { _ = f.Close() }()
+			log.V(2).Infof("Serving cached response for: %s", target)
+			serveCached(w, r, cached, f)
+			return
+		}
+	}
 
 	log.V(2).Infof("Proxying request to: %s", target)
 
-	resp, err := p.Client.Get(target)
+	o, err := p.fetch(target)
 	if err != nil {
 		log.Warningf("Failed to proxy request: %s", err)
 		w.WriteHeader(http.StatusBadGateway)
 		return
 	}
+	defer func() { _ = o.resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Warningf("Proxy target returned non-200 status: %d", resp.StatusCode)
-		w.WriteHeader(http.StatusBadGateway)
-		return
+	setHeaders(w.Header(), o.cached)
+
+	var cw *cacheWriter
+	if p.cache != nil && cacheable(o.cached.CacheControl) {
+		if cw, err = p.cache.create(target, o.cached); err != nil {
+			log.Warningf("Not caching %s: %s", target, err)
+		}
 	}
 
-	// TODO: Write to cache here.
+	body := io.Reader(o.body)
+	if cw != nil {
+		body = io.TeeReader(o.body, cw)
+	}
 
-	if resp == nil {
-		log.Fatalf("Response should not be nil when there is not error.")
+	if notModified(r, o.cached) {
+		w.WriteHeader(http.StatusNotModified)
+		if cw == nil {
+			return
+		}
+		// Still read the body so that the next request is served from the cache.
+		_, err = io.Copy(io.Discard, body)
+	} else {
+		if o.resp.ContentLength >= 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(o.resp.ContentLength, 10))
+		}
+		_, err = io.Copy(w, body)
 	}
+	o.finish(target, cw, err)
+}
+
+// origin is a response from the origin of a proxied image.
+type origin struct {
+	resp *http.Response
+	// body reads the response body, cut off after limit bytes.
+	body   *io.LimitedReader
+	limit  int64
+	cached cachedResponse
+}
 
-	b, err := io.ReadAll(resp.Body)
+// fetch requests the image at the given URL and checks that the response is an
+// image that is not too large. The caller must close the response body.
+func (p *imageProxy) fetch(target string) (*origin, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
 	if err != nil {
-		log.Warningf("Could not read proxied response: %s", err)
-		w.WriteHeader(http.StatusBadGateway)
-		return
+		return nil, err
+	}
+	return p.do(p.Client, req, *imageProxyMaxBytes, func(mediaType string) bool {
+		return strings.HasPrefix(mediaType, "image/")
+	})
+}
+
+// rangeError is returned by do if the origin cannot satisfy the requested
+// range, for instance because it starts past the end of the media.
+type rangeError struct {
+	contentRange string
+}
+
+func (e *rangeError) Error() string {
+	return fmt.Sprintf("proxy target cannot satisfy range: %q", e.contentRange)
+}
+
+// do sends the request to the origin and checks that the response has an
+// allowed media type and is at most maxBytes long. Partial content is accepted
+// if the request has a Range header, and a *rangeError is returned if that
+// range cannot be satisfied. The caller must close the response body.
+func (p *imageProxy) do(client *http.Client, req *http.Request, maxBytes int64, allowed func(mediaType string) bool) (*origin, error) {
+	target := req.URL.String()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && req.Header.Get("Range") != "" {
+		_ = resp.Body.Close()
+		return nil, &rangeError{contentRange: resp.Header.Get("Content-Range")}
+	}
+
+	partial := resp.StatusCode == http.StatusPartialContent && req.Header.Get("Range") != ""
+	if resp.StatusCode != http.StatusOK && !partial {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("proxy target returned non-200 status: %d", resp.StatusCode)
+	}
+
+	if resp.ContentLength > maxBytes {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("proxy target %s is too large: %d bytes", target, resp.ContentLength)
+	}
+
+	br := bufio.NewReaderSize(resp.Body, SniffLen)
+	contentType, mediaType := DetectContentType(resp.Header.Get("Content-Type"), br)
+	if !allowed(mediaType) {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("proxy target %s has unsupported type: %s", target, contentType)
+	}
+
+	cached := cachedResponse{
+		ContentType:  contentType,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		CacheControl: resp.Header.Get("Cache-Control"),
+	}
+	if partial {
+		cached.ContentRange = resp.Header.Get("Content-Range")
 	}
+	return &origin{
+		resp:   resp,
+		body:   &io.LimitedReader{R: br, N: maxBytes + 1},
+		limit:  maxBytes,
+		cached: cached,
+	}, nil
+}
 
-	_, err = w.Write(b)
+// finish completes a response copied from the origin, which failed with the
+// given error if not nil, and stores it in the cache if it is being written to
+// one.
+func (o *origin) finish(target string, cw *cacheWriter, err error) {
+	if err == nil && o.body.N == 0 {
+		err = fmt.Errorf("response is larger than %d bytes", o.limit)
+	}
 	if err != nil {
 		log.Warningf("Could not write proxied response back to client: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		if cw != nil {
+			cw.abort()
+		}
 		return
 	}
+
+	if cw != nil {
+		if err = cw.commit(); err != nil {
+			log.V(2).Infof("Not caching %s: %s", target, err)
+		}
+	}
+}
+
+// serveCached writes a cached response, handling conditional requests.
+func serveCached(w http.ResponseWriter, r *http.Request, cached cachedResponse, f io.ReadSeeker) {
+	// Bodies are content-addressed, so their hash is a strong validator if the
+	// origin did not send one.
+	if cached.ETag == "" {
+		cached.ETag = `"` + cached.Blob + `"`
+	}
+	setHeaders(w.Header(), cached)
+
+	modTime, err := http.ParseTime(cached.LastModified)
+	if err != nil {
+		modTime = time.Time{}
+	}
+	http.ServeContent(w, r, "", modTime, f)
+}
+
+func setHeaders(h http.Header, cached cachedResponse) {
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", ContentSecurityPolicy)
+	if cached.ContentType != "" {
+		h.Set("Content-Type", cached.ContentType)
+	}
+	if cached.ETag != "" {
+		h.Set("ETag", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		h.Set("Last-Modified", cached.LastModified)
+	}
+	h.Set("Cache-Control", privateCacheControl(cached.CacheControl))
+	if cached.ContentRange != "" {
+		h.Set("Content-Range", cached.ContentRange)
+	}
+}
+
+// DetectContentType returns the content type of a response and its media
+// type, detecting it from the start of the body if the origin did not send a
+// specific one.
+func DetectContentType(header string, br *bufio.Reader) (string, string) {
+	contentType := header
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "application/octet-stream" {
+		b, _ := br.Peek(SniffLen)
+		contentType = http.DetectContentType(b)
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	return contentType, mediaType
+}
+
+// imageExtensions maps the image types that are stored as files, such as in
+// the archive or in EPUB books, to the extension of their files.
+var imageExtensions = map[string]string{
+	"image/jpeg":    ".jpg",
+	"image/png":     ".png",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+}
+
+// ImageExtension returns the extension of files of images of the given media
+// type, and false if images of that type are not stored as files.
+func ImageExtension(mediaType string) (string, bool) {
+	ext, ok := imageExtensions[mediaType]
+	return ext, ok
+}
+
+// privateCacheControl returns the Cache-Control header sent to clients for the
+// given Cache-Control header of the origin. Only its max-age, no-store and
+// no-cache directives are kept, and responses are always private since the
+// proxy requires authentication.
+func privateCacheControl(cacheControl string) string {
+	var kept []string
+	for _, d := range strings.Split(cacheControl, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "no-store" || d == "no-cache" || strings.HasPrefix(d, "max-age=") {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == 0 {
+		return defaultCacheControl
+	}
+	return "private, " + strings.Join(kept, ", ")
+}
+
+// cacheable returns true if the Cache-Control header of the origin allows the
+// response to be stored.
+func cacheable(cacheControl string) bool {
+	for _, d := range strings.Split(cacheControl, ",") {
+		if strings.EqualFold(strings.TrimSpace(d), "no-store") {
+			return false
+		}
+	}
+	return true
+}
+
+// notModified returns true if the conditional headers of the request match the
+// response, in which case the client's copy is still valid.
+func notModified(r *http.Request, cached cachedResponse) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if cached.ETag == "" {
+			return false
+		}
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(cached.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(cached.LastModified)
+	return err == nil && !lm.After(ims)
 }
@@ -7,8 +7,14 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
+// proxyPath returns the signed proxy path of the given URL.
+func proxyPath(target string) string {
+	return fmt.Sprintf("/cache?url=%s&sig=%s", url.QueryEscape(target), SignURL(target))
+}
+
 func TestImageProxy_ServeHTTP(t *testing.T) {
 	t.Run("no url parameter", func(t *testing.T) {
 		proxy := NewImageProxy()
@@ -25,6 +31,7 @@ func TestImageProxy_ServeHTTP(t *testing.T) {
 	t.Run("proxy success", func(t *testing.T) {
 		// Create a mock backend server
 		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
 			w.WriteHeader(http.StatusOK)
 			fmt.Fprint(w, "proxied content")
 		}))
@@ -33,7 +40,7 @@ func TestImageProxy_ServeHTTP(t *testing.T) {
 		proxy := NewImageProxy().(*imageProxy)
 		proxy.Client = backend.Client()
 
-		reqUrl := fmt.Sprintf("/cache?url=%s", url.QueryEscape(backend.URL))
+		reqUrl := proxyPath(backend.URL)
 		req := httptest.NewRequest("GET", reqUrl, nil)
 		rr := httptest.NewRecorder()
 
@@ -49,6 +56,102 @@ func TestImageProxy_ServeHTTP(t *testing.T) {
 		}
 	})
 
+	t.Run("invalid signature", func(t *testing.T) {
+		proxy := NewImageProxy()
+		reqUrl := fmt.Sprintf("/cache?url=%s&sig=%s", url.QueryEscape("http://example.com/a.png"), SignURL("http://example.com/b.png"))
+		rr := httptest.NewRecorder()
+
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", reqUrl, nil))
+
+		if rr.Code != http.StatusFound {
+			t.Errorf("expected status %d, got %d", http.StatusFound, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != "http://example.com/a.png" {
+			t.Errorf("expected redirect to origin, got %q", loc)
+		}
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		proxy := NewImageProxy()
+		rr := httptest.NewRecorder()
+
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/cache?url="+url.QueryEscape("http://example.com/a.png"), nil))
+
+		if rr.Code != http.StatusFound {
+			t.Errorf("expected status %d, got %d", http.StatusFound, rr.Code)
+		}
+	})
+
+	t.Run("invalid signature with non-HTTP URL", func(t *testing.T) {
+		proxy := NewImageProxy()
+		rr := httptest.NewRecorder()
+
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/cache?url="+url.QueryEscape("javascript:alert(1)"), nil))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("blocks private IPs", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "internal")
+		}))
+		defer backend.Close()
+
+		proxy := NewImageProxy()
+		rr := httptest.NewRecorder()
+
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", proxyPath(backend.URL), nil))
+
+		if rr.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+		}
+	})
+
+	for _, tc := range []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int64
+		status      int
+	}{
+		{"rejects non-images", "text/html", "<script>alert(1)</script>", 100, http.StatusBadGateway},
+		{"detects image type", "application/octet-stream", "GIF89a...", 100, http.StatusOK},
+		{"rejects large images", "image/png", "0123456789", 5, http.StatusBadGateway},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				fmt.Fprint(w, tc.body)
+			}))
+			defer backend.Close()
+
+			oldMaxBytes := *imageProxyMaxBytes
+			*imageProxyMaxBytes = tc.maxBytes
+			defer func() { *imageProxyMaxBytes = oldMaxBytes }()
+
+			proxy := NewImageProxy().(*imageProxy)
+			proxy.Client = backend.Client()
+			rr := httptest.NewRecorder()
+
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", proxyPath(backend.URL), nil))
+
+			if rr.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rr.Code)
+			}
+			if rr.Code == http.StatusOK {
+				if got := rr.Header().Get("Content-Type"); got != "image/gif" {
+					t.Errorf("expected detected content type, got %q", got)
+				}
+				if rr.Header().Get("Content-Security-Policy") == "" || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+					t.Errorf("expected security headers, got %v", rr.Header())
+				}
+			}
+		})
+	}
+
 	t.Run("proxy backend fails", func(t *testing.T) {
 		// Create a mock backend server that always fails
 		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -59,7 +162,7 @@ func TestImageProxy_ServeHTTP(t *testing.T) {
 		proxy := NewImageProxy().(*imageProxy)
 		proxy.Client = backend.Client()
 
-		reqUrl := fmt.Sprintf("/cache?url=%s", url.QueryEscape(backend.URL))
+		reqUrl := proxyPath(backend.URL)
 		req := httptest.NewRequest("GET", reqUrl, nil)
 		rr := httptest.NewRecorder()
 
@@ -71,6 +174,89 @@ func TestImageProxy_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestImageProxy_Cache(t *testing.T) {
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		fmt.Fprint(w, "image data")
+	}))
+	defer backend.Close()
+
+	c, err := newDiskCache(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	proxy := &imageProxy{Client: backend.Client(), cache: c}
+	reqUrl := proxyPath(backend.URL)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", reqUrl, nil))
+
+		if rr.Code != http.StatusOK || rr.Body.String() != "image data" {
+			t.Fatalf("unexpected response %d: %q", rr.Code, rr.Body.String())
+		}
+		for h, v := range map[string]string{"Content-Type": "image/png", "ETag": `"v1"`, "Cache-Control": "private, max-age=3600"} {
+			if got := rr.Header().Get(h); got != v {
+				t.Errorf("expected %s %q, got %q", h, v, got)
+			}
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected second request to be served from cache, got %d backend requests", requests)
+	}
+
+	req := httptest.NewRequest("GET", reqUrl, nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d, got %d", http.StatusNotModified, rr.Code)
+	}
+}
+
+func TestPrivateCacheControl(t *testing.T) {
+	for origin, expected := range map[string]string{
+		"":                                  defaultCacheControl,
+		"public":                            defaultCacheControl,
+		"public, max-age=3600":              "private, max-age=3600",
+		"max-age=60, s-maxage=3600, public": "private, max-age=60",
+		"No-Store":                          "private, no-store",
+		"private, no-cache":                 "private, no-cache",
+	} {
+		if got := privateCacheControl(origin); got != expected {
+			t.Errorf("%q: expected %q, got %q", origin, expected, got)
+		}
+	}
+}
+
+func TestImageProxy_ConditionalWithoutCache(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		fmt.Fprint(w, "image data")
+	}))
+	defer backend.Close()
+
+	proxy := NewImageProxy().(*imageProxy)
+	proxy.Client = backend.Client()
+
+	req := httptest.NewRequest("GET", proxyPath(backend.URL), nil)
+	req.Header.Set("If-Modified-Since", "Tue, 03 Jan 2006 15:04:05 GMT")
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected status %d, got %d", http.StatusNotModified, rr.Code)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != defaultCacheControl {
+		t.Errorf("expected default Cache-Control, got %q", got)
+	}
+}
+
 func TestAuthErrorRedirect(t *testing.T) {
 	t.Run("no url parameter", func(t *testing.T) {
 		req := httptest.NewRequest("GET", "/auth-error", nil)
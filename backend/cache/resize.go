@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/utils"
+)
+
+var (
+	imageProxyWidths = flag.String("imageProxyWidths", "320,640,960,1280,1920", "Comma-separated widths that proxied images can be resized to. Requested widths are rounded up to the next one. Resizing is disabled if empty.")
+)
+
+const (
+	// defaultImageQuality is the JPEG quality of resized images if none is
+	// requested.
+	defaultImageQuality = 80
+	// maxResizePixels is the maximum number of pixels of an image to resize,
+	// which bounds the memory used to decode it.
+	maxResizePixels = 40_000_000
+)
+
+// errNoResize is returned for images that are served as they are.
+var errNoResize = errors.New("image does not need to be resized")
+
+// VariantWidths returns the widths that proxied images can be resized to, in
+// increasing order.
+func VariantWidths() []int {
+	var widths []int
+	for _, f := range strings.Split(*imageProxyWidths, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(f))
+		if err == nil && w > 0 {
+			widths = append(widths, w)
+		}
+	}
+	slices.Sort(widths)
+	return slices.Compact(widths)
+}
+
+// variantParams returns the width and quality of the variant requested with
+// the "w" and "q" parameters. The width is rounded up to the next allowed
+// width, and is zero if no resizing is requested or resizing is disabled.
+func variantParams(q url.Values) (int, int, error) {
+	if q.Get("w") == "" {
+		return 0, 0, nil
+	}
+	width, err := strconv.Atoi(q.Get("w"))
+	if err != nil || width <= 0 {
+		return 0, 0, fmt.Errorf("invalid width: %s", q.Get("w"))
+	}
+	quality := defaultImageQuality
+	if q.Get("q") != "" {
+		quality, err = strconv.Atoi(q.Get("q"))
+		if err != nil || quality < 1 || quality > 100 {
+			return 0, 0, fmt.Errorf("invalid quality: %s", q.Get("q"))
+		}
+	}
+
+	widths := VariantWidths()
+	if len(widths) == 0 {
+		return 0, 0, nil
+	}
+	i, _ := slices.BinarySearch(widths, width)
+	return widths[min(i, len(widths)-1)], quality, nil
+}
+
+func variantKey(target string, width int, quality int) string {
+	return fmt.Sprintf("%s#w=%d&q=%d", target, width, quality)
+}
+
+// resizeImage scales the image down to the given width, keeping its aspect
+// ratio. Opaque images are encoded as JPEG with the given quality and others
+// as PNG. GIFs are not resized so that animations are kept.
+func resizeImage(b []byte, width int, quality int) ([]byte, string, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	if format == "gif" || cfg.Width <= width {
+		return nil, "", errNoResize
+	}
+	if cfg.Width*cfg.Height > maxResizePixels {
+		return nil, "", fmt.Errorf("image is too large to resize: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	resized := utils.ScaleImage(img, width, max(1, cfg.Height*width/cfg.Width))
+
+	var buf bytes.Buffer
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, resized)
+	return buf.Bytes(), "image/png", err
+}
+
+// serveVariant serves the image at the given URL resized to the given width
+// and caches the result. Images that cannot or need not be resized are served
+// as they are.
+func (p *imageProxy) serveVariant(w http.ResponseWriter, r *http.Request, target string, width int, quality int) {
+	key := variantKey(target, width, quality)
+	if p.cache != nil {
+		if cached, f, ok := p.cache.open(key); ok {
+			defer func() { _ = f.Close() }()
+			log.V(2).Infof("Serving cached %dpx variant of: %s", width, target)
+			serveCached(w, r, cached, f)
+			return
+		}
+	}
+
+	b, orig, err := p.original(target)
+	if err != nil {
+		log.Warningf("Failed to proxy request: %s", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	variant := orig
+	resized, contentType, err := resizeImage(b, width, quality)
+	if err == nil {
+		variant = cachedResponse{
+			ContentType:  contentType,
+			LastModified: orig.LastModified,
+			CacheControl: orig.CacheControl,
+		}
+	} else {
+		if !errors.Is(err, errNoResize) {
+			log.Warningf("Serving %s without resizing: %s", target, err)
+		}
+		resized = b
+	}
+	h := sha256.Sum256(resized)
+	variant.Blob = hex.EncodeToString(h[:])
+
+	if p.cache != nil && cacheable(orig.CacheControl) {
+		if err = p.cache.store(key, variant, resized); err != nil {
+			log.V(2).Infof("Not caching %dpx variant of %s: %s", width, target, err)
+		}
+	}
+	serveCached(w, r, variant, bytes.NewReader(resized))
+}
+
+// original returns the image at the given URL from the cache or from its
+// origin, caching it if needed.
+func (p *imageProxy) original(target string) ([]byte, cachedResponse, error) {
+	if p.cache != nil {
+		if cached, f, ok := p.cache.open(target); ok {
+			defer func() { _ = f.Close() }()
+			b, err := io.ReadAll(f)
+			return b, cached, err
+		}
+	}
+
+	o, err := p.fetch(target)
+	if err != nil {
+		return nil, cachedResponse{}, err
+	}
+	defer func() { _ = o.resp.Body.Close() }()
+
+	b, err := io.ReadAll(o.body)
+	if err != nil {
+		return nil, cachedResponse{}, fmt.Errorf("failed to read proxied response: %w", err)
+	}
+	if o.body.N == 0 {
+		return nil, cachedResponse{}, fmt.Errorf("proxy target %s is larger than %d bytes", target, o.limit)
+	}
+
+	if p.cache != nil && cacheable(o.cached.CacheControl) {
+		if err = p.cache.store(target, o.cached, b); err != nil {
+			log.V(2).Infof("Not caching %s: %s", target, err)
+		}
+	}
+	return b, o.cached, nil
+}
@@ -0,0 +1,143 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func encodePNG(t *testing.T, width, height int, alpha uint8) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: alpha})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVariantParams(t *testing.T) {
+	testCases := []struct {
+		query   string
+		width   int
+		quality int
+		wantErr bool
+	}{
+		{"", 0, 0, false},
+		{"w=100", 320, defaultImageQuality, false},
+		{"w=640&q=50", 640, 50, false},
+		{"w=700", 960, defaultImageQuality, false},
+		{"w=5000", 1920, defaultImageQuality, false},
+		{"w=-1", 0, 0, true},
+		{"w=640&q=101", 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			q, _ := url.ParseQuery(tc.query)
+			width, quality, err := variantParams(q)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if width != tc.width || quality != tc.quality {
+				t.Errorf("expected %d, %d, got %d, %d", tc.width, tc.quality, width, quality)
+			}
+		})
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	t.Run("converts opaque images to JPEG", func(t *testing.T) {
+		b, contentType, err := resizeImage(encodePNG(t, 800, 400, 255), 320, 80)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+		if err != nil || contentType != "image/jpeg" || format != "jpeg" {
+			t.Fatalf("expected JPEG, got %s (%s): %v", contentType, format, err)
+		}
+		if cfg.Width != 320 || cfg.Height != 160 {
+			t.Errorf("expected 320x160, got %dx%d", cfg.Width, cfg.Height)
+		}
+	})
+
+	t.Run("keeps transparent images as PNG", func(t *testing.T) {
+		_, contentType, err := resizeImage(encodePNG(t, 800, 400, 128), 320, 80)
+		if err != nil || contentType != "image/png" {
+			t.Errorf("expected PNG, got %s: %v", contentType, err)
+		}
+	})
+
+	t.Run("does not upscale", func(t *testing.T) {
+		if _, _, err := resizeImage(encodePNG(t, 200, 100, 255), 320, 80); !errors.Is(err, errNoResize) {
+			t.Errorf("expected errNoResize, got %v", err)
+		}
+	})
+
+	t.Run("does not resize GIFs", func(t *testing.T) {
+		var buf bytes.Buffer
+		_ = gif.Encode(&buf, image.NewPaletted(image.Rect(0, 0, 800, 400), color.Palette{color.Black}), nil)
+		if _, _, err := resizeImage(buf.Bytes(), 320, 80); !errors.Is(err, errNoResize) {
+			t.Errorf("expected errNoResize, got %v", err)
+		}
+	})
+
+	t.Run("fails on non-images", func(t *testing.T) {
+		if _, _, err := resizeImage([]byte("<svg></svg>"), 320, 80); err == nil || errors.Is(err, errNoResize) {
+			t.Errorf("expected decoding error, got %v", err)
+		}
+	})
+}
+
+func TestImageProxy_Variant(t *testing.T) {
+	original := encodePNG(t, 800, 400, 255)
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(original)
+	}))
+	defer backend.Close()
+
+	c, err := newDiskCache(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	proxy := &imageProxy{Client: backend.Client(), cache: c}
+
+	for _, path := range []string{proxyPath(backend.URL) + "&w=300", proxyPath(backend.URL) + "&w=320", proxyPath(backend.URL)} {
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+		cfg, _, err := image.DecodeConfig(rr.Body)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if path == proxyPath(backend.URL) {
+			if cfg.Width != 800 {
+				t.Errorf("expected original image, got width %d", cfg.Width)
+			}
+		} else if cfg.Width != 320 || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Errorf("expected 320px JPEG, got %dpx %s", cfg.Width, rr.Header().Get("Content-Type"))
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected original and variant to be served from cache, got %d backend requests", requests)
+	}
+}
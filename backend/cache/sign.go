@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"sync"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/storage"
+)
+
+const signingKeySecret = "proxy_signing_key"
+
+var (
+	proxySigningKey = flag.String("proxySigningKey", "", "Secret key used to sign image proxy URLs. If empty, a random key is generated and stored in the database.")
+)
+
+var (
+	signingKeyMu sync.Mutex
+	signingKey   []byte
+)
+
+// InitSigningKey sets up the key used to sign image proxy URLs. If no key is
+// configured, a random key is generated the first time and stored in the
+// database so that proxy URLs in fetched articles remain valid after restarts.
+func InitSigningKey(d storage.Database) error {
+	key := []byte(*proxySigningKey)
+	if len(key) == 0 {
+		generated := make([]byte, 32)
+		if _, err := rand.Read(generated); err != nil {
+			return fmt.Errorf("failed to generate proxy signing key: %w", err)
+		}
+		stored, err := d.GetOrInsertServerSecret(signingKeySecret, generated)
+		if err != nil {
+			return fmt.Errorf("failed to load proxy signing key: %w", err)
+		}
+		key = stored
+	}
+
+	signingKeyMu.Lock()
+	defer signingKeyMu.Unlock()
+	signingKey = key
+	return nil
+}
+
+func getSigningKey() []byte {
+	signingKeyMu.Lock()
+	defer signingKeyMu.Unlock()
+	if signingKey == nil {
+		log.Warningf("Proxy signing key was not initialized, using a random key.")
+		signingKey = make([]byte, 32)
+		_, _ = rand.Read(signingKey)
+	}
+	return signingKey
+}
+
+// SignURL returns the signature of the given URL to be proxied, which the
+// image proxy requires as the "sig" parameter along with the URL.
+func SignURL(target string) string {
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(target))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSignature returns true if the signature is valid for the given URL.
+func validSignature(target string, sig string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, getSigningKey())
+	mac.Write([]byte(target))
+	return hmac.Equal(b, mac.Sum(nil))
+}
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestInitSigningKey(t *testing.T) {
+	var stored []byte
+	db := &storage.MockDB{}
+	db.OnGetOrInsertServerSecret = func(name string, value []byte) ([]byte, error) {
+		if name != signingKeySecret {
+			t.Errorf("unexpected secret name %q", name)
+		}
+		if stored == nil {
+			stored = value
+		}
+		return stored, nil
+	}
+
+	if err := InitSigningKey(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	sig := SignURL("http://example.com/a.png")
+
+	// A restart generates a new key, but the stored one must be used instead.
+	if err := InitSigningKey(db); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !validSignature("http://example.com/a.png", sig) {
+		t.Errorf("expected signature to remain valid after reinitializing")
+	}
+}
@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+)
+
+var (
+	mediaProxyMaxBytes   = flag.Int64("mediaProxyMaxBytes", 2<<30, "Maximum number of bytes of streamed media sent in response to a single request.")
+	mediaProxyChunkBytes = flag.Int64("mediaProxyChunkBytes", 4<<20, "Number of bytes of streamed media requested from the origin for open-ended ranges.")
+)
+
+// serveStream proxies audio, video or images without buffering them. Single
+// byte ranges are passed through to the origin so that clients can seek, and
+// open-ended ranges are cut into chunks of a fixed size, which are cached.
+func (p *imageProxy) serveStream(w http.ResponseWriter, r *http.Request, target string) {
+	rng := streamRange(r.Header.Get("Range"), *mediaProxyChunkBytes)
+	key := streamKey(target, rng)
+
+	w.Header().Set("Accept-Ranges", "bytes")
+	if p.cache != nil && rng != "" {
+		if cached, f, ok := p.cache.open(key); ok {
+			defer func() { _ = f.Close() }()
+			log.V(2).Infof("Serving cached range %s of: %s", rng, target)
+			setHeaders(w.Header(), cached)
+			if info, err := f.Stat(); err == nil {
+				w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			if _, err := io.Copy(w, f); err != nil {
+				log.V(2).Infof("Could not write cached range back to client: %s", err)
+			}
+			return
+		}
+	}
+
+	log.V(2).Infof("Streaming range %q of: %s", rng, target)
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		log.Warningf("Failed to proxy request: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	o, err := p.do(p.MediaClient, req, *mediaProxyMaxBytes, streamable)
+	var re *rangeError
+	if errors.As(err, &re) {
+		log.V(2).Infof("Range %q of %s not satisfiable: %s", rng, target, re.contentRange)
+		if re.contentRange != "" {
+			w.Header().Set("Content-Range", re.contentRange)
+		}
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil {
+		log.Warningf("Failed to proxy request: %s", err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = o.resp.Body.Close() }()
+
+	setHeaders(w.Header(), o.cached)
+	if o.resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(o.resp.ContentLength, 10))
+	}
+
+	// Only partial content is cached, since whole media files would quickly
+	// evict everything else from the cache.
+	var cw *cacheWriter
+	if p.cache != nil && o.cached.ContentRange != "" && cacheable(o.cached.CacheControl) {
+		if cw, err = p.cache.create(key, o.cached); err != nil {
+			log.Warningf("Not caching %s: %s", key, err)
+		}
+	}
+
+	body := io.Reader(o.body)
+	if cw != nil {
+		body = io.TeeReader(o.body, cw)
+	}
+
+	w.WriteHeader(o.resp.StatusCode)
+	_, err = io.Copy(w, body)
+	o.finish(key, cw, err)
+}
+
+// streamable returns true for the media types that can be streamed.
+func streamable(mediaType string) bool {
+	for _, prefix := range []string{"audio/", "video/", "image/"} {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// streamRange returns the Range header to send to the origin for the given
+// Range header of a request. Open-ended ranges are limited to chunkBytes
+// bytes, which clients handle by requesting the rest once they need it.
+// Anything but a single byte range is dropped, in which case the whole
+// response is streamed.
+func streamRange(header string, chunkBytes int64) string {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return ""
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return ""
+	}
+
+	if first == "" {
+		// The last n bytes.
+		if n, err := strconv.ParseInt(last, 10, 64); err != nil || n <= 0 {
+			return ""
+		}
+		return "bytes=-" + last
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return ""
+	}
+	if last == "" {
+		if chunkBytes <= 0 {
+			return fmt.Sprintf("bytes=%d-", start)
+		}
+		return fmt.Sprintf("bytes=%d-%d", start, start+chunkBytes-1)
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%d-%d", start, end)
+}
+
+func streamKey(target string, rng string) string {
+	return fmt.Sprintf("%s#range=%s", target, strings.TrimPrefix(rng, "bytes="))
+}
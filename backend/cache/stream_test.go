@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStreamRange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		header   string
+		expected string
+	}{
+		{"no range", "", ""},
+		{"bounded range", "bytes=10-19", "bytes=10-19"},
+		{"open-ended range", "bytes=100-", "bytes=100-199"},
+		{"suffix range", "bytes=-50", "bytes=-50"},
+		{"multiple ranges", "bytes=0-9,20-29", ""},
+		{"invalid range", "bytes=20-10", ""},
+		{"other unit", "items=0-9", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := streamRange(tc.header, 100); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestImageProxy_Stream(t *testing.T) {
+	media := bytes.Repeat([]byte("0123456789"), 100)
+	var requests []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Get("Range"))
+		if r.URL.Path == "/page" {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<html></html>")
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(media))
+	}))
+	defer backend.Close()
+
+	oldChunkBytes := *mediaProxyChunkBytes
+	*mediaProxyChunkBytes = 100
+	defer func() { *mediaProxyChunkBytes = oldChunkBytes }()
+
+	c, err := newDiskCache(t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	proxy := &imageProxy{MediaClient: backend.Client(), cache: c}
+
+	stream := func(target, rng string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", proxyPath(target)+"&stream=1", nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		rr := httptest.NewRecorder()
+		proxy.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("passes through ranges", func(t *testing.T) {
+		rr := stream(backend.URL+"/a.mp3", "bytes=10-19")
+
+		if rr.Code != http.StatusPartialContent {
+			t.Fatalf("expected status %d, got %d", http.StatusPartialContent, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Range"); got != "bytes 10-19/1000" {
+			t.Errorf("unexpected Content-Range %q", got)
+		}
+		if rr.Body.String() != "0123456789" || rr.Header().Get("Accept-Ranges") != "bytes" {
+			t.Errorf("unexpected response %v: %q", rr.Header(), rr.Body.String())
+		}
+	})
+
+	t.Run("limits and caches open-ended ranges", func(t *testing.T) {
+		requests = nil
+		for i := 0; i < 2; i++ {
+			rr := stream(backend.URL+"/b.mp3", "bytes=500-")
+
+			if rr.Code != http.StatusPartialContent || rr.Body.Len() != 100 {
+				t.Fatalf("expected chunk of 100 bytes, got %d: %d bytes", rr.Code, rr.Body.Len())
+			}
+			if got := rr.Header().Get("Content-Range"); got != "bytes 500-599/1000" {
+				t.Errorf("unexpected Content-Range %q", got)
+			}
+		}
+		if len(requests) != 1 || requests[0] != "bytes=500-599" {
+			t.Errorf("expected one request for the chunk, got %q", requests)
+		}
+	})
+
+	t.Run("passes through unsatisfiable ranges", func(t *testing.T) {
+		rr := stream(backend.URL+"/a.mp3", "bytes=2000-")
+
+		if rr.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("expected status %d, got %d", http.StatusRequestedRangeNotSatisfiable, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Range"); got != "bytes */1000" {
+			t.Errorf("unexpected Content-Range %q", got)
+		}
+	})
+
+	t.Run("streams whole responses", func(t *testing.T) {
+		rr := stream(backend.URL+"/c.mp3", "")
+
+		if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), media) {
+			t.Errorf("expected whole response, got %d: %d bytes", rr.Code, rr.Body.Len())
+		}
+	})
+
+	t.Run("limits bytes per request", func(t *testing.T) {
+		oldMaxBytes := *mediaProxyMaxBytes
+		*mediaProxyMaxBytes = 500
+		defer func() { *mediaProxyMaxBytes = oldMaxBytes }()
+
+		if rr := stream(backend.URL+"/d.mp3", ""); rr.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+		}
+		if rr := stream(backend.URL+"/d.mp3", "bytes=0-"); rr.Code != http.StatusPartialContent {
+			t.Errorf("expected status %d, got %d", http.StatusPartialContent, rr.Code)
+		}
+	})
+
+	t.Run("rejects other content", func(t *testing.T) {
+		if rr := stream(backend.URL+"/page", ""); rr.Code != http.StatusBadGateway {
+			t.Errorf("expected status %d, got %d", http.StatusBadGateway, rr.Code)
+		}
+	})
+}
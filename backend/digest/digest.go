@@ -0,0 +1,243 @@
+// Package digest sends users scheduled email digests of their articles.
+//
+// Each user opts in with models.DigestSettings, which choose the local time
+// of day, days of the week and time zone of the schedule. When a digest is
+// due, the unread (or labeled) articles retrieved in the preceding window are
+// grouped by folder and feed, rendered as HTML and plaintext, and sent through
+// the configured SMTP server.
+package digest
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/smtp"
+	"slices"
+	"strings"
+	"time"
+	// Embed the time zone database for hosts without one.
+	_ "time/tzdata"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	digestCheckInterval = flag.Duration("digestCheckInterval", time.Minute, "Interval between checks for digests that are due.")
+	digestMaxArticles   = flag.Int("digestMaxArticles", 500, "Maximum number of articles included in a digest.")
+	smtpAddr            = flag.String("smtpAddr", "", "Address (host:port) of the SMTP server used to send digests. Digests are disabled if empty.")
+	smtpUsername        = flag.String("smtpUsername", "", "Username to authenticate to the SMTP server with. No authentication is used if empty.")
+	smtpPassword        = flag.String("smtpPassword", "", "Password to authenticate to the SMTP server with.")
+	smtpFrom            = flag.String("smtpFrom", "", "Sender address of digests.")
+)
+
+// ErrNotConfigured is returned when sending a digest without an SMTP server.
+var ErrNotConfigured = errors.New("no SMTP server configured")
+
+// sendMail sends an email. It is overridden in tests.
+var sendMail = smtp.SendMail
+
+var (
+	digestsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "digests_total",
+			Help: "Total number of scheduled digests by result: sent, empty (nothing to send), or failure.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(digestsMetric)
+}
+
+// ParseTimeOfDay parses a time of day in the format "15:04" and returns the
+// number of minutes after midnight.
+func ParseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// FormatTimeOfDay formats a number of minutes after midnight as "15:04".
+func FormatTimeOfDay(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseWeekday parses the English name of a day of the week, or its first
+// three letters, ignoring case.
+func ParseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) == 3 && strings.HasPrefix(name, s)) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q", s)
+}
+
+// lastScheduled returns the most recent time at or before now at which a
+// digest is scheduled with the given settings, or the zero time if there is
+// none in the past week.
+func lastScheduled(s models.DigestSettings, now time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+	}
+
+	local := now.In(loc)
+	for i := 0; i < 8; i++ {
+		day := local.AddDate(0, 0, -i)
+		t := time.Date(day.Year(), day.Month(), day.Day(), s.TimeOfDay/60, s.TimeOfDay%60, 0, 0, loc)
+		if t.After(now) {
+			continue
+		}
+		if len(s.Weekdays) > 0 && !slices.Contains(s.Weekdays, t.Weekday()) {
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, nil
+}
+
+// Start continuously sends digests to users as they become due. It does
+// nothing if no SMTP server is configured.
+func Start(ctx context.Context, d storage.Database) {
+	if *smtpAddr == "" {
+		log.Infof("No SMTP server configured, not sending digests.")
+		return
+	}
+
+	log.Infof("Starting digest scheduler.")
+	tick := time.After(0)
+
+	for {
+		select {
+		case <-tick:
+			sendDue(d, time.Now())
+			tick = time.After(*digestCheckInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sendDue sends a digest to each user whose digest became due since their
+// last one was sent. Only the most recent scheduled digest is sent, so
+// digests missed while the server was down are not sent later.
+func sendDue(d storage.Database, now time.Time) {
+	users, err := d.GetAllUsers()
+	if err != nil {
+		log.Warningf("Failed to query all users: %s", err)
+		return
+	}
+
+	for _, u := range users {
+		s, err := d.GetDigestSettingsForUser(u)
+		if err != nil {
+			log.Warningf("while retrieving digest settings for %s: %s", u, err)
+			continue
+		}
+		if !s.Enabled {
+			continue
+		}
+
+		due, err := lastScheduled(s, now)
+		if err != nil {
+			log.Warningf("Not sending digest to %s: %s", u, err)
+			continue
+		}
+		if due.IsZero() || !due.After(s.LastSent) {
+			continue
+		}
+
+		// The digest is marked as sent even if sending fails, so that a
+		// failing digest is not retried on every check.
+		if err = d.UpdateDigestLastSentForUser(u, now); err != nil {
+			log.Warningf("while updating digest time for %s: %s", u, err)
+			continue
+		}
+
+		n, err := Send(d, u, s, now)
+		switch {
+		case err != nil:
+			log.Warningf("Failed to send digest to %s: %s", u, err)
+			digestsMetric.WithLabelValues("failure").Inc()
+		case n == 0:
+			log.V(2).Infof("No articles for digest to %s", u)
+			digestsMetric.WithLabelValues("empty").Inc()
+		default:
+			log.Infof("Sent digest of %d articles to %s", n, u)
+			digestsMetric.WithLabelValues("sent").Inc()
+		}
+	}
+}
+
+// Send sends a digest with the given settings to the user immediately,
+// regardless of its schedule, and returns the number of articles in it. No
+// email is sent if there are no articles.
+func Send(d storage.Database, u models.User, s models.DigestSettings, now time.Time) (int, error) {
+	if *smtpAddr == "" {
+		return 0, ErrNotConfigured
+	}
+	if s.Email == "" {
+		return 0, errors.New("no email address set")
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+	}
+
+	since := now.Add(-time.Duration(s.WindowHours) * time.Hour)
+	articles, err := d.GetDigestArticlesForUser(u, since, s.Labels, *digestMaxArticles)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve articles: %w", err)
+	}
+	if len(articles) == 0 {
+		return 0, nil
+	}
+
+	tree, err := d.GetFolderFeedTreeForUser(u)
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve folders: %w", err)
+	}
+
+	dg := buildDigest(tree, articles, now.In(loc))
+	from := *smtpFrom
+	if from == "" {
+		from = s.Email
+	}
+	msg, err := renderMessage(from, s.Email, dg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to render digest: %w", err)
+	}
+
+	var auth smtp.Auth
+	if *smtpUsername != "" {
+		host, _, err := net.SplitHostPort(*smtpAddr)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SMTP address: %w", err)
+		}
+		auth = smtp.PlainAuth("", *smtpUsername, *smtpPassword, host)
+	}
+	if err = sendMail(*smtpAddr, auth, from, []string{s.Email}, msg); err != nil {
+		return 0, fmt.Errorf("failed to send email: %w", err)
+	}
+
+	if s.MarkRead {
+		for _, id := range dg.articleIDs {
+			if err = d.MarkArticleForUser(u, id, models.MarkActionRead); err != nil {
+				log.Warningf("while marking article %d as read for %s: %s", id, u, err)
+			}
+		}
+	}
+
+	return dg.Count, nil
+}
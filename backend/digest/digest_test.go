@@ -0,0 +1,317 @@
+package digest
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestParseTimeOfDayAndWeekday(t *testing.T) {
+	if m, err := ParseTimeOfDay("07:30"); err != nil || m != 450 {
+		t.Errorf("expected 450, got %d (%v)", m, err)
+	}
+	if got := FormatTimeOfDay(450); got != "07:30" {
+		t.Errorf("expected 07:30, got %s", got)
+	}
+	for _, s := range []string{"7am", "25:00", ""} {
+		if _, err := ParseTimeOfDay(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+
+	for s, want := range map[string]time.Weekday{"monday": time.Monday, "Sat": time.Saturday, "SUNDAY": time.Sunday} {
+		if d, err := ParseWeekday(s); err != nil || d != want {
+			t.Errorf("ParseWeekday(%q): expected %s, got %s (%v)", s, want, d, err)
+		}
+	}
+	for _, s := range []string{"mo", "mond", "someday"} {
+		if _, err := ParseWeekday(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestLastScheduled(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A Wednesday.
+	now := time.Date(2025, 6, 11, 9, 0, 0, 0, ny)
+
+	tests := []struct {
+		name     string
+		settings models.DigestSettings
+		want     time.Time
+	}{
+		{
+			name:     "earlier today",
+			settings: models.DigestSettings{TimeOfDay: 7 * 60, Timezone: "America/New_York"},
+			want:     time.Date(2025, 6, 11, 7, 0, 0, 0, ny),
+		},
+		{
+			name:     "later today",
+			settings: models.DigestSettings{TimeOfDay: 10 * 60, Timezone: "America/New_York"},
+			want:     time.Date(2025, 6, 10, 10, 0, 0, 0, ny),
+		},
+		{
+			name:     "other timezone",
+			settings: models.DigestSettings{TimeOfDay: 12 * 60, Timezone: "UTC"},
+			want:     time.Date(2025, 6, 11, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "weekdays",
+			settings: models.DigestSettings{TimeOfDay: 7 * 60, Timezone: "America/New_York", Weekdays: []time.Weekday{time.Monday, time.Friday}},
+			want:     time.Date(2025, 6, 9, 7, 0, 0, 0, ny),
+		},
+		{
+			name:     "same weekday later",
+			settings: models.DigestSettings{TimeOfDay: 10 * 60, Timezone: "America/New_York", Weekdays: []time.Weekday{time.Wednesday}},
+			want:     time.Date(2025, 6, 4, 10, 0, 0, 0, ny),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := lastScheduled(tc.settings, now)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !got.Equal(tc.want) {
+				t.Errorf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := lastScheduled(models.DigestSettings{Timezone: "Nowhere/Special"}, now); err == nil {
+		t.Error("expected error for invalid timezone")
+	}
+}
+
+func TestBuildDigest(t *testing.T) {
+	tree := &models.Folder{
+		Name: models.RootFolder,
+		Feed: []models.Feed{{ID: 1, Title: "Root Feed"}},
+		Folders: []models.Folder{
+			{
+				Name: "Tech",
+				Feed: []models.Feed{{ID: 2, Title: "Original", CustomTitle: "Custom"}, {ID: 3, Title: "Quiet"}},
+				Folders: []models.Folder{
+					{Name: "Go", Feed: []models.Feed{{ID: 4, Title: "Go Blog"}}},
+				},
+			},
+		},
+	}
+	articles := []models.Article{
+		{ID: 10, FeedID: 4, Title: "Go 2"},
+		{ID: 11, FeedID: 2, Title: "Gadgets", Summary: "<p>Some   <b>new</b>\ngadgets</p>"},
+		{ID: 12, FeedID: 1, Title: "Hello"},
+		{ID: 13, FeedID: 9, Title: "Orphan"},
+		{ID: 14, FeedID: 2, Title: "More gadgets", Content: strings.Repeat("x", 400)},
+	}
+
+	dg := buildDigest(tree, articles, time.Now())
+
+	if dg.Count != 5 || len(dg.articleIDs) != 5 {
+		t.Fatalf("expected 5 articles, got %d (%v)", dg.Count, dg.articleIDs)
+	}
+	var got []string
+	for _, s := range dg.Sections {
+		for _, f := range s.Feeds {
+			for _, a := range f.Articles {
+				got = append(got, s.Folder+"|"+f.Title+"|"+a.Title)
+			}
+		}
+	}
+	want := []string{
+		"|Root Feed|Hello",
+		"Tech|Custom|Gadgets",
+		"Tech|Custom|More gadgets",
+		"Tech / Go|Go Blog|Go 2",
+		"Other|Feed 9|Orphan",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	gadgets := dg.Sections[1].Feeds[0].Articles
+	if gadgets[0].Summary != "Some new gadgets" {
+		t.Errorf("expected plaintext summary, got %q", gadgets[0].Summary)
+	}
+	if n := len([]rune(gadgets[1].Summary)); n != summaryLength+1 {
+		t.Errorf("expected truncated summary from content, got %d characters", n)
+	}
+}
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  []byte
+}
+
+// parseParts returns the decoded parts of a multipart email by content type.
+func parseParts(t *testing.T, raw []byte) (*mail.Message, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("invalid message: %s", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("expected multipart/alternative, got %s (%v)", mediaType, err)
+	}
+
+	parts := make(map[string]string)
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid part: %s", err)
+		}
+		b, err := io.ReadAll(quotedprintable.NewReader(p))
+		if err != nil {
+			t.Fatalf("invalid part body: %s", err)
+		}
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[ct] = string(b)
+	}
+	return m, parts
+}
+
+func TestSendDue(t *testing.T) {
+	origAddr, origFrom, origSend := *smtpAddr, *smtpFrom, sendMail
+	*smtpAddr, *smtpFrom = "smtp.example.com:25", "goliath@example.com"
+	defer func() { *smtpAddr, *smtpFrom, sendMail = origAddr, origFrom, origSend }()
+
+	var sent []sentMail
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr, from, to, msg})
+		return nil
+	}
+
+	now := time.Date(2025, 6, 11, 8, 0, 0, 0, time.UTC)
+	alice := models.User{UserId: "alice", Username: "alice"}
+	bob := models.User{UserId: "bob", Username: "bob"}
+	carol := models.User{UserId: "carol", Username: "carol"}
+
+	settings := map[models.UserId]models.DigestSettings{
+		// Due, as the last digest was sent yesterday.
+		"alice": {
+			Enabled: true, Email: "alice@example.com", TimeOfDay: 7 * 60, Timezone: "UTC",
+			WindowHours: 24, MarkRead: true, LastSent: now.Add(-25 * time.Hour),
+		},
+		// Already sent today.
+		"bob": {
+			Enabled: true, Email: "bob@example.com", TimeOfDay: 7 * 60, Timezone: "UTC",
+			WindowHours: 24, LastSent: now.Add(-30 * time.Minute),
+		},
+		// Not opted in.
+		"carol": {Email: "carol@example.com", TimeOfDay: 7 * 60, Timezone: "UTC"},
+	}
+
+	var lastSent []models.UserId
+	var marked []int64
+	var since time.Time
+	db := &storage.MockDB{
+		OnGetAllUsers: func() ([]models.User, error) {
+			return []models.User{alice, bob, carol}, nil
+		},
+		OnGetDigestSettingsForUser: func(u models.User) (models.DigestSettings, error) {
+			return settings[u.UserId], nil
+		},
+		OnUpdateDigestLastSentForUser: func(u models.User, ts time.Time) error {
+			lastSent = append(lastSent, u.UserId)
+			return nil
+		},
+		OnGetDigestArticlesForUser: func(u models.User, s time.Time, labels []string, limit int) ([]models.Article, error) {
+			since = s
+			return []models.Article{
+				{ID: 1, FeedID: 1, Title: "First <story>", Link: "http://example.com/1", Summary: "Summary & more"},
+				{ID: 2, FeedID: 1, Title: "Second story", Link: "http://example.com/2"},
+			}, nil
+		},
+		OnGetFolderFeedTreeForUser: func(u models.User) (*models.Folder, error) {
+			return &models.Folder{
+				Name:    models.RootFolder,
+				Folders: []models.Folder{{Name: "News", Feed: []models.Feed{{ID: 1, Title: "Daily News"}}}},
+			}, nil
+		},
+		OnMarkArticleForUser: func(u models.User, id int64, mark models.MarkAction) error {
+			if mark == models.MarkActionRead {
+				marked = append(marked, id)
+			}
+			return nil
+		},
+	}
+
+	sendDue(db, now)
+
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 digest to be sent, got %d", len(sent))
+	}
+	if len(lastSent) != 1 || lastSent[0] != "alice" {
+		t.Errorf("expected only alice's digest to be marked sent, got %v", lastSent)
+	}
+	if want := now.Add(-24 * time.Hour); !since.Equal(want) {
+		t.Errorf("expected articles since %s, got %s", want, since)
+	}
+	if len(marked) != 2 {
+		t.Errorf("expected 2 articles to be marked read, got %v", marked)
+	}
+
+	s := sent[0]
+	if s.addr != "smtp.example.com:25" || s.from != "goliath@example.com" || len(s.to) != 1 || s.to[0] != "alice@example.com" {
+		t.Errorf("unexpected envelope: %s from %s to %v", s.addr, s.from, s.to)
+	}
+
+	m, parts := parseParts(t, s.msg)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if want := "Goliath digest for Wed, Jun 11: 2 articles"; subject != want {
+		t.Errorf("expected subject %q, got %q", want, subject)
+	}
+	for _, want := range []string{"== News ==", "Daily News", "* First <story>", "http://example.com/2", "Summary & more"} {
+		if !strings.Contains(parts["text/plain"], want) {
+			t.Errorf("expected plaintext to contain %q, got:\n%s", want, parts["text/plain"])
+		}
+	}
+	for _, want := range []string{"<h2", "News</h2>", `<a href="http://example.com/1">First &lt;story&gt;</a>`, "Summary &amp; more"} {
+		if !strings.Contains(parts["text/html"], want) {
+			t.Errorf("expected HTML to contain %q, got:\n%s", want, parts["text/html"])
+		}
+	}
+}
+
+func TestSendWithoutArticles(t *testing.T) {
+	origAddr, origSend := *smtpAddr, sendMail
+	defer func() { *smtpAddr, sendMail = origAddr, origSend }()
+
+	sent := false
+	sendMail = func(string, smtp.Auth, string, []string, []byte) error {
+		sent = true
+		return nil
+	}
+	s := models.DigestSettings{Email: "alice@example.com", Timezone: "UTC", WindowHours: 24}
+
+	*smtpAddr = ""
+	if _, err := Send(&storage.MockDB{}, models.User{}, s, time.Now()); err != ErrNotConfigured {
+		t.Errorf("expected %v, got %v", ErrNotConfigured, err)
+	}
+
+	*smtpAddr = "smtp.example.com:25"
+	n, err := Send(&storage.MockDB{}, models.User{}, s, time.Now())
+	if err != nil || n != 0 || sent {
+		t.Errorf("expected nothing to be sent, got %d articles, sent: %t, error: %v", n, sent, err)
+	}
+}
@@ -0,0 +1,225 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/jrupac/goliath/models"
+)
+
+// summaryLength is the maximum number of characters of an article's summary
+// included in a digest.
+const summaryLength = 300
+
+// digest is the data a digest email is rendered from.
+type digest struct {
+	Date     time.Time
+	Count    int
+	Sections []section
+	// articleIDs are the IDs of the articles in the digest.
+	articleIDs []int64
+}
+
+// section holds the feeds of a folder that have articles in the digest.
+type section struct {
+	// Folder is the path of the folder, or empty for the root folder.
+	Folder string
+	Feeds  []feedSection
+}
+
+type feedSection struct {
+	Title    string
+	Link     string
+	Articles []article
+}
+
+type article struct {
+	Title   string
+	Link    string
+	Summary string
+	Date    time.Time
+}
+
+// buildDigest groups the given articles by folder and feed in the order of
+// the folder tree. Articles in feeds missing from the tree are grouped last.
+func buildDigest(tree *models.Folder, articles []models.Article, now time.Time) digest {
+	dg := digest{Date: now}
+
+	byFeed := make(map[int64][]models.Article)
+	for _, a := range articles {
+		byFeed[a.FeedID] = append(byFeed[a.FeedID], a)
+	}
+
+	add := func(s *section, title, link string, articles []models.Article) {
+		fs := feedSection{Title: title, Link: link}
+		for _, a := range articles {
+			fs.Articles = append(fs.Articles, article{
+				Title:   a.Title,
+				Link:    a.Link,
+				Summary: summarize(a),
+				Date:    a.Date.In(now.Location()),
+			})
+			dg.articleIDs = append(dg.articleIDs, a.ID)
+		}
+		dg.Count += len(articles)
+		s.Feeds = append(s.Feeds, fs)
+	}
+
+	var walk func(f models.Folder, path string)
+	walk = func(f models.Folder, path string) {
+		s := section{Folder: path}
+		for _, feed := range f.Feed {
+			if articles, ok := byFeed[feed.ID]; ok {
+				title := feed.Title
+				if feed.CustomTitle != "" {
+					title = feed.CustomTitle
+				}
+				add(&s, title, feed.Link, articles)
+				delete(byFeed, feed.ID)
+			}
+		}
+		if len(s.Feeds) > 0 {
+			dg.Sections = append(dg.Sections, s)
+		}
+		for _, child := range f.Folders {
+			childPath := child.Name
+			if path != "" {
+				childPath = path + " / " + child.Name
+			}
+			walk(child, childPath)
+		}
+	}
+	if tree != nil {
+		walk(*tree, "")
+	}
+
+	if len(byFeed) > 0 {
+		var ids []int64
+		for id := range byFeed {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		s := section{Folder: "Other"}
+		for _, id := range ids {
+			add(&s, fmt.Sprintf("Feed %d", id), "", byFeed[id])
+		}
+		dg.Sections = append(dg.Sections, s)
+	}
+
+	return dg
+}
+
+// summarize returns a short plaintext summary of the article.
+func summarize(a models.Article) string {
+	s := a.Summary
+	if s == "" {
+		s = a.Content
+	}
+	if doc, err := goquery.NewDocumentFromReader(strings.NewReader(s)); err == nil {
+		s = doc.Text()
+	}
+	s = strings.Join(strings.Fields(s), " ")
+
+	if r := []rune(s); len(r) > summaryLength {
+		s = strings.TrimSpace(string(r[:summaryLength])) + "…"
+	}
+	return s
+}
+
+func (dg digest) subject() string {
+	noun := "articles"
+	if dg.Count == 1 {
+		noun = "article"
+	}
+	return fmt.Sprintf("Goliath digest for %s: %d %s", dg.Date.Format("Mon, Jan 2"), dg.Count, noun)
+}
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Parse(
+	`{{.Subject}}
+{{range .Sections}}
+{{if .Folder}}== {{.Folder}} ==
+{{end}}{{range .Feeds}}
+{{.Title}}
+{{range .Articles}}
+  * {{.Title}}
+    {{.Link}}
+{{if .Summary}}    {{.Summary}}
+{{end}}{{end}}{{end}}{{end}}`))
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em; margin: auto;">
+<h1 style="font-size: 1.4em;">{{.Subject}}</h1>
+{{range .Sections}}
+{{if .Folder}}<h2 style="font-size: 1.2em; border-bottom: 1px solid #ccc;">{{.Folder}}</h2>{{end}}
+{{range .Feeds}}
+<h3 style="font-size: 1em;">{{if .Link}}<a href="{{.Link}}">{{.Title}}</a>{{else}}{{.Title}}{{end}}</h3>
+<ul>
+{{range .Articles}}<li style="margin-bottom: 0.8em;">
+<a href="{{.Link}}">{{.Title}}</a> <small style="color: #666;">{{.Date.Format "Jan 2 15:04"}}</small>
+{{if .Summary}}<br><span style="color: #333;">{{.Summary}}</span>{{end}}
+</li>
+{{end}}</ul>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// renderMessage renders the digest as a multipart email with HTML and
+// plaintext alternatives.
+func renderMessage(from, to string, dg digest) ([]byte, error) {
+	data := struct {
+		digest
+		Subject string
+	}{dg, dg.subject()}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", data.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", dg.Date.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+
+	parts := []struct {
+		contentType string
+		execute     func(*quotedprintable.Writer) error
+	}{
+		{"text/plain", func(w *quotedprintable.Writer) error { return textTemplate.Execute(w, data) }},
+		{"text/html", func(w *quotedprintable.Writer) error { return htmlTemplate.Execute(w, data) }},
+	}
+	for _, p := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if err = p.execute(qw); err != nil {
+			return nil, err
+		}
+		if err = qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
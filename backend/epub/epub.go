@@ -0,0 +1,390 @@
+// Package epub exports articles as EPUB 3 books to read them offline, for
+// example on an e-reader.
+//
+// The articles of a models.ArticleStream are grouped by feed, each feed
+// forming a section of the table of contents with one chapter per article.
+// Article content is sanitized and rendered as XHTML, and images are embedded
+// in the book, taken from the archived copies of saved articles, the cache of
+// the image proxy or their origin.
+package epub
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/archive"
+	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+var (
+	epubMaxArticles   = flag.Int("epubMaxArticles", 500, "Maximum number of articles in an exported EPUB book.")
+	epubMaxImages     = flag.Int("epubMaxImages", 500, "Maximum number of images embedded in an exported EPUB book. Other images are replaced by their alt text.")
+	epubMaxImageBytes = flag.Int64("epubMaxImageBytes", 100<<20,
+		"Maximum total size in bytes of the images embedded in an exported EPUB book. Other images are replaced by their alt text.")
+	epubImageTimeout = flag.Duration("epubImageTimeout", time.Minute,
+		"Maximum time spent fetching the images of an exported EPUB book. Images not fetched by then are replaced by their alt text.")
+)
+
+// fetchImage returns the image at the given URL and its content type. It is
+// overridden in tests.
+var fetchImage = cache.FetchImage
+
+// imageExtension returns the extension of files of images of the given media
+// type in the book, and false for types that EPUB readers need not support.
+func imageExtension(mediaType string) (string, bool) {
+	if mediaType == "image/avif" {
+		return "", false
+	}
+	return cache.ImageExtension(mediaType)
+}
+
+// book is the data an EPUB book is rendered from.
+type book struct {
+	ID       string
+	Title    string
+	Language string
+	Modified time.Time
+	Feeds    []*feedSection
+	// Chapters are the chapters of all feeds in reading order.
+	Chapters []*chapter
+	Images   []*image
+
+	user models.User
+	// images maps image URLs to their image in the book, or nil if the image
+	// could not be embedded.
+	images map[string]*image
+	// imageBytes is the total size of the images in the book.
+	imageBytes int64
+	// Images are no longer fetched once ctx is canceled or after
+	// imageDeadline.
+	ctx           context.Context
+	imageDeadline time.Time
+}
+
+type feedSection struct {
+	Title    string
+	Chapters []*chapter
+	// PlayOrder is the position of the section in the reading order of the
+	// NCX table of contents, which is that of its first chapter.
+	PlayOrder int
+}
+
+type chapter struct {
+	ID        string
+	File      string
+	Feed      string
+	Title     string
+	Link      string
+	Author    string
+	Date      time.Time
+	Body      string
+	PlayOrder int
+}
+
+type image struct {
+	ID        string
+	File      string
+	MediaType string
+	data      []byte
+}
+
+// Export writes an EPUB book with the user's articles selected by the given
+// stream to w. Articles in folders under the selected folders are included as
+// well. A title describing the stream is used if the given title is empty.
+// Images are no longer fetched once the context is canceled.
+func Export(ctx context.Context, d storage.Database, u models.User, s models.ArticleStream, title string, w io.Writer) error {
+	folders, err := d.GetAllFoldersForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get folders: %w", err)
+	}
+	if title == "" {
+		title = defaultTitle(s, folders)
+	}
+	if s.FolderIDs, err = withSubfolders(d, u, s.FolderIDs); err != nil {
+		return fmt.Errorf("failed to get subfolders: %w", err)
+	}
+
+	articles, err := d.GetArticlesInStreamForUser(u, s, *epubMaxArticles)
+	if err != nil {
+		return fmt.Errorf("failed to get articles: %w", err)
+	}
+	feeds, err := d.GetAllFeedsForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+
+	b := newBook(ctx, u, title, time.Now())
+	b.addArticles(feeds, articles)
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+	log.Infof("Exporting %d articles with %d images (%d bytes) as EPUB for %s", len(b.Chapters), len(b.Images), b.imageBytes, u)
+	return b.write(w)
+}
+
+// defaultTitle describes the articles selected by the stream.
+func defaultTitle(s models.ArticleStream, folders []models.Folder) string {
+	var parts []string
+	if s.Saved {
+		parts = append(parts, "Saved articles")
+	} else {
+		parts = append(parts, "Articles")
+	}
+	if s.Label != "" {
+		parts = append(parts, fmt.Sprintf("labeled %q", s.Label))
+	}
+	var names []string
+	for _, f := range folders {
+		if slices.Contains(s.FolderIDs, f.ID) {
+			names = append(names, f.Name)
+		}
+	}
+	if len(names) > 0 {
+		parts = append(parts, "in "+strings.Join(names, ", "))
+	}
+	if !s.Since.IsZero() {
+		parts = append(parts, "since "+s.Since.Format("January 2, 2006"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// withSubfolders returns the given folders and all folders under them.
+func withSubfolders(d storage.Database, u models.User, ids []int64) ([]int64, error) {
+	all := slices.Clone(ids)
+	for i := 0; i < len(all); i++ {
+		children, err := d.GetFolderChildrenForUser(u, all[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			if !slices.Contains(all, c) {
+				all = append(all, c)
+			}
+		}
+	}
+	return all, nil
+}
+
+func newBook(ctx context.Context, u models.User, title string, now time.Time) *book {
+	return &book{
+		ID:            newUUID(),
+		Title:         xmlText(title),
+		Language:      "en",
+		Modified:      now,
+		user:          u,
+		images:        map[string]*image{},
+		ctx:           ctx,
+		imageDeadline: now.Add(*epubImageTimeout),
+	}
+}
+
+// newUUID returns a random UUID URN that identifies a book.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// addArticles adds a chapter for each article, grouped by feed in order of
+// the feeds' titles. The language of the book is the most common language of
+// the articles.
+func (b *book) addArticles(feeds []models.Feed, articles []models.Article) {
+	titles := map[int64]string{}
+	for _, f := range feeds {
+		titles[f.ID] = f.Title
+		if f.CustomTitle != "" {
+			titles[f.ID] = f.CustomTitle
+		}
+	}
+
+	byFeed := map[int64]*feedSection{}
+	languages := map[string]int{}
+	for _, a := range articles {
+		fs, ok := byFeed[a.FeedID]
+		if !ok {
+			title := titles[a.FeedID]
+			if title == "" {
+				title = "(Untitled)"
+			}
+			fs = &feedSection{Title: xmlText(title)}
+			byFeed[a.FeedID] = fs
+			b.Feeds = append(b.Feeds, fs)
+		}
+		fs.Chapters = append(fs.Chapters, b.newChapter(fs.Title, a))
+		if a.Language != "" {
+			languages[a.Language]++
+		}
+	}
+
+	slices.SortStableFunc(b.Feeds, func(x, y *feedSection) int {
+		return strings.Compare(strings.ToLower(x.Title), strings.ToLower(y.Title))
+	})
+	for _, fs := range b.Feeds {
+		for _, c := range fs.Chapters {
+			b.Chapters = append(b.Chapters, c)
+			c.PlayOrder = len(b.Chapters)
+		}
+		fs.PlayOrder = fs.Chapters[0].PlayOrder
+	}
+
+	for lang, n := range languages {
+		if n > languages[b.Language] || (n == languages[b.Language] && lang < b.Language) {
+			b.Language = lang
+		}
+	}
+}
+
+func (b *book) newChapter(feed string, a models.Article) *chapter {
+	title := a.Title
+	if title == "" {
+		title = "(Untitled)"
+	}
+	base, _ := url.Parse(a.Link)
+	return &chapter{
+		ID:     fmt.Sprintf("article-%d", a.ID),
+		File:   fmt.Sprintf("article-%d.xhtml", a.ID),
+		Feed:   feed,
+		Title:  xmlText(title),
+		Link:   xmlText(a.Link),
+		Author: xmlText(strings.Join(a.Authors, ", ")),
+		Date:   a.Date,
+		Body:   b.toXHTML(base, a.GetArchivedContents(true)),
+	}
+}
+
+// image returns the image at the given source embedded in the book, adding it
+// if needed, or nil if it cannot be embedded.
+func (b *book) image(base *url.URL, src string) *image {
+	src = strings.TrimSpace(src)
+	key := src
+	if !strings.HasPrefix(src, "/archive/") {
+		u, err := url.Parse(src)
+		if err != nil {
+			return nil
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		key = cache.OriginURL(u.String())
+	}
+	if img, ok := b.images[key]; ok {
+		return img
+	}
+	if len(b.Images) >= *epubMaxImages || b.imageBytes >= *epubMaxImageBytes {
+		return nil
+	}
+
+	var data []byte
+	var contentType string
+	var err error
+	if strings.HasPrefix(key, "/archive/") {
+		var ok bool
+		if data, ok = archive.ReadImage(b.user, key); ok {
+			contentType = http.DetectContentType(data)
+		} else {
+			err = fmt.Errorf("archived image not found")
+		}
+	} else if strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		if b.ctx.Err() != nil || time.Now().After(b.imageDeadline) {
+			err = fmt.Errorf("out of time to fetch images")
+		} else {
+			data, contentType, err = fetchImage(key)
+		}
+	} else {
+		err = fmt.Errorf("unsupported image URL")
+	}
+
+	var img *image
+	if err != nil {
+		log.V(2).Infof("Not embedding image %s: %s", key, err)
+	} else if ext, ok := imageExtension(mediaType(contentType)); !ok {
+		log.V(2).Infof("Not embedding image %s of type %s", key, contentType)
+	} else if b.imageBytes+int64(len(data)) > *epubMaxImageBytes {
+		log.V(2).Infof("Not embedding image %s: book would exceed %d bytes of images", key, *epubMaxImageBytes)
+	} else {
+		b.imageBytes += int64(len(data))
+		n := len(b.Images) + 1
+		img = &image{
+			ID:        fmt.Sprintf("image-%d", n),
+			File:      fmt.Sprintf("images/image-%d%s", n, ext),
+			MediaType: mediaType(contentType),
+			data:      data,
+		}
+		b.Images = append(b.Images, img)
+	}
+	b.images[key] = img
+	return img
+}
+
+// bookFile is a file of the book rendered from a template.
+type bookFile struct {
+	name string
+	tmpl string
+	data any
+}
+
+// chapterPage is the data a chapter is rendered from.
+type chapterPage struct {
+	*chapter
+	Language string
+}
+
+// write renders the book as an EPUB container.
+func (b *book) write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	// The media type must be the first file and must not be compressed.
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(f, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	files := []bookFile{
+		{"META-INF/container.xml", "container", b},
+		{"OEBPS/content.opf", "package", b},
+		{"OEBPS/nav.xhtml", "nav", b},
+		{"OEBPS/toc.ncx", "ncx", b},
+		{"OEBPS/style.css", "style", b},
+	}
+	for _, c := range b.Chapters {
+		files = append(files, bookFile{"OEBPS/" + c.File, "chapter", chapterPage{c, b.Language}})
+	}
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if err = templates.ExecuteTemplate(f, file.tmpl, file.data); err != nil {
+			return fmt.Errorf("failed to render %s: %w", file.name, err)
+		}
+	}
+
+	for _, img := range b.Images {
+		f, err := zw.Create("OEBPS/" + img.File)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(img.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
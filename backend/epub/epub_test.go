@@ -0,0 +1,220 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+// testPNG is the signature and header of a PNG image, which is enough for its
+// content type to be detected.
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestExport(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice"}
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	var stream models.ArticleStream
+	d := &storage.MockDB{
+		OnGetAllFoldersForUser: func(u models.User) ([]models.Folder, error) {
+			return []models.Folder{{ID: 1, Name: "Tech"}, {ID: 2, Name: "Go"}}, nil
+		},
+		OnGetFolderChildrenForUser: func(u models.User, id int64) ([]int64, error) {
+			if id == 1 {
+				return []int64{2}, nil
+			}
+			return nil, nil
+		},
+		OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+			return []models.Feed{
+				{ID: 10, Title: "Zeta Blog"},
+				{ID: 20, Title: "Alpha News", CustomTitle: "Alpha & Omega"},
+			}, nil
+		},
+		OnGetArticlesInStreamForUser: func(u models.User, s models.ArticleStream, limit int) ([]models.Article, error) {
+			stream = s
+			return []models.Article{
+				{
+					ID: 1, FeedID: 10, Title: "First <post>", Link: "https://zeta.example/1",
+					Content:   `<p>Hello<br>world &amp; <img src="/a.png" alt="A"> <img src="https://other.example/missing.png" alt="gone"></p><script>alert(1)</script>`,
+					Authors:   []string{"Bob"},
+					Date:      date,
+					TextStats: models.TextStats{Language: "de"},
+				},
+				{
+					ID: 2, FeedID: 20, Title: "Second", Link: "https://alpha.example/2",
+					Content:   `<p>Bad` + "\x01" + ` char <a href="/rel">link</a> <img src="https://zeta.example/a.png"></p>`,
+					Date:      date,
+					TextStats: models.TextStats{Language: "de"},
+				},
+				{ID: 3, FeedID: 20, Title: "", Link: "https://alpha.example/3", Content: "<p>Untitled</p>", Date: date},
+			}, nil
+		},
+	}
+
+	var fetched []string
+	defer func(f func(string) ([]byte, string, error)) { fetchImage = f }(fetchImage)
+	fetchImage = func(target string) ([]byte, string, error) {
+		fetched = append(fetched, target)
+		if target == "https://zeta.example/a.png" {
+			return testPNG, "image/png", nil
+		}
+		return nil, "", errors.New("not found")
+	}
+
+	var buf bytes.Buffer
+	if err := Export(context.Background(), d, user, models.ArticleStream{FolderIDs: []int64{1}}, "", &buf); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+
+	if !slices.Equal(stream.FolderIDs, []int64{1, 2}) {
+		t.Errorf("expected subfolders to be selected, got %v", stream.FolderIDs)
+	}
+	if !slices.Equal(fetched, []string{"https://zeta.example/a.png", "https://other.example/missing.png"}) {
+		t.Errorf("expected each image to be fetched once, got %v", fetched)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("failed to read book: %s", err)
+	}
+	if len(zr.File) == 0 || zr.File[0].Name != "mimetype" || zr.File[0].Method != zip.Store {
+		t.Fatal("expected an uncompressed mimetype file first")
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %s", f.Name, err)
+		}
+		b, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		files[f.Name] = string(b)
+
+		if strings.HasSuffix(f.Name, ".xml") || strings.HasSuffix(f.Name, ".opf") ||
+			strings.HasSuffix(f.Name, ".ncx") || strings.HasSuffix(f.Name, ".xhtml") {
+			dec := xml.NewDecoder(bytes.NewReader(b))
+			for {
+				if _, err := dec.Token(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatalf("%s is not well-formed XML: %s\n%s", f.Name, err, b)
+				}
+			}
+		}
+	}
+
+	if files["mimetype"] != "application/epub+zip" {
+		t.Errorf("unexpected mimetype: %q", files["mimetype"])
+	}
+	if files["OEBPS/images/image-1.png"] != string(testPNG) {
+		t.Error("expected image to be embedded")
+	}
+
+	opf := files["OEBPS/content.opf"]
+	for _, want := range []string{
+		"<dc:title>Articles in Tech</dc:title>",
+		"<dc:language>de</dc:language>",
+		`<item id="image-1" href="images/image-1.png" media-type="image/png"/>`,
+	} {
+		if !strings.Contains(opf, want) {
+			t.Errorf("expected package to contain %q:\n%s", want, opf)
+		}
+	}
+	// Feeds are ordered by title.
+	spine := opf[strings.Index(opf, "<spine"):]
+	if i, j := strings.Index(spine, "article-2"), strings.Index(spine, "article-1"); i < 0 || j < 0 || i > j {
+		t.Errorf("expected articles of Alpha & Omega first:\n%s", spine)
+	}
+
+	nav := files["OEBPS/nav.xhtml"]
+	if !strings.Contains(nav, `<a href="article-2.xhtml">Alpha &amp; Omega</a>`) ||
+		!strings.Contains(nav, `<a href="article-3.xhtml">(Untitled)</a>`) {
+		t.Errorf("unexpected table of contents:\n%s", nav)
+	}
+
+	first := files["OEBPS/article-1.xhtml"]
+	for _, want := range []string{"First &lt;post&gt;", "Bob · March 1, 2024", "<br/>", `<img src="images/image-1.png" alt="A"/>`, "gone"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("expected chapter to contain %q:\n%s", want, first)
+		}
+	}
+	if strings.Contains(first, "<script") || strings.Contains(first, "missing.png") {
+		t.Errorf("expected scripts and missing images to be removed:\n%s", first)
+	}
+
+	second := files["OEBPS/article-2.xhtml"]
+	if !strings.Contains(second, `<img src="images/image-1.png" alt=""/>`) ||
+		!strings.Contains(second, `href="https://alpha.example/rel"`) {
+		t.Errorf("expected image to be embedded and link resolved:\n%s", second)
+	}
+}
+
+func TestBookImageLimits(t *testing.T) {
+	var fetched []string
+	defer func(f func(string) ([]byte, string, error)) { fetchImage = f }(fetchImage)
+	fetchImage = func(target string) ([]byte, string, error) {
+		fetched = append(fetched, target)
+		return testPNG, "image/png", nil
+	}
+
+	t.Run("limits total image bytes", func(t *testing.T) {
+		defer func(n int64) { *epubMaxImageBytes = n }(*epubMaxImageBytes)
+		*epubMaxImageBytes = int64(len(testPNG)) + 1
+
+		b := newBook(context.Background(), models.User{}, "Test", time.Now())
+		if b.image(nil, "https://example.com/a.png") == nil {
+			t.Error("expected first image to be embedded")
+		}
+		if b.image(nil, "https://example.com/b.png") != nil {
+			t.Error("expected image over the size limit to not be embedded")
+		}
+	})
+
+	t.Run("stops fetching after deadline", func(t *testing.T) {
+		fetched = nil
+		b := newBook(context.Background(), models.User{}, "Test", time.Now().Add(-*epubImageTimeout-time.Second))
+		if b.image(nil, "https://example.com/a.png") != nil || len(fetched) != 0 {
+			t.Errorf("expected no image to be fetched, got %v", fetched)
+		}
+	})
+
+	t.Run("stops fetching when canceled", func(t *testing.T) {
+		fetched = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		b := newBook(ctx, models.User{}, "Test", time.Now())
+		if b.image(nil, "https://example.com/a.png") != nil || len(fetched) != 0 {
+			t.Errorf("expected no image to be fetched, got %v", fetched)
+		}
+	})
+}
+
+func TestDefaultTitle(t *testing.T) {
+	folders := []models.Folder{{ID: 1, Name: "Tech"}}
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		stream models.ArticleStream
+		want   string
+	}{
+		{models.ArticleStream{Saved: true}, "Saved articles"},
+		{models.ArticleStream{Label: "later"}, `Articles labeled "later"`},
+		{models.ArticleStream{Saved: true, FolderIDs: []int64{1}, Since: since}, "Saved articles in Tech since March 1, 2024"},
+	}
+	for _, tt := range tests {
+		if got := defaultTitle(tt.stream, folders); got != tt.want {
+			t.Errorf("defaultTitle(%+v) = %q, want %q", tt.stream, got, tt.want)
+		}
+	}
+}
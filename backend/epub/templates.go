@@ -0,0 +1,143 @@
+package epub
+
+import (
+	"text/template"
+)
+
+// Strings in the book are already stripped of characters not allowed in XML,
+// so escaping them as HTML is enough to write them in XML documents.
+var templates = template.Must(template.New("epub").Funcs(template.FuncMap{
+	"x": template.HTMLEscapeString,
+}).Parse(`
+{{- define "container" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+
+{{- define "package" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="{{x .Language}}">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{.ID}}</dc:identifier>
+    <dc:title>{{x .Title}}</dc:title>
+    <dc:language>{{x .Language}}</dc:language>
+    <dc:creator>Goliath</dc:creator>
+    <dc:date>{{.Modified.UTC.Format "2006-01-02T15:04:05Z"}}</dc:date>
+    <meta property="dcterms:modified">{{.Modified.UTC.Format "2006-01-02T15:04:05Z"}}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="style" href="style.css" media-type="text/css"/>
+{{- range .Chapters}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="application/xhtml+xml"/>
+{{- end}}
+{{- range .Images}}
+    <item id="{{.ID}}" href="{{.File}}" media-type="{{.MediaType}}"/>
+{{- end}}
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="nav"/>
+{{- range .Chapters}}
+    <itemref idref="{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+{{end}}
+
+{{- define "nav" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{x .Language}}" lang="{{x .Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <title>{{x .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <nav epub:type="toc" id="toc">
+    <h1>{{x .Title}}</h1>
+    <ol>
+{{- range .Feeds}}
+      <li>
+        <a href="{{(index .Chapters 0).File}}">{{x .Title}}</a>
+        <ol>
+{{- range .Chapters}}
+          <li><a href="{{.File}}">{{x .Title}}</a></li>
+{{- end}}
+        </ol>
+      </li>
+{{- end}}
+    </ol>
+  </nav>
+</body>
+</html>
+{{end}}
+
+{{- define "ncx" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1" xml:lang="{{x .Language}}">
+  <head>
+    <meta name="dtb:uid" content="{{.ID}}"/>
+    <meta name="dtb:depth" content="2"/>
+    <meta name="dtb:totalPageCount" content="0"/>
+    <meta name="dtb:maxPageNumber" content="0"/>
+  </head>
+  <docTitle><text>{{x .Title}}</text></docTitle>
+  <navMap>
+{{- range $i, $feed := .Feeds}}
+    <navPoint id="feed-{{$i}}" playOrder="{{.PlayOrder}}">
+      <navLabel><text>{{x .Title}}</text></navLabel>
+      <content src="{{(index .Chapters 0).File}}"/>
+{{- range .Chapters}}
+      <navPoint id="nav-{{.ID}}" playOrder="{{.PlayOrder}}">
+        <navLabel><text>{{x .Title}}</text></navLabel>
+        <content src="{{.File}}"/>
+      </navPoint>
+{{- end}}
+    </navPoint>
+{{- end}}
+  </navMap>
+</ncx>
+{{end}}
+
+{{- define "style" -}}
+body { font-family: serif; line-height: 1.5; }
+header { margin-bottom: 1.5em; }
+h1 { font-size: 1.5em; line-height: 1.2; margin: 0.25em 0; }
+.feed, .byline, .source { font-size: 0.85em; color: #555; margin: 0; }
+.source { margin-top: 2em; word-wrap: break-word; }
+img { max-width: 100%; height: auto; }
+pre { white-space: pre-wrap; }
+nav ol { list-style: none; padding-left: 1em; }
+{{end}}
+
+{{- define "chapter" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="{{x .Language}}" lang="{{x .Language}}">
+<head>
+  <meta charset="UTF-8"/>
+  <title>{{x .Title}}</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+  <article>
+    <header>
+      <p class="feed">{{x .Feed}}</p>
+      <h1>{{x .Title}}</h1>
+      <p class="byline">{{if .Author}}{{x .Author}} · {{end}}{{.Date.Format "January 2, 2006"}}</p>
+    </header>
+{{.Body}}
+{{- if .Link}}
+    <p class="source"><a href="{{x .Link}}">{{x .Link}}</a></p>
+{{- end}}
+  </article>
+</body>
+</html>
+{{end}}
+`))
@@ -0,0 +1,129 @@
+package epub
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/fetch"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// toXHTML sanitizes the HTML content of an article and renders it as XHTML,
+// embedding its images in the book. Images that cannot be embedded are
+// replaced by their alt text.
+func (b *book) toXHTML(base *url.URL, content string) string {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fetch.SanitizeBody(content)), body)
+	if err != nil {
+		log.Warningf("while parsing article content: %s", err)
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		b.rewrite(base, n)
+		if err = html.Render(&buf, n); err != nil {
+			log.Warningf("while rendering article content: %s", err)
+			return ""
+		}
+	}
+	return buf.String()
+}
+
+// rewrite prepares the given node and its descendants to be rendered as XHTML.
+func (b *book) rewrite(base *url.URL, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		n.Data = xmlText(n.Data)
+	case html.ElementNode:
+		var attrs []html.Attribute
+		for _, a := range n.Attr {
+			// Namespaced attributes cannot be rendered as XHTML.
+			if a.Namespace != "" || strings.Contains(a.Key, ":") {
+				continue
+			}
+			a.Val = xmlText(a.Val)
+			attrs = append(attrs, a)
+		}
+		n.Attr = attrs
+
+		switch n.DataAtom {
+		case atom.Img:
+			b.rewriteImage(base, n)
+			return
+		case atom.A:
+			for i, a := range n.Attr {
+				if a.Key != "href" || base == nil {
+					continue
+				}
+				if u, err := base.Parse(a.Val); err == nil {
+					n.Attr[i].Val = u.String()
+				}
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		b.rewrite(base, c)
+		c = next
+	}
+}
+
+// rewriteImage points the image at its copy in the book, or replaces it with
+// its alt text.
+func (b *book) rewriteImage(base *url.URL, n *html.Node) {
+	var src, alt string
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "src":
+			src = a.Val
+		case "alt":
+			alt = a.Val
+		}
+	}
+
+	var img *image
+	if src != "" {
+		img = b.image(base, src)
+	}
+	if img == nil {
+		n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: alt}, n)
+		n.Parent.RemoveChild(n)
+		return
+	}
+
+	attrs := []html.Attribute{{Key: "src", Val: img.File}, {Key: "alt", Val: alt}}
+	for _, a := range n.Attr {
+		if a.Key == "width" || a.Key == "height" || a.Key == "title" {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attr = attrs
+}
+
+// xmlText removes the characters that are not allowed in XML documents.
+func xmlText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return r
+		case r < 0x20, r >= 0xD800 && r < 0xE000, r == 0xFFFE, r == 0xFFFF:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// mediaType returns the media type of a content type without its parameters.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
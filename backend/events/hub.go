@@ -0,0 +1,200 @@
+package events
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	subscriberBufferSize = flag.Int("eventSubscriberBufferSize", 64,
+		"Number of pending events buffered per event stream subscriber. A subscriber that falls further behind than this is disconnected.")
+)
+
+var (
+	subscribersMetric = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "event_stream_subscribers",
+			Help: "Current number of connected event stream subscribers on a per-user basis.",
+		},
+		[]string{"username"},
+	)
+	eventsPublishedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_stream_published_total",
+			Help: "Total number of events published to the event hub on a per-user, per-type basis.",
+		},
+		[]string{"username", "type"},
+	)
+	subscribersDroppedMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "event_stream_subscribers_dropped_total",
+			Help: "Total number of event stream subscribers disconnected because they could not keep up.",
+		},
+		[]string{"username"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(subscribersMetric)
+	prometheus.MustRegister(eventsPublishedMetric)
+	prometheus.MustRegister(subscribersDroppedMetric)
+}
+
+// Type identifies the kind of change described by an Event.
+type Type string
+
+const (
+	// TypeArticles is published when new articles are persisted.
+	TypeArticles Type = "articles"
+	// TypeMark is published when the read or saved state of articles changes.
+	TypeMark Type = "mark"
+)
+
+// Event is a single change notification delivered to subscribers.
+type Event struct {
+	// ID is a monotonically increasing identifier assigned by the Hub.
+	ID   uint64 `json:"id"`
+	Type Type   `json:"type"`
+	// Mark is set for TypeMark events and is one of "read", "unread", "saved",
+	// or "unsaved".
+	Mark       string    `json:"mark,omitempty"`
+	ArticleIDs []int64   `json:"article_ids,omitempty"`
+	FeedID     int64     `json:"feed_id,omitempty"`
+	FolderID   int64     `json:"folder_id,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// MarkName returns the name used in events for the given mark action.
+func MarkName(mark models.MarkAction) string {
+	switch mark {
+	case models.MarkActionRead:
+		return "read"
+	case models.MarkActionUnread:
+		return "unread"
+	case models.MarkActionSaved:
+		return "saved"
+	case models.MarkActionUnsaved:
+		return "unsaved"
+	default:
+		return ""
+	}
+}
+
+// Subscription is a single subscriber's view of the event stream.
+type Subscription struct {
+	// C receives events for the subscribed user. It is closed when the
+	// subscription is canceled or when the subscriber falls too far behind.
+	C <-chan Event
+
+	c    chan Event
+	user models.User
+	hub  *Hub
+}
+
+// Cancel removes the subscription from the hub. It is safe to call multiple
+// times.
+func (s *Subscription) Cancel() {
+	s.hub.remove(s)
+}
+
+// Hub is an in-process publish/subscribe hub that fans out events to all
+// subscribers of a user. Publishing never blocks: a subscriber whose buffer is
+// full is disconnected so that a slow client cannot stall the publisher.
+//
+// A nil *Hub is valid and drops all published events.
+type Hub struct {
+	lock   sync.Mutex
+	subs   map[models.UserId]map[*Subscription]struct{}
+	nextID atomic.Uint64
+}
+
+// NewHub returns a new, empty Hub.
+func NewHub() *Hub {
+	return &Hub{subs: map[models.UserId]map[*Subscription]struct{}{}}
+}
+
+// Subscribe registers a new subscriber for the given user.
+func (h *Hub) Subscribe(u models.User) *Subscription {
+	c := make(chan Event, *subscriberBufferSize)
+	s := &Subscription{C: c, c: c, user: u, hub: h}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	userSubs, ok := h.subs[u.UserId]
+	if !ok {
+		userSubs = map[*Subscription]struct{}{}
+		h.subs[u.UserId] = userSubs
+	}
+	userSubs[s] = struct{}{}
+	subscribersMetric.WithLabelValues(u.Username).Inc()
+
+	log.V(2).Infof("New event subscriber for %s (total: %d)", u, len(userSubs))
+	return s
+}
+
+// Publish delivers the given event to all current subscribers of the user.
+func (h *Hub) Publish(u models.User, e Event) {
+	if h == nil {
+		return
+	}
+
+	e.ID = h.nextID.Add(1)
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	eventsPublishedMetric.WithLabelValues(u.Username, string(e.Type)).Inc()
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for s := range h.subs[u.UserId] {
+		select {
+		case s.c <- e:
+		default:
+			log.Warningf("Disconnecting slow event subscriber for %s", u)
+			subscribersDroppedMetric.WithLabelValues(u.Username).Inc()
+			h.removeLocked(s)
+		}
+	}
+}
+
+// PublishArticles is a convenience wrapper to publish a TypeArticles event.
+func (h *Hub) PublishArticles(u models.User, feedID, folderID int64, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	h.Publish(u, Event{Type: TypeArticles, FeedID: feedID, FolderID: folderID, ArticleIDs: ids})
+}
+
+// PublishMark is a convenience wrapper to publish a TypeMark event.
+func (h *Hub) PublishMark(u models.User, mark models.MarkAction, e Event) {
+	e.Type = TypeMark
+	e.Mark = MarkName(mark)
+	h.Publish(u, e)
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.removeLocked(s)
+}
+
+func (h *Hub) removeLocked(s *Subscription) {
+	userSubs := h.subs[s.user.UserId]
+	if _, ok := userSubs[s]; !ok {
+		return
+	}
+	delete(userSubs, s)
+	if len(userSubs) == 0 {
+		delete(h.subs, s.user.UserId)
+	}
+	subscribersMetric.WithLabelValues(s.user.Username).Dec()
+	close(s.c)
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+)
+
+func TestHub(t *testing.T) {
+	alice := models.User{UserId: "alice", Username: "alice"}
+	bob := models.User{UserId: "bob", Username: "bob"}
+
+	t.Run("fan out to all subscribers of a user", func(t *testing.T) {
+		h := NewHub()
+		s1 := h.Subscribe(alice)
+		s2 := h.Subscribe(alice)
+		s3 := h.Subscribe(bob)
+		defer s1.Cancel()
+		defer s2.Cancel()
+		defer s3.Cancel()
+
+		h.PublishArticles(alice, 1, 2, []int64{10, 11})
+
+		for _, s := range []*Subscription{s1, s2} {
+			select {
+			case e := <-s.C:
+				if e.Type != TypeArticles || e.FeedID != 1 || e.FolderID != 2 || len(e.ArticleIDs) != 2 {
+					t.Errorf("unexpected event: %+v", e)
+				}
+			default:
+				t.Errorf("expected event for subscriber")
+			}
+		}
+		select {
+		case e := <-s3.C:
+			t.Errorf("unexpected event for other user: %+v", e)
+		default:
+		}
+	})
+
+	t.Run("mark events carry mark name", func(t *testing.T) {
+		h := NewHub()
+		s := h.Subscribe(alice)
+		defer s.Cancel()
+
+		h.PublishMark(alice, models.MarkActionSaved, Event{ArticleIDs: []int64{5}})
+
+		e := <-s.C
+		if e.Type != TypeMark || e.Mark != "saved" {
+			t.Errorf("unexpected event: %+v", e)
+		}
+		if e.ID == 0 || e.Time.IsZero() {
+			t.Errorf("expected ID and time to be set: %+v", e)
+		}
+	})
+
+	t.Run("empty article list is not published", func(t *testing.T) {
+		h := NewHub()
+		s := h.Subscribe(alice)
+		defer s.Cancel()
+
+		h.PublishArticles(alice, 1, 2, nil)
+
+		select {
+		case e := <-s.C:
+			t.Errorf("unexpected event: %+v", e)
+		default:
+		}
+	})
+
+	t.Run("slow subscriber is disconnected", func(t *testing.T) {
+		h := NewHub()
+		s := h.Subscribe(alice)
+		defer s.Cancel()
+
+		for i := 0; i <= *subscriberBufferSize; i++ {
+			h.PublishArticles(alice, 1, 2, []int64{int64(i)})
+		}
+
+		n := 0
+		for range s.C {
+			n++
+		}
+		if n != *subscriberBufferSize {
+			t.Errorf("expected %d buffered events, got %d", *subscriberBufferSize, n)
+		}
+		if _, ok := h.subs[alice.UserId]; ok {
+			t.Errorf("expected subscriber to be removed")
+		}
+	})
+
+	t.Run("cancel is idempotent", func(t *testing.T) {
+		h := NewHub()
+		s := h.Subscribe(alice)
+		s.Cancel()
+		s.Cancel()
+
+		if _, ok := <-s.C; ok {
+			t.Errorf("expected channel to be closed")
+		}
+	})
+
+	t.Run("nil hub drops events", func(t *testing.T) {
+		var h *Hub
+		h.PublishArticles(alice, 1, 2, []int64{1})
+		h.PublishMark(alice, models.MarkActionRead, Event{})
+	})
+}
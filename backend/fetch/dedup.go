@@ -0,0 +1,27 @@
+package fetch
+
+import (
+	"github.com/arbovm/levenshtein"
+	"github.com/jrupac/goliath/models"
+)
+
+// editDistanceFraction returns the edit distance between two texts as a
+// fraction of the length of the first. Identical texts, including two empty
+// ones, are at distance zero.
+func editDistanceFraction(base string, comp string) float64 {
+	if base == comp {
+		return 0
+	}
+	return float64(levenshtein.Distance(base, comp)) / float64(len(base))
+}
+
+// isDedupSimilar returns true if both the titles and the summaries of two
+// articles are within `maxEditDedup` of each other. The edit distance is
+// computed exactly rather than estimated from SimHashes of the texts: those
+// differ in as many bits for short titles with a single edit as for
+// unrelated ones, so no bound on them keeps the meaning of `maxEditDedup`.
+// Only the few articles sharing a link are compared, so this stays cheap.
+func isDedupSimilar(o models.Article, n models.Article) bool {
+	return editDistanceFraction(o.Title, n.Title) < *maxEditDedup &&
+		editDistanceFraction(o.Summary, n.Summary) < *maxEditDedup
+}
@@ -0,0 +1,117 @@
+package fetch
+
+import (
+	"testing"
+
+	"github.com/arbovm/levenshtein"
+	"github.com/jrupac/goliath/models"
+)
+
+func TestIsDedupSimilar(t *testing.T) {
+	oldMaxEditDedup := *maxEditDedup
+	defer func() { *maxEditDedup = oldMaxEditDedup }()
+
+	title := "Acme launches rocket-powered roller skates"
+	summary := "The new skates feature a reinforced frame, an improved ignition system and a safety parachute."
+
+	testCases := []struct {
+		name         string
+		maxEditDedup float64
+		old          models.Article
+		new          models.Article
+		expected     bool
+	}{
+		{
+			name:         "identical",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: title, Summary: summary},
+			expected:     true,
+		},
+		{
+			name:         "empty summaries",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title},
+			new:          models.Article{Title: title},
+			expected:     true,
+		},
+		{
+			name:         "title just inside",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: title + "!!!!", Summary: summary},
+			expected:     true,
+		},
+		{
+			name:         "title just outside",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: title + "!!!!!", Summary: summary},
+			expected:     false,
+		},
+		{
+			name:         "summary just inside",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: title, Summary: summary + " (Update)"},
+			expected:     true,
+		},
+		{
+			name:         "summary just outside",
+			maxEditDedup: 0.1,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: title, Summary: summary + " (Updated)"},
+			expected:     false,
+		},
+		{
+			name:         "short title just inside",
+			maxEditDedup: 0.3,
+			old:          models.Article{Title: "Go 1.25", Summary: summary},
+			new:          models.Article{Title: "Go 1.36", Summary: summary},
+			expected:     true,
+		},
+		{
+			name:         "short title just outside",
+			maxEditDedup: 0.3,
+			old:          models.Article{Title: "Go 1.25", Summary: summary},
+			new:          models.Article{Title: "Go 2.36", Summary: summary},
+			expected:     false,
+		},
+		{
+			name:         "single edit to very short title",
+			maxEditDedup: 0.3,
+			old:          models.Article{Title: "Go", Summary: summary},
+			new:          models.Article{Title: "Gp", Summary: summary},
+			expected:     false,
+		},
+		{
+			name:         "unrelated",
+			maxEditDedup: 0.3,
+			old:          models.Article{Title: title, Summary: summary},
+			new:          models.Article{Title: "Local bakery wins regional sourdough award", Summary: summary},
+			expected:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			*maxEditDedup = tc.maxEditDedup
+
+			// Check the test case against the edit distance itself, so that the
+			// pairs stay on the intended side of the threshold.
+			within := func(base string, comp string) bool {
+				if base == comp {
+					return true
+				}
+				return float64(levenshtein.Distance(base, comp))/float64(len(base)) < tc.maxEditDedup
+			}
+			if want := within(tc.old.Title, tc.new.Title) && within(tc.old.Summary, tc.new.Summary); want != tc.expected {
+				t.Fatalf("expected similar %t by edit distance, got %t", tc.expected, want)
+			}
+
+			if got := isDedupSimilar(tc.old, tc.new); got != tc.expected {
+				t.Errorf("expected similar %t, got %t", tc.expected, got)
+			}
+		})
+	}
+}
@@ -2,17 +2,20 @@ package fetch
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"regexp"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	log "github.com/golang/glog"
 	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/events"
 	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/goliath/storage"
 	"github.com/jrupac/goliath/utils"
@@ -27,7 +30,7 @@ var (
 	normalizeFavicons = flag.Bool("normalizeFavicons", true, "If true, resize favicons to 256x256 and encode as PNG.")
 	strictDedup       = flag.Bool("strictDedup", true, "If true, only the link name is used to de-duplicate unread articles.")
 	maxEditDedup      = flag.Float64("maxEditDedup", 0.1,
-		"The max edit distance between articles to be de-duplicated, expressed as percent of content. If `strictDedup` is set, this is ignored.")
+		"The max edit distance between the titles and summaries of articles to be de-duplicated, expressed as percent of their length. If `strictDedup` is set, this is ignored.")
 	minFetchInterval = flag.Duration("minFetchInterval", 10*time.Minute, "Minimum interval between feed fetches.")
 	maxFetchInterval = flag.Duration("maxFetchInterval", 24*time.Hour, "Maximum interval between feed fetches.")
 	emaAlphaFaster   = flag.Float64("emaAlphaFaster", 0.5,
@@ -42,6 +45,7 @@ var (
 	pauseChan             = make(chan struct{})
 	pauseChanDone         = make(chan struct{})
 	resumeChan            = make(chan struct{})
+	startFeedsChan        = make(chan startFeedsRequest)
 	bluemondayTitlePolicy = bluemonday.StrictPolicy()
 	bluemondayBodyPolicy  = makeBodyPolicy()
 )
@@ -86,7 +90,7 @@ var (
 
 var feedFetchStatKeys = []string{
 	"total", "inserted", "marked_read_auto", "updated_existing",
-	"existing_removed", "too_old", "retrieval_cache_hit", "muted",
+	"existing_removed", "too_old", "retrieval_cache_hit", "muted", "grouped",
 }
 
 func init() {
@@ -140,20 +144,133 @@ func Resume() {
 	resumeChan <- struct{}{}
 }
 
+type startFeedsRequest struct {
+	user  models.User
+	feeds []models.Feed
+}
+
+var errFetcherNotRunning = errors.New("fetcher is not running")
+
+var (
+	fetchLoopMu sync.Mutex
+	// Closed when the fetch loop returns, or nil if it was never started.
+	fetchLoopDone chan struct{}
+)
+
+func setFetchLoopDone(done chan struct{}) {
+	fetchLoopMu.Lock()
+	defer fetchLoopMu.Unlock()
+	fetchLoopDone = done
+}
+
+func getFetchLoopDone() chan struct{} {
+	fetchLoopMu.Lock()
+	defer fetchLoopMu.Unlock()
+	return fetchLoopDone
+}
+
+// StartFeeds begins continuous fetching of the newly created feeds with the
+// given IDs without pausing and resuming fetching for all other feeds. If
+// fetching is currently paused, the feeds are picked up when it resumes.
+// If fetching has not started yet or has stopped, an error is returned.
+func StartFeeds(ctx context.Context, d storage.Database, u models.User, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	feeds, err := d.GetAllFeedsForUser(u)
+	if err != nil {
+		return fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+
+	want := map[int64]bool{}
+	for _, id := range ids {
+		want[id] = true
+	}
+	req := startFeedsRequest{user: u}
+	for _, feed := range feeds {
+		if want[feed.ID] {
+			req.feeds = append(req.feeds, feed)
+		}
+	}
+
+	done := getFetchLoopDone()
+	if done == nil {
+		return errFetcherNotRunning
+	}
+	select {
+	case startFeedsChan <- req:
+		return nil
+	case <-done:
+		return errFetcherNotRunning
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type feedLoopKey struct {
+	userID models.UserId
+	feedID int64
+}
+
+// feedLoops tracks the feeds that are being fetched, since a newly created
+// feed may be started both by StartFeeds and by a concurrent read of all feeds.
+type feedLoops struct {
+	mu     sync.Mutex
+	active map[feedLoopKey]bool
+}
+
+func newFeedLoops() *feedLoops {
+	return &feedLoops{active: map[feedLoopKey]bool{}}
+}
+
+// add returns false if the feed is already being fetched.
+func (l *feedLoops) add(key feedLoopKey) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key] {
+		return false
+	}
+	l.active[key] = true
+	return true
+}
+
+func (l *feedLoops) remove(key feedLoopKey) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.active, key)
+}
+
 type Fetcher struct {
 	d         storage.Database
 	retCache  cache.RetrievalCache
+	hub       *events.Hub
+	fullText  *fullTextQueue
+	webhooks  *webhookDispatcher
+	links     *linkResolver
+	loops     *feedLoops
 	finder    IconFinder
 	fetchFunc rss.FetchFunc
 }
 
-func New(d storage.Database, retCache cache.RetrievalCache) *Fetcher {
+func New(d storage.Database, retCache cache.RetrievalCache, hub *events.Hub) *Fetcher {
 	// Turn off logging of HTTP icon requests.
 	b := besticon.New(besticon.WithLogger(besticon.NewDefaultLogger(io.Discard)))
 
 	return &Fetcher{
 		d:         d,
 		retCache:  retCache,
+		hub:       hub,
+		fullText:  newFullTextQueue(d),
+		webhooks:  newWebhookDispatcher(d),
+		links:     newLinkResolver(),
+		loops:     newFeedLoops(),
 		finder:    b.NewIconFinder(),
 		fetchFunc: fetchFuncWithAcceptHeader,
 	}
@@ -164,6 +281,10 @@ func New(d storage.Database, retCache cache.RetrievalCache) *Fetcher {
 func (f Fetcher) Start(ctx context.Context) {
 	log.Infof("Starting continuous feed fetching.")
 
+	done := make(chan struct{})
+	setFetchLoopDone(done)
+	defer close(done)
+
 	// Add additional time layouts that sometimes appear in feeds.
 	rss.TimeLayouts = append(rss.TimeLayouts, "2006-01-02")
 	rss.TimeLayouts = append(rss.TimeLayouts, "Monday, 02 Jan 2006 15:04:05 MST")
@@ -177,16 +298,23 @@ func (f Fetcher) Start(ctx context.Context) {
 	// on a cancellation of the *parent* context in the select statement below.
 	fetchCtx, cancel := context.WithCancel(ctx)
 
+	// Full-text extraction and webhook deliveries continue while fetching is
+	// paused.
+	f.fullText.start(ctx)
+	f.webhooks.start(ctx)
+
 	// A WaitGroup of size 1 to wait on all fetching to complete.
 	fetchCond := &sync.WaitGroup{}
 	fetchCond.Add(1)
 	go f.start(fetchCtx, fetchCond)
+	paused := false
 
 	for {
 		select {
 		case <-pauseChan:
 			cancel()
 			fetchCond.Wait()
+			paused = true
 			log.Info("Fetcher paused.")
 			pauseChanDone <- struct{}{}
 		case <-resumeChan:
@@ -194,7 +322,20 @@ func (f Fetcher) Start(ctx context.Context) {
 			fetchCtx, cancel = context.WithCancel(ctx)
 			fetchCond.Add(1)
 			go f.start(fetchCtx, fetchCond)
+			paused = false
 			log.Info("Fetcher resumed.")
+		case req := <-startFeedsChan:
+			// While paused, new feeds are read from the database on resume.
+			if paused {
+				break
+			}
+			// These are tracked by the same WaitGroup so that pausing waits for
+			// them as well.
+			fetchCond.Add(len(req.feeds))
+			for _, feed := range req.feeds {
+				go f.fetchUserFeed(fetchCtx, fetchCond, req.user, feed)
+			}
+			log.Infof("Started fetching %d new feeds for %s.", len(req.feeds), req.user)
 		case <-ctx.Done():
 			// Explicitly cancel the child context when returning to avoid leaking it
 			cancel()
@@ -212,6 +353,9 @@ func (f Fetcher) start(ctx context.Context, parent *sync.WaitGroup) {
 		log.Fatalf("cannot start fetcher because fetching users failed: %s", err)
 	}
 
+	// Resume webhook deliveries interrupted by the last shutdown.
+	f.webhooks.resume(users)
+
 	// A WaitGroup used to wait for all users' fetch loops to complete.
 	userCond := &sync.WaitGroup{}
 	userCond.Add(len(users))
@@ -250,6 +394,18 @@ func (f Fetcher) startFetchForUser(ctx context.Context, parent *sync.WaitGroup,
 func (f Fetcher) fetchUserFeed(ctx context.Context, parent *sync.WaitGroup, user models.User, feed models.Feed) {
 	defer parent.Done()
 
+	if feed.Synthetic() {
+		log.V(2).Infof("Not fetching synthetic feed for %s: %s", user, feed)
+		return
+	}
+
+	key := feedLoopKey{userID: user.UserId, feedID: feed.ID}
+	if !f.loops.add(key) {
+		log.V(2).Infof("Already fetching %s %s", user, feed)
+		return
+	}
+	defer f.loops.remove(key)
+
 	log.Infof("Starting fetch for:\n\t%s %s", user, feed)
 	tick := make(<-chan time.Time)
 	firstFetchDone := make(chan firstFetchResult, 1)
@@ -268,7 +424,7 @@ func (f Fetcher) fetchUserFeed(ctx context.Context, parent *sync.WaitGroup, user
 	go func() {
 		feedFetchAttemptsMetric.WithLabelValues(user.Username, feedIDStr, feed.Title, feed.URL).Inc()
 		fetchTime := time.Now()
-		fetch, err := rss.FetchByFunc(f.fetchFunc, feed.URL)
+		fetch, meta, err := f.fetchFeed(feed.URL)
 		if err != nil {
 			log.Warningf("during first fetch for %s %s: %s", user, feed, err)
 			firstFetchDone <- firstFetchResult{
@@ -283,7 +439,7 @@ func (f Fetcher) fetchUserFeed(ctx context.Context, parent *sync.WaitGroup, user
 		f.updateFeedMetadataForUser(ctx, user, &feed, fetch)
 		f.updateFeedFaviconForUser(ctx, user, &feed, fetch)
 
-		f.processUserFeedItems(ctx, user, &feed, fetch.Items)
+		f.processUserFeedItems(ctx, user, &feed, fetch.Items, meta)
 
 		refresh := f.calculateNextInterval(user, &feed, fetch, fetchTime)
 		firstFetchDone <- firstFetchResult{
@@ -316,14 +472,14 @@ func (f Fetcher) fetchUserFeed(ctx context.Context, parent *sync.WaitGroup, user
 			var refresh time.Time
 			var interval time.Duration
 			fetchTime := time.Now()
-			if fetch, err := rss.FetchByFunc(f.fetchFunc, feed.URL); err != nil {
+			if fetch, meta, err := f.fetchFeed(feed.URL); err != nil {
 				log.Warningf("while fetching %s %s: %s", user, feed, err)
 				consecutiveFailures++
 				interval = f.calculateFailureBackoff(consecutiveFailures)
 				refresh = fetchTime.Add(interval)
 				feedFetchErrorsMetric.WithLabelValues(user.Username, feedIDStr, feed.Title, feed.URL).Inc()
 			} else {
-				f.processUserFeedItems(ctx, user, &feed, fetch.Items)
+				f.processUserFeedItems(ctx, user, &feed, fetch.Items, meta)
 				consecutiveFailures = 0
 				refresh = f.calculateNextInterval(user, &feed, fetch, fetchTime)
 				interval = refresh.Sub(fetchTime)
@@ -339,15 +495,21 @@ func (f Fetcher) fetchUserFeed(ctx context.Context, parent *sync.WaitGroup, user
 	}
 }
 
-func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, feed *models.Feed, items []*rss.Item) {
+// IngestItems persists items of a synthetic feed, such as messages of an
+// email newsletter, in the same way as items of fetched feeds. Returns an
+// error if any item could not be persisted.
+func (f Fetcher) IngestItems(ctx context.Context, user models.User, feed *models.Feed, items []*rss.Item) error {
+	return f.processUserFeedItems(ctx, user, feed, items, nil)
+}
+
+// processUserFeedItems persists new items of the feed. The metadata is
+// optional and is applied to the items it has an entry for. Returns an error
+// if any new item could not be persisted.
+func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, feed *models.Feed, items []*rss.Item, meta itemMetadata) error {
 	prevLatest := feed.Latest
 	numTotal := len(items)
-	var numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numTooOld, numRetrievalCache, numMuted int
-
-	existingArticles, err := f.d.GetArticlesForFeedForUser(user, feed.ID)
-	if err != nil {
-		log.Warningf("while fetching existing articles for %s: %s", feed, err)
-	}
+	var numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numTooOld, numRetrievalCache, numMuted, numGrouped int
+	var insertErrs []error
 
 	muteWords, err := f.d.GetMuteWordsForUser(user)
 	if err != nil {
@@ -374,15 +536,44 @@ func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, fee
 		feedRegexes = append(feedRegexes, r)
 	}
 
+	rules, err := f.d.GetRulesForUser(user)
+	if err != nil {
+		log.Warningf("while fetching rules for user %s: %s", user, err)
+	}
+	ruleMatchers := compileRules(rules)
+
+	webhooks, err := f.d.GetWebhooksForUser(user)
+	if err != nil {
+		log.Warningf("while fetching webhooks for user %s: %s", user, err)
+	}
+
+	stories := newStoryGrouper(f.d, user, feed.ID)
+
+	// Notify event stream subscribers of whatever was persisted, even if the
+	// context is canceled partway through.
+	var insertedIds []int64
+	defer func() {
+		f.hub.PublishArticles(user, feed.ID, feed.FolderID, insertedIds)
+	}()
+
 	for _, item := range items {
 		// The context is canceled, so just return
 		if ctx.Err() != nil {
-			return
+			return ctx.Err()
 		}
 
 		a := processItem(feed, item)
+		meta.apply(item, &a)
+		var res ruleResult
+
+		tooOld := !a.Date.After(prevLatest)
+		if !tooOld {
+			// The article hash includes the link, so canonicalize it before
+			// looking the article up.
+			f.links.canonicalize(ctx, &a)
+		}
 
-		if !a.Date.After(prevLatest) {
+		if tooOld {
 			log.V(2).Infof("Not persisting too old article: %s", a)
 			numTooOld += 1
 		} else if f.retCache.Lookup(user, feed.ID, a.Hash()) {
@@ -394,10 +585,27 @@ func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, fee
 		} else if maybeMuteArticle(a, muteWords, unmuteFeeds) {
 			log.V(2).Infof("Not persisting because of muted word: %s", a)
 			numMuted += 1
+		} else if res = applyRules(ruleMatchers, &a, time.Now()); res.mute {
+			log.V(2).Infof("Not persisting because of rules %v: %s", res.matched, a)
+			numMuted += 1
 		} else {
 			numInserted += 1
 
 			// Remove existing articles that are similar to the newly fetched one.
+			// Only articles sharing a link can be similar, so they are looked up
+			// by link rather than comparing against every article of the feed.
+			links := []string{a.Link}
+			if a.OriginalLink != "" {
+				links = append(links, a.OriginalLink)
+			}
+			existingArticles, err := f.d.GetArticlesWithLinksForFeedForUser(user, feed.ID, links)
+			if err != nil {
+				log.Warningf("while fetching existing articles for %s: %s", feed, err)
+			}
+			// Articles inserted during this fetch are not de-duplicated.
+			existingArticles = slices.DeleteFunc(existingArticles, func(o models.Article) bool {
+				return slices.Contains(insertedIds, o.ID)
+			})
 			unreadIds, readIds := getSimilarExistingArticles(existingArticles, a)
 
 			if len(unreadIds) == 0 && len(readIds) > 0 {
@@ -416,11 +624,31 @@ func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, fee
 				}
 			}
 
+			// Group the article with near-duplicates from other feeds.
+			a.Fingerprint = fingerprint(a)
+			if stories.group(&a) {
+				numGrouped += 1
+			}
+
 			log.V(2).Infof("Processed for %s a new article: %s", user, a)
-			if err = f.d.InsertArticleForUser(user, a); err != nil {
+			if id, err := f.d.InsertArticleForUser(user, a); err != nil {
 				log.Warningf("while persisting article for %s due to %s: %s", user, err, a)
+				insertErrs = append(insertErrs, fmt.Errorf("failed to persist article %q: %w", a.Title, err))
 			} else {
 				f.retCache.Add(user, feed.ID, a.Hash())
+				if id != 0 {
+					insertedIds = append(insertedIds, id)
+					if res.star {
+						if err = f.d.MarkArticleForUser(user, id, models.MarkActionSaved); err != nil {
+							log.Warningf("while starring article for %s: %s", feed, err)
+						}
+					}
+					if (feed.FetchFullText || res.fetchFullText) && a.Link != "" {
+						f.fullText.enqueue(fullTextJob{user: user, articleID: id, link: a.Link, syntheticDate: a.SyntheticDate})
+					}
+					a.ID = id
+					f.webhooks.fire(user, feed, webhooks, a, res.matched, rules)
+				}
 			}
 
 			if a.Date.After(feed.Latest) {
@@ -435,16 +663,17 @@ func (f Fetcher) processUserFeedItems(ctx context.Context, user models.User, fee
 	}
 
 	log.Infof(
-		"Fetch stats:\n\t%s %s\n\ttotal=%d, inserted=%d (marked read=%d, updated existing=%d, existing removed=%d), too old=%d, retrieval cache=%d, muted=%d",
-		user, feed, numTotal, numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numTooOld, numRetrievalCache, numMuted)
+		"Fetch stats:\n\t%s %s\n\ttotal=%d, inserted=%d (marked read=%d, updated existing=%d, existing removed=%d, grouped=%d), too old=%d, retrieval cache=%d, muted=%d",
+		user, feed, numTotal, numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numGrouped, numTooOld, numRetrievalCache, numMuted)
 
 	feedIDStr := strconv.FormatInt(feed.ID, 10)
-	statCounts := []int{numTotal, numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numTooOld, numRetrievalCache, numMuted}
+	statCounts := []int{numTotal, numInserted, numMarkedRead, numUpdatedExisting, numExistingRemoved, numTooOld, numRetrievalCache, numMuted, numGrouped}
 	for i, stat := range feedFetchStatKeys {
 		if statCounts[i] > 0 {
 			feedFetchStatsMetric.WithLabelValues(user.Username, feedIDStr, feed.Title, feed.URL, stat).Add(float64(statCounts[i]))
 		}
 	}
+	return errors.Join(insertErrs...)
 }
 
 type firstFetchResult struct {
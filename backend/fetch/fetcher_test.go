@@ -2,13 +2,17 @@ package fetch
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/events"
 	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/goliath/storage"
 	"github.com/jrupac/rss"
@@ -54,7 +58,7 @@ func TestProcessUserFeedItems(t *testing.T) {
 		db := &storage.MockDB{}
 		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache()}
 
-		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items)
+		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items, nil)
 
 		if len(db.InsertedArticles) != 2 {
 			t.Errorf("expected 2 articles to be inserted, got %d", len(db.InsertedArticles))
@@ -72,7 +76,7 @@ func TestProcessUserFeedItems(t *testing.T) {
 		futureTime, _ := time.Parse(time.RFC3339, "2026-01-01T00:00:00Z")
 		futureFeed := &models.Feed{ID: 1, Latest: futureTime}
 
-		fetcher.processUserFeedItems(context.Background(), user, futureFeed, testFeedData.Items)
+		fetcher.processUserFeedItems(context.Background(), user, futureFeed, testFeedData.Items, nil)
 
 		if len(db.InsertedArticles) != 0 {
 			t.Errorf("expected 0 articles to be inserted, got %d", len(db.InsertedArticles))
@@ -82,11 +86,15 @@ func TestProcessUserFeedItems(t *testing.T) {
 	t.Run("marks new article as read if similar existing are all read", func(t *testing.T) {
 		feed := &models.Feed{ID: 1, Latest: pastTime}
 		db := &storage.MockDB{}
-		// Override GetArticlesForFeedForUser to return a similar, read article
+		// Override GetArticlesWithLinksForFeedForUser to return a similar, read article
 		*strictDedup = true
 		defer func() { *strictDedup = true }() // Restore
-		db.OnGetArticlesForFeedForUser = func(u models.User, feedID int64) ([]models.Article, error) {
+		db.OnGetArticlesWithLinksForFeedForUser = func(u models.User, feedID int64, links []string) ([]models.Article, error) {
+			if !slices.Contains(links, "http://example.com/article1") {
+				return nil, nil
+			}
 			return []models.Article{{
+				ID:   10,
 				Link: "http://example.com/article1", // Same link as first test article
 				Read: true,
 			}}, nil
@@ -94,7 +102,7 @@ func TestProcessUserFeedItems(t *testing.T) {
 
 		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache()}
 
-		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items)
+		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items, nil)
 
 		if len(db.InsertedArticles) != 2 {
 			t.Fatalf("expected 2 articles to be inserted, got %d", len(db.InsertedArticles))
@@ -114,6 +122,134 @@ func TestProcessUserFeedItems(t *testing.T) {
 			t.Error("did not find article 1 in inserted articles")
 		}
 	})
+
+	t.Run("publishes inserted articles", func(t *testing.T) {
+		feed := &models.Feed{ID: 1, FolderID: 2, Latest: pastTime}
+		db := &storage.MockDB{}
+		hub := events.NewHub()
+		sub := hub.Subscribe(user)
+		defer sub.Cancel()
+		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache(), hub: hub}
+
+		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items, nil)
+
+		select {
+		case e := <-sub.C:
+			if e.Type != events.TypeArticles || e.FeedID != 1 || e.FolderID != 2 {
+				t.Errorf("unexpected event: %+v", e)
+			}
+			if len(e.ArticleIDs) != 2 {
+				t.Errorf("expected 2 article IDs, got %d", len(e.ArticleIDs))
+			}
+		default:
+			t.Error("expected an articles event to be published")
+		}
+	})
+
+	t.Run("reports articles that failed to persist", func(t *testing.T) {
+		db := &storage.MockDB{
+			OnInsertArticleForUser: func(u models.User, a models.Article) (int64, error) {
+				return 0, errors.New("connection refused")
+			},
+		}
+		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache()}
+
+		err := fetcher.processUserFeedItems(context.Background(), user, &models.Feed{ID: 1, Latest: pastTime}, testFeedData.Items, nil)
+		if err == nil || !strings.Contains(err.Error(), "connection refused") {
+			t.Errorf("expected insert error, got %v", err)
+		}
+
+		db.OnInsertArticleForUser = nil
+		if err = fetcher.processUserFeedItems(context.Background(), user, &models.Feed{ID: 2, Latest: pastTime}, testFeedData.Items, nil); err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("queues full text extraction for feeds that fetch full text", func(t *testing.T) {
+		db := &storage.MockDB{}
+		queue := &fullTextQueue{d: db, jobs: make(chan fullTextJob, 10)}
+		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache(), fullText: queue}
+
+		fetcher.processUserFeedItems(context.Background(), user, &models.Feed{ID: 1, Latest: pastTime}, testFeedData.Items, nil)
+		if len(queue.jobs) != 0 {
+			t.Fatalf("expected no jobs for feed without full text, got %d", len(queue.jobs))
+		}
+
+		feed := &models.Feed{ID: 2, Latest: pastTime, FetchFullText: true}
+		fetcher.processUserFeedItems(context.Background(), user, feed, testFeedData.Items, nil)
+		if len(queue.jobs) != 2 {
+			t.Fatalf("expected 2 jobs, got %d", len(queue.jobs))
+		}
+		job := <-queue.jobs
+		if job.link != "http://example.com/article1" || job.articleID == 0 {
+			t.Errorf("unexpected job: %+v", job)
+		}
+	})
+
+	t.Run("applies rules", func(t *testing.T) {
+		var starred []int64
+		db := &storage.MockDB{
+			OnGetRulesForUser: func(u models.User) ([]models.Rule, error) {
+				return []models.Rule{
+					{ID: 1, Name: "mute first", Conditions: models.RuleConditions{TitleRegex: "article 1$"}, Actions: models.RuleActions{Mute: true}},
+					{ID: 2, Name: "label second", Conditions: models.RuleConditions{ContentRegex: "second"}, Actions: models.RuleActions{
+						MarkRead: true, Star: true, Labels: []string{"later"}, Priority: true, FetchFullText: true,
+					}},
+				}, nil
+			},
+			OnMarkArticleForUser: func(u models.User, id int64, mark models.MarkAction) error {
+				if mark == models.MarkActionSaved {
+					starred = append(starred, id)
+				}
+				return nil
+			},
+		}
+		queue := &fullTextQueue{d: db, jobs: make(chan fullTextJob, 10)}
+		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache(), fullText: queue}
+
+		fetcher.processUserFeedItems(context.Background(), user, &models.Feed{ID: 1, Latest: pastTime}, testFeedData.Items, nil)
+
+		if len(db.InsertedArticles) != 1 {
+			t.Fatalf("expected 1 article to be inserted, got %d", len(db.InsertedArticles))
+		}
+		a := db.InsertedArticles[0]
+		if a.Title != "Test Article 2" || !a.Read || !a.Priority || len(a.Labels) != 1 || a.Labels[0] != "later" {
+			t.Errorf("expected rule actions to be applied, got %+v", a)
+		}
+		if len(starred) != 1 || starred[0] != 1 {
+			t.Errorf("expected inserted article to be starred, got %v", starred)
+		}
+		if len(queue.jobs) != 1 {
+			t.Errorf("expected 1 full text job, got %d", len(queue.jobs))
+		}
+	})
+
+	t.Run("fires matching webhooks", func(t *testing.T) {
+		var delivered []models.WebhookDelivery
+		db := &storage.MockDB{
+			OnGetWebhooksForUser: func(u models.User) ([]models.Webhook, error) {
+				return []models.Webhook{
+					{ID: 1, URL: "http://example.com/all"},
+					{ID: 2, URL: "http://example.com/second", Filter: models.WebhookFilter{Keywords: []string{"second"}}},
+				}, nil
+			},
+			OnInsertWebhookDeliveryForUser: func(u models.User, d models.WebhookDelivery) (int64, error) {
+				delivered = append(delivered, d)
+				return int64(len(delivered)), nil
+			},
+		}
+		webhooks := &webhookDispatcher{d: db, jobs: make(chan webhookJob, 10)}
+		fetcher := Fetcher{d: db, retCache: cache.NewMockRetrievalCache(), webhooks: webhooks}
+
+		fetcher.processUserFeedItems(context.Background(), user, &models.Feed{ID: 1, Latest: pastTime}, testFeedData.Items, nil)
+
+		if len(delivered) != 3 || len(webhooks.jobs) != 3 {
+			t.Fatalf("expected 3 deliveries, got %d (%d queued)", len(delivered), len(webhooks.jobs))
+		}
+		if last := delivered[2]; last.WebhookID != 2 || last.ArticleID != 2 {
+			t.Errorf("unexpected delivery: %+v", last)
+		}
+	})
 }
 
 func TestFetchUserFeed(t *testing.T) {
@@ -148,6 +284,32 @@ func TestFetchUserFeed(t *testing.T) {
 	}
 }
 
+func TestFetchUserFeed_AlreadyFetching(t *testing.T) {
+	user := models.User{UserId: "test-user"}
+	feed := models.Feed{ID: 1, URL: "http://example.com/feed"}
+	fetched := false
+
+	fetcher := Fetcher{
+		d:        &storage.MockDB{},
+		retCache: cache.NewMockRetrievalCache(),
+		loops:    newFeedLoops(),
+		fetchFunc: func(url string) (*http.Response, error) {
+			fetched = true
+			return mockFetchFunc(url)
+		},
+	}
+	fetcher.loops.add(feedLoopKey{userID: user.UserId, feedID: feed.ID})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	fetcher.fetchUserFeed(context.Background(), &wg, user, feed)
+	wg.Wait()
+
+	if fetched {
+		t.Error("expected feed that is already being fetched to not be fetched again")
+	}
+}
+
 func TestFetcher_PauseResume(t *testing.T) {
 	user := models.User{UserId: "test-user"}
 	db := &storage.MockDB{
@@ -162,7 +324,7 @@ func TestFetcher_PauseResume(t *testing.T) {
 	}
 
 	retCache := cache.NewMockRetrievalCache()
-	fetcher := New(db, retCache)
+	fetcher := New(db, retCache, nil)
 	fetcher.fetchFunc = mockFetchFunc
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -204,3 +366,74 @@ func TestFetcher_PauseResume(t *testing.T) {
 		t.Fatal("timed out waiting for fetcher to resume")
 	}
 }
+
+func TestFetcher_StartFeeds(t *testing.T) {
+	user := models.User{UserId: "test-user"}
+	var lock sync.Mutex
+	var feeds []models.Feed
+	db := &storage.MockDB{
+		GetAllUsersCalled:  make(chan bool, 1),
+		ProcessItemsCalled: make(chan bool, 2),
+		OnGetAllUsers: func() ([]models.User, error) {
+			return []models.User{user}, nil
+		},
+		OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return feeds, nil
+		},
+	}
+
+	fetcher := New(db, cache.NewMockRetrievalCache(), nil)
+	fetcher.fetchFunc = mockFetchFunc
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go fetcher.Start(ctx)
+
+	select {
+	case <-db.GetAllUsersCalled:
+	case <-time.After(1 * time.Second):
+		t.Fatal("timed out waiting for fetcher to start")
+	}
+
+	// Simulate a feed being created after fetching started.
+	lock.Lock()
+	feeds = []models.Feed{{ID: 1, URL: "http://example.com/feed"}, {ID: 2, URL: "http://example.com/other"}}
+	lock.Unlock()
+
+	if err := StartFeeds(ctx, db, user, []int64{1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	select {
+	case <-db.ProcessItemsCalled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for new feed to be fetched")
+	}
+
+	select {
+	case <-db.GetAllUsersCalled:
+		t.Error("expected fetching to not be restarted")
+	default:
+	}
+}
+
+func TestStartFeeds_NotRunning(t *testing.T) {
+	old := getFetchLoopDone()
+	setFetchLoopDone(nil)
+	defer setFetchLoopDone(old)
+
+	user := models.User{UserId: "test-user"}
+	db := &storage.MockDB{
+		OnGetAllFeedsForUser: func(u models.User) ([]models.Feed, error) {
+			return []models.Feed{{ID: 1, URL: "http://example.com/feed"}}, nil
+		},
+	}
+
+	err := StartFeeds(context.Background(), db, user, []int64{1})
+	if !errors.Is(err, errFetcherNotRunning) {
+		t.Errorf("expected %v, got %v", errFetcherNotRunning, err)
+	}
+}
@@ -0,0 +1,143 @@
+package fetch
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	fullTextWorkers    = flag.Int("fullTextWorkers", 4, "Number of concurrent full-text extractions for feeds that fetch full text.")
+	fullTextQueueSize  = flag.Int("fullTextQueueSize", 1000, "Maximum number of articles waiting for full-text extraction.")
+	fullTextMaxRetries = flag.Int("fullTextMaxRetries", 3, "Maximum number of retries of a failed full-text extraction.")
+	fullTextRetryDelay = flag.Duration("fullTextRetryDelay", time.Minute,
+		"Delay before the first retry of a failed full-text extraction. The delay doubles on each subsequent retry.")
+)
+
+var (
+	fullTextExtractionsMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "full_text_extractions_total",
+			Help: "Total number of background full-text extractions by result: success, retry, failure, or dropped (queue full).",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(fullTextExtractionsMetric)
+}
+
+type fullTextJob struct {
+	user      models.User
+	articleID int64
+	link      string
+	// syntheticDate is set if the feed gave no date for the article, in
+	// which case the date found by a site rule replaces its retrieval time.
+	syntheticDate bool
+	attempt       int
+}
+
+// fullTextQueue extracts the full text of articles in the background with a
+// bounded number of workers and stores it as the articles' parsed content.
+type fullTextQueue struct {
+	d    storage.Database
+	jobs chan fullTextJob
+	// extract returns the full text of the article at the given URL and the
+	// lead image and canonical link of its page.
+	extract func(context.Context, string) (fullTextResult, error)
+}
+
+func newFullTextQueue(d storage.Database) *fullTextQueue {
+	return &fullTextQueue{
+		d:       d,
+		jobs:    make(chan fullTextJob, *fullTextQueueSize),
+		extract: extractSanitizedFullTextResult,
+	}
+}
+
+// start runs the queue's workers until the given context is canceled.
+func (q *fullTextQueue) start(ctx context.Context) {
+	if q == nil {
+		return
+	}
+	for i := 0; i < *fullTextWorkers; i++ {
+		go q.work(ctx)
+	}
+}
+
+// enqueue adds a job to the queue without blocking. Jobs are dropped if the
+// queue is full.
+func (q *fullTextQueue) enqueue(job fullTextJob) {
+	if q == nil {
+		return
+	}
+	select {
+	case q.jobs <- job:
+	default:
+		log.Warningf("Full-text queue is full, dropping article %d for %s", job.articleID, job.user)
+		fullTextExtractionsMetric.WithLabelValues("dropped").Inc()
+	}
+}
+
+func (q *fullTextQueue) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-q.jobs:
+			q.process(ctx, job)
+		}
+	}
+}
+
+func (q *fullTextQueue) process(ctx context.Context, job fullTextJob) {
+	res, err := q.extract(ctx, job.link)
+	if err == nil {
+		err = q.d.UpdateArticleParsedContentForUser(job.user, job.articleID, res.content, AnalyzeText(res.content))
+	}
+	if err == nil {
+		log.V(2).Infof("Extracted full text of article %d for %s", job.articleID, job.user)
+		if res.image != "" {
+			if err = q.d.UpdateArticleThumbnailForUser(job.user, job.articleID, res.image); err != nil {
+				log.Warningf("while updating thumbnail of article %d for %s: %s", job.articleID, job.user, err)
+			}
+		}
+		if *canonicalizeLinks && res.canonical != "" && res.canonical != job.link {
+			if err = q.d.UpdateArticleLinkForUser(job.user, job.articleID, res.canonical); err != nil {
+				log.Warningf("while updating link of article %d for %s: %s", job.articleID, job.user, err)
+			}
+		}
+		if job.syntheticDate && !res.date.IsZero() {
+			if err = q.d.UpdateArticleDateForUser(job.user, job.articleID, res.date); err != nil {
+				log.Warningf("while updating date of article %d for %s: %s", job.articleID, job.user, err)
+			}
+		}
+		fullTextExtractionsMetric.WithLabelValues("success").Inc()
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	if job.attempt >= *fullTextMaxRetries {
+		log.Warningf("Giving up on full text of article %d (%s) for %s: %s", job.articleID, job.link, job.user, err)
+		fullTextExtractionsMetric.WithLabelValues("failure").Inc()
+		return
+	}
+
+	delay := *fullTextRetryDelay << job.attempt
+	log.V(2).Infof("Retrying full text of article %d (%s) in %s: %s", job.articleID, job.link, delay, err)
+	fullTextExtractionsMetric.WithLabelValues("retry").Inc()
+	job.attempt++
+	time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			q.enqueue(job)
+		}
+	})
+}
@@ -0,0 +1,178 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestFullTextQueue(t *testing.T) {
+	user := models.User{UserId: "test-user"}
+
+	t.Run("stores extracted content", func(t *testing.T) {
+		stored := make(chan string, 1)
+		thumbnails := make(chan string, 1)
+		links := make(chan string, 1)
+		db := &storage.MockDB{
+			OnUpdateArticleLinkForUser: func(u models.User, id int64, link string) error {
+				links <- link
+				return nil
+			},
+			OnUpdateArticleThumbnailForUser: func(u models.User, id int64, thumbnail string) error {
+				thumbnails <- thumbnail
+				return nil
+			},
+			OnUpdateArticleParsedContentForUser: func(u models.User, id int64, parsed string, stats models.TextStats) error {
+				if id != 7 {
+					t.Errorf("expected article 7, got %d", id)
+				}
+				stored <- parsed
+				return nil
+			},
+		}
+		q := &fullTextQueue{
+			d:    db,
+			jobs: make(chan fullTextJob, 1),
+			extract: func(ctx context.Context, url string) (fullTextResult, error) {
+				return fullTextResult{
+					content:   "<p>full text of " + url + "</p>",
+					image:     "http://example.com/lead.jpg",
+					canonical: "http://example.com/canonical/a",
+				}, nil
+			},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.start(ctx)
+
+		q.enqueue(fullTextJob{user: user, articleID: 7, link: "http://example.com/a"})
+
+		select {
+		case parsed := <-stored:
+			if parsed != "<p>full text of http://example.com/a</p>" {
+				t.Errorf("unexpected parsed content: %q", parsed)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for parsed content")
+		}
+		select {
+		case thumbnail := <-thumbnails:
+			if thumbnail != "http://example.com/lead.jpg" {
+				t.Errorf("unexpected thumbnail: %q", thumbnail)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for thumbnail")
+		}
+		select {
+		case link := <-links:
+			if link != "http://example.com/canonical/a" {
+				t.Errorf("unexpected link: %q", link)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for link")
+		}
+	})
+
+	t.Run("replaces synthetic dates with rule dates", func(t *testing.T) {
+		ruleDate := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+		dates := make(chan time.Time, 2)
+		stored := make(chan int64, 2)
+		db := &storage.MockDB{
+			OnUpdateArticleDateForUser: func(u models.User, id int64, date time.Time) error {
+				if id != 2 {
+					t.Errorf("expected only article 2 to be updated, got %d", id)
+				}
+				dates <- date
+				return nil
+			},
+			OnUpdateArticleParsedContentForUser: func(u models.User, id int64, parsed string, stats models.TextStats) error {
+				stored <- id
+				return nil
+			},
+		}
+		q := &fullTextQueue{
+			d:    db,
+			jobs: make(chan fullTextJob, 2),
+			extract: func(ctx context.Context, url string) (fullTextResult, error) {
+				return fullTextResult{content: "<p>full text</p>", date: ruleDate}, nil
+			},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.start(ctx)
+
+		q.enqueue(fullTextJob{user: user, articleID: 1, link: "http://example.com/a"})
+		q.enqueue(fullTextJob{user: user, articleID: 2, link: "http://example.com/b", syntheticDate: true})
+
+		select {
+		case date := <-dates:
+			if !date.Equal(ruleDate) {
+				t.Errorf("expected date %s, got %s", ruleDate, date)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for date")
+		}
+		for i := 0; i < 2; i++ {
+			select {
+			case <-stored:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for parsed content")
+			}
+		}
+	})
+
+	t.Run("retries failed extractions", func(t *testing.T) {
+		origDelay, origRetries := *fullTextRetryDelay, *fullTextMaxRetries
+		*fullTextRetryDelay, *fullTextMaxRetries = time.Millisecond, 2
+		defer func() { *fullTextRetryDelay, *fullTextMaxRetries = origDelay, origRetries }()
+
+		attempts := make(chan struct{}, 10)
+		q := &fullTextQueue{
+			d:    &storage.MockDB{},
+			jobs: make(chan fullTextJob, 1),
+			extract: func(ctx context.Context, url string) (fullTextResult, error) {
+				attempts <- struct{}{}
+				return fullTextResult{}, errors.New("failed")
+			},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		q.start(ctx)
+
+		q.enqueue(fullTextJob{user: user, articleID: 1, link: "http://example.com/a"})
+
+		// The initial attempt plus two retries.
+		for i := 0; i < 3; i++ {
+			select {
+			case <-attempts:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for attempt %d", i+1)
+			}
+		}
+		select {
+		case <-attempts:
+			t.Error("expected no more than 2 retries")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("drops jobs when full", func(t *testing.T) {
+		q := &fullTextQueue{jobs: make(chan fullTextJob, 1)}
+		q.enqueue(fullTextJob{articleID: 1})
+		q.enqueue(fullTextJob{articleID: 2})
+
+		if len(q.jobs) != 1 || (<-q.jobs).articleID != 1 {
+			t.Error("expected only the first job to be queued")
+		}
+	})
+
+	t.Run("nil queue is a no-op", func(t *testing.T) {
+		var q *fullTextQueue
+		q.start(context.Background())
+		q.enqueue(fullTextJob{articleID: 1})
+	})
+}
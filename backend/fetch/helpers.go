@@ -31,6 +31,10 @@ func (f Fetcher) updateFeedMetadataForUser(ctx context.Context, u models.User, m
 		// angle brackets as tags — this preserves titles like "<antirez>".
 		mFeed.Title = strings.TrimSpace(html.UnescapeString(rFeed.Title))
 	}
+	if mFeed.CustomTitle != "" {
+		// A user-assigned title takes precedence over the feed's own title.
+		mFeed.Title = mFeed.CustomTitle
+	}
 	if rFeed.Description != "" {
 		mFeed.Description = strings.TrimSpace(html.UnescapeString(rFeed.Description))
 	}
@@ -0,0 +1,267 @@
+package fetch
+
+import (
+	"container/list"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	canonicalizeLinks  = flag.Bool("canonicalizeLinks", true, "If true, known tracking parameters are removed from the links of new articles.")
+	unshortenLinks     = flag.Bool("unshortenLinks", true, "If true, links of new articles to known redirect shorteners are replaced by their targets.")
+	unshortenTimeout   = flag.Duration("unshortenTimeout", 5*time.Second, "Timeout for resolving a link through redirect shorteners.")
+	unshortenCacheSize = flag.Int("unshortenCacheSize", 10000, "Maximum number of resolved shortened links kept in memory.")
+)
+
+// maxUnshortenHops is the maximum number of redirects followed to resolve a
+// shortened link.
+const maxUnshortenHops = 5
+
+var (
+	unshortenedLinksMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "unshortened_links_total",
+			Help: "Total number of shortened links resolved by result: success, failure, or cached.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(unshortenedLinksMetric)
+}
+
+// trackingParams are query parameters that only track where a visitor came
+// from. Parameters starting with "utm_" are removed as well.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "gclsrc": true, "dclid": true, "msclkid": true, "yclid": true,
+	"mc_cid": true, "mc_eid": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true, "igshid": true,
+	"oly_anon_id": true, "oly_enc_id": true, "vero_id": true, "rb_clid": true, "s_cid": true,
+	"_ga": true, "_gl": true, "ncid": true, "xtor": true, "ref_src": true, "wt_mc": true, "cmpid": true,
+}
+
+// shortenerHosts are the hosts of services that only redirect to other links.
+var shortenerHosts = map[string]bool{
+	"feedproxy.google.com": true, "t.co": true, "bit.ly": true, "bitly.com": true, "j.mp": true,
+	"ow.ly": true, "buff.ly": true, "dlvr.it": true, "goo.gl": true, "tinyurl.com": true,
+	"trib.al": true, "lnkd.in": true, "fb.me": true, "is.gd": true, "rebrand.ly": true,
+	"amzn.to": true, "wp.me": true, "tiny.cc": true, "shorturl.at": true,
+}
+
+// isShortened returns true if the URL points at a redirect shortener. Links
+// through FeedBurner redirect as well.
+func isShortened(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if shortenerHosts[host] {
+		return true
+	}
+	return host == "feeds.feedburner.com" && strings.HasPrefix(u.Path, "/~r/")
+}
+
+// stripTrackingParams returns the link without known tracking query
+// parameters. The order of the remaining parameters is kept.
+func stripTrackingParams(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || (u.RawQuery == "" && !strings.Contains(u.Fragment, "=")) {
+		return link
+	}
+
+	var kept []string
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		if p == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(p, "=")
+		if k, err := url.QueryUnescape(key); err == nil && isTrackingParam(k) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	u.ForceQuery = false
+
+	// Some publishers put tracking parameters in the fragment instead.
+	if key, _, ok := strings.Cut(u.Fragment, "="); ok && isTrackingParam(key) {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	return u.String()
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return strings.HasPrefix(key, "utm_") || trackingParams[key]
+}
+
+// linkResolver canonicalizes the links of articles, resolving shortened links
+// through their redirects. Resolved links are cached since the same items are
+// seen on every fetch of a feed.
+type linkResolver struct {
+	client *http.Client
+
+	mu      sync.Mutex
+	size    int
+	lru     *list.List // of *resolvedLink, most recently used first
+	entries map[string]*list.Element
+}
+
+type resolvedLink struct {
+	short  string
+	target string
+}
+
+func newLinkResolver() *linkResolver {
+	return &linkResolver{
+		client: &http.Client{
+			// Each redirect is followed separately so that every hop goes
+			// through the SSRF checks of the transport.
+			Transport: utils.NewSafeTransport(),
+			Timeout:   *unshortenTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		size:    *unshortenCacheSize,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// canonicalize rewrites the link of the article to its canonical form and
+// keeps the link given by the feed as the article's original link if it
+// differs. A nil resolver only removes tracking parameters.
+func (r *linkResolver) canonicalize(ctx context.Context, a *models.Article) {
+	if a.Link == "" || !*canonicalizeLinks {
+		return
+	}
+
+	link := a.Link
+	if r != nil && *unshortenLinks {
+		link = r.resolve(ctx, link)
+	}
+	link = stripTrackingParams(link)
+
+	if link != a.Link {
+		log.V(2).Infof("Canonicalized link %s to %s", a.Link, link)
+		a.OriginalLink = a.Link
+		a.Link = link
+	}
+}
+
+// resolve returns the target of the link if it points at a redirect
+// shortener, or the link itself otherwise or if it cannot be resolved.
+func (r *linkResolver) resolve(ctx context.Context, link string) string {
+	u, err := url.Parse(link)
+	if err != nil || !isShortened(u) {
+		return link
+	}
+
+	if target, ok := r.lookup(link); ok {
+		unshortenedLinksMetric.WithLabelValues("cached").Inc()
+		return target
+	}
+
+	target, err := r.follow(ctx, u)
+	if err != nil {
+		log.V(2).Infof("Failed to resolve shortened link %s: %s", link, err)
+		unshortenedLinksMetric.WithLabelValues("failure").Inc()
+		// Do not retry on every fetch.
+		target = link
+	} else {
+		unshortenedLinksMetric.WithLabelValues("success").Inc()
+	}
+	r.add(link, target)
+	return target
+}
+
+// follow requests the URL and its redirects for as long as they point at
+// redirect shorteners and returns the first URL that does not. Only the
+// shorteners are requested, never the target itself.
+func (r *linkResolver) follow(ctx context.Context, u *url.URL) (string, error) {
+	for hop := 0; hop < maxUnshortenHops; hop++ {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return "", fmt.Errorf("unsupported scheme: %s", u.Scheme)
+		}
+
+		next, err := r.location(ctx, u, http.MethodHead)
+		if err == nil && next == nil {
+			// Some shorteners do not redirect HEAD requests.
+			next, err = r.location(ctx, u, http.MethodGet)
+		}
+		if err != nil {
+			return "", err
+		}
+		if next == nil {
+			return "", fmt.Errorf("no redirect from %s", u)
+		}
+		if !isShortened(next) {
+			return next.String(), nil
+		}
+		u = next
+	}
+	return "", fmt.Errorf("stopped after %d redirects", maxUnshortenHops)
+}
+
+// location returns the URL the given URL redirects to, or nil if the
+// response is not a redirect.
+func (r *linkResolver) location(ctx context.Context, u *url.URL, method string) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", *fullTextUserAgent)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return nil, nil
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, nil
+	}
+	return u.Parse(loc)
+}
+
+func (r *linkResolver) lookup(link string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.entries[link]
+	if !ok {
+		return "", false
+	}
+	r.lru.MoveToFront(elem)
+	return elem.Value.(*resolvedLink).target, true
+}
+
+func (r *linkResolver) add(link, target string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if elem, ok := r.entries[link]; ok {
+		elem.Value.(*resolvedLink).target = target
+		r.lru.MoveToFront(elem)
+		return
+	}
+	r.entries[link] = r.lru.PushFront(&resolvedLink{short: link, target: target})
+	for r.lru.Len() > r.size {
+		e := r.lru.Remove(r.lru.Back()).(*resolvedLink)
+		delete(r.entries, e.short)
+	}
+}
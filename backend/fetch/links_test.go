@@ -0,0 +1,176 @@
+package fetch
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+)
+
+func TestStripTrackingParams(t *testing.T) {
+	testCases := []struct {
+		name     string
+		link     string
+		expected string
+	}{
+		{
+			name:     "no query",
+			link:     "https://example.com/post",
+			expected: "https://example.com/post",
+		},
+		{
+			name:     "utm parameters",
+			link:     "https://example.com/post?utm_source=rss&utm_medium=feed&UTM_Campaign=x",
+			expected: "https://example.com/post",
+		},
+		{
+			name:     "keeps other parameters in order",
+			link:     "https://example.com/post?z=1&fbclid=abc&a=2&gclid=def&m",
+			expected: "https://example.com/post?z=1&a=2&m",
+		},
+		{
+			name:     "tracking fragment",
+			link:     "https://example.com/post?id=3#utm_source=feed",
+			expected: "https://example.com/post?id=3",
+		},
+		{
+			name:     "keeps other fragments",
+			link:     "https://example.com/post?ref_src=twsrc#comments",
+			expected: "https://example.com/post#comments",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := stripTrackingParams(tc.link); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsShortened(t *testing.T) {
+	for link, expected := range map[string]bool{
+		"https://t.co/abc": true,
+		"http://feedproxy.google.com/~r/Example/~3/x": true,
+		"http://feeds.feedburner.com/~r/Example/~3/x": true,
+		"http://feeds.feedburner.com/Example":         false,
+		"https://example.com/t.co":                    false,
+	} {
+		u, _ := url.Parse(link)
+		if got := isShortened(u); got != expected {
+			t.Errorf("%s: expected %t, got %t", link, expected, got)
+		}
+	}
+}
+
+func TestLinkResolver(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			// Only redirect GET requests.
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://example.com/post?id=1&utm_source=twitter", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// Treat the test server as a shortener. Its private address would be
+	// rejected by the resolver's transport, so use a plain client instead.
+	serverURL, _ := url.Parse(server.URL)
+	shortenerHosts[serverURL.Hostname()] = true
+	defer delete(shortenerHosts, serverURL.Hostname())
+
+	r := newLinkResolver()
+	r.client = &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	a := models.Article{Link: server.URL + "/a"}
+	r.canonicalize(context.Background(), &a)
+	if a.Link != "https://example.com/post?id=1" {
+		t.Errorf("unexpected link: %s", a.Link)
+	}
+	if a.OriginalLink != server.URL+"/a" {
+		t.Errorf("unexpected original link: %s", a.OriginalLink)
+	}
+
+	// Resolved links are cached.
+	n := requests.Load()
+	a = models.Article{Link: server.URL + "/a"}
+	r.canonicalize(context.Background(), &a)
+	if a.Link != "https://example.com/post?id=1" || requests.Load() != n {
+		t.Errorf("expected cached link, got %s after %d requests", a.Link, requests.Load()-n)
+	}
+
+	// Links that cannot be resolved are kept.
+	for _, path := range []string{"/loop", "/missing"} {
+		a = models.Article{Link: server.URL + path}
+		r.canonicalize(context.Background(), &a)
+		if a.Link != server.URL+path || a.OriginalLink != "" {
+			t.Errorf("%s: expected unchanged link, got %s (%s)", path, a.Link, a.OriginalLink)
+		}
+	}
+
+	// Links that are not shortened are not requested.
+	n = requests.Load()
+	a = models.Article{Link: "https://example.com/other?utm_medium=feed"}
+	r.canonicalize(context.Background(), &a)
+	if a.Link != "https://example.com/other" || requests.Load() != n {
+		t.Errorf("unexpected link %s after %d requests", a.Link, requests.Load()-n)
+	}
+
+	// A nil resolver only strips tracking parameters.
+	var nilResolver *linkResolver
+	a = models.Article{Link: server.URL + "/a?utm_source=x"}
+	nilResolver.canonicalize(context.Background(), &a)
+	if a.Link != server.URL+"/a" {
+		t.Errorf("unexpected link: %s", a.Link)
+	}
+}
+
+func TestLinkResolverCacheEviction(t *testing.T) {
+	r := &linkResolver{size: 2, lru: list.New(), entries: map[string]*list.Element{}}
+	r.add("a", "1")
+	r.add("b", "2")
+	r.lookup("a")
+	r.add("c", "3")
+
+	if _, ok := r.lookup("b"); ok {
+		t.Error("expected least recently used link to be evicted")
+	}
+	for link, expected := range map[string]string{"a": "1", "c": "3"} {
+		if got, ok := r.lookup(link); !ok || got != expected {
+			t.Errorf("%s: expected %q, got %q (%t)", link, expected, got, ok)
+		}
+	}
+}
+
+func TestSameLink(t *testing.T) {
+	old := models.Article{Link: "http://feedproxy.google.com/~r/x"}
+	canonical := models.Article{Link: "https://example.com/post", OriginalLink: "http://feedproxy.google.com/~r/x"}
+	if !sameLink(old, canonical) {
+		t.Error("expected article stored before canonicalization to match its original link")
+	}
+	if sameLink(models.Article{Link: "https://example.com/a"}, models.Article{Link: "https://example.com/b"}) {
+		t.Error("expected different links not to match")
+	}
+}
@@ -0,0 +1,307 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/rss"
+	"golang.org/x/net/html/charset"
+)
+
+// rssAuthorRegex matches the "email (Name)" format of RSS author elements.
+var rssAuthorRegex = regexp.MustCompile(`^\S+@\S+\s+\((.+)\)$`)
+
+// itemMeta is metadata of a feed item that the RSS library does not parse.
+type itemMeta struct {
+	authors   []string
+	comments  string
+	thumbnail string
+	// duration is the playing time of the item's media.
+	duration time.Duration
+}
+
+// itemMetadata maps item IDs and links to their metadata.
+type itemMetadata map[string]itemMeta
+
+// apply sets the metadata of the given item on the article.
+func (m itemMetadata) apply(item *rss.Item, a *models.Article) {
+	meta, ok := m[item.ID]
+	if !ok || item.ID == "" {
+		if meta, ok = m[item.Link]; !ok || item.Link == "" {
+			return
+		}
+	}
+	a.Authors = meta.authors
+	if meta.comments != "" {
+		a.CommentsURL = getAbsoluteUrl(a.Link, meta.comments)
+	}
+	// Thumbnails chosen by the publisher take precedence over ones found in the
+	// item's contents.
+	if meta.thumbnail != "" {
+		a.Thumbnail = processImageUrl(a.Link, meta.thumbnail)
+	}
+	if meta.duration > 0 {
+		for i := range a.Enclosures {
+			if a.Enclosures[i].Playable() && a.Enclosures[i].Duration == 0 {
+				a.Enclosures[i].Duration = meta.duration
+			}
+		}
+	}
+}
+
+// fetchFeed fetches and parses the feed at the given URL along with the
+// metadata of its items.
+func (f Fetcher) fetchFeed(feedURL string) (*rss.Feed, itemMetadata, error) {
+	var body []byte
+	capture := func(u string) (*http.Response, error) {
+		resp, err := f.fetchFunc(u)
+		if err != nil {
+			return resp, err
+		}
+		body, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+
+	fetch, err := rss.FetchByFunc(capture, feedURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fetch, parseItemMetadata(body), nil
+}
+
+type xmlMetaLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Text string `xml:",chardata"`
+}
+
+// xmlMediaElem is a Media RSS <media:thumbnail> or <media:content> element.
+// Thumbnails may be nested in content elements.
+type xmlMediaElem struct {
+	URL        string         `xml:"url,attr"`
+	Medium     string         `xml:"medium,attr"`
+	Type       string         `xml:"type,attr"`
+	Duration   string         `xml:"duration,attr"`
+	Thumbnails []xmlMediaElem `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// xmlMediaGroup is a <media:group> element.
+type xmlMediaGroup struct {
+	Thumbnails []xmlMediaElem `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Contents   []xmlMediaElem `xml:"http://search.yahoo.com/mrss/ content"`
+}
+
+type xmlMetaAuthor struct {
+	Name string `xml:"name"`
+	Text string `xml:",chardata"`
+}
+
+// xmlMetaItem is an RSS item or Atom entry.
+type xmlMetaItem struct {
+	About    string          `xml:"about,attr"`
+	GUID     string          `xml:"guid"`
+	ID       string          `xml:"id"`
+	Links    []xmlMetaLink   `xml:"link"`
+	Authors  []xmlMetaAuthor `xml:"author"`
+	Creators []string        `xml:"creator"`
+	Comments []string        `xml:"comments"`
+	// Media RSS elements
+	Thumbnails    []xmlMediaElem  `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaContents []xmlMediaElem  `xml:"http://search.yahoo.com/mrss/ content"`
+	MediaGroups   []xmlMediaGroup `xml:"http://search.yahoo.com/mrss/ group"`
+	// iTunes podcast elements
+	ItunesDurations []string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+}
+
+// parseItemMetadata returns the authors, comments links, thumbnails and media
+// durations of the items in the given RSS or Atom document. Errors are logged and any metadata parsed
+// until then is returned.
+func parseItemMetadata(body []byte) itemMetadata {
+	m := itemMetadata{}
+
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	d.CharsetReader = charset.NewReaderLabel
+
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.V(2).Infof("while parsing item metadata: %s", err)
+			break
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || (start.Name.Local != "item" && start.Name.Local != "entry") {
+			continue
+		}
+
+		var item xmlMetaItem
+		if err = d.DecodeElement(&item, &start); err != nil {
+			log.V(2).Infof("while parsing item metadata: %s", err)
+			break
+		}
+		meta := item.meta()
+		if len(meta.authors) == 0 && meta.comments == "" && meta.thumbnail == "" && meta.duration == 0 {
+			continue
+		}
+		for _, key := range item.keys() {
+			m[key] = meta
+		}
+	}
+
+	return m
+}
+
+func (item xmlMetaItem) meta() itemMeta {
+	var meta itemMeta
+
+	seen := map[string]bool{}
+	addAuthor := func(s string) {
+		s = strings.TrimSpace(s)
+		if match := rssAuthorRegex.FindStringSubmatch(s); match != nil {
+			s = strings.TrimSpace(match[1])
+		}
+		if s != "" && !seen[s] {
+			seen[s] = true
+			meta.authors = append(meta.authors, s)
+		}
+	}
+	for _, a := range item.Authors {
+		if a.Name != "" {
+			addAuthor(a.Name)
+		} else {
+			addAuthor(a.Text)
+		}
+	}
+	for _, c := range item.Creators {
+		addAuthor(c)
+	}
+
+	// Other elements named "comments", e.g. <slash:comments>, hold a count
+	// instead of a link.
+	for _, c := range item.Comments {
+		if isHTTPURL(c) {
+			meta.comments = strings.TrimSpace(c)
+			break
+		}
+	}
+	if meta.comments == "" {
+		for _, l := range item.Links {
+			if l.Rel == "replies" && isHTTPURL(l.Href) {
+				meta.comments = l.Href
+				break
+			}
+		}
+	}
+
+	meta.thumbnail = item.thumbnail()
+	meta.duration = item.duration()
+
+	return meta
+}
+
+// duration returns the iTunes duration of the item, or else the duration of
+// its first Media RSS content that has one.
+func (item xmlMetaItem) duration() time.Duration {
+	for _, d := range item.ItunesDurations {
+		if dur := parseMediaDuration(d); dur > 0 {
+			return dur
+		}
+	}
+	contents := item.MediaContents
+	for _, g := range item.MediaGroups {
+		contents = append(contents, g.Contents...)
+	}
+	for _, c := range contents {
+		if dur := parseMediaDuration(c.Duration); dur > 0 {
+			return dur
+		}
+	}
+	return 0
+}
+
+// parseMediaDuration parses a duration given in seconds or as "MM:SS" or
+// "HH:MM:SS", as used by iTunes and Media RSS. Returns zero if it is invalid.
+func parseMediaDuration(s string) time.Duration {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var seconds float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(p, 64)
+		// Only the last part, the seconds, may have a fraction.
+		if err != nil || v < 0 || (i < len(parts)-1 && v != float64(int64(v))) {
+			return 0
+		}
+		seconds = seconds*60 + v
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// thumbnail returns the URL of the first Media RSS thumbnail of the item, or
+// else of its first image media content.
+func (item xmlMetaItem) thumbnail() string {
+	thumbnails := item.Thumbnails
+	contents := item.MediaContents
+	for _, g := range item.MediaGroups {
+		thumbnails = append(thumbnails, g.Thumbnails...)
+		contents = append(contents, g.Contents...)
+	}
+	for _, c := range contents {
+		thumbnails = append(thumbnails, c.Thumbnails...)
+	}
+
+	for _, t := range thumbnails {
+		if isHTTPURL(t.URL) {
+			return strings.TrimSpace(t.URL)
+		}
+	}
+	for _, c := range contents {
+		if (c.Medium == "image" || strings.HasPrefix(c.Type, "image/")) && isHTTPURL(c.URL) {
+			return strings.TrimSpace(c.URL)
+		}
+	}
+	return ""
+}
+
+// keys returns the values that an rss.Item parsed from this item may have as
+// its ID or link.
+func (item xmlMetaItem) keys() []string {
+	var keys []string
+	for _, k := range []string{item.GUID, item.ID, item.About} {
+		if k = strings.TrimSpace(k); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	for _, l := range item.Links {
+		if l.Rel != "" && l.Rel != "alternate" {
+			continue
+		}
+		if k := strings.TrimSpace(l.Href + l.Text); k != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
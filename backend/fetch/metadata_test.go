@@ -0,0 +1,214 @@
+package fetch
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/rss"
+)
+
+const metadataRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:slash="http://purl.org/rss/1.0/modules/slash/">
+<channel>
+  <title>Example</title>
+  <item>
+    <title>First</title>
+    <link>http://example.com/1</link>
+    <guid>urn:example:1</guid>
+    <author>jane@example.com (Jane Doe)</author>
+    <dc:creator>John Smith</dc:creator>
+    <dc:creator>Jane Doe</dc:creator>
+    <slash:comments>12</slash:comments>
+    <comments>http://example.com/1#comments</comments>
+  </item>
+  <item>
+    <title>Second</title>
+    <link>http://example.com/2</link>
+    <dc:creator>John Smith</dc:creator>
+  </item>
+  <item>
+    <title>Third</title>
+    <link>http://example.com/3</link>
+  </item>
+</channel>
+</rss>`
+
+const metadataAtom = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example</title>
+  <entry>
+    <id>tag:example.com,2025:1</id>
+    <title>First</title>
+    <link rel="alternate" href="http://example.com/1"/>
+    <link rel="replies" type="text/html" href="http://example.com/1#comments"/>
+    <author><name>Jane Doe</name><email>jane@example.com</email></author>
+  </entry>
+</feed>`
+
+func TestParseItemMetadata(t *testing.T) {
+	m := parseItemMetadata([]byte(metadataRSS))
+
+	first := itemMeta{authors: []string{"Jane Doe", "John Smith"}, comments: "http://example.com/1#comments"}
+	for _, key := range []string{"urn:example:1", "http://example.com/1"} {
+		if got := m[key]; !slices.Equal(got.authors, first.authors) || got.comments != first.comments {
+			t.Errorf("%s: expected %+v, got %+v", key, first, got)
+		}
+	}
+	if got := m["http://example.com/2"]; !slices.Equal(got.authors, []string{"John Smith"}) || got.comments != "" {
+		t.Errorf("unexpected metadata of second item: %+v", got)
+	}
+	if _, ok := m["http://example.com/3"]; ok {
+		t.Errorf("expected no metadata for item without any")
+	}
+
+	m = parseItemMetadata([]byte(metadataAtom))
+	got := m["tag:example.com,2025:1"]
+	if !slices.Equal(got.authors, []string{"Jane Doe"}) || got.comments != "http://example.com/1#comments" {
+		t.Errorf("unexpected Atom metadata: %+v", got)
+	}
+
+	if m = parseItemMetadata([]byte("not a feed <")); len(m) != 0 {
+		t.Errorf("expected no metadata for invalid document, got %+v", m)
+	}
+}
+
+func TestParseItemMetadataThumbnail(t *testing.T) {
+	m := parseItemMetadata([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+  <item>
+    <link>http://example.com/1</link>
+    <media:content url="http://example.com/1.mp4" type="video/mp4">
+      <media:thumbnail url="http://example.com/1-poster.jpg"/>
+    </media:content>
+    <media:thumbnail url="http://example.com/1.jpg"/>
+  </item>
+  <item>
+    <link>http://example.com/2</link>
+    <media:group>
+      <media:content url="http://example.com/2.jpg" medium="image"/>
+    </media:group>
+  </item>
+  <item>
+    <link>http://example.com/3</link>
+    <media:content url="http://example.com/3.mp3" type="audio/mpeg"/>
+  </item>
+</channel>
+</rss>`))
+
+	if got := m["http://example.com/1"].thumbnail; got != "http://example.com/1.jpg" {
+		t.Errorf("expected media:thumbnail, got %q", got)
+	}
+	if got := m["http://example.com/2"].thumbnail; got != "http://example.com/2.jpg" {
+		t.Errorf("expected image media:content in group, got %q", got)
+	}
+	if _, ok := m["http://example.com/3"]; ok {
+		t.Errorf("expected no metadata for item with only audio media")
+	}
+}
+
+func TestParseItemMetadataDuration(t *testing.T) {
+	m := parseItemMetadata([]byte(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel>
+  <item>
+    <link>http://example.com/1</link>
+    <enclosure url="http://example.com/1.mp3" type="audio/mpeg" length="1234"/>
+    <itunes:duration>1:02:03</itunes:duration>
+    <media:content url="http://example.com/1.mp3" type="audio/mpeg" duration="60"/>
+  </item>
+  <item>
+    <link>http://example.com/2</link>
+    <media:group>
+      <media:content url="http://example.com/2.mp4" type="video/mp4" duration="95"/>
+    </media:group>
+  </item>
+</channel>
+</rss>`))
+
+	if got := m["http://example.com/1"].duration; got != time.Hour+2*time.Minute+3*time.Second {
+		t.Errorf("expected iTunes duration, got %s", got)
+	}
+	if got := m["http://example.com/2"].duration; got != 95*time.Second {
+		t.Errorf("expected media:content duration, got %s", got)
+	}
+}
+
+func TestParseMediaDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"3600":     time.Hour,
+		"12:34":    12*time.Minute + 34*time.Second,
+		"01:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+		" 90.5 ":   90*time.Second + 500*time.Millisecond,
+		"":         0,
+		"1:2:3:4":  0,
+		"1.5:00":   0,
+		"-5":       0,
+		"unknown":  0,
+	} {
+		if got := parseMediaDuration(s); got != expected {
+			t.Errorf("%q: expected %s, got %s", s, expected, got)
+		}
+	}
+}
+
+func TestItemMetadataApply(t *testing.T) {
+	m := itemMetadata{
+		"urn:1":                {authors: []string{"Jane Doe"}, comments: "/comments/1"},
+		"http://example.com/2": {authors: []string{"John Smith"}},
+	}
+
+	a := models.Article{Link: "http://example.com/1"}
+	m.apply(&rss.Item{ID: "urn:1", Link: "http://example.com/1"}, &a)
+	if !slices.Equal(a.Authors, []string{"Jane Doe"}) || a.CommentsURL != "http://example.com/comments/1" {
+		t.Errorf("unexpected article: %+v", a)
+	}
+
+	a = models.Article{}
+	m.apply(&rss.Item{ID: "urn:2", Link: "http://example.com/2"}, &a)
+	if !slices.Equal(a.Authors, []string{"John Smith"}) {
+		t.Errorf("expected lookup by link, got %+v", a)
+	}
+
+	a = models.Article{Enclosures: []models.Enclosure{
+		{URL: "http://example.com/3.mp3", Type: "audio/mpeg"},
+		{URL: "http://example.com/3.jpg", Type: "image/jpeg"},
+	}}
+	itemMetadata{"urn:3": {duration: time.Minute}}.apply(&rss.Item{ID: "urn:3"}, &a)
+	if a.Enclosures[0].Duration != time.Minute || a.Enclosures[1].Duration != 0 {
+		t.Errorf("expected duration on playable enclosure only, got %+v", a.Enclosures)
+	}
+
+	a = models.Article{}
+	var empty itemMetadata
+	empty.apply(&rss.Item{ID: "urn:1"}, &a)
+	if a.Authors != nil {
+		t.Errorf("expected no authors, got %+v", a.Authors)
+	}
+}
+
+func TestFetchFeedCapturesMetadata(t *testing.T) {
+	f := Fetcher{fetchFunc: func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/rss+xml"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(metadataRSS))),
+		}, nil
+	}}
+
+	fetch, meta, err := f.fetchFeed("http://example.com/feed")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(fetch.Items) != 3 {
+		t.Errorf("expected 3 items, got %d", len(fetch.Items))
+	}
+	if got := meta["http://example.com/2"]; !slices.Equal(got.authors, []string{"John Smith"}) {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+}
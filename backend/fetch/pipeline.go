@@ -0,0 +1,371 @@
+package fetch
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/rss"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Transformer is a named step that rewrites the content of new articles of
+// the feeds it is configured for. Each feed has an ordered list of
+// transformers, which run on the content of its items before it is sanitized
+// and its images are proxied.
+type Transformer struct {
+	Name        string
+	Description string
+	apply       func(doc *goquery.Document, base *url.URL)
+}
+
+// transformers is the registry of transformers by name.
+var transformers = map[string]Transformer{}
+
+func registerTransformer(t Transformer) {
+	if _, ok := transformers[t.Name]; ok {
+		panic(fmt.Sprintf("transformer %q registered twice", t.Name))
+	}
+	transformers[t.Name] = t
+}
+
+func init() {
+	registerTransformer(Transformer{
+		Name:        "strip-tracking-pixels",
+		Description: "Remove images of at most 1x1 pixels and images from known tracking services.",
+		apply:       stripTrackingPixels,
+	})
+	registerTransformer(Transformer{
+		Name:        "strip-share-bars",
+		Description: "Remove share buttons, social links and similar boilerplate.",
+		apply:       stripShareBars,
+	})
+	registerTransformer(Transformer{
+		Name:        "youtube-links",
+		Description: "Replace embedded YouTube players, which are otherwise removed by sanitization, with links to the videos.",
+		apply:       rewriteYouTubeEmbeds,
+	})
+	registerTransformer(Transformer{
+		Name:        "lazy-images",
+		Description: "Load lazy-loaded images from their data-src or data-srcset attributes.",
+		apply:       expandLazyImages,
+	})
+	registerTransformer(Transformer{
+		Name:        "absolute-srcset",
+		Description: "Make relative URLs in image srcset attributes absolute.",
+		apply:       absolutizeSrcset,
+	})
+}
+
+// Transformers returns all registered transformers ordered by name.
+func Transformers() []Transformer {
+	var ret []Transformer
+	for _, t := range transformers {
+		ret = append(ret, t)
+	}
+	slices.SortFunc(ret, func(a, b Transformer) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return ret
+}
+
+// ValidateTransformers returns an error if any of the given transformer names
+// is not registered or is given more than once.
+func ValidateTransformers(names []string) error {
+	for i, name := range names {
+		if _, ok := transformers[name]; !ok {
+			return fmt.Errorf("unknown transformer: %q", name)
+		}
+		if slices.Contains(names[:i], name) {
+			return fmt.Errorf("duplicate transformer: %q", name)
+		}
+	}
+	return nil
+}
+
+// applyTransformers runs the named transformers in order on the HTML content,
+// resolving relative URLs against the base URL. Unknown transformers are
+// skipped.
+func applyTransformers(names []string, baseURL string, s string) string {
+	if len(names) == 0 || s == "" {
+		return s
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		log.Warningf("while parsing HTML: %s", err)
+		return s
+	}
+	base, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		base = nil
+	}
+
+	for _, name := range names {
+		t, ok := transformers[name]
+		if !ok {
+			log.Warningf("Skipping unknown transformer %q", name)
+			continue
+		}
+		t.apply(doc, base)
+	}
+
+	resp, err := doc.Find("body").Html()
+	if err != nil {
+		log.Warningf("while rendering transformed HTML: %s", err)
+		return s
+	}
+	return resp
+}
+
+var (
+	// trackingPixelPattern matches the URLs of images used by common services
+	// to track when articles are read.
+	trackingPixelPattern = regexp.MustCompile(`(?i)^https?://(` +
+		`feeds\.feedburner\.com/~r/|feeds\.feedblitz\.com/~/i/|pixel\.wp\.com/|stats\.wordpress\.com/|` +
+		`www\.google-analytics\.com/|pixel\.quantserve\.com/|sb\.scorecardresearch\.com/)`)
+	// trackingPathPattern matches the paths of images that are named as
+	// tracking pixels.
+	trackingPathPattern = regexp.MustCompile(`(?i)/(pixel|beacon|tracking|open)\.(gif|png)$`)
+	// styleDimensionPatterns match the width and height of an element in its
+	// inline style.
+	styleDimensionPatterns = map[string]*regexp.Regexp{
+		"width":  regexp.MustCompile(`(?i)(?:^|[;\s])width\s*:\s*([0-9]+)px`),
+		"height": regexp.MustCompile(`(?i)(?:^|[;\s])height\s*:\s*([0-9]+)px`),
+	}
+)
+
+// stripTrackingPixels removes images that are at most 1x1 pixels or come from
+// known tracking services.
+func stripTrackingPixels(doc *goquery.Document, base *url.URL) {
+	doc.Find("img").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		src = resolveURL(base, src)
+		tracking := trackingPixelPattern.MatchString(src)
+		if u, err := url.Parse(src); err == nil && trackingPathPattern.MatchString(u.Path) {
+			tracking = true
+		}
+		if tracking || (isTiny(s, "width") && isTiny(s, "height")) {
+			s.Remove()
+		}
+	})
+}
+
+// isTiny returns true if the given dimension of the image is at most one pixel
+// in its attributes or inline style.
+func isTiny(s *goquery.Selection, dim string) bool {
+	v, ok := s.Attr(dim)
+	if !ok {
+		style, _ := s.Attr("style")
+		m := styleDimensionPatterns[dim].FindStringSubmatch(style)
+		if m == nil {
+			return false
+		}
+		v = m[1]
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(v), "px"))
+	return err == nil && n <= 1
+}
+
+// shareClassPattern matches the classes and IDs of share bars and related
+// boilerplate added by publishing platforms.
+var shareClassPattern = regexp.MustCompile(`(?i)(^|[\s_-])(share|sharing|sharedaddy|social|addtoany|a2a_kit|feedflare|jp-relatedposts|related-posts|post-share|subscribe-box)([\s_-]|$)`)
+
+// shareLinkPattern matches links that share the article on social networks.
+var shareLinkPattern = regexp.MustCompile(`(?i)^https?://(www\.)?(` +
+	`twitter\.com/(intent/|share)|x\.com/intent/|facebook\.com/(sharer|share\.php|dialog/share)|` +
+	`linkedin\.com/(sharearticle|sharing/)|pinterest\.com/pin/create|reddit\.com/submit|` +
+	`news\.ycombinator\.com/submitlink|getpocket\.com/save|tumblr\.com/share|wa\.me/|api\.whatsapp\.com/send|` +
+	`feeds\.feedburner\.com/~ff/|feedads\.g\.doubleclick\.net/)`)
+
+// stripShareBars removes share bars and links that share the article, along
+// with the images in them.
+func stripShareBars(doc *goquery.Document, base *url.URL) {
+	doc.Find("div, ul, ol, p, aside, section, nav, footer, span").Each(func(_ int, s *goquery.Selection) {
+		class, _ := s.Attr("class")
+		id, _ := s.Attr("id")
+		if shareClassPattern.MatchString(class) || shareClassPattern.MatchString(id) {
+			s.Remove()
+		}
+	})
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if !shareLinkPattern.MatchString(resolveURL(base, href)) {
+			return
+		}
+		// Remove list items and paragraphs that only hold the link.
+		parent := s.Parent()
+		s.Remove()
+		if parent.Is("li, p") && strings.TrimSpace(parent.Text()) == "" && parent.Find("img").Length() == 0 {
+			parent.Remove()
+		}
+	})
+}
+
+// youTubeEmbedPattern matches the URLs of embedded YouTube players and
+// captures the ID of the video.
+var youTubeEmbedPattern = regexp.MustCompile(`(?i)^(?:https?:)?//(?:www\.)?(?:youtube\.com|youtube-nocookie\.com)/embed/([A-Za-z0-9_-]{6,})`)
+
+// rewriteYouTubeEmbeds replaces embedded YouTube players with links to the
+// videos, so that no request is made to YouTube until a video is opened.
+func rewriteYouTubeEmbeds(doc *goquery.Document, _ *url.URL) {
+	doc.Find("iframe").Each(func(_ int, s *goquery.Selection) {
+		src, _ := s.Attr("src")
+		if src == "" {
+			src, _ = s.Attr("data-src")
+		}
+		m := youTubeEmbedPattern.FindStringSubmatch(strings.TrimSpace(src))
+		if m == nil {
+			return
+		}
+		text := "Watch on YouTube"
+		if title, _ := s.Attr("title"); strings.TrimSpace(title) != "" {
+			text = fmt.Sprintf("Watch on YouTube: %s", strings.TrimSpace(title))
+		}
+		link := &html.Node{
+			Type:     html.ElementNode,
+			Data:     "a",
+			DataAtom: atom.A,
+			Attr:     []html.Attribute{{Key: "href", Val: "https://www.youtube.com/watch?v=" + m[1]}},
+		}
+		link.AppendChild(&html.Node{Type: html.TextNode, Data: text})
+		p := &html.Node{Type: html.ElementNode, Data: "p", DataAtom: atom.P}
+		p.AppendChild(link)
+		s.ReplaceWithNodes(p)
+	})
+}
+
+// lazySrcAttrs are the attributes that hold the sources of lazy-loaded images,
+// in order of preference.
+var lazySrcAttrs = []string{"data-src", "data-lazy-src", "data-original", "data-lazy", "data-url"}
+
+// lazySrcsetAttrs are the attributes that hold the srcset of lazy-loaded
+// images, in order of preference.
+var lazySrcsetAttrs = []string{"data-srcset", "data-lazy-srcset"}
+
+// expandLazyImages sets the sources of lazy-loaded images, which usually only
+// have a placeholder as their source, from their data attributes.
+func expandLazyImages(doc *goquery.Document, _ *url.URL) {
+	doc.Find("img, source").Each(func(_ int, s *goquery.Selection) {
+		for _, attr := range lazySrcAttrs {
+			if v, ok := s.Attr(attr); ok && strings.TrimSpace(v) != "" {
+				if s.Is("img") {
+					s.SetAttr("src", strings.TrimSpace(v))
+				}
+				break
+			}
+		}
+		for _, attr := range lazySrcsetAttrs {
+			if v, ok := s.Attr(attr); ok && strings.TrimSpace(v) != "" {
+				s.SetAttr("srcset", strings.TrimSpace(v))
+				break
+			}
+		}
+		for _, attr := range slices.Concat(lazySrcAttrs, lazySrcsetAttrs) {
+			s.RemoveAttr(attr)
+		}
+		s.RemoveClass("lazyload", "lazy")
+	})
+	// The noscript fallbacks of lazy-loaded images would duplicate them.
+	doc.Find("noscript").Each(func(_ int, s *goquery.Selection) {
+		if s.Prev().Is("img") {
+			s.Remove()
+		}
+	})
+}
+
+// absolutizeSrcset makes the URLs of each candidate in the srcset attributes
+// of images absolute.
+func absolutizeSrcset(doc *goquery.Document, base *url.URL) {
+	if base == nil {
+		return
+	}
+	doc.Find("img[srcset], source[srcset]").Each(func(_ int, s *goquery.Selection) {
+		srcset, _ := s.Attr("srcset")
+		var candidates []string
+		for _, c := range strings.Split(srcset, ",") {
+			fields := strings.Fields(c)
+			if len(fields) == 0 {
+				continue
+			}
+			fields[0] = resolveURL(base, fields[0])
+			candidates = append(candidates, strings.Join(fields, " "))
+		}
+		s.SetAttr("srcset", strings.Join(candidates, ", "))
+	})
+}
+
+// resolveURL returns the URL resolved against the base URL if possible, or
+// the URL as given otherwise.
+func resolveURL(base *url.URL, s string) string {
+	s = strings.TrimSpace(s)
+	u, err := url.Parse(s)
+	if err != nil || base == nil {
+		return s
+	}
+	return base.ResolveReference(u).String()
+}
+
+// TransformerPreview is the content of a sample item of a feed before and
+// after being rewritten by a list of transformers.
+type TransformerPreview struct {
+	Title  string
+	Link   string
+	Before string
+	After  string
+}
+
+// previewFetchFunc fetches feeds to preview transformers on. It is overridden
+// in tests.
+var previewFetchFunc rss.FetchFunc = fetchFuncWithAcceptHeader
+
+// PreviewTransformers fetches the feed and returns the content of one of its
+// items as processed without any transformers and with the given ones. The
+// item with the given link is used if there is one, and the first item with
+// content otherwise.
+func PreviewTransformers(feed models.Feed, names []string, link string) (TransformerPreview, error) {
+	if err := ValidateTransformers(names); err != nil {
+		return TransformerPreview{}, err
+	}
+	if feed.Synthetic() {
+		return TransformerPreview{}, fmt.Errorf("cannot fetch synthetic feed")
+	}
+
+	fetched, _, err := Fetcher{fetchFunc: previewFetchFunc}.fetchFeed(feed.URL)
+	if err != nil {
+		return TransformerPreview{}, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+
+	var sample *rss.Item
+	for _, item := range fetched.Items {
+		if link != "" && getAbsoluteUrl(feed.Link, item.Link) == getAbsoluteUrl(feed.Link, link) {
+			sample = item
+			break
+		}
+		if sample == nil && link == "" && (item.Content != "" || item.Summary != "") {
+			sample = item
+		}
+	}
+	if sample == nil {
+		return TransformerPreview{}, fmt.Errorf("no matching item in feed")
+	}
+
+	feed.Transformers = nil
+	before := processItem(&feed, sample)
+	feed.Transformers = names
+	after := processItem(&feed, sample)
+
+	return TransformerPreview{
+		Title:  after.Title,
+		Link:   after.Link,
+		Before: before.Content,
+		After:  after.Content,
+	}, nil
+}
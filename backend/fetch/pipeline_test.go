@@ -0,0 +1,151 @@
+package fetch
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+)
+
+func TestApplyTransformers(t *testing.T) {
+	testCases := []struct {
+		name         string
+		transformers []string
+		content      string
+		expected     string
+	}{
+		{
+			name:         "no transformers",
+			transformers: nil,
+			content:      `<p>Hello</p><img src="http://example.com/pixel.gif">`,
+			expected:     `<p>Hello</p><img src="http://example.com/pixel.gif">`,
+		},
+		{
+			name:         "strip tracking pixels",
+			transformers: []string{"strip-tracking-pixels"},
+			content: `<p>Hello</p><img src="http://feeds.feedburner.com/~r/Example/~4/abc" height="1" width="1">` +
+				`<img src="/a.png" width="1" height="1"><img src="/b.png" style="width: 1px; height:0px">` +
+				`<img src="/open.gif"><img src="/photo.jpg" width="1" height="600">`,
+			expected: `<p>Hello</p><img src="/photo.jpg" width="1" height="600"/>`,
+		},
+		{
+			name:         "strip share bars",
+			transformers: []string{"strip-share-bars"},
+			content: `<p>Hello</p><div class="sharedaddy sd-sharing-enabled"><a href="https://example.com/x">Share</a></div>` +
+				`<ul><li><a href="https://twitter.com/intent/tweet?url=x">Tweet</a></li><li><a href="/about">About</a></li></ul>` +
+				`<p>See <a href="https://www.facebook.com/sharer/sharer.php?u=x">this</a> too</p>`,
+			expected: `<p>Hello</p><ul><li><a href="/about">About</a></li></ul><p>See  too</p>`,
+		},
+		{
+			name:         "youtube links",
+			transformers: []string{"youtube-links"},
+			content: `<iframe src="https://www.youtube.com/embed/dQw4w9WgXcQ?rel=0" title="A video"></iframe>` +
+				`<iframe src="https://player.vimeo.com/video/1"></iframe>`,
+			expected: `<p><a href="https://www.youtube.com/watch?v=dQw4w9WgXcQ">Watch on YouTube: A video</a></p>` +
+				`<iframe src="https://player.vimeo.com/video/1"></iframe>`,
+		},
+		{
+			name:         "lazy images",
+			transformers: []string{"lazy-images"},
+			content: `<img src="data:image/gif;base64,R0lGOD" data-src="/big.jpg" data-srcset="/big.jpg 1x, /big2.jpg 2x" class="lazyload hero">` +
+				`<noscript><img src="/big.jpg"></noscript>`,
+			expected: `<img src="/big.jpg" srcset="/big.jpg 1x, /big2.jpg 2x" class="hero"/>`,
+		},
+		{
+			name:         "absolute srcset",
+			transformers: []string{"absolute-srcset"},
+			content:      `<img src="/a.jpg" srcset="/a.jpg 1x,  img/a2.jpg 2x, https://cdn.example.com/a3.jpg 3x">`,
+			expected:     `<img src="/a.jpg" srcset="http://example.com/a.jpg 1x, http://example.com/blog/img/a2.jpg 2x, https://cdn.example.com/a3.jpg 3x"/>`,
+		},
+		{
+			name:         "transformers run in order",
+			transformers: []string{"lazy-images", "absolute-srcset", "unknown"},
+			content:      `<img data-src="/a.jpg" data-srcset="/a.jpg 1x">`,
+			expected:     `<img srcset="http://example.com/a.jpg 1x" src="/a.jpg"/>`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := applyTransformers(tc.transformers, "http://example.com/blog/", tc.content)
+			if actual != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateTransformers(t *testing.T) {
+	if err := ValidateTransformers([]string{"lazy-images", "absolute-srcset"}); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if err := ValidateTransformers([]string{"lazy-images", "nope"}); err == nil {
+		t.Error("expected error for unknown transformer")
+	}
+	if err := ValidateTransformers([]string{"lazy-images", "lazy-images"}); err == nil {
+		t.Error("expected error for duplicate transformer")
+	}
+	for _, tr := range Transformers() {
+		if tr.Description == "" || tr.apply == nil {
+			t.Errorf("transformer %q is incomplete", tr.Name)
+		}
+	}
+}
+
+const transformerRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>Example</title>
+    <link>http://example.com/</link>
+    <item>
+      <title>First</title>
+      <link>http://example.com/1</link>
+      <description><![CDATA[<p>One</p><img data-src="/one.jpg">]]></description>
+    </item>
+    <item>
+      <title>Second</title>
+      <link>http://example.com/2</link>
+      <description><![CDATA[<p>Two</p><img data-src="/two.jpg">]]></description>
+    </item>
+  </channel>
+</rss>`
+
+func TestPreviewTransformers(t *testing.T) {
+	defer func(f func(string) (*http.Response, error)) { previewFetchFunc = f }(previewFetchFunc)
+	previewFetchFunc = func(url string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/rss+xml"}},
+			Body:       io.NopCloser(bytes.NewReader([]byte(transformerRSS))),
+		}, nil
+	}
+
+	feed := models.Feed{ID: 1, URL: "http://example.com/feed", Link: "http://example.com/", Transformers: []string{"strip-share-bars"}}
+
+	p, err := PreviewTransformers(feed, []string{"lazy-images"}, "http://example.com/2")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if p.Title != "Second" || p.Link != "http://example.com/2" {
+		t.Errorf("expected second item, got %+v", p)
+	}
+	if strings.Contains(p.Before, `src="http://example.com/two.jpg"`) {
+		t.Errorf("expected lazy image without source before transformers, got %s", p.Before)
+	}
+	if !strings.Contains(p.After, `src="http://example.com/two.jpg"`) {
+		t.Errorf("expected lazy image with source after transformers, got %s", p.After)
+	}
+
+	if p, err = PreviewTransformers(feed, []string{"lazy-images"}, ""); err != nil || p.Title != "First" {
+		t.Errorf("expected first item, got %+v (%v)", p, err)
+	}
+	if _, err = PreviewTransformers(feed, nil, "http://example.com/3"); err == nil {
+		t.Error("expected error for missing item")
+	}
+	if _, err = PreviewTransformers(feed, []string{"nope"}, ""); err == nil {
+		t.Error("expected error for unknown transformer")
+	}
+}
@@ -7,18 +7,19 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"net"
+	"html"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"time"
 
 	"codeberg.org/readeck/go-readability/v2"
 	"github.com/PuerkitoBio/goquery"
 	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/utils"
 )
 
 var (
@@ -39,122 +40,173 @@ var (
 type articleExtractor struct {
 	client    *http.Client
 	userAgent string
+	rules     *siteRules
 }
 
-func isPrivateIP(ip net.IP) bool {
-	if ip == nil {
-		return true
+// newArticleExtractor creates a hardened HTTP client with SSRF protection and timeout.
+func newArticleExtractor(timeout time.Duration, userAgent string) *articleExtractor {
+	client := utils.NewSafeClient(timeout)
+
+	return &articleExtractor{
+		client:    client,
+		userAgent: userAgent,
 	}
-	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsPrivate() {
-		return true
+}
+
+// fullTextResult is the full text of an article, the lead image and
+// canonical link declared by its page, and the date found by a site rule.
+type fullTextResult struct {
+	content   string
+	image     string
+	canonical string
+	date      time.Time
+}
+
+// Extract returns the full text of the article at the given URL. If a site
+// rule applies to the article's host, it is used for extraction and
+// readability heuristics are only used if the rule does not match the page.
+func (e *articleExtractor) Extract(ctx context.Context, articleURL string) (string, error) {
+	art, err := e.extract(ctx, articleURL)
+	return art.content, err
+}
+
+// extract is like Extract, but also returns the lead image and canonical link
+// of the page.
+func (e *articleExtractor) extract(ctx context.Context, articleURL string) (fullTextResult, error) {
+	parsedURL, err := url.Parse(articleURL)
+	if err != nil {
+		return fullTextResult{}, fmt.Errorf("invalid URL: %w", err)
 	}
-	// CGNAT range: 100.64.0.0/10
-	if ip4 := ip.To4(); ip4 != nil {
-		if ip4[0] == 100 && (ip4[1] >= 64 && ip4[1] <= 127) {
-			return true
-		}
+
+	page, err := e.fetch(ctx, articleURL)
+	if err != nil {
+		return fullTextResult{}, err
 	}
-	return false
-}
 
-// newArticleExtractor creates a hardened HTTP client with SSRF protection and timeout.
-func newArticleExtractor(timeout time.Duration, userAgent string) *articleExtractor {
-	dialer := &net.Dialer{
-		Timeout:   10 * time.Second,
-		KeepAlive: 30 * time.Second,
-		Control: func(network, address string, c syscall.RawConn) error {
-			host, _, err := net.SplitHostPort(address)
-			if err != nil {
-				return err
-			}
-			ip := net.ParseIP(host)
-			if ip != nil && isPrivateIP(ip) {
-				return fmt.Errorf("SSRF protection: access to private IP %s is blocked", ip)
+	content := ""
+	var date time.Time
+	if rule := e.rules.lookup(parsedURL.Hostname()); rule != nil {
+		art, err := e.extractWithRule(ctx, rule, parsedURL, page)
+		if err != nil {
+			log.V(2).Infof("Site rule failed for %s, falling back to readability: %s", articleURL, err)
+		} else {
+			log.V(2).Infof("Extracted %s with site rule (title=%q, date=%s)", articleURL, art.title, art.date)
+			content = art.content
+			date = art.date
+			if art.title != "" && !strings.Contains(content, "<h1") {
+				content = "<h1>" + html.EscapeString(art.title) + "</h1>" + content
 			}
-			return nil
-		},
+		}
 	}
 
-	// Double check IP resolution during network dial
-	transport := &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
-		DialContext:           dialer.DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
+	if content == "" {
+		art, err := readability.FromReader(bytes.NewReader(page), parsedURL)
+		if err != nil {
+			return fullTextResult{}, fmt.Errorf("failed to parse readability content: %w", err)
+		}
+
+		var buf bytes.Buffer
+		if err := art.RenderHTML(&buf); err != nil {
+			return fullTextResult{}, fmt.Errorf("failed to render HTML: %w", err)
+		}
+		content = buf.String()
 	}
 
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   timeout,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			if len(via) >= 5 {
-				return errors.New("stopped after 5 redirects")
-			}
-			// Block cross-host redirects to avoid SSRF bypass via redirect to metadata endpoints
-			if len(via) > 0 {
-				if req.URL.Host != via[0].URL.Host {
-					return fmt.Errorf("SSRF protection: cross-host redirect from %s to %s is blocked", via[0].URL.Host, req.URL.Host)
-				}
-			}
-			return nil
-		},
+	if content == "" {
+		return fullTextResult{}, ErrEmptyContent
 	}
 
-	return &articleExtractor{
-		client:    client,
-		userAgent: userAgent,
+	content = promoteImageSources(content)
+	content = rewriteFragmentUrls(content, parsedURL)
+
+	return fullTextResult{
+		content:   content,
+		image:     pageImage(page, parsedURL),
+		canonical: pageCanonical(page, parsedURL),
+		date:      date,
+	}, nil
+}
+
+// pageImage returns the absolute URL of the image declared by the page's
+// Open Graph or Twitter card metadata, or an empty string if there is none.
+func pageImage(page []byte, pageURL *url.URL) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return ""
+	}
+
+	for _, sel := range []string{
+		`meta[property="og:image"]`, `meta[name="og:image"]`,
+		`meta[name="twitter:image"]`, `meta[property="twitter:image"]`,
+	} {
+		content, ok := doc.Find(sel).First().Attr("content")
+		if !ok || strings.TrimSpace(content) == "" {
+			continue
+		}
+		imageURL, err := pageURL.Parse(strings.TrimSpace(content))
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+			continue
+		}
+		return imageURL.String()
 	}
+	return ""
 }
 
-func (e *articleExtractor) Extract(ctx context.Context, articleURL string) (string, error) {
-	parsedURL, err := url.Parse(articleURL)
+// pageCanonical returns the canonical link declared by the page without
+// tracking parameters, or an empty string if there is none.
+func pageCanonical(page []byte, pageURL *url.URL) string {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
 	if err != nil {
-		return "", fmt.Errorf("invalid URL: %w", err)
+		return ""
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", articleURL, nil)
+	href, ok := doc.Find(`link[rel~="canonical"]`).First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return ""
+	}
+	canonicalURL, err := pageURL.Parse(strings.TrimSpace(href))
+	if err != nil || (canonicalURL.Scheme != "http" && canonicalURL.Scheme != "https") || canonicalURL.Host == "" {
+		return ""
+	}
+	canonicalURL.Fragment = ""
+	canonicalURL.RawFragment = ""
+	return stripTrackingParams(canonicalURL.String())
+}
+
+// fetch returns the body of the page at the given URL.
+func (e *articleExtractor) fetch(ctx context.Context, pageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", e.userAgent)
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
 
 	resp, err := e.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch URL: %w", err)
+		return nil, fmt.Errorf("failed to fetch URL: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("non-200 HTTP status: %d", resp.StatusCode)
+		return nil, fmt.Errorf("non-200 HTTP status: %d", resp.StatusCode)
 	}
 
-	art, err := readability.FromReader(resp.Body, parsedURL)
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxArticleBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to parse readability content: %w", err)
-	}
-
-	var buf bytes.Buffer
-	if err := art.RenderHTML(&buf); err != nil {
-		return "", fmt.Errorf("failed to render HTML: %w", err)
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
-
-	content := buf.String()
-	if content == "" {
-		return "", ErrEmptyContent
-	}
-
-	content = promoteImageSources(content)
-	content = rewriteFragmentUrls(content, parsedURL)
-
-	return content, nil
+	return page, nil
 }
 
 // ExtractFullText initializes/retrieves the singleton extractor and performs the extraction.
 func ExtractFullText(ctx context.Context, url string) (string, error) {
+	return fullTextExtractor().Extract(ctx, url)
+}
+
+// fullTextExtractor returns the singleton extractor, initializing it first if
+// needed.
+func fullTextExtractor() *articleExtractor {
 	extractorOnce.Do(func() {
 		timeout := 10 * time.Second
 		if fullTextTimeout != nil && *fullTextTimeout > 0 {
@@ -166,9 +218,35 @@ func ExtractFullText(ctx context.Context, url string) (string, error) {
 		}
 		log.Infof("Initializing full-text article extractor (timeout=%s, userAgent=%s)", timeout, userAgent)
 		extractor = newArticleExtractor(timeout, userAgent)
+		extractor.rules = newSiteRules(*siteRulesDir, *siteRulesReloadInterval)
 	})
 
-	return extractor.Extract(ctx, url)
+	return extractor
+}
+
+// ExtractSanitizedFullText extracts the full text of the article at the given
+// URL and prepares it for storage as the article's parsed content.
+func ExtractSanitizedFullText(ctx context.Context, url string) (string, error) {
+	res, err := extractSanitizedFullTextResult(ctx, url)
+	return res.content, err
+}
+
+// extractSanitizedFullTextResult is like ExtractSanitizedFullText, but also
+// returns the lead image of the article's page, rewritten to the image proxy
+// if proxying is enabled, and the page's canonical link.
+func extractSanitizedFullTextResult(ctx context.Context, url string) (fullTextResult, error) {
+	art, err := fullTextExtractor().extract(ctx, url)
+	if err != nil {
+		return fullTextResult{}, err
+	}
+
+	if art.image != "" {
+		art.image = processImageUrl(url, art.image)
+	}
+
+	// Rewrite relative URLs/images and proxy them using the article's URL as base.
+	art.content = SanitizeBody(ProcessHTMLContent(url, art.content))
+	return art, nil
 }
 
 func parseSrcset(srcset string) string {
@@ -2,7 +2,6 @@ package fetch
 
 import (
 	"context"
-	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -11,32 +10,6 @@ import (
 	"time"
 )
 
-func TestIsPrivateIP(t *testing.T) {
-	tests := []struct {
-		ip   net.IP
-		want bool
-	}{
-		{net.ParseIP("127.0.0.1"), true},
-		{net.ParseIP("::1"), true},
-		{net.ParseIP("10.0.0.1"), true},
-		{net.ParseIP("172.16.0.1"), true},
-		{net.ParseIP("192.168.1.1"), true},
-		{net.ParseIP("100.64.0.1"), true},
-		{net.ParseIP("100.127.255.255"), true},
-		{net.ParseIP("100.128.0.1"), false},
-		{net.ParseIP("8.8.8.8"), false},
-		{net.ParseIP("1.1.1.1"), false},
-		{nil, true},
-	}
-
-	for _, tt := range tests {
-		got := isPrivateIP(tt.ip)
-		if got != tt.want {
-			t.Errorf("isPrivateIP(%v) = %v, want %v", tt.ip, got, tt.want)
-		}
-	}
-}
-
 func TestSSRFBlocking(t *testing.T) {
 	e := newArticleExtractor(1*time.Second, "Test-Agent")
 
@@ -160,6 +133,84 @@ func TestPromoteImageSources(t *testing.T) {
 	}
 }
 
+func TestPageImage(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/post")
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "og:image",
+			input:    `<html><head><meta property="og:image" content="/lead.jpg"><meta name="twitter:image" content="/card.jpg"></head></html>`,
+			expected: "https://example.com/lead.jpg",
+		},
+		{
+			name:     "twitter:image",
+			input:    `<html><head><meta name="twitter:image" content="https://cdn.example.com/card.jpg"></head></html>`,
+			expected: "https://cdn.example.com/card.jpg",
+		},
+		{
+			name:     "ignores non-HTTP image",
+			input:    `<html><head><meta property="og:image" content="data:image/png;base64,AAAA"></head></html>`,
+			expected: "",
+		},
+		{
+			name:     "no image",
+			input:    `<html><head><title>Post</title></head></html>`,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pageImage([]byte(tc.input), pageURL); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestPageCanonical(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/post?utm_source=rss")
+
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "relative canonical",
+			input:    `<html><head><link rel="canonical" href="/2024/post?id=1&utm_medium=feed#top"></head></html>`,
+			expected: "https://example.com/2024/post?id=1",
+		},
+		{
+			name:     "absolute canonical",
+			input:    `<html><head><link rel="alternate" href="/feed"><link rel="canonical" href="https://www.example.com/post"></head></html>`,
+			expected: "https://www.example.com/post",
+		},
+		{
+			name:     "ignores non-HTTP canonical",
+			input:    `<html><head><link rel="canonical" href="javascript:void(0)"></head></html>`,
+			expected: "",
+		},
+		{
+			name:     "no canonical",
+			input:    `<html><head><title>Post</title></head></html>`,
+			expected: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pageCanonical([]byte(tc.input), pageURL); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
 func TestRewriteFragmentUrls(t *testing.T) {
 	articleURL, _ := url.Parse("https://example.com/post")
 
@@ -0,0 +1,164 @@
+package fetch
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+)
+
+// RuleMatcher evaluates a rule's conditions against articles.
+type RuleMatcher struct {
+	Rule    models.Rule
+	title   *regexp.Regexp
+	content *regexp.Regexp
+	author  *regexp.Regexp
+}
+
+// NewRuleMatcher returns a matcher for the given rule, or an error if any of
+// its regular expressions are invalid.
+func NewRuleMatcher(r models.Rule) (*RuleMatcher, error) {
+	m := &RuleMatcher{Rule: r}
+	var err error
+	if r.Conditions.TitleRegex != "" {
+		// Prepend (?i) to ensure case-insensitive matching
+		if m.title, err = regexp.Compile("(?i)" + r.Conditions.TitleRegex); err != nil {
+			return nil, fmt.Errorf("invalid title regex: %w", err)
+		}
+	}
+	if r.Conditions.ContentRegex != "" {
+		if m.content, err = regexp.Compile("(?i)" + r.Conditions.ContentRegex); err != nil {
+			return nil, fmt.Errorf("invalid content regex: %w", err)
+		}
+	}
+	if r.Conditions.AuthorRegex != "" {
+		if m.author, err = regexp.Compile("(?i)" + r.Conditions.AuthorRegex); err != nil {
+			return nil, fmt.Errorf("invalid author regex: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// Matches returns true if the article satisfies all the rule's conditions at
+// the given time.
+func (m *RuleMatcher) Matches(a models.Article, now time.Time) bool {
+	c := m.Rule.Conditions
+
+	if len(c.FeedIDs) > 0 && !slices.Contains(c.FeedIDs, a.FeedID) {
+		return false
+	}
+	if len(c.FolderIDs) > 0 && !slices.Contains(c.FolderIDs, a.FolderID) {
+		return false
+	}
+	if c.MinAge > 0 && now.Sub(a.Date) <= c.MinAge {
+		return false
+	}
+	if len(c.LinkDomains) > 0 && !linkInDomains(a.Link, c.LinkDomains) {
+		return false
+	}
+	if len(c.Categories) > 0 && !anyCategory(a.Categories, c.Categories) {
+		return false
+	}
+	if m.author != nil && !slices.ContainsFunc(a.Authors, m.author.MatchString) {
+		return false
+	}
+	if m.title != nil && !m.title.MatchString(extractTextFromHtmlUnsafe(a.Title)) {
+		return false
+	}
+	if m.content != nil &&
+		!m.content.MatchString(extractTextFromHtmlUnsafe(a.Summary)) &&
+		!m.content.MatchString(extractTextFromHtmlUnsafe(a.Content)) {
+		return false
+	}
+	return true
+}
+
+// linkInDomains returns true if the link's host is any of the given domains
+// or a subdomain of one.
+func linkInDomains(link string, domains []string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyCategory returns true if any of the categories is one of the wanted ones,
+// ignoring case.
+func anyCategory(categories []string, want []string) bool {
+	for _, c := range categories {
+		for _, w := range want {
+			if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(w)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compileRules returns matchers for the given rules. Rules that fail to
+// compile are logged and skipped.
+func compileRules(rules []models.Rule) []*RuleMatcher {
+	var matchers []*RuleMatcher
+	for _, r := range rules {
+		m, err := NewRuleMatcher(r)
+		if err != nil {
+			log.Warningf("Skipping %s: %s", r, err)
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers
+}
+
+// ruleResult holds the combined actions of all rules matching an article
+// that are taken after the article is persisted.
+type ruleResult struct {
+	// matched holds the IDs of the rules that matched.
+	matched       []int64
+	mute          bool
+	star          bool
+	fetchFullText bool
+}
+
+// applyRules evaluates the given rules against the article and applies the
+// actions of the matching rules that modify the article itself. The other
+// actions are returned.
+func applyRules(matchers []*RuleMatcher, a *models.Article, now time.Time) ruleResult {
+	var res ruleResult
+	for _, m := range matchers {
+		if !m.Matches(*a, now) {
+			continue
+		}
+		log.V(2).Infof("Article matched %s: %s", m.Rule, a)
+		act := m.Rule.Actions
+		res.matched = append(res.matched, m.Rule.ID)
+		res.mute = res.mute || act.Mute
+		res.star = res.star || act.Star
+		res.fetchFullText = res.fetchFullText || act.FetchFullText
+		if act.MarkRead {
+			a.Read = true
+		}
+		if act.Priority {
+			a.Priority = true
+		}
+		for _, l := range act.Labels {
+			if !slices.Contains(a.Labels, l) {
+				a.Labels = append(a.Labels, l)
+			}
+		}
+	}
+	return res
+}
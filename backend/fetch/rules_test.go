@@ -0,0 +1,91 @@
+package fetch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+)
+
+func TestRuleMatcher(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	article := models.Article{
+		FeedID:     10,
+		FolderID:   2,
+		Title:      "<b>Weekly</b> Roundup",
+		Summary:    "Links about Go and databases.",
+		Link:       "https://blog.example.com/roundup",
+		Date:       now.Add(-48 * time.Hour),
+		Authors:    []string{"Jane Doe", "John Smith"},
+		Categories: []string{"Programming", "Databases"},
+	}
+
+	tests := []struct {
+		name       string
+		conditions models.RuleConditions
+		want       bool
+	}{
+		{"no conditions", models.RuleConditions{}, true},
+		{"feed", models.RuleConditions{FeedIDs: []int64{1, 10}}, true},
+		{"other feed", models.RuleConditions{FeedIDs: []int64{1}}, false},
+		{"folder", models.RuleConditions{FolderIDs: []int64{2}}, true},
+		{"other folder", models.RuleConditions{FolderIDs: []int64{3}}, false},
+		{"title regex ignores case and markup", models.RuleConditions{TitleRegex: "^weekly roundup$"}, true},
+		{"title regex mismatch", models.RuleConditions{TitleRegex: "daily"}, false},
+		{"content regex", models.RuleConditions{ContentRegex: `\bgo\b`}, true},
+		{"content regex mismatch", models.RuleConditions{ContentRegex: "rust"}, false},
+		{"link subdomain", models.RuleConditions{LinkDomains: []string{"example.com"}}, true},
+		{"link exact domain", models.RuleConditions{LinkDomains: []string{"blog.example.com"}}, true},
+		{"link other domain", models.RuleConditions{LinkDomains: []string{"ample.com"}}, false},
+		{"author regex", models.RuleConditions{AuthorRegex: "^john"}, true},
+		{"author regex mismatch", models.RuleConditions{AuthorRegex: "^doe"}, false},
+		{"category ignores case", models.RuleConditions{Categories: []string{"sports", "databases"}}, true},
+		{"other category", models.RuleConditions{Categories: []string{"sports"}}, false},
+		{"older than", models.RuleConditions{MinAge: 24 * time.Hour}, true},
+		{"not older than", models.RuleConditions{MinAge: 72 * time.Hour}, false},
+		{"all match", models.RuleConditions{FeedIDs: []int64{10}, TitleRegex: "roundup", MinAge: time.Hour}, true},
+		{"one mismatch", models.RuleConditions{FeedIDs: []int64{10}, TitleRegex: "daily"}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := NewRuleMatcher(models.Rule{Conditions: tc.conditions})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got := m.Matches(article, now); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := NewRuleMatcher(models.Rule{Conditions: models.RuleConditions{ContentRegex: "("}}); err == nil {
+		t.Error("expected error for invalid regex")
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules := compileRules([]models.Rule{
+		{ID: 1, Actions: models.RuleActions{Labels: []string{"a", "b"}}},
+		{ID: 2, Conditions: models.RuleConditions{TitleRegex: "("}, Actions: models.RuleActions{Mute: true}},
+		{ID: 3, Conditions: models.RuleConditions{TitleRegex: "news"}, Actions: models.RuleActions{Labels: []string{"b", "c"}, Star: true}},
+		{ID: 4, Conditions: models.RuleConditions{TitleRegex: "sports"}, Actions: models.RuleActions{Mute: true}},
+	})
+	if len(rules) != 3 {
+		t.Fatalf("expected invalid rule to be skipped, got %d rules", len(rules))
+	}
+
+	a := models.Article{Title: "Morning news"}
+	res := applyRules(rules, &a, time.Now())
+	if res.mute || !res.star || len(res.matched) != 2 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if len(a.Labels) != 3 || a.Labels[0] != "a" || a.Labels[1] != "b" || a.Labels[2] != "c" {
+		t.Errorf("expected deduplicated labels, got %v", a.Labels)
+	}
+
+	a = models.Article{Title: "Sports news"}
+	if res = applyRules(rules, &a, time.Now()); !res.mute {
+		t.Errorf("expected article to be muted, got %+v", res)
+	}
+}
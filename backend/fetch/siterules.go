@@ -0,0 +1,542 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/golang/glog"
+)
+
+var (
+	siteRulesDir            = flag.String("siteRulesDir", "", "Directory of site-specific full-text extraction rules. If empty, only readability heuristics are used.")
+	siteRulesReloadInterval = flag.Duration("siteRulesReloadInterval", time.Minute, "Minimum interval between checks of the site rules directory for changes.")
+	siteRulesMaxPages       = flag.Int("siteRulesMaxPages", 10, "Maximum number of pages followed for multi-page articles.")
+)
+
+const (
+	// siteRulesExt is the file extension of site rule files.
+	siteRulesExt = ".txt"
+	// maxArticleBytes bounds the size of a single fetched article page.
+	maxArticleBytes = 10 << 20
+)
+
+var (
+	errNoRuleMatch = errors.New("site rule body did not match")
+)
+
+// siteRule holds the extraction rules for a single site. Each field is a list
+// of CSS selectors that are tried in order.
+//
+// Rules are read from files in the format of FiveFilters site configs. Each
+// file is named after the host it applies to, e.g. "example.com.txt", and a
+// leading "." applies it to all subdomains as well, e.g. ".example.com.txt".
+// Each line is a "directive: value" pair:
+//
+//	# A comment.
+//	body: //div[@id="article"]
+//	strip: //aside | //div[contains(@class, "share")]
+//	strip_id_or_class: comments
+//	title: //h1
+//	date: //time
+//	next_page_link: //a[@rel="next"]
+//
+// Values may be XPath expressions or CSS selectors. Only the subset of XPath
+// that has an equivalent CSS selector is supported. Unsupported directives
+// are ignored. The date is only used for articles whose feed gives none.
+type siteRule struct {
+	body     []string
+	strip    []string
+	title    []string
+	date     []string
+	nextPage []string
+}
+
+// extractedArticle is the result of extracting an article with a site rule.
+type extractedArticle struct {
+	content string
+	title   string
+	date    time.Time
+}
+
+// parseSiteRule parses a site rule file. Invalid lines are logged and
+// skipped, so a single bad selector does not disable the whole rule.
+func parseSiteRule(name string, r io.Reader) (*siteRule, error) {
+	rule := &siteRule{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		directive, value, ok := strings.Cut(line, ":")
+		if !ok {
+			log.Warningf("Skipping invalid line %d in site rule %s: %s", n, name, line)
+			continue
+		}
+		directive = strings.TrimSpace(directive)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		var dst *[]string
+		switch directive {
+		case "body":
+			dst = &rule.body
+		case "strip":
+			dst = &rule.strip
+		case "strip_id_or_class":
+			rule.strip = append(rule.strip, fmt.Sprintf("[id*=%s], [class*=%s]", cssQuote(value), cssQuote(value)))
+			continue
+		case "title":
+			dst = &rule.title
+		case "date":
+			dst = &rule.date
+		case "next_page_link":
+			dst = &rule.nextPage
+		default:
+			log.V(2).Infof("Ignoring unsupported directive %q in site rule %s", directive, name)
+			continue
+		}
+
+		sel, err := toSelector(value)
+		if err != nil {
+			log.Warningf("Skipping line %d in site rule %s: %s", n, name, err)
+			continue
+		}
+		*dst = append(*dst, sel)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// toSelector returns the CSS selector for the given site rule value, which
+// is either an XPath expression or already a CSS selector.
+func toSelector(value string) (string, error) {
+	if strings.HasPrefix(value, "/") || strings.HasPrefix(value, "(") {
+		return xpathToCSS(value)
+	}
+	return value, nil
+}
+
+var (
+	xpathIndex      = regexp.MustCompile(`^\d+$`)
+	xpathAttrExists = regexp.MustCompile(`^@([\w:-]+)$`)
+	xpathAttrEquals = regexp.MustCompile(`^@([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')$`)
+	xpathContains   = regexp.MustCompile(`^contains\(\s*@([\w:-]+)\s*,\s*(?:"([^"]*)"|'([^']*)')\s*\)$`)
+	xpathStartsWith = regexp.MustCompile(`^starts-with\(\s*@([\w:-]+)\s*,\s*(?:"([^"]*)"|'([^']*)')\s*\)$`)
+	// xpathClassToken matches the common idiom for testing whether an element
+	// has a class: contains(concat(' ', normalize-space(@class), ' '), ' x ').
+	xpathClassToken = regexp.MustCompile(`^contains\(\s*concat\(\s*(?:' '|" ")\s*,\s*normalize-space\(\s*@class\s*\)\s*,\s*(?:' '|" ")\s*\)\s*,\s*(?:"\s*([^"\s]+)\s*"|'\s*([^'\s]+)\s*')\s*\)$`)
+)
+
+// xpathToCSS translates an XPath expression into an equivalent CSS selector.
+// Supported are unions, child and descendant steps with element names or
+// "*", and predicates testing attribute existence, equality, "contains",
+// "starts-with", class tokens and positions, joined with "and".
+func xpathToCSS(xpath string) (string, error) {
+	xpath = strings.TrimSpace(xpath)
+	// A parenthesized expression only groups the path.
+	if strings.HasPrefix(xpath, "(") && strings.HasSuffix(xpath, ")") && matchingBracket(xpath, 0) == len(xpath)-1 {
+		xpath = xpath[1 : len(xpath)-1]
+	}
+
+	var alternatives []string
+	for _, path := range splitTopLevel(xpath, " | ", "|") {
+		css, err := xpathPathToCSS(strings.TrimSpace(path))
+		if err != nil {
+			return "", fmt.Errorf("unsupported XPath %q: %w", xpath, err)
+		}
+		alternatives = append(alternatives, css)
+	}
+	return strings.Join(alternatives, ", "), nil
+}
+
+func xpathPathToCSS(path string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(path); {
+		switch {
+		case strings.HasPrefix(path[i:], "//"):
+			if b.Len() > 0 {
+				b.WriteString(" ")
+			}
+			i += 2
+		case path[i] == '/':
+			if b.Len() > 0 {
+				b.WriteString(" > ")
+			}
+			i++
+		case i > 0:
+			return "", fmt.Errorf("unexpected %q", path[i:])
+		}
+
+		j := i
+		for j < len(path) && (isXPathNameChar(path[j]) || path[j] == '*') {
+			j++
+		}
+		name := path[i:j]
+		if name == "" {
+			return "", fmt.Errorf("missing element name at %q", path[i:])
+		}
+		i = j
+
+		step := name
+		for i < len(path) && path[i] == '[' {
+			end := matchingBracket(path, i)
+			if end < 0 {
+				return "", errors.New("unbalanced brackets")
+			}
+			pred, err := xpathPredicateToCSS(path[i+1 : end])
+			if err != nil {
+				return "", err
+			}
+			step += pred
+			i = end + 1
+		}
+		if name == "*" && step != name {
+			step = strings.TrimPrefix(step, "*")
+		}
+		b.WriteString(step)
+	}
+	if b.Len() == 0 {
+		return "", errors.New("empty path")
+	}
+	return b.String(), nil
+}
+
+func xpathPredicateToCSS(pred string) (string, error) {
+	var b strings.Builder
+	for _, cond := range splitTopLevel(pred, " and ") {
+		cond = strings.TrimSpace(cond)
+		if m := xpathIndex.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, ":nth-of-type(%s)", m[0])
+		} else if m = xpathAttrExists.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, "[%s]", m[1])
+		} else if m = xpathAttrEquals.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, "[%s=%s]", m[1], cssQuote(m[2]+m[3]))
+		} else if m = xpathClassToken.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, "[class~=%s]", cssQuote(m[1]+m[2]))
+		} else if m = xpathContains.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, "[%s*=%s]", m[1], cssQuote(m[2]+m[3]))
+		} else if m = xpathStartsWith.FindStringSubmatch(cond); m != nil {
+			fmt.Fprintf(&b, "[%s^=%s]", m[1], cssQuote(m[2]+m[3]))
+		} else {
+			return "", fmt.Errorf("unsupported predicate %q", cond)
+		}
+	}
+	return b.String(), nil
+}
+
+func isXPathNameChar(c byte) bool {
+	return c == '-' || c == '_' || c == ':' || c == '.' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// matchingBracket returns the index of the bracket closing the one at the
+// given index, skipping quoted strings, or -1 if there is none.
+func matchingBracket(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s at the first of the given separators that occurs
+// outside of brackets and quoted strings.
+func splitTopLevel(s string, seps ...string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote = c
+			continue
+		case c == '[' || c == '(':
+			depth++
+			continue
+		case c == ']' || c == ')':
+			depth--
+			continue
+		}
+		if depth != 0 {
+			continue
+		}
+		for _, sep := range seps {
+			if strings.HasPrefix(s[i:], sep) {
+				parts = append(parts, s[start:i])
+				i += len(sep) - 1
+				start = i + 1
+				break
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func cssQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// siteRules is a directory of site rules that is reloaded when its contents
+// change. A nil *siteRules has no rules.
+type siteRules struct {
+	dir      string
+	interval time.Duration
+
+	mu        sync.Mutex
+	rules     map[string]*siteRule
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+func newSiteRules(dir string, interval time.Duration) *siteRules {
+	if dir == "" {
+		return nil
+	}
+	s := &siteRules{dir: dir, interval: interval}
+	s.reloadIfChanged()
+	log.Infof("Loaded %d site rules from %s", len(s.rules), dir)
+	return s
+}
+
+// lookup returns the rule for the given host, if any. A rule for the host
+// itself takes precedence over a rule for any of its parent domains.
+func (s *siteRules) lookup(host string) *siteRule {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastCheck) >= s.interval {
+		s.reloadIfChanged()
+	}
+
+	host = strings.ToLower(host)
+	if r, ok := s.rules[host]; ok {
+		return r
+	}
+	if r, ok := s.rules[strings.TrimPrefix(host, "www.")]; ok {
+		return r
+	}
+	for h := host; h != ""; {
+		if r, ok := s.rules["."+h]; ok {
+			return r
+		}
+		_, h, _ = strings.Cut(h, ".")
+	}
+	return nil
+}
+
+// reloadIfChanged reloads all rules if any rule file was added, removed or
+// modified since the last load. It must be called with s.mu held.
+func (s *siteRules) reloadIfChanged() {
+	s.lastCheck = time.Now()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Warningf("Failed to read site rules directory %s: %s", s.dir, err)
+		return
+	}
+	modTimes := map[string]time.Time{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), siteRulesExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		modTimes[e.Name()] = info.ModTime()
+	}
+
+	if s.rules != nil && len(modTimes) == len(s.modTimes) {
+		changed := false
+		for name, t := range modTimes {
+			if prev, ok := s.modTimes[name]; !ok || !prev.Equal(t) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+
+	rules := map[string]*siteRule{}
+	for name := range modTimes {
+		f, err := os.Open(filepath.Join(s.dir, name))
+		if err != nil {
+			log.Warningf("Failed to open site rule %s: %s", name, err)
+			continue
+		}
+		rule, err := parseSiteRule(name, f)
+		_ = f.Close()
+		if err != nil {
+			log.Warningf("Failed to parse site rule %s: %s", name, err)
+			continue
+		}
+		rules[strings.ToLower(strings.TrimSuffix(name, siteRulesExt))] = rule
+	}
+	if s.rules != nil {
+		log.Infof("Reloaded %d site rules from %s", len(rules), s.dir)
+	}
+	s.rules = rules
+	s.modTimes = modTimes
+}
+
+// extractWithRule extracts an article from the given page using the given
+// rule, following next-page links on the same host for multi-page articles.
+func (e *articleExtractor) extractWithRule(ctx context.Context, rule *siteRule, pageURL *url.URL, page []byte) (extractedArticle, error) {
+	var art extractedArticle
+	var parts []string
+	visited := map[string]bool{pageURL.String(): true}
+
+	for n := 1; ; n++ {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+		if err != nil {
+			return art, fmt.Errorf("failed to parse page: %w", err)
+		}
+
+		if n == 1 {
+			art.title = strings.TrimSpace(selectFirst(doc, rule.title).Text())
+			art.date = parseRuleDate(selectFirst(doc, rule.date))
+		}
+		next := nextPageURL(doc, rule.nextPage, pageURL)
+
+		for _, sel := range rule.strip {
+			doc.Find(sel).Remove()
+		}
+		body := selectFirst(doc, rule.body)
+		var content strings.Builder
+		body.Each(func(_ int, s *goquery.Selection) {
+			if h, err := goquery.OuterHtml(s); err == nil {
+				content.WriteString(h)
+			}
+		})
+		if strings.TrimSpace(body.Text()) == "" && body.Find("img").Length() == 0 {
+			if n == 1 {
+				return art, errNoRuleMatch
+			}
+			break
+		}
+		parts = append(parts, content.String())
+
+		if next == nil || n >= *siteRulesMaxPages || visited[next.String()] {
+			break
+		}
+		visited[next.String()] = true
+		if page, err = e.fetch(ctx, next.String()); err != nil {
+			log.Warningf("Failed to fetch next page %s: %s", next, err)
+			break
+		}
+		pageURL = next
+	}
+
+	art.content = strings.Join(parts, "\n")
+	return art, nil
+}
+
+// selectFirst returns the elements matched by the first selector that
+// matches any element.
+func selectFirst(doc *goquery.Document, selectors []string) *goquery.Selection {
+	for _, sel := range selectors {
+		if s := doc.Find(sel); s.Length() > 0 {
+			return s
+		}
+	}
+	return &goquery.Selection{}
+}
+
+// nextPageURL returns the URL of the next page of a multi-page article, if it
+// is on the same host as the current page.
+func nextPageURL(doc *goquery.Document, selectors []string, pageURL *url.URL) *url.URL {
+	href, ok := selectFirst(doc, selectors).First().Attr("href")
+	if !ok || href == "" {
+		return nil
+	}
+	next, err := pageURL.Parse(href)
+	if err != nil || next.Host != pageURL.Host {
+		return nil
+	}
+	next.Fragment = ""
+	return next
+}
+
+var ruleDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+}
+
+// parseRuleDate parses the date of the given element from its datetime or
+// content attribute, or its text.
+func parseRuleDate(s *goquery.Selection) time.Time {
+	s = s.First()
+	if s.Length() == 0 {
+		return time.Time{}
+	}
+	value := strings.TrimSpace(s.Text())
+	for _, attr := range []string{"datetime", "content"} {
+		if v, ok := s.Attr(attr); ok && v != "" {
+			value = strings.TrimSpace(v)
+			break
+		}
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC()
+	}
+	for _, layout := range ruleDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
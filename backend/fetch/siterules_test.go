@@ -0,0 +1,213 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestXPathToCSS(t *testing.T) {
+	tests := []struct {
+		xpath string
+		want  string
+	}{
+		{`//article`, `article`},
+		{`//div[@id="content"]`, `div[id="content"]`},
+		{`//div[@id='content']//p`, `div[id="content"] p`},
+		{`//div[@class="post"]/h1`, `div[class="post"] > h1`},
+		{`//*[contains(@class, 'share')]`, `[class*="share"]`},
+		{`//div[contains(concat(' ', normalize-space(@class), ' '), ' entry ')]`, `div[class~="entry"]`},
+		{`//a[starts-with(@href, "/page/") and @rel]`, `a[href^="/page/"][rel]`},
+		{`//ul/li[2]`, `ul > li:nth-of-type(2)`},
+		{`//aside | //footer`, `aside, footer`},
+		{`(//h1|//h2)`, `h1, h2`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.xpath, func(t *testing.T) {
+			got, err := xpathToCSS(tc.xpath)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+
+	for _, xpath := range []string{`//p/text()`, `//div[last()]`, `//div[@id="a"`, `//div[@id="a" or @id="b"]`} {
+		if got, err := xpathToCSS(xpath); err == nil {
+			t.Errorf("expected error for %q, got %q", xpath, got)
+		}
+	}
+}
+
+func TestParseSiteRule(t *testing.T) {
+	rule, err := parseSiteRule("example.com.txt", strings.NewReader(`
+# Example rule
+body: //div[@id="story"]
+body: article
+strip: //aside
+strip_id_or_class: related
+strip: //p/text()
+title: //h1
+date: time
+next_page_link: //a[@rel="next"]
+test_url: http://example.com/story
+not a directive
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	check := func(name string, got []string, want ...string) {
+		if strings.Join(got, "\n") != strings.Join(want, "\n") {
+			t.Errorf("expected %s selectors %q, got %q", name, want, got)
+		}
+	}
+	check("body", rule.body, `div[id="story"]`, `article`)
+	check("strip", rule.strip, `aside`, `[id*="related"], [class*="related"]`)
+	check("title", rule.title, `h1`)
+	check("date", rule.date, `time`)
+	check("next page", rule.nextPage, `a[rel="next"]`)
+}
+
+func TestSiteRulesLookupAndReload(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string, mod time.Time) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write("example.com.txt", "body: article", now)
+	write(".example.org.txt", "body: main", now)
+
+	rules := newSiteRules(dir, 0)
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "article"},
+		{"www.example.com", "article"},
+		{"blog.example.com", ""},
+		{"example.org", "main"},
+		{"news.example.org", "main"},
+		{"example.net", ""},
+	}
+	for _, tc := range tests {
+		got := ""
+		if r := rules.lookup(tc.host); r != nil {
+			got = r.body[0]
+		}
+		if got != tc.want {
+			t.Errorf("lookup(%q): expected %q, got %q", tc.host, tc.want, got)
+		}
+	}
+
+	write("example.com.txt", "body: #story", now.Add(time.Second))
+	if r := rules.lookup("example.com"); r == nil || r.body[0] != "#story" {
+		t.Errorf("expected modified rule to be reloaded, got %+v", r)
+	}
+	if err := os.Remove(filepath.Join(dir, ".example.org.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if r := rules.lookup("example.org"); r != nil {
+		t.Errorf("expected removed rule to be unloaded, got %+v", r)
+	}
+
+	var none *siteRules
+	if r := none.lookup("example.com"); r != nil {
+		t.Errorf("expected no rule without a rules directory, got %+v", r)
+	}
+}
+
+func TestExtractWithSiteRule(t *testing.T) {
+	pages := map[string]string{
+		"/story": `<html><body>
+			<h1 class="headline">Story Title</h1>
+			<time datetime="2025-03-04T05:06:07Z">March 4</time>
+			<div id="story"><p>First page text.</p><div class="share">Share this</div></div>
+			<div id="sidebar"><p>Sidebar text that readability might keep.</p></div>
+			<a rel="next" href="/story?page=2">Next</a>
+		</body></html>`,
+		"/story?page=2": `<html><body>
+			<div id="story"><p>Second page text.</p></div>
+			<a rel="next" href="/story">Back to the first page</a>
+		</body></html>`,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.RequestURI()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	rule := `body: //div[@id="story"]
+strip_id_or_class: share
+title: //h1[contains(@class, "headline")]
+date: time
+next_page_link: //a[@rel="next"]
+`
+	if err := os.WriteFile(filepath.Join(dir, "127.0.0.1.txt"), []byte(rule), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &articleExtractor{
+		client:    ts.Client(),
+		userAgent: "Test-Agent",
+		rules:     newSiteRules(dir, time.Hour),
+	}
+
+	parsed, err := e.Extract(context.Background(), ts.URL+"/story")
+	if err != nil {
+		t.Fatalf("unexpected extraction error: %v", err)
+	}
+	for _, want := range []string{"Story Title", "First page text.", "Second page text."} {
+		if !strings.Contains(parsed, want) {
+			t.Errorf("expected output to contain %q, got: %s", want, parsed)
+		}
+	}
+	for _, unwanted := range []string{"Share this", "Sidebar text"} {
+		if strings.Contains(parsed, unwanted) {
+			t.Errorf("expected output not to contain %q, got: %s", unwanted, parsed)
+		}
+	}
+
+	u, err := url.Parse(ts.URL + "/story")
+	if err != nil {
+		t.Fatal(err)
+	}
+	art, err := e.extractWithRule(context.Background(), e.rules.lookup(u.Hostname()), u, []byte(pages["/story"]))
+	if err != nil {
+		t.Fatalf("unexpected extraction error: %v", err)
+	}
+	if art.title != "Story Title" {
+		t.Errorf("expected title %q, got %q", "Story Title", art.title)
+	}
+	if want := time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC); !art.date.Equal(want) {
+		t.Errorf("expected date %s, got %s", want, art.date)
+	}
+
+	// A rule that does not match the page falls back to readability.
+	_, err = e.extractWithRule(context.Background(), &siteRule{body: []string{"#missing"}}, u, []byte(pages["/story"]))
+	if err != errNoRuleMatch {
+		t.Errorf("expected %v, got %v", errNoRuleMatch, err)
+	}
+}
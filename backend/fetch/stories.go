@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"flag"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+var (
+	groupStories     = flag.Bool("groupStories", true, "If true, near-duplicate articles from different feeds are grouped into stories.")
+	storyWindow      = flag.Duration("storyWindow", 48*time.Hour, "Maximum time between the retrieval of articles grouped into the same story.")
+	storyMaxDistance = flag.Int("storyMaxDistance", 10, "Maximum number of differing bits between the fingerprints of articles in the same story.")
+)
+
+// minFingerprintWords is the minimum number of words other than stop words of
+// an article to compute its fingerprint. Shorter texts are too similar to
+// compare.
+const minFingerprintWords = 15
+
+// fingerprint returns the SimHash of the words of the article's title and
+// content, or zero if it has too few words. Stop words are left out since
+// they are shared by unrelated articles. Single words rather than longer
+// shingles are hashed so that edits to a syndicated article, which are
+// usually a few words, change few bits.
+func fingerprint(a models.Article) uint64 {
+	content := a.Content
+	if content == "" {
+		content = a.Summary
+	}
+	words := strings.FieldsFunc(strings.ToLower(a.Title+" "+htmlText(content)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	kept := words[:0]
+	for _, w := range words {
+		if len(stopWordLanguages[w]) == 0 {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) < minFingerprintWords {
+		return 0
+	}
+	return simHash(kept)
+}
+
+// simHash returns the SimHash of the features: each bit is set if most
+// features have it set in their hash. The fraction of bits that differ
+// between the SimHashes of two sets of features estimates the angle between
+// them, so similar sets have close SimHashes.
+func simHash(features []string) uint64 {
+	var weights [64]int
+	h := fnv.New64a()
+	for _, f := range features {
+		h.Reset()
+		_, _ = h.Write([]byte(f))
+		sum := mix64(h.Sum64())
+		for b := range weights {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+
+	var fp uint64
+	for b, w := range weights {
+		if w > 0 {
+			fp |= 1 << b
+		}
+	}
+	return fp
+}
+
+// mix64 spreads the bits of a hash so that each bit of the result is equally
+// likely to be set, which FNV does not guarantee for short inputs.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// fingerprintDistance returns the number of bits that differ between two
+// fingerprints.
+func fingerprintDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// isSameStory returns true if the articles share a link or their
+// fingerprints are close enough.
+func isSameStory(o models.Article, n models.Article) bool {
+	if n.Link != "" && sameLink(o, n) {
+		return true
+	}
+	return o.Fingerprint != 0 && n.Fingerprint != 0 &&
+		fingerprintDistance(o.Fingerprint, n.Fingerprint) <= *storyMaxDistance
+}
+
+// storyGrouper groups new articles of a feed with near-duplicates recently
+// retrieved from the user's other feeds. Candidates are only loaded once an
+// article needs to be grouped, since most fetches have no new articles.
+type storyGrouper struct {
+	d      storage.Database
+	user   models.User
+	feedID int64
+
+	loaded     bool
+	settings   models.StorySettings
+	candidates []models.Article
+}
+
+func newStoryGrouper(d storage.Database, user models.User, feedID int64) *storyGrouper {
+	if !*groupStories {
+		return nil
+	}
+	return &storyGrouper{d: d, user: user, feedID: feedID}
+}
+
+func (g *storyGrouper) load() {
+	g.loaded = true
+
+	var err error
+	g.settings, err = g.d.GetStorySettingsForUser(g.user)
+	if err != nil {
+		log.Warningf("while fetching story settings for user %s: %s", g.user, err)
+		return
+	}
+	if !g.settings.Group && !g.settings.MarkRead {
+		return
+	}
+
+	g.candidates, err = g.d.GetStoryCandidatesForUser(g.user, g.feedID, time.Now().Add(-*storyWindow))
+	if err != nil {
+		log.Warningf("while fetching story candidates for user %s, feed %d: %s", g.user, g.feedID, err)
+	}
+}
+
+// group looks for the earliest article of another feed that the given
+// article is a near-duplicate of, and applies the user's story settings to
+// the article if there is one. Returns true if the article joined a story.
+// A nil grouper does not group articles.
+func (g *storyGrouper) group(a *models.Article) bool {
+	if g == nil {
+		return false
+	}
+	if !g.loaded {
+		g.load()
+	}
+
+	for _, c := range g.candidates {
+		if !isSameStory(c, *a) {
+			continue
+		}
+		log.V(2).Infof("Grouping article with article %d of feed %d: %s", c.ID, c.FeedID, a)
+		if g.settings.Group {
+			// The story of the candidate is looked up when inserting.
+			a.StoryID = c.ID
+		}
+		if g.settings.MarkRead {
+			a.Read = true
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+const pressRelease = `<p>Acme Corporation today announced the general availability of its new
+line of rocket-powered roller skates, designed for coyotes and other desert
+dwellers who need to move quickly across long distances. The skates feature a
+reinforced frame, an improved ignition system and a safety parachute.</p>
+<p>"We listened to our customers," said the chief executive of Acme. The skates
+ship next month from all authorized dealers.</p>`
+
+func TestFingerprint(t *testing.T) {
+	original := models.Article{Title: "Acme launches rocket skates", Content: pressRelease}
+	syndicated := models.Article{
+		Title: "Acme launches rocket skates",
+		Content: "<div>" + strings.Replace(pressRelease, "next month", "in two weeks", 1) +
+			"<p>Read more news.</p></div>",
+	}
+	different := models.Article{
+		Title: "Local bakery wins award",
+		Content: `<p>The bakery on the corner of Main Street won the regional award for the
+best sourdough bread this year, beating more than forty other entries from
+across the state. The owners thanked their staff and loyal customers.</p>`,
+	}
+
+	fp := fingerprint(original)
+	if fp == 0 {
+		t.Fatal("expected non-zero fingerprint")
+	}
+	if d := fingerprintDistance(fp, fingerprint(syndicated)); d > *storyMaxDistance {
+		t.Errorf("expected syndicated copy to be close, got distance %d", d)
+	}
+	if d := fingerprintDistance(fp, fingerprint(different)); d <= 2**storyMaxDistance {
+		t.Errorf("expected different article to be far, got distance %d", d)
+	}
+	if fingerprint(models.Article{Title: "Short", Summary: "<p>Too short to compare.</p>"}) != 0 {
+		t.Error("expected zero fingerprint for short article")
+	}
+}
+
+func TestStoryGrouper(t *testing.T) {
+	user := models.User{UserId: "test-user"}
+	fp := fingerprint(models.Article{Title: "Acme launches rocket skates", Content: pressRelease})
+	candidates := []models.Article{
+		{ID: 1, FeedID: 2, Link: "https://example.com/other", Fingerprint: fp ^ 0xFFFF},
+		{ID: 2, FeedID: 2, Link: "https://example.com/skates", OriginalLink: "https://t.co/skates"},
+		{ID: 3, FeedID: 3, Link: "https://news.example.com/acme", Fingerprint: fp ^ 0b101, StoryID: 2},
+	}
+
+	testCases := []struct {
+		name          string
+		settings      models.StorySettings
+		article       models.Article
+		expectGrouped bool
+		expectStory   int64
+		expectRead    bool
+	}{
+		{
+			name:          "same link",
+			settings:      models.StorySettings{Group: true},
+			article:       models.Article{Link: "https://example.com/skates"},
+			expectGrouped: true,
+			expectStory:   2,
+		},
+		{
+			name:          "same original link",
+			settings:      models.StorySettings{Group: true},
+			article:       models.Article{Link: "https://example.com/x", OriginalLink: "https://t.co/skates"},
+			expectGrouped: true,
+			expectStory:   2,
+		},
+		{
+			name:          "close fingerprint",
+			settings:      models.StorySettings{Group: true, MarkRead: true},
+			article:       models.Article{Link: "https://example.com/y", Fingerprint: fp},
+			expectGrouped: true,
+			expectStory:   3,
+			expectRead:    true,
+		},
+		{
+			name:          "mark read without grouping",
+			settings:      models.StorySettings{MarkRead: true},
+			article:       models.Article{Link: "https://example.com/skates"},
+			expectGrouped: true,
+			expectRead:    true,
+		},
+		{
+			name:     "no match",
+			settings: models.StorySettings{Group: true},
+			article:  models.Article{Link: "https://example.com/z", Fingerprint: ^fp},
+		},
+		{
+			name:     "disabled",
+			settings: models.StorySettings{},
+			article:  models.Article{Link: "https://example.com/skates"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := &storage.MockDB{
+				OnGetStorySettingsForUser: func(u models.User) (models.StorySettings, error) {
+					return tc.settings, nil
+				},
+				OnGetStoryCandidatesForUser: func(u models.User, feedID int64, since time.Time) ([]models.Article, error) {
+					if feedID != 1 {
+						t.Errorf("expected candidates excluding feed 1, got %d", feedID)
+					}
+					return candidates, nil
+				},
+			}
+
+			g := newStoryGrouper(db, user, 1)
+			a := tc.article
+			if grouped := g.group(&a); grouped != tc.expectGrouped {
+				t.Errorf("expected grouped %t, got %t", tc.expectGrouped, grouped)
+			}
+			if a.StoryID != tc.expectStory {
+				t.Errorf("expected story %d, got %d", tc.expectStory, a.StoryID)
+			}
+			if a.Read != tc.expectRead {
+				t.Errorf("expected read %t, got %t", tc.expectRead, a.Read)
+			}
+		})
+	}
+
+	t.Run("candidates are loaded once", func(t *testing.T) {
+		loads := 0
+		db := &storage.MockDB{
+			OnGetStorySettingsForUser: func(u models.User) (models.StorySettings, error) {
+				return models.DefaultStorySettings, nil
+			},
+			OnGetStoryCandidatesForUser: func(u models.User, feedID int64, since time.Time) ([]models.Article, error) {
+				loads++
+				return candidates, nil
+			},
+		}
+		g := newStoryGrouper(db, user, 1)
+		for i := 0; i < 3; i++ {
+			g.group(&models.Article{Link: "https://example.com/new"})
+		}
+		if loads != 1 {
+			t.Errorf("expected candidates to be loaded once, got %d", loads)
+		}
+	})
+
+	t.Run("nil grouper", func(t *testing.T) {
+		var g *storyGrouper
+		if g.group(&models.Article{Link: "https://example.com/skates"}) {
+			t.Error("expected nil grouper not to group")
+		}
+	})
+}
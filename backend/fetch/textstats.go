@@ -0,0 +1,188 @@
+package fetch
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jrupac/goliath/models"
+	"golang.org/x/net/html"
+)
+
+const (
+	// wordsPerMinute is the reading speed for languages that separate words
+	// with spaces.
+	wordsPerMinute = 230
+	// charsPerMinute is the reading speed for Chinese and Japanese text, in
+	// which each character is counted as a word.
+	charsPerMinute = 500
+	// minStopWords is the minimum number of stop words needed to detect the
+	// language of text in the Latin or Cyrillic scripts.
+	minStopWords = 2
+)
+
+// stopWords are frequent words of each language detected by stop words.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "was", "for", "with", "on", "are", "this", "be", "have", "you", "not", "but", "they", "from", "which"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "un", "una", "es", "por", "con", "para", "del", "se", "no", "su", "al", "lo", "como", "más", "pero"},
+	"fr": {"le", "la", "les", "de", "des", "et", "est", "un", "une", "du", "en", "que", "qui", "dans", "pour", "pas", "sur", "au", "avec", "ce", "il", "sont", "mais"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "sich", "auf", "für", "dem", "des", "auch", "es", "im", "wird", "sind"},
+	"it": {"il", "la", "di", "che", "e", "è", "un", "una", "per", "non", "del", "della", "le", "gli", "sono", "con", "ma", "anche", "nel", "alla", "si", "questo"},
+	"pt": {"o", "a", "os", "as", "de", "que", "e", "do", "da", "em", "um", "uma", "não", "para", "com", "por", "mais", "dos", "das", "ao", "se", "é", "mas"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "met", "zijn", "voor", "er", "ook", "maar", "aan", "om", "wordt", "bij", "dit", "naar"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "av", "för", "med", "inte", "den", "till", "har", "de", "om", "ett", "men", "var", "jag", "sig", "från"},
+	"no": {"og", "det", "er", "som", "en", "på", "av", "for", "med", "ikke", "den", "til", "har", "de", "om", "et", "men", "var", "jeg", "seg", "fra", "å"},
+	"da": {"og", "det", "er", "som", "en", "på", "af", "for", "med", "ikke", "den", "til", "har", "de", "om", "et", "men", "var", "jeg", "sig", "fra", "at"},
+	"hu": {"a", "az", "és", "hogy", "nem", "egy", "is", "de", "van", "meg", "csak", "ez", "mint", "már", "volt", "még", "ki", "el", "le", "ha", "vagy", "azt"},
+	"ru": {"и", "в", "не", "на", "что", "с", "он", "как", "по", "это", "но", "к", "из", "у", "за", "от", "о", "так", "же", "для", "все", "она"},
+	"uk": {"і", "та", "в", "не", "на", "що", "з", "до", "як", "це", "від", "для", "але", "про", "за", "його", "він", "вона", "є", "у", "ми", "який"},
+}
+
+// stopWordLanguages maps each stop word to the languages it is frequent in.
+var stopWordLanguages = func() map[string][]string {
+	m := map[string][]string{}
+	for lang, words := range stopWords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
+
+// scriptLanguages are the languages detected by their script alone.
+var scriptLanguages = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+}
+
+// AnalyzeText returns the word count, estimated reading time and detected
+// language of the given HTML content.
+func AnalyzeText(content string) models.TextStats {
+	words := strings.FieldsFunc(htmlText(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+
+	var stats models.TextStats
+	cjk := 0
+	for _, w := range words {
+		if n := countCJK(w); n > 0 {
+			cjk += n
+		} else {
+			stats.WordCount++
+		}
+	}
+
+	minutes := float64(stats.WordCount)/wordsPerMinute + float64(cjk)/charsPerMinute
+	stats.WordCount += cjk
+	stats.ReadingTime = time.Duration(minutes * float64(time.Minute)).Round(time.Second)
+	stats.Language = detectLanguage(words)
+	return stats
+}
+
+// htmlText returns the text of the given HTML with the text of each node
+// separated by spaces and without the contents of scripts and styles.
+func htmlText(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return s
+	}
+
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return b.String()
+}
+
+// isCJK returns true if the rune is a Chinese or Japanese character, which
+// are written without spaces between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+func countCJK(s string) int {
+	n := 0
+	for _, r := range s {
+		if isCJK(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// detectLanguage returns the ISO 639-1 code of the language of the given
+// words, or an empty string if it could not be detected. Languages written
+// in their own script are detected by script, and others by counting their
+// most frequent words.
+func detectLanguage(words []string) string {
+	var han, kana, other int
+	script := map[string]int{}
+	for _, w := range words {
+		for _, r := range w {
+			switch {
+			case unicode.Is(unicode.Han, r):
+				han++
+			case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+				kana++
+			case unicode.IsLetter(r):
+				other++
+				for _, s := range scriptLanguages {
+					if unicode.Is(s.table, r) {
+						script[s.lang]++
+						break
+					}
+				}
+			}
+		}
+	}
+
+	// Japanese mixes kana with Chinese characters, so any significant amount
+	// of kana is enough to tell them apart.
+	if han+kana > other {
+		if kana*10 > han+kana {
+			return "ja"
+		}
+		return "zh"
+	}
+	for lang, n := range script {
+		if n*2 > other {
+			return lang
+		}
+	}
+
+	scores := map[string]int{}
+	for _, w := range words {
+		for _, lang := range stopWordLanguages[strings.ToLower(w)] {
+			scores[lang]++
+		}
+	}
+
+	best, bestScore, tied := "", 0, false
+	for lang, score := range scores {
+		if score > bestScore {
+			best, bestScore, tied = lang, score, false
+		} else if score == bestScore {
+			tied = true
+		}
+	}
+	if bestScore < minStopWords || tied {
+		return ""
+	}
+	return best
+}
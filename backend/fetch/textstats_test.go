@@ -0,0 +1,76 @@
+package fetch
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAnalyzeText(t *testing.T) {
+	t.Run("counts words and estimates reading time", func(t *testing.T) {
+		content := "<p>" + strings.Repeat("The cat sat on the mat. ", 115) + "</p><script>var x = 1;</script>"
+
+		stats := AnalyzeText(content)
+
+		if stats.WordCount != 690 {
+			t.Errorf("expected 690 words, got %d", stats.WordCount)
+		}
+		if stats.ReadingTime != 3*time.Minute {
+			t.Errorf("expected reading time of 3m, got %s", stats.ReadingTime)
+		}
+		if stats.Language != "en" {
+			t.Errorf("expected English, got %q", stats.Language)
+		}
+	})
+
+	t.Run("separates words in adjacent elements", func(t *testing.T) {
+		if stats := AnalyzeText("<p>one</p><p>two</p>"); stats.WordCount != 2 {
+			t.Errorf("expected 2 words, got %d", stats.WordCount)
+		}
+	})
+
+	t.Run("counts Chinese characters as words", func(t *testing.T) {
+		stats := AnalyzeText("<p>我们今天去公园散步</p>")
+
+		if stats.WordCount != 9 {
+			t.Errorf("expected 9 words, got %d", stats.WordCount)
+		}
+		if stats.Language != "zh" {
+			t.Errorf("expected Chinese, got %q", stats.Language)
+		}
+	})
+
+	t.Run("empty content", func(t *testing.T) {
+		stats := AnalyzeText("")
+		if stats.WordCount != 0 || stats.ReadingTime != 0 || stats.Language != "" {
+			t.Errorf("expected no stats, got %+v", stats)
+		}
+	})
+}
+
+func TestDetectLanguage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"English", "The results of the study are not what they expected from the data", "en"},
+		{"Spanish", "El gobierno anunció que los precios de la energía bajarán para las familias", "es"},
+		{"French", "Le gouvernement a annoncé que les prix de l'énergie sont en baisse pour les familles", "fr"},
+		{"German", "Die Regierung hat angekündigt, dass die Preise für Energie nicht mehr steigen und auch sinken", "de"},
+		{"Russian", "Правительство объявило, что цены на энергию не будут расти и это хорошо для всех", "ru"},
+		{"Japanese", "今日はとても良い天気ですね", "ja"},
+		{"Korean", "오늘은 날씨가 아주 좋습니다", "ko"},
+		{"Greek", "Η κυβέρνηση ανακοίνωσε νέα μέτρα", "el"},
+		{"too short", "Hello world", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			words := strings.FieldsFunc(tc.input, func(r rune) bool { return r == ' ' || r == ',' })
+			if got := detectLanguage(words); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
@@ -8,17 +8,19 @@ import (
 	"image/png"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/arbovm/levenshtein"
 	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/cache"
 	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/utils"
 	"github.com/jrupac/rss"
 	"github.com/kljensen/snowball"
 	"github.com/mat/besticon/v3/besticon"
-	"golang.org/x/image/draw"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
@@ -31,6 +33,8 @@ var (
 	proxyInsecureImages = flag.Bool("proxyInsecureImages", false, "If true, image 'src' attributes are rewritten to be reverse proxied over HTTPS.")
 	proxySecureImages   = flag.Bool("proxySecureImages", false, "If true, also rewritten images served over HTTPS to a proxy server.")
 	proxyUrlBase        = flag.String("proxyUrlBase", "", "Base URL to reverse image proxy server.")
+	proxyImageSrcset    = flag.Bool("proxyImageSrcset", false, "If true, proxied images in article content are given a 'srcset' of resized variants.")
+	proxyInsecureMedia  = flag.Bool("proxyInsecureMedia", false, "If true, audio and video enclosures served over HTTP are rewritten to be streamed through the proxy over HTTPS.")
 )
 
 func processItem(feed *models.Feed, item *rss.Item) models.Article {
@@ -53,16 +57,49 @@ func processItem(feed *models.Feed, item *rss.Item) models.Article {
 	// or not, so we use a heuristic.
 	contents = maybeUnescapeHtml(contents)
 
+	// Run the feed's transformers before the lead image is picked, since they
+	// may remove tracking pixels or reveal lazy-loaded images.
+	contents = applyTransformers(feed.Transformers, feed.Link, contents)
+
 	parsed := ""
 
-	if item.Enclosures != nil {
-		for _, enc := range item.Enclosures {
-			if strings.HasPrefix(enc.Type, "image") && enc.URL != "" {
-				finalEncUrl := processImageUrl(feed.Link, enc.URL)
-				contents = prependMediaToHtml(finalEncUrl, contents)
-			}
+	// Pick the lead image before the contents are rewritten, preferring the
+	// item's own image and image enclosures to images in the contents.
+	var thumbnail string
+	if item.Image != nil && item.Image.URL != "" {
+		thumbnail = item.Image.URL
+	}
+	for _, enc := range item.Enclosures {
+		if thumbnail == "" && enc != nil && enc.URL != "" && strings.HasPrefix(enc.Type, "image") {
+			thumbnail = enc.URL
 		}
 	}
+	if thumbnail == "" {
+		thumbnail = leadImageFromHtml(contents)
+	}
+	if thumbnail != "" {
+		thumbnail = processImageUrl(feed.Link, thumbnail)
+	}
+
+	var enclosures []models.Enclosure
+	for _, enc := range item.Enclosures {
+		if enc == nil || enc.URL == "" {
+			continue
+		}
+		if strings.HasPrefix(enc.Type, "image") {
+			finalEncUrl := processImageUrl(feed.Link, enc.URL)
+			contents = prependMediaToHtml(finalEncUrl, contents)
+		}
+		e := models.Enclosure{
+			URL:    getAbsoluteUrl(feed.Link, enc.URL),
+			Type:   strings.ToLower(strings.TrimSpace(enc.Type)),
+			Length: int64(enc.Length),
+		}
+		if e.Playable() {
+			e.URL = processMediaUrl(e.URL)
+		}
+		enclosures = append(enclosures, e)
+	}
 
 	if *sanitizeHTML {
 		title = bluemondayTitlePolicy.Sanitize(title)
@@ -95,10 +132,63 @@ func processItem(feed *models.Feed, item *rss.Item) models.Article {
 		Read:          item.Read,
 		Saved:         false,
 		Retrieved:     retrieved,
+		Enclosures:    enclosures,
+		Categories:    itemCategories(item),
+		Thumbnail:     thumbnail,
+		TextStats:     AnalyzeText(contents),
 		SyntheticDate: syntheticDate,
 	}
 }
 
+// minLeadImageSize is the minimum width and height in pixels, when given, of
+// images in the contents to be considered as the lead image. This skips
+// tracking pixels and icons.
+const minLeadImageSize = 100
+
+// leadImageFromHtml returns the source of the first image in the HTML that is
+// not known to be small, or an empty string if there is none.
+func leadImageFromHtml(s string) string {
+	if !strings.Contains(s, "<img") {
+		return ""
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		log.Warningf("while parsing HTML: %s", err)
+		return ""
+	}
+
+	var src string
+	doc.Find("img").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		for _, attr := range []string{"width", "height"} {
+			if v, ok := sel.Attr(attr); ok {
+				if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(v), "px")); err == nil && n < minLeadImageSize {
+					return true
+				}
+			}
+		}
+		s, _ := sel.Attr("src")
+		s = strings.TrimSpace(s)
+		if s == "" || strings.HasPrefix(s, "data:") {
+			return true
+		}
+		src = s
+		return false
+	})
+	return src
+}
+
+// itemCategories returns the distinct, non-empty categories of the item.
+func itemCategories(item *rss.Item) []string {
+	var categories []string
+	for _, c := range item.Categories {
+		c = strings.TrimSpace(c)
+		if c != "" && !slices.Contains(categories, c) {
+			categories = append(categories, c)
+		}
+	}
+	return categories
+}
+
 // maybeResizeImage converts the provided besticon.Icon to a 256x256 PNG image
 // and returns an imagePair struct containing the base64-encoded image and
 // metadata.
@@ -108,8 +198,7 @@ func maybeResizeImage(folderId int64, feedId int64, bi besticon.Icon, i *image.I
 	if *normalizeFavicons {
 		var buff bytes.Buffer
 
-		resized := image.NewRGBA(image.Rect(0, 0, 256, 256))
-		draw.CatmullRom.Scale(resized, resized.Rect, *i, (*i).Bounds(), draw.Over, nil)
+		resized := utils.ScaleImage(*i, 256, 256)
 
 		err := png.Encode(&buff, resized)
 		if err != nil {
@@ -188,6 +277,27 @@ func processImageUrl(feedLink, imageUrl string) string {
 		return absUrlStr
 	}
 
+	return proxyUrl(absUrlStr, nil)
+}
+
+// processMediaUrl rewrites the absolute URL of an audio or video file served
+// over HTTP to be streamed through the proxy if configured.
+func processMediaUrl(mediaUrl string) string {
+	if !*proxyInsecureMedia {
+		return mediaUrl
+	}
+
+	u, err := url.Parse(mediaUrl)
+	if err != nil || u.Scheme != "http" {
+		return mediaUrl
+	}
+
+	return proxyUrl(mediaUrl, url.Values{"stream": {"1"}})
+}
+
+// proxyUrl returns the signed URL of the given absolute URL through the
+// proxy, with the given extra parameters.
+func proxyUrl(absUrlStr string, params url.Values) string {
 	newUrl, err := url.Parse(fmt.Sprintf("%s/%s", *proxyUrlBase, cacheEndpoint))
 	if err != nil {
 		log.Warningf("invalid proxy base URL %s: %s", *proxyUrlBase, err)
@@ -196,12 +306,36 @@ func processImageUrl(feedLink, imageUrl string) string {
 
 	q := newUrl.Query()
 	q.Add("url", absUrlStr)
+	q.Add("sig", cache.SignURL(absUrlStr))
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
 	newUrl.RawQuery = q.Encode()
 
 	log.V(2).Infof("Rewritten URL: %s", newUrl.String())
 	return newUrl.String()
 }
 
+// imageSrcset returns a srcset attribute listing the resized variants of the
+// given image proxy URL, or an empty string if the URL is not proxied.
+func imageSrcset(proxiedUrl string) string {
+	u, err := url.Parse(proxiedUrl)
+	if err != nil || !strings.HasSuffix(u.Path, "/"+cacheEndpoint) || !u.Query().Has("sig") {
+		return ""
+	}
+
+	var entries []string
+	for _, width := range cache.VariantWidths() {
+		q := u.Query()
+		q.Set("w", strconv.Itoa(width))
+		u.RawQuery = q.Encode()
+		entries = append(entries, fmt.Sprintf("%s %dw", u.String(), width))
+	}
+	return strings.Join(entries, ", ")
+}
+
 // ProcessHTMLContent parses the given string as HTML, searches for
 // image source URLs, makes them absolute if they are relative, and then rewrites
 // them to point at the reverse image proxy. Also replaces relative URLs in <a> tags.
@@ -224,6 +358,12 @@ func ProcessHTMLContent(baseURL string, s string) string {
 			if attr.Key == "src" {
 				finalUrl := processImageUrl(baseURL, attr.Val)
 				s.SetAttr(attr.Key, finalUrl)
+				if !*proxyImageSrcset {
+					continue
+				}
+				if srcset := imageSrcset(finalUrl); srcset != "" {
+					s.SetAttr("srcset", srcset)
+				}
 			}
 		}
 	})
@@ -307,9 +447,22 @@ func prependMediaToHtml(imgSrc string, s string) string {
 	return resp
 }
 
-// stemWord returns the stemmed version of the word in English using the Porter
-// Stemming algorithm.
-func stemWord(s string) string {
+// snowballLanguages maps the languages supported by the Snowball stemmer to
+// their names in it.
+var snowballLanguages = map[string]string{
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"ru": "russian",
+	"sv": "swedish",
+	"no": "norwegian",
+	"hu": "hungarian",
+}
+
+// stemWord returns the stemmed version of the word in the given language using
+// the Snowball stemmer. Words are stemmed as English if the language is not
+// known and only lowercased if there is no stemmer for the language.
+func stemWord(s string, lang string) string {
 	ret := s
 
 	// Filter out some punctuation and other marks. Do not include a single quote
@@ -320,12 +473,19 @@ func stemWord(s string) string {
 	}
 	ret = reg.ReplaceAllString(ret, "")
 
-	stemmed, _ := snowball.Stem(ret, "english", true)
+	if lang == "" {
+		lang = "en"
+	}
+	language, ok := snowballLanguages[lang]
+	if !ok {
+		return strings.ToLower(ret)
+	}
+	stemmed, _ := snowball.Stem(ret, language, true)
 	return stemmed
 }
 
 // maybeMuteArticle returns true if any of the article's title or contents
-// match any of the muted words.
+// match any of the muted words. Words are stemmed in the article's language.
 func maybeMuteArticle(a models.Article, muteWords []string, unmuteFeeds []int64) bool {
 	muteWordMap := make(map[string]string)
 
@@ -338,7 +498,7 @@ func maybeMuteArticle(a models.Article, muteWords []string, unmuteFeeds []int64)
 	}
 
 	for _, word := range muteWords {
-		muteWordMap[stemWord(word)] = word
+		muteWordMap[stemWord(word, a.Language)] = word
 	}
 
 	textWords := strings.Fields(extractTextFromHtmlUnsafe(a.Title))
@@ -346,7 +506,7 @@ func maybeMuteArticle(a models.Article, muteWords []string, unmuteFeeds []int64)
 	textWords = append(textWords, strings.Fields(extractTextFromHtmlUnsafe(a.Content))...)
 
 	for _, textWord := range textWords {
-		if muteWord, ok := muteWordMap[stemWord(textWord)]; ok {
+		if muteWord, ok := muteWordMap[stemWord(textWord, a.Language)]; ok {
 			log.Infof(
 				"Filtering article due to muted word \"%s\" -> \"%s\": %s",
 				muteWord, textWord, a.String())
@@ -377,11 +537,25 @@ func maybeMuteArticleByRegex(a models.Article, regexes []*regexp.Regexp) bool {
 	return false
 }
 
+// sameLink returns true if the articles share a link, comparing both their
+// canonical and original links.
+func sameLink(o models.Article, n models.Article) bool {
+	for _, ol := range []string{o.Link, o.OriginalLink} {
+		if ol == "" {
+			continue
+		}
+		if ol == n.Link || ol == n.OriginalLink {
+			return true
+		}
+	}
+	return o.Link == n.Link
+}
+
 func getSimilarExistingArticles(articles []models.Article, a models.Article) ([]int64, []int64) {
 	var unreadIds, readIds []int64
 
 	isSimilar := func(o models.Article, n models.Article) bool {
-		if o.Link != n.Link {
+		if !sameLink(o, n) {
 			return false
 		}
 
@@ -389,14 +563,7 @@ func getSimilarExistingArticles(articles []models.Article, a models.Article) ([]
 			return true
 		}
 
-		editDistPercent := func(base string, comp string) float64 {
-			return float64(levenshtein.Distance(base, comp)) / float64(len(base))
-		}
-
-		distTitle := editDistPercent(o.Title, a.Title)
-		distSummary := editDistPercent(o.Summary, a.Summary)
-
-		return distTitle < *maxEditDedup && distSummary < *maxEditDedup
+		return isDedupSimilar(o, n)
 	}
 
 	for _, old := range articles {
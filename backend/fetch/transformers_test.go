@@ -2,10 +2,12 @@ package fetch
 
 import (
 	"regexp"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/jrupac/goliath/cache"
 	"github.com/jrupac/goliath/models"
 	"github.com/jrupac/rss"
 )
@@ -181,6 +183,92 @@ func TestProcessItem(t *testing.T) {
 		}
 	})
 
+	t.Run("stores enclosures", func(t *testing.T) {
+		item := baseItem()
+		item.Enclosures = []*rss.Enclosure{
+			{URL: "/episode.mp3", Type: "Audio/MPEG", Length: 1234},
+			{URL: "", Type: "audio/mpeg"},
+			{URL: "http://example.com/image.jpg", Type: "image/jpeg"},
+		}
+
+		article := processItem(feed, item)
+
+		if len(article.Enclosures) != 2 {
+			t.Fatalf("expected 2 enclosures, got %+v", article.Enclosures)
+		}
+		e := article.Enclosures[0]
+		if e.URL != "http://example.com/episode.mp3" || e.Type != "audio/mpeg" || e.Length != 1234 || !e.Playable() {
+			t.Errorf("unexpected enclosure: %+v", e)
+		}
+		if article.Enclosures[1].Playable() {
+			t.Errorf("image enclosure should not be playable: %+v", article.Enclosures[1])
+		}
+	})
+
+	t.Run("streams insecure media enclosures through proxy", func(t *testing.T) {
+		oldProxyMedia := *proxyInsecureMedia
+		*proxyInsecureMedia = true
+		defer func() { *proxyInsecureMedia = oldProxyMedia }()
+
+		oldProxyUrlBase := *proxyUrlBase
+		*proxyUrlBase = "https://proxy.example.com"
+		defer func() { *proxyUrlBase = oldProxyUrlBase }()
+
+		item := baseItem()
+		item.Enclosures = []*rss.Enclosure{
+			{URL: "http://example.com/episode.mp3", Type: "audio/mpeg"},
+			{URL: "https://example.com/episode.mp4", Type: "video/mp4"},
+		}
+
+		article := processItem(feed, item)
+
+		mediaUrl := "http://example.com/episode.mp3"
+		expected := "https://proxy.example.com/cache?sig=" + cache.SignURL(mediaUrl) + "&stream=1&url=http%3A%2F%2Fexample.com%2Fepisode.mp3"
+		if got := article.Enclosures[0].URL; got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+		if got := article.Enclosures[1].URL; got != "https://example.com/episode.mp4" {
+			t.Errorf("expected secure enclosure not to be proxied, got %s", got)
+		}
+	})
+
+	t.Run("picks thumbnail", func(t *testing.T) {
+		item := baseItem()
+		item.Content = `<p><img src="data:image/gif;base64,R0lGOD"><img src="/pixel.gif" width="1" height="1"><img src="/lead.jpg" width="640"></p>`
+
+		if got := processItem(feed, item).Thumbnail; got != "http://example.com/lead.jpg" {
+			t.Errorf("expected first large image in content, got %q", got)
+		}
+
+		item.Enclosures = []*rss.Enclosure{
+			{URL: "/episode.mp3", Type: "audio/mpeg"},
+			{URL: "/cover.jpg", Type: "image/jpeg"},
+		}
+		if got := processItem(feed, item).Thumbnail; got != "http://example.com/cover.jpg" {
+			t.Errorf("expected image enclosure, got %q", got)
+		}
+
+		item.Image = &rss.Image{URL: "http://example.com/feed-image.png"}
+		if got := processItem(feed, item).Thumbnail; got != "http://example.com/feed-image.png" {
+			t.Errorf("expected item image, got %q", got)
+		}
+
+		if got := processItem(feed, baseItem()).Thumbnail; got != "" {
+			t.Errorf("expected no thumbnail, got %q", got)
+		}
+	})
+
+	t.Run("keeps categories", func(t *testing.T) {
+		item := baseItem()
+		item.Categories = []string{" Go ", "", "Databases", "Go"}
+
+		article := processItem(feed, item)
+
+		if !slices.Equal(article.Categories, []string{"Go", "Databases"}) {
+			t.Errorf("unexpected categories: %q", article.Categories)
+		}
+	})
+
 	t.Run("with empty title", func(t *testing.T) {
 		item := baseItem()
 		item.Title = ""
@@ -316,7 +404,7 @@ func TestProcessImageUrl(t *testing.T) {
 		defer func() { *proxyUrlBase = oldProxyUrlBase }()
 
 		imageUrl := "http://insecure.com/foo.jpg"
-		expected := "https://proxy.example.com/cache?url=http%3A%2F%2Finsecure.com%2Ffoo.jpg"
+		expected := "https://proxy.example.com/cache?sig=" + cache.SignURL(imageUrl) + "&url=http%3A%2F%2Finsecure.com%2Ffoo.jpg"
 		result := processImageUrl(feedLink, imageUrl)
 		if result != expected {
 			t.Errorf("expected %s, got %s", expected, result)
@@ -347,20 +435,41 @@ func TestMaybeRewriteUrls(t *testing.T) {
 		defer func() { *proxyInsecureImages = oldProxyInsecure }()
 
 		content := "Hello world <img src='http://insecure.com/foo.jpg'>"
-		expected := "<html><head></head><body>Hello world <img src=\"/cache?url=http%3A%2F%2Finsecure.com%2Ffoo.jpg\"/></body></html>"
+		expected := "<html><head></head><body>Hello world <img src=\"/cache?sig=" + cache.SignURL("http://insecure.com/foo.jpg") + "&amp;url=http%3A%2F%2Finsecure.com%2Ffoo.jpg\"/></body></html>"
 		result := ProcessHTMLContent(feed.Link, content)
 		if result != expected {
 			t.Errorf("expected %s, got %s", expected, result)
 		}
 	})
 
+	t.Run("adds srcset of resized variants to proxied image", func(t *testing.T) {
+		oldProxyInsecure := *proxyInsecureImages
+		*proxyInsecureImages = true
+		defer func() { *proxyInsecureImages = oldProxyInsecure }()
+
+		oldSrcset := *proxyImageSrcset
+		*proxyImageSrcset = true
+		defer func() { *proxyImageSrcset = oldSrcset }()
+
+		result := ProcessHTMLContent(feed.Link, "<img src='http://insecure.com/foo.jpg'> <img src='https://secure.com/bar.jpg'>")
+
+		sig := cache.SignURL("http://insecure.com/foo.jpg")
+		expected := `srcset="/cache?sig=` + sig + `&amp;url=http%3A%2F%2Finsecure.com%2Ffoo.jpg&amp;w=320 320w, `
+		if !strings.Contains(result, expected) {
+			t.Errorf("expected result to contain %s, got %s", expected, result)
+		}
+		if strings.Count(result, "srcset") != 1 {
+			t.Errorf("expected only proxied image to have srcset, got %s", result)
+		}
+	})
+
 	t.Run("rewrites relative URL and proxies insecure image", func(t *testing.T) {
 		oldProxyInsecure := *proxyInsecureImages
 		*proxyInsecureImages = true
 		defer func() { *proxyInsecureImages = oldProxyInsecure }()
 
 		content := "Hello world <img src='/foo.jpg'>"
-		expected := "<html><head></head><body>Hello world <img src=\"/cache?url=http%3A%2F%2Fexample.com%2Ffoo.jpg\"/></body></html>"
+		expected := "<html><head></head><body>Hello world <img src=\"/cache?sig=" + cache.SignURL("http://example.com/foo.jpg") + "&amp;url=http%3A%2F%2Fexample.com%2Ffoo.jpg\"/></body></html>"
 		result := ProcessHTMLContent(feed.Link, content)
 		if result != expected {
 			t.Errorf("expected %s, got %s", expected, result)
@@ -419,17 +528,20 @@ func TestStemWord(t *testing.T) {
 	testCases := []struct {
 		name     string
 		input    string
+		lang     string
 		expected string
 	}{
-		{"running", "running", "run"},
-		{"jumps", "jumps", "jump"},
-		{"happily", "happily", "happili"},
-		{"punctuation", "awe.some!", "awesom"},
+		{"running", "running", "en", "run"},
+		{"jumps", "jumps", "en", "jump"},
+		{"happily", "happily", "en", "happili"},
+		{"punctuation", "awe.some!", "en", "awesom"},
+		{"unknown language", "running", "", "run"},
+		{"no stemmer", "Häuser.", "de", "häuser"},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			result := stemWord(tc.input)
+			result := stemWord(tc.input, tc.lang)
 			if result != tc.expected {
 				t.Errorf("expected %q, got %q", tc.expected, result)
 			}
@@ -544,6 +656,25 @@ func TestGetSimilarExistingArticles(t *testing.T) {
 		}
 	})
 
+	t.Run("fuzzy matching with a rewritten summary", func(t *testing.T) {
+		*strictDedup = false
+		*maxEditDedup = 0.1
+
+		stored := []models.Article{
+			{ID: 1, Link: "http://example.com/a", Title: "Original Title", Summary: "Original Summary", Read: true},
+			{ID: 5, Link: "http://example.com/a", Title: "Original Title", Summary: "A rewritten summary of a new article"},
+		}
+		unreadIDs, readIDs := getSimilarExistingArticles(stored, newArticle)
+
+		if len(unreadIDs) != 0 {
+			t.Errorf("expected no unreadIDs, got %v", unreadIDs)
+		}
+
+		if len(readIDs) != 1 || readIDs[0] != 1 {
+			t.Errorf("expected readIDs [1], got %v", readIDs)
+		}
+	})
+
 	t.Run("strict matching", func(t *testing.T) {
 		*strictDedup = true
 
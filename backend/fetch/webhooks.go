@@ -0,0 +1,417 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/jrupac/goliath/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	webhookWorkers    = flag.Int("webhookWorkers", 2, "Number of concurrent webhook deliveries.")
+	webhookQueueSize  = flag.Int("webhookQueueSize", 1000, "Maximum number of webhook deliveries waiting to be sent.")
+	webhookMaxRetries = flag.Int("webhookMaxRetries", 5, "Maximum number of retries of a failed webhook delivery before it is marked dead.")
+	webhookRetryDelay = flag.Duration("webhookRetryDelay", 30*time.Second,
+		"Delay before the first retry of a failed webhook delivery. The delay doubles on each subsequent retry.")
+	webhookTimeout           = flag.Duration("webhookTimeout", 10*time.Second, "Timeout for webhook delivery requests.")
+	webhookAllowPrivateHosts = flag.Bool("webhookAllowPrivateHosts", false,
+		"If true, webhooks may be delivered to loopback and private addresses, e.g. to a local service. Only enable this if all users are trusted.")
+)
+
+const (
+	// WebhookSignatureHeader holds the hex-encoded HMAC-SHA256 of the payload,
+	// keyed with the webhook's secret and prefixed with "sha256=".
+	WebhookSignatureHeader = "X-Goliath-Signature"
+	// WebhookDeliveryHeader holds the ID of the delivery, which is the same
+	// across retries.
+	WebhookDeliveryHeader = "X-Goliath-Delivery"
+)
+
+var (
+	webhookDeliveriesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "webhook_deliveries_total",
+			Help: "Total number of webhook delivery attempts by result: success, retry, failure (marked dead), or dropped (queue full).",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(webhookDeliveriesMetric)
+}
+
+// WebhookPayload is the data a webhook payload is rendered from. Without a
+// template, it is sent encoded as JSON.
+type WebhookPayload struct {
+	Event   string                `json:"event"`
+	User    string                `json:"user"`
+	Feed    WebhookPayloadFeed    `json:"feed"`
+	Article WebhookPayloadArticle `json:"article"`
+	// Rules holds the names of the rules the article matched.
+	Rules []string `json:"rules,omitempty"`
+}
+
+type WebhookPayloadFeed struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+type WebhookPayloadArticle struct {
+	ID      int64     `json:"id"`
+	Title   string    `json:"title"`
+	Link    string    `json:"link"`
+	Summary string    `json:"summary"`
+	Date    time.Time `json:"date"`
+	Labels  []string  `json:"labels,omitempty"`
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to embed a string in a JSON template.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// ParseWebhookTemplate parses a webhook payload template. Fields of
+// WebhookPayload are available in the template, as is a "json" function to
+// encode values as JSON.
+func ParseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("payload").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderWebhookPayload renders the payload for the given webhook.
+func renderWebhookPayload(w models.Webhook, p WebhookPayload) ([]byte, error) {
+	if w.Template == "" {
+		return json.Marshal(p)
+	}
+	tmpl, err := ParseWebhookTemplate(w.Template)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SignWebhookPayload returns the value of the signature header for the given
+// payload and secret.
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookMatches returns true if the article matches the webhook's filter.
+// The given rule IDs are the rules the article matched.
+func webhookMatches(w models.Webhook, a models.Article, ruleIDs []int64) bool {
+	f := w.Filter
+
+	if len(f.FeedIDs) > 0 && !slices.Contains(f.FeedIDs, a.FeedID) {
+		return false
+	}
+	if len(f.FolderIDs) > 0 && !slices.Contains(f.FolderIDs, a.FolderID) {
+		return false
+	}
+	if len(f.RuleIDs) > 0 && !slices.ContainsFunc(f.RuleIDs, func(id int64) bool {
+		return slices.Contains(ruleIDs, id)
+	}) {
+		return false
+	}
+	if len(f.Keywords) > 0 {
+		text := strings.ToLower(strings.Join([]string{
+			extractTextFromHtmlUnsafe(a.Title),
+			extractTextFromHtmlUnsafe(a.Summary),
+			extractTextFromHtmlUnsafe(a.Content),
+		}, "\n"))
+		if !slices.ContainsFunc(f.Keywords, func(k string) bool {
+			return strings.Contains(text, strings.ToLower(k))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+type webhookJob struct {
+	user     models.User
+	webhook  models.Webhook
+	delivery models.WebhookDelivery
+}
+
+// webhookDispatcher delivers webhook payloads in the background with a
+// bounded number of workers and logs each delivery in the database.
+type webhookDispatcher struct {
+	d      storage.Database
+	jobs   chan webhookJob
+	client *http.Client
+
+	// started is when the dispatcher was created. Deliveries logged as
+	// pending before then were interrupted by a restart and are resumed.
+	started time.Time
+	mu      sync.Mutex
+	resumed map[models.UserId]bool
+}
+
+func newWebhookDispatcher(d storage.Database) *webhookDispatcher {
+	client := utils.NewSafeClient(*webhookTimeout)
+	if *webhookAllowPrivateHosts {
+		client = &http.Client{Timeout: *webhookTimeout}
+	}
+	return &webhookDispatcher{
+		d:       d,
+		jobs:    make(chan webhookJob, *webhookQueueSize),
+		client:  client,
+		started: time.Now(),
+	}
+}
+
+// start runs the dispatcher's workers until the given context is canceled.
+func (wd *webhookDispatcher) start(ctx context.Context) {
+	if wd == nil {
+		return
+	}
+	for i := 0; i < *webhookWorkers; i++ {
+		go wd.work(ctx)
+	}
+}
+
+// resume queues the deliveries of the given users that were still pending
+// when the server last stopped, waiting out what is left of their retry delay.
+// Deliveries to webhooks that were deleted since are marked dead. Each user's
+// deliveries are only resumed once.
+func (wd *webhookDispatcher) resume(users []models.User) {
+	if wd == nil {
+		return
+	}
+
+	for _, u := range users {
+		wd.mu.Lock()
+		done := wd.resumed[u.UserId]
+		if wd.resumed == nil {
+			wd.resumed = map[models.UserId]bool{}
+		}
+		wd.resumed[u.UserId] = true
+		wd.mu.Unlock()
+		if done {
+			continue
+		}
+
+		deliveries, err := wd.d.GetWebhookDeliveriesForUser(u, models.WebhookDeliveryPending, 0)
+		if err != nil {
+			log.Warningf("while fetching pending webhook deliveries for %s: %s", u, err)
+			continue
+		}
+		if len(deliveries) == 0 {
+			continue
+		}
+		webhooks, err := wd.d.GetWebhooksForUser(u)
+		if err != nil {
+			log.Warningf("while fetching webhooks for %s: %s", u, err)
+			continue
+		}
+
+		for _, d := range deliveries {
+			if !d.Created.Before(wd.started) {
+				continue
+			}
+			i := slices.IndexFunc(webhooks, func(w models.Webhook) bool { return w.ID == d.WebhookID })
+			if i < 0 {
+				job := webhookJob{user: u, webhook: models.Webhook{ID: d.WebhookID}, delivery: d}
+				job.delivery.Status = models.WebhookDeliveryDead
+				job.delivery.Error = "webhook was deleted"
+				wd.update(job)
+				continue
+			}
+
+			job := webhookJob{user: u, webhook: webhooks[i], delivery: d}
+			var delay time.Duration
+			if d.Attempts > 0 {
+				delay = time.Until(d.Updated.Add(*webhookRetryDelay << (d.Attempts - 1)))
+			}
+			log.V(2).Infof("Resuming delivery %d to %s for %s in %s", d.ID, job.webhook, u, max(delay, 0))
+			if delay > 0 {
+				time.AfterFunc(delay, func() { wd.enqueue(job) })
+			} else {
+				wd.enqueue(job)
+			}
+		}
+	}
+}
+
+// fire dispatches the webhooks matching the given newly inserted article. The
+// given rule IDs are the IDs of those of the user's rules that the article
+// matched.
+func (wd *webhookDispatcher) fire(u models.User, feed *models.Feed, webhooks []models.Webhook, a models.Article, ruleIDs []int64, rules []models.Rule) {
+	if wd == nil || len(webhooks) == 0 {
+		return
+	}
+
+	p := WebhookPayload{
+		Event: "article",
+		User:  u.Username,
+		Feed:  WebhookPayloadFeed{ID: feed.ID, Title: feed.Title, URL: feed.URL},
+		Article: WebhookPayloadArticle{
+			ID:      a.ID,
+			Title:   a.Title,
+			Link:    a.Link,
+			Summary: a.Summary,
+			Date:    a.Date,
+			Labels:  a.Labels,
+		},
+	}
+	for _, r := range rules {
+		if slices.Contains(ruleIDs, r.ID) {
+			p.Rules = append(p.Rules, r.Name)
+		}
+	}
+
+	for _, w := range webhooks {
+		if webhookMatches(w, a, ruleIDs) {
+			wd.dispatch(u, w, p)
+		}
+	}
+}
+
+// dispatch renders the given payload for the webhook, logs the delivery and
+// queues it to be sent.
+func (wd *webhookDispatcher) dispatch(u models.User, w models.Webhook, p WebhookPayload) {
+	delivery := models.WebhookDelivery{
+		WebhookID: w.ID,
+		ArticleID: p.Article.ID,
+		Status:    models.WebhookDeliveryPending,
+	}
+	payload, err := renderWebhookPayload(w, p)
+	if err != nil {
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.Error = fmt.Sprintf("failed to render payload: %s", err)
+	}
+	delivery.Payload = string(payload)
+
+	if delivery.ID, err = wd.d.InsertWebhookDeliveryForUser(u, delivery); err != nil {
+		log.Warningf("while logging delivery of %s for %s: %s", w, u, err)
+		return
+	}
+	if delivery.Status == models.WebhookDeliveryDead {
+		log.Warningf("Not delivering %s for %s: %s", w, u, delivery.Error)
+		webhookDeliveriesMetric.WithLabelValues("failure").Inc()
+		return
+	}
+	wd.enqueue(webhookJob{user: u, webhook: w, delivery: delivery})
+}
+
+// enqueue adds a job to the queue without blocking. If the queue is full, the
+// delivery is marked dead.
+func (wd *webhookDispatcher) enqueue(job webhookJob) {
+	select {
+	case wd.jobs <- job:
+	default:
+		log.Warningf("Webhook queue is full, dropping delivery %d of %s for %s", job.delivery.ID, job.webhook, job.user)
+		webhookDeliveriesMetric.WithLabelValues("dropped").Inc()
+		job.delivery.Status = models.WebhookDeliveryDead
+		job.delivery.Error = "webhook queue is full"
+		wd.update(job)
+	}
+}
+
+func (wd *webhookDispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-wd.jobs:
+			wd.process(ctx, job)
+		}
+	}
+}
+
+func (wd *webhookDispatcher) process(ctx context.Context, job webhookJob) {
+	job.delivery.Attempts++
+	code, err := wd.send(ctx, job)
+	job.delivery.ResponseCode = code
+	if err == nil {
+		log.V(2).Infof("Delivered %d to %s for %s", job.delivery.ID, job.webhook, job.user)
+		webhookDeliveriesMetric.WithLabelValues("success").Inc()
+		job.delivery.Status = models.WebhookDeliveryDelivered
+		job.delivery.Error = ""
+		wd.update(job)
+		return
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	job.delivery.Error = err.Error()
+
+	retries := job.delivery.Attempts - 1
+	if retries >= *webhookMaxRetries {
+		log.Warningf("Giving up on delivery %d to %s for %s: %s", job.delivery.ID, job.webhook, job.user, err)
+		webhookDeliveriesMetric.WithLabelValues("failure").Inc()
+		job.delivery.Status = models.WebhookDeliveryDead
+		wd.update(job)
+		return
+	}
+
+	delay := *webhookRetryDelay << retries
+	log.V(2).Infof("Retrying delivery %d to %s in %s: %s", job.delivery.ID, job.webhook, delay, err)
+	webhookDeliveriesMetric.WithLabelValues("retry").Inc()
+	wd.update(job)
+	time.AfterFunc(delay, func() {
+		if ctx.Err() == nil {
+			wd.enqueue(job)
+		}
+	})
+}
+
+// send posts the job's payload to its webhook and returns the response status
+// code, if any.
+func (wd *webhookDispatcher) send(ctx context.Context, job webhookJob) (int, error) {
+	payload := []byte(job.delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Goliath/1.0 (+http://github.com/jrupac/goliath)")
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(job.webhook.Secret, payload))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatInt(job.delivery.ID, 10))
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("non-2xx HTTP status: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (wd *webhookDispatcher) update(job webhookJob) {
+	if err := wd.d.UpdateWebhookDeliveryForUser(job.user, job.delivery); err != nil {
+		log.Warningf("while updating delivery %d of %s for %s: %s", job.delivery.ID, job.webhook, job.user, err)
+	}
+}
@@ -0,0 +1,269 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+)
+
+func TestWebhookMatches(t *testing.T) {
+	a := models.Article{FeedID: 1, FolderID: 2, Title: "Release notes", Summary: "<p>Version <b>2.0</b> is out</p>"}
+
+	tests := []struct {
+		name    string
+		filter  models.WebhookFilter
+		ruleIDs []int64
+		want    bool
+	}{
+		{"empty filter", models.WebhookFilter{}, nil, true},
+		{"feed", models.WebhookFilter{FeedIDs: []int64{1}}, nil, true},
+		{"other feed", models.WebhookFilter{FeedIDs: []int64{3}}, nil, false},
+		{"folder", models.WebhookFilter{FolderIDs: []int64{2}}, nil, true},
+		{"other folder", models.WebhookFilter{FolderIDs: []int64{3}}, nil, false},
+		{"keyword ignores case and markup", models.WebhookFilter{Keywords: []string{"nope", "VERSION 2.0"}}, nil, true},
+		{"missing keyword", models.WebhookFilter{Keywords: []string{"security"}}, nil, false},
+		{"matched rule", models.WebhookFilter{RuleIDs: []int64{4, 5}}, []int64{5}, true},
+		{"unmatched rule", models.WebhookFilter{RuleIDs: []int64{4}}, []int64{5}, false},
+		{"all conditions", models.WebhookFilter{FeedIDs: []int64{1}, Keywords: []string{"release"}}, nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := webhookMatches(models.Webhook{Filter: tc.filter}, a, tc.ruleIDs); got != tc.want {
+				t.Errorf("expected %t, got %t", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRenderWebhookPayload(t *testing.T) {
+	p := WebhookPayload{
+		Event:   "article",
+		Feed:    WebhookPayloadFeed{ID: 1, Title: "Example"},
+		Article: WebhookPayloadArticle{ID: 2, Title: `Say "hi"`, Link: "http://example.com/2"},
+	}
+
+	b, err := renderWebhookPayload(models.Webhook{}, p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var decoded WebhookPayload
+	if err = json.Unmarshal(b, &decoded); err != nil || decoded.Article.Title != p.Article.Title {
+		t.Errorf("expected default JSON payload, got %s (%v)", b, err)
+	}
+
+	w := models.Webhook{Template: `{"text": {{json (printf "%s: %s" .Feed.Title .Article.Title)}}}`}
+	b, err = renderWebhookPayload(w, p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := `{"text": "Example: Say \"hi\""}`; string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+
+	if _, err = renderWebhookPayload(models.Webhook{Template: "{{.Missing}}"}, p); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	user := models.User{UserId: "test-user", Username: "alice"}
+	p := WebhookPayload{Event: "article", Article: WebhookPayloadArticle{ID: 7, Title: "Hello"}}
+
+	newDispatcher := func(updates chan models.WebhookDelivery) *webhookDispatcher {
+		db := &storage.MockDB{
+			OnInsertWebhookDeliveryForUser: func(u models.User, d models.WebhookDelivery) (int64, error) {
+				return 42, nil
+			},
+			OnUpdateWebhookDeliveryForUser: func(u models.User, d models.WebhookDelivery) error {
+				updates <- d
+				return nil
+			},
+		}
+		return &webhookDispatcher{d: db, jobs: make(chan webhookJob, 10), client: http.DefaultClient}
+	}
+
+	t.Run("delivers signed payload", func(t *testing.T) {
+		requests := make(chan *http.Request, 1)
+		bodies := make(chan []byte, 1)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			requests <- r
+			bodies <- b
+		}))
+		defer ts.Close()
+
+		updates := make(chan models.WebhookDelivery, 10)
+		wd := newDispatcher(updates)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wd.start(ctx)
+
+		wd.dispatch(user, models.Webhook{ID: 1, URL: ts.URL, Secret: "s3cret"}, p)
+
+		select {
+		case r := <-requests:
+			body := <-bodies
+			if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhookPayload("s3cret", body); got != want {
+				t.Errorf("expected signature %s, got %s", want, got)
+			}
+			if got := r.Header.Get(WebhookDeliveryHeader); got != "42" {
+				t.Errorf("expected delivery ID 42, got %s", got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for delivery")
+		}
+
+		select {
+		case d := <-updates:
+			if d.Status != models.WebhookDeliveryDelivered || d.Attempts != 1 || d.ResponseCode != http.StatusOK {
+				t.Errorf("unexpected delivery: %+v", d)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for delivery update")
+		}
+	})
+
+	t.Run("retries and marks dead", func(t *testing.T) {
+		origDelay, origRetries := *webhookRetryDelay, *webhookMaxRetries
+		*webhookRetryDelay, *webhookMaxRetries = time.Millisecond, 2
+		defer func() { *webhookRetryDelay, *webhookMaxRetries = origDelay, origRetries }()
+
+		var attempts atomic.Int32
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer ts.Close()
+
+		updates := make(chan models.WebhookDelivery, 10)
+		wd := newDispatcher(updates)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wd.start(ctx)
+
+		wd.dispatch(user, models.Webhook{ID: 1, URL: ts.URL}, p)
+
+		for {
+			select {
+			case d := <-updates:
+				if d.Status == models.WebhookDeliveryPending {
+					continue
+				}
+				if d.Status != models.WebhookDeliveryDead || d.Attempts != 3 || d.ResponseCode != http.StatusServiceUnavailable {
+					t.Errorf("unexpected delivery: %+v", d)
+				}
+				if n := attempts.Load(); n != 3 {
+					t.Errorf("expected 3 attempts, got %d", n)
+				}
+				return
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for delivery to be marked dead")
+			}
+		}
+	})
+
+	t.Run("marks dead when payload does not render", func(t *testing.T) {
+		var logged models.WebhookDelivery
+		wd := &webhookDispatcher{
+			d: &storage.MockDB{
+				OnInsertWebhookDeliveryForUser: func(u models.User, d models.WebhookDelivery) (int64, error) {
+					logged = d
+					return 1, nil
+				},
+			},
+			jobs: make(chan webhookJob, 1),
+		}
+
+		wd.dispatch(user, models.Webhook{ID: 1, URL: "http://example.com", Template: "{{.Missing}}"}, p)
+
+		if logged.Status != models.WebhookDeliveryDead || logged.Error == "" {
+			t.Errorf("expected dead delivery, got %+v", logged)
+		}
+		if len(wd.jobs) != 0 {
+			t.Errorf("expected nothing to be queued, got %d jobs", len(wd.jobs))
+		}
+	})
+
+	t.Run("resumes pending deliveries after restart", func(t *testing.T) {
+		started := time.Now()
+		deliveries := []models.WebhookDelivery{
+			// Interrupted before its first attempt.
+			{ID: 1, WebhookID: 1, Status: models.WebhookDeliveryPending, Created: started.Add(-time.Hour)},
+			// Waiting for a retry long after its delay passed.
+			{ID: 2, WebhookID: 1, Status: models.WebhookDeliveryPending, Attempts: 1,
+				Created: started.Add(-time.Hour), Updated: started.Add(-time.Hour)},
+			// Its webhook was deleted.
+			{ID: 3, WebhookID: 2, Status: models.WebhookDeliveryPending, Created: started.Add(-time.Hour)},
+			// Dispatched since the restart.
+			{ID: 4, WebhookID: 1, Status: models.WebhookDeliveryPending, Created: started.Add(time.Second)},
+		}
+		var loads int
+		var dead []models.WebhookDelivery
+		wd := &webhookDispatcher{
+			d: &storage.MockDB{
+				OnGetWebhookDeliveriesForUser: func(u models.User, status string, limit int) ([]models.WebhookDelivery, error) {
+					if status != models.WebhookDeliveryPending {
+						t.Errorf("expected pending deliveries, got %s", status)
+					}
+					loads++
+					return deliveries, nil
+				},
+				OnGetWebhooksForUser: func(u models.User) ([]models.Webhook, error) {
+					return []models.Webhook{{ID: 1, URL: "http://example.com"}}, nil
+				},
+				OnUpdateWebhookDeliveryForUser: func(u models.User, d models.WebhookDelivery) error {
+					dead = append(dead, d)
+					return nil
+				},
+			},
+			jobs:    make(chan webhookJob, 10),
+			started: started,
+		}
+
+		wd.resume([]models.User{user})
+		wd.resume([]models.User{user})
+
+		if loads != 1 {
+			t.Errorf("expected deliveries to be resumed once, got %d loads", loads)
+		}
+		var queued []int64
+		for len(wd.jobs) > 0 {
+			queued = append(queued, (<-wd.jobs).delivery.ID)
+		}
+		if !slices.Equal(queued, []int64{1, 2}) {
+			t.Errorf("expected deliveries [1 2] to be queued, got %v", queued)
+		}
+		if len(dead) != 1 || dead[0].ID != 3 || dead[0].Status != models.WebhookDeliveryDead {
+			t.Errorf("expected delivery 3 to be marked dead, got %+v", dead)
+		}
+	})
+}
+
+func TestWebhookDispatcherPrivateHosts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	job := webhookJob{webhook: models.Webhook{URL: ts.URL}}
+
+	orig := *webhookAllowPrivateHosts
+	defer func() { *webhookAllowPrivateHosts = orig }()
+
+	*webhookAllowPrivateHosts = false
+	if _, err := newWebhookDispatcher(&storage.MockDB{}).send(context.Background(), job); err == nil {
+		t.Error("expected delivery to loopback address to be refused")
+	}
+
+	*webhookAllowPrivateHosts = true
+	if code, err := newWebhookDispatcher(&storage.MockDB{}).send(context.Background(), job); err != nil || code != http.StatusOK {
+		t.Errorf("expected delivery to loopback address, got %d: %v", code, err)
+	}
+}
@@ -15,9 +15,13 @@ import (
 	log "github.com/golang/glog"
 	"github.com/jrupac/goliath/admin"
 	"github.com/jrupac/goliath/api"
+	"github.com/jrupac/goliath/archive"
 	"github.com/jrupac/goliath/auth"
 	"github.com/jrupac/goliath/cache"
+	"github.com/jrupac/goliath/digest"
+	"github.com/jrupac/goliath/events"
 	"github.com/jrupac/goliath/fetch"
+	"github.com/jrupac/goliath/newsletter"
 	"github.com/jrupac/goliath/opml"
 	"github.com/jrupac/goliath/storage"
 	"github.com/jrupac/goliath/utils"
@@ -86,19 +90,27 @@ func main() {
 	ctx, cancel := context.WithCancel(ctx)
 	installSignalHandler(cancel)
 
+	if err := cache.InitSigningKey(d); err != nil {
+		log.Fatalf("Fatal error while initializing proxy signing key: %s", err)
+	}
+
 	retrievalCache, err := cache.StartRetrievalCache(ctx, d)
 	if err != nil {
 		log.Fatalf("Fatal error while starting retrieval cache: %s", err)
 	}
 
-	fetcher := fetch.New(d, retrievalCache)
+	hub := events.NewHub()
+	fetcher := fetch.New(d, retrievalCache, hub)
 
 	go fetcher.Start(ctx)
 	go storage.StartGC(ctx, d)
+	go digest.Start(ctx, d)
+	go archive.Start(ctx, d)
+	go newsletter.Start(ctx, d, fetcher)
 	go admin.Start(ctx, d)
 	go serveMetrics(ctx)
 
-	if err = serve(ctx, d); err != nil {
+	if err = serve(ctx, d, hub); err != nil {
 		log.Infof("%s", err)
 	}
 }
@@ -127,18 +139,19 @@ func processOpml(d storage.Database) {
 		log.Infof("Completed parsing OPML file %s", *opmlImportPath)
 		utils.DebugPrint("Parsed OPML file", *p)
 
-		if err = d.ImportOpmlForUser(user, p); err != nil {
+		report, err := d.ImportOpmlForUser(user, p)
+		if err != nil {
 			log.Warningf("Error while importing OPML: %s", err)
+		} else {
+			log.Infof("Completed importing OPML: %s", report)
 		}
 	}
 
 	if *opmlExportPath != "" {
-		folderTree, err := d.GetFolderFeedTreeForUser(user)
+		o, err := d.ExportOpmlForUser(user)
 		if err != nil {
-			log.Warningf("Error while fetching folder tree: %s", err)
-		}
-
-		if err = opml.ExportOpml(folderTree, *opmlExportPath); err != nil {
+			log.Warningf("Error while fetching feeds to export: %s", err)
+		} else if err = opml.ExportOpml(o, *opmlExportPath); err != nil {
 			log.Warningf("Error while exporting OPML: %s", err)
 		} else {
 			log.Infof("Completed exporting OPML file to %s", *opmlExportPath)
@@ -183,7 +196,7 @@ func serveMetrics(ctx context.Context) {
 	}
 }
 
-func serve(ctx context.Context, d storage.Database) error {
+func serve(ctx context.Context, d storage.Database, hub *events.Hub) error {
 	mux := http.NewServeMux()
 	srv := &http.Server{
 		Addr:           fmt.Sprintf(":%d", *port),
@@ -203,10 +216,16 @@ func serve(ctx context.Context, d storage.Database) error {
 
 	mux.HandleFunc("/auth", auth.HandleLogin(d))
 	mux.HandleFunc("/logout", auth.HandleLogout)
-	mux.HandleFunc("/fever/", api.FeverHandler(d))
-	mux.HandleFunc("/greader/", api.GReaderHandler(d))
+	mux.HandleFunc("/fever/", api.FeverHandler(d, hub))
+	mux.HandleFunc("/greader/", api.GReaderHandler(d, hub))
+	mux.HandleFunc("/events", api.EventsHandler(d, hub))
+	mux.HandleFunc(api.StarredFeedPath, api.StarredFeedHandler(d))
+	mux.HandleFunc("/opml/import", api.OpmlImportHandler(d))
+	mux.HandleFunc("/opml/export", api.OpmlExportHandler(d))
+	mux.HandleFunc("/export/epub", api.EpubExportHandler(d))
 	mux.HandleFunc("/version", handleVersion)
 	mux.Handle("/cache", auth.WithAuth(cache.NewImageProxy(), d, *publicFolder, cache.AuthErrorRedirect, true))
+	mux.HandleFunc("/archive/", archive.Handler(d))
 	mux.Handle("/static/", http.FileServer(http.Dir(*publicFolder)))
 	mux.Handle("/", auth.WithAuth(http.FileServer(http.Dir(*publicFolder)), d, *publicFolder, nil, false))
 	log.Infof("Starting HTTP server on %s", srv.Addr)
@@ -32,10 +32,64 @@ type Article struct {
 	Saved     bool
 	Date      time.Time
 	Retrieved time.Time
+	// OriginalLink is the link given by the feed, if it differs from the
+	// canonical Link.
+	OriginalLink string
+	// Authors, Categories and CommentsURL are taken from the feed item.
+	Authors     []string
+	Categories  []string
+	CommentsURL string
+	// Thumbnail is the URL of the article's lead image, rewritten to the image
+	// proxy if proxying is enabled.
+	Thumbnail string
+	// TextStats are computed from the article's content, or from its parsed
+	// content once it is extracted.
+	TextStats
+	// SavedAt is the time the article was last saved, if known.
+	SavedAt time.Time
+	// Archived is the offline copy of the content of a saved article, with its
+	// images pointing at local copies, or empty if it is not archived.
+	Archived string
+	// Labels and Priority are assigned by rules when the article is fetched.
+	Labels   []string
+	Priority bool
+	// Enclosures are media files attached to the article.
+	Enclosures []Enclosure
+	// Fingerprint is the SimHash of the article's text, or zero if it is too
+	// short to compare.
+	Fingerprint uint64
+	// StoryID is the ID of the first article of the story the article belongs
+	// to, or zero if it is not grouped with articles from other feeds. When
+	// inserting an article, it may be the ID of any article of the story.
+	StoryID int64
+	// Sources are the other articles of the story this article leads.
+	Sources []StorySource
 	// Metadata
 	SyntheticDate bool
 }
 
+// ArticleStream selects articles, for example to export them. Articles must
+// match all the fields that are set.
+type ArticleStream struct {
+	// Saved selects saved articles.
+	Saved bool
+	// Label selects articles with the given label assigned by rules.
+	Label string
+	// FolderIDs selects articles in feeds directly under any of these folders.
+	FolderIDs []int64
+	// Since selects articles retrieved at or after this time.
+	Since time.Time
+}
+
+// TextStats describes the text of an article.
+type TextStats struct {
+	WordCount   int
+	ReadingTime time.Duration
+	// Language is the ISO 639-1 code of the detected language, or empty if it
+	// could not be detected.
+	Language string
+}
+
 // Hash returns a SHA256 hash of this object.
 func (a Article) Hash() string {
 	h := sha3.New256()
@@ -65,6 +119,16 @@ func (a Article) GetContents(serveParsed bool) string {
 	return content
 }
 
+// GetArchivedContents returns the archived copy of the content of this article
+// if there is one, since its images do not depend on the origin, or else its
+// content. The archived images are only served to the frontend.
+func (a Article) GetArchivedContents(serveParsed bool) string {
+	if a.Archived != "" {
+		return a.Archived
+	}
+	return a.GetContents(serveParsed)
+}
+
 func (a Article) String() string {
 	// Substring length to print out for string fields
 	n := 100
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// DigestSettings are a user's settings for scheduled email digests.
+type DigestSettings struct {
+	Enabled bool
+	// Email is the address digests are sent to.
+	Email string
+	// TimeOfDay is the number of minutes after local midnight at which the
+	// digest is sent.
+	TimeOfDay int
+	// Weekdays are the days on which the digest is sent. If empty, it is sent
+	// every day.
+	Weekdays []time.Weekday
+	// Timezone is the IANA name of the time zone of the schedule.
+	Timezone string
+	// WindowHours is the number of hours before sending that articles must
+	// have been retrieved in to be included.
+	WindowHours int
+	// Labels, if set, selects articles with any of these labels, read or not,
+	// instead of unread articles.
+	Labels []string
+	// MarkRead marks the articles in a digest as read once it is sent.
+	MarkRead bool
+	// LastSent is when the last scheduled digest was sent.
+	LastSent time.Time
+}
+
+func (s DigestSettings) String() string {
+	return fmt.Sprintf("DigestSettings{Enabled:%t, TimeOfDay:%d, Timezone:%q}", s.Enabled, s.TimeOfDay, s.Timezone)
+}
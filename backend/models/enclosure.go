@@ -0,0 +1,24 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Enclosure is a media file attached to an article, such as the audio of a
+// podcast episode.
+type Enclosure struct {
+	URL  string
+	Type string
+	// Length is the size of the file in bytes, or zero if unknown.
+	Length int64
+	// Duration is the play time of the media, or zero if unknown.
+	Duration time.Duration
+	// Position is where the user last stopped playback.
+	Position time.Duration
+}
+
+// Playable returns whether the enclosure is audio or video.
+func (e Enclosure) Playable() bool {
+	return strings.HasPrefix(e.Type, "audio/") || strings.HasPrefix(e.Type, "video/")
+}
@@ -2,11 +2,16 @@ package models
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/sha3"
 )
 
+// NewsletterURLPrefix prefixes the URLs of synthetic feeds whose articles are
+// received as email newsletters rather than fetched.
+const NewsletterURLPrefix = "newsletter:"
+
 // Feed is a single source of articles.
 type Feed struct {
 	// Primary key
@@ -14,10 +19,19 @@ type Feed struct {
 	FolderID int64
 	// Data fields
 	Title       string
+	// CustomTitle is a user-assigned title that is kept in place of the title
+	// provided by the feed itself.
+	CustomTitle string
 	Description string
 	URL         string
 	Link        string
 	Latest      time.Time
+	// FetchFullText indicates that the full text of new articles should be
+	// extracted from their links at fetch time.
+	FetchFullText bool
+	// Transformers are the names of the transformers that rewrite the content
+	// of new articles, in the order they run.
+	Transformers []string
 	EstimatedRefreshInterval int
 }
 
@@ -31,6 +45,11 @@ func (f Feed) Hash() string {
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
 
+// Synthetic returns true if the feed's articles are not fetched from its URL.
+func (f Feed) Synthetic() bool {
+	return strings.HasPrefix(f.URL, NewsletterURLPrefix)
+}
+
 func (f Feed) String() string {
 	return fmt.Sprintf(
 		"Feed{Folder:%d, ID:%d, Title:\"%s\", Link:\"%s\", URL:\"%s\"}",
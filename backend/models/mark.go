@@ -44,4 +44,6 @@ const (
 	StreamFilterUnread
 	StreamFilterSaved
 	StreamFilterUnsaved
+	// StreamFilterPriority selects unread articles moved to priority by rules.
+	StreamFilterPriority
 )
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// NewsletterAddress is a generated email address at which a user receives
+// newsletters. The token is the local part of the address.
+type NewsletterAddress struct {
+	Token   string
+	Created time.Time
+}
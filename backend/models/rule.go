@@ -0,0 +1,62 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rule is a user-defined rule that is applied to new articles as they are
+// fetched. A rule matches an article if all of its set conditions match, and
+// a rule without conditions matches every article.
+type Rule struct {
+	ID         int64
+	Name       string
+	Conditions RuleConditions
+	Actions    RuleActions
+	Created    time.Time
+}
+
+// RuleConditions are the conditions of a rule. Unset conditions are ignored.
+type RuleConditions struct {
+	// FeedIDs matches articles in any of the given feeds.
+	FeedIDs []int64 `json:"feed_ids,omitempty"`
+	// FolderIDs matches articles in feeds directly under any of the given
+	// folders.
+	FolderIDs []int64 `json:"folder_ids,omitempty"`
+	// TitleRegex matches articles whose title matches the case-insensitive
+	// regular expression.
+	TitleRegex string `json:"title_regex,omitempty"`
+	// ContentRegex matches articles whose summary or content matches the
+	// case-insensitive regular expression.
+	ContentRegex string `json:"content_regex,omitempty"`
+	// LinkDomains matches articles linking to any of the given domains or
+	// their subdomains.
+	LinkDomains []string `json:"link_domains,omitempty"`
+	// MinAge matches articles published longer ago than the given duration.
+	MinAge time.Duration `json:"min_age,omitempty"`
+	// AuthorRegex matches articles with any author matching the
+	// case-insensitive regular expression.
+	AuthorRegex string `json:"author_regex,omitempty"`
+	// Categories matches articles in any of the given categories, ignoring
+	// case.
+	Categories []string `json:"categories,omitempty"`
+}
+
+// RuleActions are the actions taken on articles matching a rule.
+type RuleActions struct {
+	// Mute drops the article instead of persisting it. Other actions have no
+	// effect on muted articles.
+	Mute     bool `json:"mute,omitempty"`
+	MarkRead bool `json:"mark_read,omitempty"`
+	Star     bool `json:"star,omitempty"`
+	// Labels are added to the article's labels.
+	Labels   []string `json:"labels,omitempty"`
+	Priority bool     `json:"priority,omitempty"`
+	// FetchFullText extracts the full text of the article from its link, as
+	// if its feed had full-text extraction enabled.
+	FetchFullText bool `json:"fetch_full_text,omitempty"`
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("Rule{ID:%d, Name:%q}", r.ID, r.Name)
+}
@@ -0,0 +1,29 @@
+package models
+
+import "fmt"
+
+// StorySettings are a user's settings for near-duplicate articles from
+// different feeds, which are grouped into stories.
+type StorySettings struct {
+	// Group shows each story as its first article, with the other articles
+	// attached as its sources.
+	Group bool
+	// MarkRead marks articles read when they join an existing story.
+	MarkRead bool
+}
+
+// DefaultStorySettings are the settings of users who never set them.
+var DefaultStorySettings = StorySettings{Group: true}
+
+func (s StorySettings) String() string {
+	return fmt.Sprintf("StorySettings{Group:%t, MarkRead:%t}", s.Group, s.MarkRead)
+}
+
+// StorySource is another article in the story of an article.
+type StorySource struct {
+	ArticleID int64
+	FeedID    int64
+	FeedTitle string
+	Title     string
+	Link      string
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// StarredFeedToken grants read-only access to a user's saved articles as a
+// feed. The token itself is the credential and is embedded in the feed URL.
+type StarredFeedToken struct {
+	Token string
+	// FolderID restricts the feed to saved articles in this folder. A value of
+	// 0 includes all saved articles.
+	FolderID int64
+	Created  time.Time
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Webhook is an outgoing webhook that is fired for each new article matching
+// its filter as the article is inserted.
+type Webhook struct {
+	ID  int64
+	URL string
+	// Secret is the key used to sign payloads with HMAC-SHA256.
+	Secret string
+	Filter WebhookFilter
+	// Template is a Go text/template that renders the payload. If empty, a
+	// default JSON payload is sent.
+	Template string
+	Created  time.Time
+}
+
+func (w Webhook) String() string {
+	return fmt.Sprintf("Webhook{ID:%d, URL:%q}", w.ID, w.URL)
+}
+
+// WebhookFilter selects the articles a webhook fires for. An article matches
+// if all set conditions match, and an empty filter matches every article.
+type WebhookFilter struct {
+	// FeedIDs matches articles in any of the given feeds.
+	FeedIDs []int64 `json:"feed_ids,omitempty"`
+	// FolderIDs matches articles in feeds directly under any of the given
+	// folders.
+	FolderIDs []int64 `json:"folder_ids,omitempty"`
+	// Keywords matches articles whose title or contents contain any of the
+	// given keywords, ignoring case.
+	Keywords []string `json:"keywords,omitempty"`
+	// RuleIDs matches articles that matched any of the given rules.
+	RuleIDs []int64 `json:"rule_ids,omitempty"`
+}
+
+// Statuses of webhook deliveries.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	// WebhookDeliveryDead marks deliveries that were given up on.
+	WebhookDeliveryDead = "dead"
+)
+
+// WebhookDelivery records the delivery of a single payload to a webhook.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	ArticleID int64
+	Payload   string
+	Status    string
+	Attempts  int
+	// ResponseCode is the HTTP status code of the last attempt, if any.
+	ResponseCode int
+	// Error describes why the last attempt failed, if it did.
+	Error   string
+	Created time.Time
+	Updated time.Time
+}
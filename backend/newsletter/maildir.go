@@ -0,0 +1,106 @@
+package newsletter
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+)
+
+// watchMaildir delivers new messages in the given Maildir on a regular
+// interval until the context is canceled.
+func (s *service) watchMaildir(ctx context.Context, dir string) {
+	tick := time.After(0)
+
+	for {
+		select {
+		case <-tick:
+			s.processMaildir(ctx, dir)
+			tick = time.After(*newsletterMaildirInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processMaildir delivers each message in the "new" directory of the Maildir
+// and then moves it to the "cur" directory, marked as seen. Invalid messages
+// and messages without known recipients are moved as well so that they are
+// not retried, but messages that failed to be persisted are left in "new" to
+// be retried on the next run.
+func (s *service) processMaildir(ctx context.Context, dir string) {
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	if err != nil {
+		log.Warningf("while reading Maildir %s: %s", dir, err)
+		return
+	}
+
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, "new", e.Name())
+		if !s.processMaildirMessage(ctx, path) {
+			continue
+		}
+
+		dest := filepath.Join(dir, "cur", e.Name()+":2,S")
+		if err = os.Rename(path, dest); err != nil {
+			log.Warningf("while moving %s to %s: %s", path, dest, err)
+		}
+	}
+}
+
+// processMaildirMessage delivers the message at the given path to the users
+// it is addressed to. Returns false if the message should be retried.
+func (s *service) processMaildirMessage(ctx context.Context, path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Warningf("while opening %s: %s", path, err)
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	msg, err := parseMessage(io.LimitReader(f, *newsletterMaxBytes))
+	if err != nil {
+		log.Warningf("Skipping invalid newsletter %s: %s", path, err)
+		newsletterMessagesMetric.WithLabelValues("invalid").Inc()
+		return true
+	}
+
+	var users []models.User
+	seen := map[models.UserId]bool{}
+	for _, addr := range msg.recipients {
+		if u, ok := s.lookup(addr); ok && !seen[u.UserId] {
+			seen[u.UserId] = true
+			users = append(users, u)
+		}
+	}
+	if len(users) == 0 {
+		log.Warningf("Skipping newsletter %s without known recipients: %v", path, msg.recipients)
+		newsletterMessagesMetric.WithLabelValues("rejected").Inc()
+		return true
+	}
+
+	// As over SMTP, the message is retried for all users if any failed.
+	ok := true
+	for _, u := range users {
+		if err = s.deliver(ctx, u, msg); err != nil {
+			log.Warningf("while delivering newsletter %s to %s: %s", path, u, err)
+			newsletterMessagesMetric.WithLabelValues("failure").Inc()
+			ok = false
+			continue
+		}
+		newsletterMessagesMetric.WithLabelValues("delivered").Inc()
+	}
+	return ok
+}
@@ -0,0 +1,198 @@
+package newsletter
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	log "github.com/golang/glog"
+	"golang.org/x/net/html/charset"
+)
+
+// recipientHeaders are the headers that recipients are read from when a
+// message is not received over SMTP, in order of preference.
+var recipientHeaders = []string{"Delivered-To", "X-Original-To", "To", "Cc"}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// message is a parsed newsletter message.
+type message struct {
+	from      *mail.Address
+	subject   string
+	date      time.Time
+	messageID string
+	// html is the HTML body of the message, converted from plaintext if the
+	// message has no HTML body.
+	html string
+	// recipients are the addresses in the recipient headers.
+	recipients []string
+}
+
+// parseMessage parses an RFC 5322 message.
+func parseMessage(r io.Reader) (*message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	from, err := parser.Parse(m.Header.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From header: %w", err)
+	}
+
+	msg := &message{
+		from:      from,
+		messageID: strings.Trim(strings.TrimSpace(m.Header.Get("Message-Id")), "<>"),
+	}
+
+	subject := m.Header.Get("Subject")
+	if msg.subject, err = wordDecoder.DecodeHeader(subject); err != nil {
+		msg.subject = subject
+	}
+	msg.subject = strings.TrimSpace(msg.subject)
+
+	if msg.date, err = m.Header.Date(); err != nil {
+		msg.date = time.Time{}
+	}
+
+	for _, h := range recipientHeaders {
+		for _, v := range m.Header[h] {
+			addrs, err := parser.ParseList(v)
+			if err != nil {
+				continue
+			}
+			for _, a := range addrs {
+				msg.recipients = append(msg.recipients, a.Address)
+			}
+		}
+	}
+
+	htmlBody, textBody, err := readBody(textproto.MIMEHeader(m.Header), m.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	if htmlBody != "" {
+		msg.html = cleanHTML(htmlBody)
+	} else {
+		msg.html = textToHTML(textBody)
+	}
+	if msg.html == "" {
+		return nil, errors.New("message has no text or HTML body")
+	}
+
+	return msg, nil
+}
+
+// readBody returns the first HTML and plaintext bodies of a message or
+// message part. Attachments are skipped.
+func readBody(header textproto.MIMEHeader, body io.Reader) (htmlBody string, textBody string, err error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition")); disposition == "attachment" {
+		return "", "", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return htmlBody, textBody, err
+			}
+			h, t, err := readBody(p.Header, p)
+			if err != nil {
+				return htmlBody, textBody, err
+			}
+			if htmlBody == "" {
+				htmlBody = h
+			}
+			if textBody == "" {
+				textBody = t
+			}
+		}
+		return htmlBody, textBody, nil
+	}
+
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		return "", "", nil
+	}
+
+	r := body
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	if cs := params["charset"]; cs != "" && !strings.EqualFold(cs, "utf-8") && !strings.EqualFold(cs, "us-ascii") {
+		if cr, err := charset.NewReaderLabel(cs, r); err != nil {
+			log.Warningf("Unknown charset %q, reading as UTF-8: %s", cs, err)
+		} else {
+			r = cr
+		}
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", "", err
+	}
+	if mediaType == "text/html" {
+		return string(b), "", nil
+	}
+	return "", string(b), nil
+}
+
+// cleanHTML returns the contents of the body of an HTML email, without
+// elements that would affect the rendering of the rest of the page.
+func cleanHTML(s string) string {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		log.Warningf("while parsing HTML: %s", err)
+		return s
+	}
+	doc.Find("script, style, link, meta, title, base").Remove()
+
+	body, err := doc.Find("body").Html()
+	if err != nil {
+		log.Warningf("while rendering HTML: %s", err)
+		return s
+	}
+	return strings.TrimSpace(body)
+}
+
+// textToHTML converts a plaintext body to HTML paragraphs.
+func textToHTML(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), "\r\n", "\n")
+	if s == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, p := range strings.Split(s, "\n\n") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		lines := strings.Split(p, "\n")
+		for i, l := range lines {
+			lines[i] = html.EscapeString(l)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
@@ -0,0 +1,243 @@
+// Package newsletter receives email newsletters and persists them as articles.
+//
+// Users receive newsletters at generated addresses whose local part is a
+// token identifying them. Messages are accepted by an embedded SMTP server or
+// picked up from a Maildir. Each sender becomes a synthetic feed, and each
+// message an article that is processed in the same way as fetched articles.
+package newsletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/jrupac/rss"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	newsletterSMTPAddr        = flag.String("newsletterSmtpAddr", "", "Address (host:port) to accept newsletters on over SMTP. The SMTP server is disabled if empty.")
+	newsletterMaildir         = flag.String("newsletterMaildir", "", "Path of a Maildir to pick up newsletters from. Disabled if empty.")
+	newsletterMaildirInterval = flag.Duration("newsletterMaildirInterval", time.Minute, "Interval between checks of the newsletter Maildir for new messages.")
+	newsletterDomain          = flag.String("newsletterDomain", "", "Domain of newsletter addresses. If empty, messages to any domain are accepted.")
+	newsletterFolder          = flag.String("newsletterFolder", "Newsletters", "Folder that feeds of new newsletter senders are created in. If empty, they are created at the top level.")
+	newsletterMaxBytes        = flag.Int64("newsletterMaxBytes", 10<<20, "Maximum size in bytes of a newsletter message.")
+)
+
+var (
+	newsletterMessagesMetric = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "newsletter_messages_total",
+			Help: "Total number of received newsletter messages by result: delivered, rejected (unknown recipient), invalid, or failure.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(newsletterMessagesMetric)
+}
+
+// Ingester persists items of synthetic feeds. It is implemented by
+// fetch.Fetcher.
+type Ingester interface {
+	IngestItems(ctx context.Context, user models.User, feed *models.Feed, items []*rss.Item) error
+}
+
+// NewToken returns a random token for a new newsletter address.
+func NewToken() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Address returns the newsletter address for the given token. If no domain
+// is configured, only the token is returned.
+func Address(token string) string {
+	if *newsletterDomain == "" {
+		return token
+	}
+	return token + "@" + strings.ToLower(*newsletterDomain)
+}
+
+// Start receives newsletters over SMTP and from a Maildir, as configured,
+// until the given context is canceled.
+func Start(ctx context.Context, d storage.Database, ingester Ingester) {
+	if *newsletterSMTPAddr == "" && *newsletterMaildir == "" {
+		return
+	}
+
+	s := &service{d: d, ingester: ingester}
+
+	if *newsletterMaildir != "" {
+		log.Infof("Watching Maildir %s for newsletters.", *newsletterMaildir)
+		go s.watchMaildir(ctx, *newsletterMaildir)
+	}
+
+	if *newsletterSMTPAddr != "" {
+		l, err := net.Listen("tcp", *newsletterSMTPAddr)
+		if err != nil {
+			log.Errorf("Failed to start newsletter SMTP server: %s", err)
+			return
+		}
+		log.Infof("Starting newsletter SMTP server on %s", l.Addr())
+		if err = newSMTPServer(s).serve(ctx, l); err != nil {
+			log.Errorf("Newsletter SMTP server failed: %s", err)
+		}
+	}
+}
+
+// service delivers received messages to users.
+type service struct {
+	d        storage.Database
+	ingester Ingester
+	// mu serializes deliveries so that concurrent messages from a new sender
+	// create a single feed.
+	mu sync.Mutex
+}
+
+// lookup returns the user that the given newsletter address belongs to.
+// Subaddresses, e.g. "<token>+<tag>@<domain>", belong to the same user.
+func (s *service) lookup(addr string) (models.User, bool) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	i := strings.LastIndex(addr, "@")
+	if i < 0 {
+		return models.User{}, false
+	}
+	local, domain := addr[:i], addr[i+1:]
+	if *newsletterDomain != "" && domain != strings.ToLower(*newsletterDomain) {
+		return models.User{}, false
+	}
+	local, _, _ = strings.Cut(local, "+")
+
+	u, err := s.d.GetUserByNewsletterAddress(local)
+	if err != nil {
+		return models.User{}, false
+	}
+	return u, true
+}
+
+// deliver persists the message as an article in the feed of its sender,
+// creating the feed if needed.
+func (s *service) deliver(ctx context.Context, u models.User, msg *message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	feed, err := s.feedForSender(u, msg.from)
+	if err != nil {
+		return err
+	}
+
+	// Messages are dated by when they were sent, unless that would cause them
+	// to be dropped as older than the latest article of the feed.
+	date := msg.date
+	if now := time.Now(); date.IsZero() || date.After(now) || !date.After(feed.Latest) {
+		date = now
+	}
+
+	item := &rss.Item{
+		Title:     msg.subject,
+		Content:   msg.html,
+		Link:      messageLink(msg),
+		ID:        msg.messageID,
+		Date:      date,
+		DateValid: true,
+	}
+	if err = s.ingester.IngestItems(ctx, u, &feed, []*rss.Item{item}); err != nil {
+		return fmt.Errorf("failed to persist message: %w", err)
+	}
+	return nil
+}
+
+// messageLink returns a link that uniquely identifies the message, since
+// articles with the same link are considered duplicates.
+func messageLink(msg *message) string {
+	id := msg.messageID
+	if id == "" {
+		id = fmt.Sprintf("%d.%s", msg.date.UnixNano(), msg.from.Address)
+	}
+	return "mid:" + url.PathEscape(id)
+}
+
+// feedForSender returns the user's feed for the given sender, creating it in
+// the newsletter folder if it does not exist.
+func (s *service) feedForSender(u models.User, from *mail.Address) (models.Feed, error) {
+	sender := strings.ToLower(from.Address)
+	feedURL := models.NewsletterURLPrefix + sender
+
+	feeds, err := s.d.GetAllFeedsForUser(u)
+	if err != nil {
+		return models.Feed{}, fmt.Errorf("failed to fetch feeds: %w", err)
+	}
+	for _, f := range feeds {
+		if f.URL == feedURL {
+			return f, nil
+		}
+	}
+
+	folderID, err := s.folderForUser(u)
+	if err != nil {
+		return models.Feed{}, err
+	}
+
+	title := from.Name
+	if title == "" {
+		title = sender
+	}
+	feed := models.Feed{
+		FolderID:    folderID,
+		Title:       title,
+		Description: fmt.Sprintf("Newsletter from %s", sender),
+		URL:         feedURL,
+		Link:        "mailto:" + sender,
+	}
+	if feed.ID, err = s.d.InsertFeedForUser(u, feed, folderID); err != nil {
+		return models.Feed{}, fmt.Errorf("failed to insert feed: %w", err)
+	}
+	log.Infof("Created newsletter feed for %s: %s", u, feed)
+	return feed, nil
+}
+
+// folderForUser returns the ID of the folder that new newsletter feeds are
+// created in, creating it under the root folder if it does not exist.
+func (s *service) folderForUser(u models.User) (int64, error) {
+	folders, err := s.d.GetAllFoldersForUser(u)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch folders: %w", err)
+	}
+
+	var rootID int64
+	for _, f := range folders {
+		if *newsletterFolder != "" && f.Name == *newsletterFolder {
+			return f.ID, nil
+		}
+		if f.Name == models.RootFolder {
+			rootID = f.ID
+		}
+	}
+	if rootID == 0 {
+		return 0, fmt.Errorf("root folder not found for %s", u)
+	}
+	if *newsletterFolder == "" {
+		return rootID, nil
+	}
+
+	id, err := s.d.InsertFolderForUser(u, models.Folder{Name: *newsletterFolder}, rootID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert folder: %w", err)
+	}
+	return id, nil
+}
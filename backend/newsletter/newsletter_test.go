@@ -0,0 +1,372 @@
+package newsletter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jrupac/goliath/models"
+	"github.com/jrupac/goliath/storage"
+	"github.com/jrupac/rss"
+)
+
+const multipartMessage = "From: =?utf-8?q?Weekly_Caf=C3=A9?= <news@example.com>\r\n" +
+	"To: abc123@news.example.org\r\n" +
+	"Subject: =?utf-8?q?Issue_=231?=\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0700\r\n" +
+	"Message-ID: <issue-1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"b1\"\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Plain body\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=iso-8859-1\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"<html><head><style>p{}</style></head><body><p>Caf=E9</p><script>x()</script></body></html>\r\n" +
+	"--b1--\r\n"
+
+const plainMessage = "From: news@example.com\r\n" +
+	"Subject: Plain\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"Rmlyc3QgPGxpbmU+ClNlY29uZAoKVGhpcmQ=\r\n"
+
+type fakeIngester struct {
+	mu    sync.Mutex
+	feeds []models.Feed
+	items []*rss.Item
+	// err, if set, is returned instead of persisting items.
+	err error
+}
+
+func (i *fakeIngester) IngestItems(_ context.Context, _ models.User, feed *models.Feed, items []*rss.Item) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.err != nil {
+		return i.err
+	}
+	i.feeds = append(i.feeds, *feed)
+	i.items = append(i.items, items...)
+	return nil
+}
+
+func setFlag[T any](t *testing.T, f *T, v T) {
+	old := *f
+	*f = v
+	t.Cleanup(func() { *f = old })
+}
+
+func newTestService(t *testing.T) (*service, *fakeIngester, *[]models.Feed) {
+	setFlag(t, newsletterDomain, "news.example.org")
+
+	user := models.User{UserId: "1", Username: "user"}
+	var feeds []models.Feed
+	folders := []models.Folder{{ID: 1, Name: models.RootFolder}}
+	d := &storage.MockDB{
+		OnGetUserByNewsletterAddress: func(token string) (models.User, error) {
+			if token == "abc123" {
+				return user, nil
+			}
+			return models.User{}, errors.New("could not find address")
+		},
+		OnGetAllFeedsForUser: func(models.User) ([]models.Feed, error) {
+			return feeds, nil
+		},
+		OnGetAllFoldersForUser: func(models.User) ([]models.Folder, error) {
+			return folders, nil
+		},
+		OnInsertFolderForUser: func(_ models.User, f models.Folder, _ int64) (int64, error) {
+			f.ID = int64(len(folders) + 1)
+			folders = append(folders, f)
+			return f.ID, nil
+		},
+		OnInsertFeedForUser: func(_ models.User, f models.Feed, _ int64) (int64, error) {
+			f.ID = int64(len(feeds) + 100)
+			feeds = append(feeds, f)
+			return f.ID, nil
+		},
+	}
+	ingester := &fakeIngester{}
+	return &service{d: d, ingester: ingester}, ingester, &feeds
+}
+
+func TestParseMessage(t *testing.T) {
+	msg, err := parseMessage(strings.NewReader(multipartMessage))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if msg.from.Name != "Weekly Café" || msg.from.Address != "news@example.com" {
+		t.Errorf("unexpected sender: %v", msg.from)
+	}
+	if msg.subject != "Issue #1" {
+		t.Errorf("unexpected subject: %q", msg.subject)
+	}
+	if msg.messageID != "issue-1@example.com" {
+		t.Errorf("unexpected message ID: %q", msg.messageID)
+	}
+	if msg.html != "<p>Café</p>" {
+		t.Errorf("unexpected HTML: %q", msg.html)
+	}
+	if len(msg.recipients) != 1 || msg.recipients[0] != "abc123@news.example.org" {
+		t.Errorf("unexpected recipients: %v", msg.recipients)
+	}
+
+	msg, err = parseMessage(strings.NewReader(plainMessage))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if want := "<p>First &lt;line&gt;<br>Second</p><p>Third</p>"; msg.html != want {
+		t.Errorf("expected %q, got %q", want, msg.html)
+	}
+	if !msg.date.IsZero() {
+		t.Errorf("expected zero date, got %s", msg.date)
+	}
+
+	if _, err = parseMessage(strings.NewReader("From: news@example.com\r\n\r\n")); err == nil {
+		t.Errorf("expected error for empty body")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	s, _, _ := newTestService(t)
+
+	for addr, want := range map[string]bool{
+		"abc123@news.example.org":      true,
+		"ABC123@News.Example.org":      true,
+		"abc123+tech@news.example.org": true,
+		"abc123@other.example.org":     false,
+		"other@news.example.org":       false,
+		"abc123":                       false,
+	} {
+		if _, ok := s.lookup(addr); ok != want {
+			t.Errorf("lookup(%q): expected %t, got %t", addr, want, ok)
+		}
+	}
+}
+
+func TestDeliverCreatesFeedOnce(t *testing.T) {
+	s, ingester, feeds := newTestService(t)
+	setFlag(t, newsletterFolder, "Newsletters")
+	u, _ := s.lookup("abc123@news.example.org")
+
+	for i := 0; i < 2; i++ {
+		msg, err := parseMessage(strings.NewReader(multipartMessage))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err = s.deliver(context.Background(), u, msg); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if len(*feeds) != 1 {
+		t.Fatalf("expected 1 feed, got %d", len(*feeds))
+	}
+	f := (*feeds)[0]
+	if f.URL != "newsletter:news@example.com" || f.Title != "Weekly Café" || f.FolderID != 2 || !f.Synthetic() {
+		t.Errorf("unexpected feed: %+v", f)
+	}
+	if len(ingester.items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(ingester.items))
+	}
+	item := ingester.items[0]
+	if item.Title != "Issue #1" || item.Link != "mid:issue-1@example.com" || item.Content != "<p>Café</p>" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if want := time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC); !item.Date.Equal(want) {
+		t.Errorf("expected date %s, got %s", want, item.Date)
+	}
+}
+
+func TestSMTPServer(t *testing.T) {
+	s, ingester, _ := newTestService(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = newSMTPServer(s).serve(ctx, l) }()
+
+	c, err := smtp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if err = c.Mail("news@example.com"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.Rcpt("unknown@news.example.org"); err == nil {
+		t.Errorf("expected unknown recipient to be rejected")
+	}
+	if err = c.Rcpt("abc123+weekly@news.example.org"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err = w.Write([]byte(multipartMessage)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(ingester.items) != 1 || ingester.items[0].Title != "Issue #1" {
+		t.Errorf("unexpected items: %+v", ingester.items)
+	}
+}
+
+func TestSMTPServerRejectsLargeMessage(t *testing.T) {
+	s, ingester, _ := newTestService(t)
+	setFlag(t, newsletterMaxBytes, int64(100))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = newSMTPServer(s).serve(ctx, l) }()
+
+	c, err := smtp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if err = c.Mail("news@example.com"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.Rcpt("abc123@news.example.org"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, _ = w.Write([]byte(multipartMessage))
+	if err = w.Close(); err == nil || !strings.HasPrefix(err.Error(), "552") {
+		t.Errorf("expected 552 error, got %v", err)
+	}
+	if len(ingester.items) != 0 {
+		t.Errorf("expected no items, got %d", len(ingester.items))
+	}
+}
+
+func TestProcessMaildir(t *testing.T) {
+	s, ingester, _ := newTestService(t)
+
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o700); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new", "1.host"), []byte(multipartMessage), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new", "2.host"), []byte(plainMessage), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s.processMaildir(context.Background(), dir)
+
+	// The second message has no known recipient, so only the first is
+	// delivered, but both are moved out of "new".
+	if len(ingester.items) != 1 || ingester.items[0].Title != "Issue #1" {
+		t.Errorf("unexpected items: %+v", ingester.items)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "new")); len(entries) != 0 {
+		t.Errorf("expected new to be empty, got %d entries", len(entries))
+	}
+	for _, name := range []string{"1.host:2,S", "2.host:2,S"} {
+		if _, err := os.Stat(filepath.Join(dir, "cur", name)); err != nil {
+			t.Errorf("expected %s in cur: %s", name, err)
+		}
+	}
+}
+
+func TestSMTPServerRetriesFailedDelivery(t *testing.T) {
+	s, ingester, _ := newTestService(t)
+	ingester.err = errors.New("database unavailable")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = newSMTPServer(s).serve(ctx, l) }()
+
+	c, err := smtp.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if err = c.Mail("news@example.com"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err = c.Rcpt("abc123@news.example.org"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, _ = w.Write([]byte(multipartMessage))
+	if err = w.Close(); err == nil || !strings.HasPrefix(err.Error(), "451") {
+		t.Errorf("expected 451 error, got %v", err)
+	}
+}
+
+func TestProcessMaildirKeepsFailedMessages(t *testing.T) {
+	s, ingester, _ := newTestService(t)
+	ingester.err = errors.New("database unavailable")
+
+	dir := t.TempDir()
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o700); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new", "1.host"), []byte(multipartMessage), 0o600); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	s.processMaildir(context.Background(), dir)
+
+	if _, err := os.Stat(filepath.Join(dir, "new", "1.host")); err != nil {
+		t.Errorf("expected message to stay in new: %s", err)
+	}
+
+	// The message is delivered once persisting succeeds again.
+	ingester.err = nil
+	s.processMaildir(context.Background(), dir)
+
+	if len(ingester.items) != 1 {
+		t.Errorf("expected 1 item, got %d", len(ingester.items))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cur", "1.host:2,S")); err != nil {
+		t.Errorf("expected message in cur: %s", err)
+	}
+}
@@ -0,0 +1,214 @@
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/jrupac/goliath/models"
+)
+
+const (
+	// smtpTimeout is the maximum time to wait for each command of a client.
+	smtpTimeout = 5 * time.Minute
+	// smtpMaxRecipients is the maximum number of recipients of a message.
+	smtpMaxRecipients = 100
+)
+
+// smtpServer is a minimal SMTP server that only accepts messages for
+// newsletter addresses. It does not support TLS or authentication, so it is
+// meant to receive mail relayed by a mail server in front of it.
+type smtpServer struct {
+	s        *service
+	hostname string
+}
+
+func newSMTPServer(s *service) *smtpServer {
+	hostname := *newsletterDomain
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if hostname == "" {
+		hostname = "localhost"
+	}
+	return &smtpServer{s: s, hostname: hostname}
+}
+
+// serve accepts connections on the given listener until the context is
+// canceled.
+func (srv *smtpServer) serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		go srv.handle(ctx, conn)
+	}
+}
+
+// session holds the state of the message being received on a connection.
+type session struct {
+	hasSender  bool
+	recipients []models.User
+}
+
+func (srv *smtpServer) handle(ctx context.Context, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	tc := textproto.NewConn(conn)
+	reply := func(code int, msg string) bool {
+		return tc.PrintfLine("%d %s", code, msg) == nil
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	if !reply(220, srv.hostname+" Goliath ESMTP ready") {
+		return
+	}
+
+	var sess session
+	for {
+		_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		var ok bool
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			ok = reply(250, srv.hostname)
+		case "EHLO":
+			ok = tc.PrintfLine("250-%s", srv.hostname) == nil &&
+				tc.PrintfLine("250-SIZE %d", *newsletterMaxBytes) == nil &&
+				reply(250, "8BITMIME")
+		case "MAIL":
+			if _, found := cutPrefixFold(arg, "FROM:"); !found {
+				ok = reply(501, "Syntax: MAIL FROM:<address>")
+				break
+			}
+			sess = session{hasSender: true}
+			ok = reply(250, "OK")
+		case "RCPT":
+			addr, found := cutPrefixFold(arg, "TO:")
+			if !found {
+				ok = reply(501, "Syntax: RCPT TO:<address>")
+			} else if !sess.hasSender {
+				ok = reply(503, "Need MAIL command first")
+			} else if len(sess.recipients) >= smtpMaxRecipients {
+				ok = reply(452, "Too many recipients")
+			} else if u, known := srv.s.lookup(parsePath(addr)); !known {
+				newsletterMessagesMetric.WithLabelValues("rejected").Inc()
+				ok = reply(550, "No such user")
+			} else {
+				sess.recipients = append(sess.recipients, u)
+				ok = reply(250, "OK")
+			}
+		case "DATA":
+			if len(sess.recipients) == 0 {
+				ok = reply(503, "Need RCPT command first")
+				break
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			code, msg := srv.receive(ctx, tc, sess.recipients)
+			sess = session{}
+			ok = reply(code, msg)
+		case "RSET":
+			sess = session{}
+			ok = reply(250, "OK")
+		case "NOOP":
+			ok = reply(250, "OK")
+		case "VRFY":
+			ok = reply(252, "Cannot VRFY user")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			ok = reply(502, "Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// receive reads a message and delivers it to the given recipients. It
+// returns the reply to send to the client.
+func (srv *smtpServer) receive(ctx context.Context, tc *textproto.Conn, recipients []models.User) (int, string) {
+	dr := tc.DotReader()
+	b, err := io.ReadAll(io.LimitReader(dr, *newsletterMaxBytes+1))
+	if err != nil {
+		return 451, "Failed to read message"
+	}
+	if int64(len(b)) > *newsletterMaxBytes {
+		_, _ = io.Copy(io.Discard, dr)
+		return 552, "Message too large"
+	}
+
+	msg, err := parseMessage(bytes.NewReader(b))
+	if err != nil {
+		log.Warningf("Rejecting invalid newsletter: %s", err)
+		newsletterMessagesMetric.WithLabelValues("invalid").Inc()
+		return 554, "Invalid message"
+	}
+
+	// If delivery fails for any recipient, the client is asked to retry.
+	// Recipients that already received the message get it again, but the
+	// new article replaces the previous one since they share a link.
+	failed := 0
+	for _, u := range recipients {
+		if err = srv.s.deliver(ctx, u, msg); err != nil {
+			log.Warningf("while delivering newsletter from %s to %s: %s", msg.from.Address, u, err)
+			newsletterMessagesMetric.WithLabelValues("failure").Inc()
+			failed++
+			continue
+		}
+		newsletterMessagesMetric.WithLabelValues("delivered").Inc()
+	}
+	if failed > 0 {
+		return 451, "Failed to deliver message"
+	}
+	return 250, "OK"
+}
+
+// cutPrefixFold is like strings.CutPrefix, but ignores case.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// parsePath returns the address of a reverse- or forward-path argument,
+// e.g. "<user@example.com> SIZE=1000".
+func parsePath(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "<") {
+		if i := strings.Index(s, ">"); i > 0 {
+			return s[1:i]
+		}
+	}
+	addr, _, _ := strings.Cut(s, " ")
+	return addr
+}
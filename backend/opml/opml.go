@@ -2,52 +2,82 @@ package opml
 
 import (
 	"bytes"
+	"encoding/json"
 	"encoding/xml"
 	log "github.com/golang/glog"
 	"github.com/jrupac/goliath/models"
 	"golang.org/x/net/html/charset"
+	"io"
 	"io/ioutil"
 	"os"
+	"regexp"
 	"syscall"
 	"time"
 )
 
+// Namespace is the XML namespace of Goliath-specific outline attributes, which
+// carry per-feed settings between Goliath instances.
+const Namespace = "https://github.com/jrupac/goliath"
+
+const (
+	namespacePrefix = "goliath"
+	attrCustomTitle = "customTitle"
+	attrMuteRegexes = "muteRegexes"
+	attrUnmuted     = "unmuted"
+)
+
 type header struct {
 	Title       string `xml:"title"`
 	DateCreated string `xml:"dateCreated"`
 }
 
 type outline struct {
-	Type        string    `xml:"type,attr,omitempty"`
-	Text        string    `xml:"text,attr,omitempty"`
-	Title       string    `xml:"title,attr,omitempty"`
-	Description string    `xml:"description,attr,omitempty"`
-	URL         string    `xml:"xmlUrl,attr,omitempty"`
-	Folders     []outline `xml:"outline,omitempty"`
+	Type        string     `xml:"type,attr,omitempty"`
+	Text        string     `xml:"text,attr,omitempty"`
+	Title       string     `xml:"title,attr,omitempty"`
+	Description string     `xml:"description,attr,omitempty"`
+	URL         string     `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL     string     `xml:"htmlUrl,attr,omitempty"`
+	Extra       []xml.Attr `xml:",any,attr"`
+	Folders     []outline  `xml:"outline,omitempty"`
 }
 
 type internalOpmlType struct {
-	XMLName xml.Name  `xml:"opml"`
-	Version string    `xml:"version,attr"`
-	Header  header    `xml:"head"`
-	Body    []outline `xml:"body>outline"`
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	// Only set on export; the decoder resolves namespace declarations itself.
+	XmlnsGoliath string    `xml:"xmlns:goliath,attr,omitempty"`
+	Header       header    `xml:"head"`
+	Body         []outline `xml:"body>outline"`
+}
+
+// FeedSettings holds per-feed Goliath settings that are not part of the feed
+// itself.
+type FeedSettings struct {
+	MuteRegexes []string
+	Unmuted     bool
 }
 
 // Opml is a nested tree of folders.
 type Opml struct {
 	Header  header
 	Folders models.Folder
+	// Settings maps feed URLs to the Goliath settings of that feed. Feeds with
+	// default settings need not have an entry.
+	Settings map[string]FeedSettings
 }
 
 func createOpmlObject(oi *internalOpmlType) *Opml {
-	return &Opml{
-		Header:  oi.Header,
-		Folders: parseOutline(oi.Body),
+	o := &Opml{
+		Header:   oi.Header,
+		Settings: map[string]FeedSettings{},
 	}
+	o.Folders = o.parseOutline(oi.Body)
+	return o
 }
 
 // parseOutline converts "outline" objects into Folder and Feed objects.
-func parseOutline(children []outline) models.Folder {
+func (op *Opml) parseOutline(children []outline) models.Folder {
 	folder := models.Folder{
 		Name: models.RootFolder,
 	}
@@ -69,7 +99,9 @@ func parseOutline(children []outline) models.Folder {
 				Title:       name,
 				Description: o.Description,
 				URL:         o.URL,
+				Link:        o.HTMLURL,
 			}
+			feed.CustomTitle = op.parseSettings(o)
 			folder.Feed = append(folder.Feed, feed)
 		} else {
 			// This entity has no URL so we presume it is a Folder.
@@ -83,7 +115,7 @@ func parseOutline(children []outline) models.Folder {
 				name = "<untitled>"
 			}
 
-			child := parseOutline(o.Folders)
+			child := op.parseOutline(o.Folders)
 			child.Name = name
 			folder.Folders = append(folder.Folders, child)
 		}
@@ -92,23 +124,97 @@ func parseOutline(children []outline) models.Folder {
 	return folder
 }
 
+// parseSettings reads Goliath attributes of the given feed outline into the
+// settings of this object and returns the custom title of the feed, if any.
+func (op *Opml) parseSettings(o outline) string {
+	var customTitle string
+	var settings FeedSettings
+	found := false
+
+	for _, a := range o.Extra {
+		// Accept the prefix itself in case the namespace was not declared.
+		if a.Name.Space != Namespace && a.Name.Space != namespacePrefix {
+			continue
+		}
+		switch a.Name.Local {
+		case attrCustomTitle:
+			customTitle = a.Value
+		case attrUnmuted:
+			settings.Unmuted = a.Value == "true"
+			found = true
+		case attrMuteRegexes:
+			var regexes []string
+			if err := json.Unmarshal([]byte(a.Value), &regexes); err != nil {
+				log.Warningf("Ignoring malformed mute regexes for feed %s: %s", o.URL, err)
+				continue
+			}
+			for _, r := range regexes {
+				if _, err := regexp.Compile(r); err != nil {
+					log.Warningf("Ignoring invalid mute regex for feed %s: %s", o.URL, err)
+					continue
+				}
+				settings.MuteRegexes = append(settings.MuteRegexes, r)
+			}
+			found = true
+		}
+	}
+
+	if found {
+		op.Settings[o.URL] = settings
+	}
+	return customTitle
+}
+
 // parseFolders converts a rooted folder into a list of outline objects.
-func parseFolders(folder models.Folder) []outline {
+func (op *Opml) parseFolders(folder models.Folder) []outline {
 	var outlines []outline
 
 	for _, feed := range folder.Feed {
-		outlines = append(outlines, outline{Type: "rss", Text: feed.Title, URL: feed.URL})
+		o := outline{
+			Type:        "rss",
+			Text:        feed.Title,
+			Description: feed.Description,
+			URL:         feed.URL,
+			HTMLURL:     feed.Link,
+		}
+		o.Extra = op.settingsAttrs(feed)
+		outlines = append(outlines, o)
 	}
 
 	for _, child := range folder.Folders {
 		o := outline{Text: child.Name}
-		o.Folders = parseFolders(child)
+		o.Folders = op.parseFolders(child)
 		outlines = append(outlines, o)
 	}
 
 	return outlines
 }
 
+// settingsAttrs returns Goliath attributes for the settings of the given feed.
+func (op *Opml) settingsAttrs(feed models.Feed) []xml.Attr {
+	var attrs []xml.Attr
+	attr := func(local, value string) {
+		attrs = append(attrs, xml.Attr{Name: xml.Name{Local: namespacePrefix + ":" + local}, Value: value})
+	}
+
+	if feed.CustomTitle != "" {
+		attr(attrCustomTitle, feed.CustomTitle)
+	}
+	settings := op.Settings[feed.URL]
+	if settings.Unmuted {
+		attr(attrUnmuted, "true")
+	}
+	if len(settings.MuteRegexes) > 0 {
+		b, err := json.Marshal(settings.MuteRegexes)
+		if err != nil {
+			log.Warningf("Failed to encode mute regexes for feed %s: %s", feed.URL, err)
+		} else {
+			attr(attrMuteRegexes, string(b))
+		}
+	}
+	return attrs
+}
+
 // ParseOpml open a file and returns a parsed OPML object.
 func ParseOpml(filename string) (*Opml, error) {
 	log.Infof("Loading OPML file from %s", filename)
@@ -118,12 +224,17 @@ func ParseOpml(filename string) (*Opml, error) {
 		return nil, err
 	}
 
-	r := bytes.NewReader(f)
+	return Parse(bytes.NewReader(f))
+}
+
+// Parse reads an OPML document from the given reader and returns a parsed OPML
+// object.
+func Parse(r io.Reader) (*Opml, error) {
 	d := xml.NewDecoder(r)
 	d.CharsetReader = charset.NewReaderLabel
 
 	oi := new(internalOpmlType)
-	err = d.Decode(&oi)
+	err := d.Decode(&oi)
 	if err != nil {
 		return nil, err
 	}
@@ -131,26 +242,31 @@ func ParseOpml(filename string) (*Opml, error) {
 	return createOpmlObject(oi), nil
 }
 
-// ExportOpml exports the given folder (with associated feeds and child folders)
-// to a file of the given filename in OPML format.
+// ExportOpml exports the given OPML object to a file of the given filename.
 // The file is created with 0777 mode if it does not exist.
-func ExportOpml(tree *models.Folder, filename string) error {
-	// OPML specifies that time fields conform to RFC822.
-	exportTime := time.Now().Format(time.RFC822)
-	export := &internalOpmlType{Version: "2.0"}
-	export.Header = header{Title: "Goliath Feed Export", DateCreated: exportTime}
-	export.Body = parseFolders(*tree)
-
+func ExportOpml(o *Opml, filename string) error {
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, syscall.S_IRWXU|syscall.S_IRWXG|syscall.S_IRWXO)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	if _, err = f.WriteString(xml.Header); err != nil {
+	return Write(o, f)
+}
+
+// Write writes the given OPML object (the root folder with associated feeds and
+// child folders, along with feed settings) to the given writer in OPML format.
+func Write(o *Opml, w io.Writer) error {
+	// OPML specifies that time fields conform to RFC822.
+	exportTime := time.Now().Format(time.RFC822)
+	export := &internalOpmlType{Version: "2.0", XmlnsGoliath: Namespace}
+	export.Header = header{Title: "Goliath Feed Export", DateCreated: exportTime}
+	export.Body = o.parseFolders(o.Folders)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
 		return err
 	}
-	e := xml.NewEncoder(f)
+	e := xml.NewEncoder(w)
 	e.Indent("", "  ")
 	return e.Encode(export)
 }
@@ -0,0 +1,110 @@
+package opml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jrupac/goliath/models"
+)
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	in := &Opml{
+		Folders: models.Folder{
+			Name: models.RootFolder,
+			Feed: []models.Feed{
+				{Title: "Top", URL: "http://top.example.com/feed", Link: "http://top.example.com"},
+			},
+			Folders: []models.Folder{{
+				Name: "Tech",
+				Feed: []models.Feed{{
+					Title:       "My Title",
+					CustomTitle: "My Title",
+					Description: "A blog",
+					URL:         "http://example.com/feed",
+					Link:        "http://example.com",
+				}},
+				Folders: []models.Folder{{
+					Name: "Go",
+					Feed: []models.Feed{{Title: "Go Blog", URL: "http://go.example.com/feed"}},
+				}},
+			}},
+		},
+		Settings: map[string]FeedSettings{
+			"http://example.com/feed":    {MuteRegexes: []string{`(?i)sponsored`, `"quoted"`}},
+			"http://go.example.com/feed": {Unmuted: true},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(in, &buf); err != nil {
+		t.Fatalf("failed to write OPML: %s", err)
+	}
+	if !strings.Contains(buf.String(), `xmlns:goliath="`+Namespace+`"`) {
+		t.Errorf("expected namespace declaration in output:\n%s", buf.String())
+	}
+
+	out, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse OPML: %s", err)
+	}
+
+	top := out.Folders.Feed
+	if len(top) != 1 || top[0].Link != "http://top.example.com" {
+		t.Errorf("unexpected top-level feeds: %+v", top)
+	}
+	if len(out.Folders.Folders) != 1 {
+		t.Fatalf("expected 1 folder, got %d", len(out.Folders.Folders))
+	}
+
+	tech := out.Folders.Folders[0]
+	if tech.Name != "Tech" || len(tech.Feed) != 1 {
+		t.Fatalf("unexpected folder: %+v", tech)
+	}
+	want := models.Feed{
+		Title:       "My Title",
+		CustomTitle: "My Title",
+		Description: "A blog",
+		URL:         "http://example.com/feed",
+		Link:        "http://example.com",
+	}
+	if !reflect.DeepEqual(tech.Feed[0], want) {
+		t.Errorf("expected feed %+v, got %+v", want, tech.Feed[0])
+	}
+	if len(tech.Folders) != 1 || tech.Folders[0].Name != "Go" || len(tech.Folders[0].Feed) != 1 {
+		t.Errorf("expected nested folder to round-trip, got %+v", tech.Folders)
+	}
+
+	if !reflect.DeepEqual(out.Settings, in.Settings) {
+		t.Errorf("expected settings %+v, got %+v", in.Settings, out.Settings)
+	}
+}
+
+func TestParseGoliathAttributes(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<opml version="2.0" xmlns:g="` + Namespace + `">
+  <body>
+    <outline text="A" xmlUrl="http://a.example.com/feed" g:unmuted="true" g:muteRegexes='["ok", "("]'/>
+    <outline text="B" xmlUrl="http://b.example.com/feed" other:customTitle="ignored" xmlns:other="http://example.com/ns"/>
+    <outline text="C" xmlUrl="http://c.example.com/feed" g:muteRegexes="not json"/>
+  </body>
+</opml>`
+
+	o, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse OPML: %s", err)
+	}
+
+	want := map[string]FeedSettings{
+		"http://a.example.com/feed": {MuteRegexes: []string{"ok"}, Unmuted: true},
+	}
+	if !reflect.DeepEqual(o.Settings, want) {
+		t.Errorf("expected settings %+v, got %+v", want, o.Settings)
+	}
+	for _, f := range o.Folders.Feed {
+		if f.CustomTitle != "" {
+			t.Errorf("unexpected custom title for %s: %q", f.URL, f.CustomTitle)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package opml
+
+import "fmt"
+
+// ReportFeed describes the outcome of importing a single feed.
+type ReportFeed struct {
+	ID     int64  `json:"id,omitempty"`
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	Folder string `json:"folder"`
+	// Reason is set for skipped feeds.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ReportFolder describes the outcome of importing a single folder.
+type ReportFolder struct {
+	ID   int64  `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Reason is set for skipped folders.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ImportReport summarizes the result of importing an OPML document. Created
+// entries did not exist before the import, merged entries already existed and
+// were left in place, and skipped entries were not imported.
+type ImportReport struct {
+	CreatedFeeds   []ReportFeed   `json:"created_feeds"`
+	MergedFeeds    []ReportFeed   `json:"merged_feeds"`
+	SkippedFeeds   []ReportFeed   `json:"skipped_feeds"`
+	CreatedFolders []ReportFolder `json:"created_folders"`
+	MergedFolders  []ReportFolder `json:"merged_folders"`
+	SkippedFolders []ReportFolder `json:"skipped_folders"`
+}
+
+// CreatedFeedIDs returns the IDs of all feeds created by the import.
+func (r ImportReport) CreatedFeedIDs() []int64 {
+	var ids []int64
+	for _, f := range r.CreatedFeeds {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func (r ImportReport) String() string {
+	return fmt.Sprintf(
+		"ImportReport{feeds: created=%d, merged=%d, skipped=%d; folders: created=%d, merged=%d, skipped=%d}",
+		len(r.CreatedFeeds), len(r.MergedFeeds), len(r.SkippedFeeds),
+		len(r.CreatedFolders), len(r.MergedFolders), len(r.SkippedFolders))
+}
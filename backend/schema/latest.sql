@@ -24,6 +24,10 @@ CREATE TABLE IF NOT EXISTS UserPrefs
     userid     UUID NOT NULL PRIMARY KEY,
     -- Data columns
     mute_words STRING[],
+    -- Whether near-duplicate articles are shown as one story, and whether
+    -- articles joining a story are marked read
+    group_stories   BOOL NOT NULL DEFAULT true,
+    mark_story_read BOOL NOT NULL DEFAULT false,
     CONSTRAINT userprefs_userid_fkey
         FOREIGN KEY (userid)
             REFERENCES UserTable (id)
@@ -111,6 +115,12 @@ CREATE TABLE IF NOT EXISTS Feed
     latest TIMESTAMPTZ DEFAULT CAST(0 AS TIMESTAMPTZ),
     -- Estimated interval between feed fetches (in seconds)
     estimated_refresh_interval INT DEFAULT 600,
+    -- User-assigned title that takes precedence over the feed's own title
+    custom_title STRING,
+    -- Whether to extract the full text of new articles at fetch time
+    fetch_full_text BOOL DEFAULT false,
+    -- Names of the transformers that rewrite the content of new articles, in order
+    transformers STRING[],
     CONSTRAINT unique_userid_hash
         UNIQUE (userid, hash)
 );
@@ -141,6 +151,29 @@ CREATE TABLE IF NOT EXISTS Article
     link      STRING,
     read      BOOL,
     saved BOOL DEFAULT false,
+    -- Timestamp of when the article was last saved
+    saved_at  TIMESTAMPTZ,
+    -- Labels and priority assigned by rules
+    labels    STRING[],
+    priority  BOOL DEFAULT false,
+    -- Authors, categories and comments link of the feed item
+    authors    STRING[],
+    categories STRING[],
+    comments   STRING,
+    -- URL of the lead image
+    thumbnail  STRING,
+    -- Word count, estimated reading time in seconds and detected language
+    word_count   INT DEFAULT 0,
+    reading_time INT DEFAULT 0,
+    language     STRING,
+    -- Offline copy of the content of a saved article with local images
+    archived  STRING,
+    -- Link given by the feed if it differs from the canonical link
+    original_link STRING,
+    -- SimHash of the text of the article
+    fingerprint INT8,
+    -- ID of the first article of the story of near-duplicates across feeds
+    story     INT,
     -- Publication timestamp
     date      TIMESTAMPTZ,
     -- Retrieval timestamp
@@ -157,6 +190,22 @@ CREATE
     INDEX ON Article (userid, id, read)
     STORING (title, summary, content, parsed, link, date);
 
+CREATE
+    INDEX IF NOT EXISTS article_story_idx
+    ON Article (userid, story);
+
+CREATE
+    INDEX IF NOT EXISTS article_retrieved_idx
+    ON Article (userid, retrieved) STORING (link, original_link, fingerprint, story);
+
+CREATE
+    INDEX IF NOT EXISTS article_feed_link_idx
+    ON Article (userid, feed, link) STORING (original_link, read);
+
+CREATE
+    INDEX IF NOT EXISTS article_feed_original_link_idx
+    ON Article (userid, feed, original_link) STORING (link, read);
+
 CREATE TABLE IF NOT EXISTS UserFeedMuteRegexes
 (
     userid UUID NOT NULL,
@@ -171,4 +220,158 @@ CREATE TABLE IF NOT EXISTS UserFeedMuteRegexes
         FOREIGN KEY (feedid)
             REFERENCES Feed (id)
             ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS StarredFeedToken
+(
+    -- Key columns
+    token   STRING NOT NULL PRIMARY KEY,
+    userid  UUID   NOT NULL,
+    -- Data columns
+    -- Folder to restrict the feed to, or 0 for all saved articles
+    folder  INT    NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS Rule
+(
+    -- Key columns
+    userid     UUID   NOT NULL,
+    id         SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    -- Data columns
+    name       STRING NOT NULL,
+    -- JSON-encoded models.RuleConditions
+    conditions JSONB  NOT NULL,
+    -- JSON-encoded models.RuleActions
+    actions    JSONB  NOT NULL,
+    created    TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS Webhook
+(
+    -- Key columns
+    userid   UUID   NOT NULL,
+    id       SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    -- Data columns
+    url      STRING NOT NULL,
+    -- Key used to sign payloads with HMAC-SHA256
+    secret   STRING NOT NULL,
+    -- JSON-encoded models.WebhookFilter
+    filter   JSONB  NOT NULL,
+    -- Go text/template for the payload, or empty for the default JSON payload
+    template STRING NOT NULL DEFAULT '',
+    created  TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS WebhookDelivery
+(
+    -- Key columns
+    userid        UUID   NOT NULL,
+    id            SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    webhook       INT    NOT NULL,
+    -- Data columns
+    article       INT    NOT NULL,
+    payload       STRING,
+    -- One of "pending", "delivered" or "dead"
+    status        STRING NOT NULL,
+    attempts      INT    NOT NULL DEFAULT 0,
+    response_code INT    NOT NULL DEFAULT 0,
+    error         STRING NOT NULL DEFAULT '',
+    created       TIMESTAMPTZ DEFAULT now(),
+    updated       TIMESTAMPTZ DEFAULT now(),
+    INDEX (userid, status, id),
+    CONSTRAINT fk_webhook
+        FOREIGN KEY (webhook)
+            REFERENCES Webhook (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS DigestSettings
+(
+    -- Key columns
+    userid       UUID   NOT NULL PRIMARY KEY,
+    -- Data columns
+    enabled      BOOL   NOT NULL DEFAULT false,
+    email        STRING NOT NULL,
+    -- Minutes after local midnight at which the digest is sent
+    time_of_day  INT    NOT NULL DEFAULT 420,
+    -- Days of the week (0 is Sunday) on which the digest is sent, or empty for
+    -- every day
+    weekdays     INT[],
+    -- IANA time zone name
+    timezone     STRING NOT NULL DEFAULT 'UTC',
+    window_hours INT    NOT NULL DEFAULT 24,
+    -- If set, only articles with any of these labels are included instead of
+    -- unread articles
+    labels       STRING[],
+    mark_read    BOOL   NOT NULL DEFAULT false,
+    last_sent    TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS NewsletterAddress
+(
+    -- Key columns
+    -- Local part of the address, which identifies the user
+    token   STRING NOT NULL PRIMARY KEY,
+    userid  UUID   NOT NULL,
+    -- Data columns
+    created TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS Enclosure
+(
+    -- Key columns
+    userid    UUID   NOT NULL,
+    article   INT    NOT NULL,
+    -- Position of the enclosure within the article
+    idx       INT    NOT NULL,
+    PRIMARY KEY (userid, article, idx),
+    -- Data columns
+    url       STRING NOT NULL,
+    mime_type STRING,
+    -- Size in bytes, or zero if unknown
+    length    INT    NOT NULL DEFAULT 0,
+    -- Durations in seconds, or zero if unknown
+    duration  INT    NOT NULL DEFAULT 0,
+    position  INT    NOT NULL DEFAULT 0,
+    position_updated TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_article
+        FOREIGN KEY (article)
+            REFERENCES Article (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ServerSecret
+(
+    -- Key columns
+    name  STRING PRIMARY KEY,
+    -- Data columns
+    value BYTES NOT NULL
 );
\ No newline at end of file
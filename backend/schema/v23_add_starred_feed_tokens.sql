@@ -0,0 +1,23 @@
+-- Add StarredFeedToken table for private Atom feeds of saved articles and
+-- track when articles were saved.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS saved_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS StarredFeedToken
+(
+    -- Key columns
+    token   STRING NOT NULL PRIMARY KEY,
+    userid  UUID   NOT NULL,
+    -- Data columns
+    -- Folder to restrict the feed to, or 0 for all saved articles
+    folder  INT    NOT NULL DEFAULT 0,
+    created TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE StarredFeedToken to goliath;
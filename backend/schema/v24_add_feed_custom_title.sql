@@ -0,0 +1,6 @@
+-- Add custom_title column to Feed table so that user-assigned titles are not
+-- overwritten by the title in the source feed.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Feed ADD COLUMN IF NOT EXISTS custom_title STRING;
@@ -0,0 +1,6 @@
+-- Add fetch_full_text column to Feed table to extract the full text of new
+-- articles at fetch time.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Feed ADD COLUMN IF NOT EXISTS fetch_full_text BOOL DEFAULT false;
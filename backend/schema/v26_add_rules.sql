@@ -0,0 +1,28 @@
+-- Add Rule table for user-defined rules applied to new articles at fetch time,
+-- and the labels and priority flag that rules can assign to articles.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS labels STRING[];
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS priority BOOL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS Rule
+(
+    -- Key columns
+    userid     UUID   NOT NULL,
+    id         SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    -- Data columns
+    name       STRING NOT NULL,
+    -- JSON-encoded models.RuleConditions
+    conditions JSONB  NOT NULL,
+    -- JSON-encoded models.RuleActions
+    actions    JSONB  NOT NULL,
+    created    TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE Rule to goliath;
@@ -0,0 +1,52 @@
+-- Add Webhook table for outgoing webhooks fired when articles are inserted, and
+-- WebhookDelivery table to log their deliveries.
+
+SET DATABASE TO Goliath;
+
+CREATE TABLE IF NOT EXISTS Webhook
+(
+    -- Key columns
+    userid   UUID   NOT NULL,
+    id       SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    -- Data columns
+    url      STRING NOT NULL,
+    -- Key used to sign payloads with HMAC-SHA256
+    secret   STRING NOT NULL,
+    -- JSON-encoded models.WebhookFilter
+    filter   JSONB  NOT NULL,
+    -- Go text/template for the payload, or empty for the default JSON payload
+    template STRING NOT NULL DEFAULT '',
+    created  TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS WebhookDelivery
+(
+    -- Key columns
+    userid        UUID   NOT NULL,
+    id            SERIAL NOT NULL UNIQUE,
+    PRIMARY KEY (userid, id),
+    webhook       INT    NOT NULL,
+    -- Data columns
+    article       INT    NOT NULL,
+    payload       STRING,
+    -- One of "pending", "delivered" or "dead"
+    status        STRING NOT NULL,
+    attempts      INT    NOT NULL DEFAULT 0,
+    response_code INT    NOT NULL DEFAULT 0,
+    error         STRING NOT NULL DEFAULT '',
+    created       TIMESTAMPTZ DEFAULT now(),
+    updated       TIMESTAMPTZ DEFAULT now(),
+    INDEX (userid, status, id),
+    CONSTRAINT fk_webhook
+        FOREIGN KEY (webhook)
+            REFERENCES Webhook (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE Webhook to goliath;
+GRANT ALL ON TABLE WebhookDelivery to goliath;
@@ -0,0 +1,31 @@
+-- Add DigestSettings table for per-user scheduled email digests.
+
+SET DATABASE TO Goliath;
+
+CREATE TABLE IF NOT EXISTS DigestSettings
+(
+    -- Key columns
+    userid       UUID   NOT NULL PRIMARY KEY,
+    -- Data columns
+    enabled      BOOL   NOT NULL DEFAULT false,
+    email        STRING NOT NULL,
+    -- Minutes after local midnight at which the digest is sent
+    time_of_day  INT    NOT NULL DEFAULT 420,
+    -- Days of the week (0 is Sunday) on which the digest is sent, or empty for
+    -- every day
+    weekdays     INT[],
+    -- IANA time zone name
+    timezone     STRING NOT NULL DEFAULT 'UTC',
+    window_hours INT    NOT NULL DEFAULT 24,
+    -- If set, only articles with any of these labels are included instead of
+    -- unread articles
+    labels       STRING[],
+    mark_read    BOOL   NOT NULL DEFAULT false,
+    last_sent    TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE DigestSettings to goliath;
@@ -0,0 +1,20 @@
+-- Add NewsletterAddress table for per-user generated addresses that inbound
+-- email newsletters are received at.
+
+SET DATABASE TO Goliath;
+
+CREATE TABLE IF NOT EXISTS NewsletterAddress
+(
+    -- Key columns
+    -- Local part of the address, which identifies the user
+    token   STRING NOT NULL PRIMARY KEY,
+    userid  UUID   NOT NULL,
+    -- Data columns
+    created TIMESTAMPTZ DEFAULT now(),
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE NewsletterAddress to goliath;
@@ -0,0 +1,33 @@
+-- Add Enclosure table for media files attached to articles, such as podcast
+-- episodes, along with the user's playback position of each.
+
+SET DATABASE TO Goliath;
+
+CREATE TABLE IF NOT EXISTS Enclosure
+(
+    -- Key columns
+    userid    UUID   NOT NULL,
+    article   INT    NOT NULL,
+    -- Position of the enclosure within the article
+    idx       INT    NOT NULL,
+    PRIMARY KEY (userid, article, idx),
+    -- Data columns
+    url       STRING NOT NULL,
+    mime_type STRING,
+    -- Size in bytes, or zero if unknown
+    length    INT    NOT NULL DEFAULT 0,
+    -- Durations in seconds, or zero if unknown
+    duration  INT    NOT NULL DEFAULT 0,
+    position  INT    NOT NULL DEFAULT 0,
+    position_updated TIMESTAMPTZ,
+    CONSTRAINT fk_user
+        FOREIGN KEY (userid)
+            REFERENCES UserTable (id)
+            ON DELETE CASCADE,
+    CONSTRAINT fk_article
+        FOREIGN KEY (article)
+            REFERENCES Article (id)
+            ON DELETE CASCADE
+);
+
+GRANT ALL ON TABLE Enclosure to goliath;
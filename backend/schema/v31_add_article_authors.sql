@@ -0,0 +1,7 @@
+-- Add authors, categories and comments link of the feed item to Article.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS authors STRING[];
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS categories STRING[];
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS comments STRING;
@@ -0,0 +1,5 @@
+-- Add the URL of the lead image of an article to Article.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS thumbnail STRING;
@@ -0,0 +1,8 @@
+-- Add the word count, estimated reading time and detected language of an
+-- article to Article.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS word_count INT DEFAULT 0;
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS reading_time INT DEFAULT 0;
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS language STRING;
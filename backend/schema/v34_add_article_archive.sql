@@ -0,0 +1,6 @@
+-- Add the offline copy of a saved article, with its images rewritten to local
+-- copies, to Article.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS archived STRING;
@@ -0,0 +1,6 @@
+-- Add the ordered list of transformers that rewrite the content of new
+-- articles to Feed.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Feed ADD COLUMN IF NOT EXISTS transformers STRING[];
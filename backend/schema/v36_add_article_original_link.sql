@@ -0,0 +1,6 @@
+-- Add the link given by the feed to Article, kept when the stored link is
+-- canonicalized.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS original_link STRING;
@@ -0,0 +1,14 @@
+-- Add content fingerprints and the story that groups near-duplicate articles
+-- across feeds to Article, and the story preferences of users to UserPrefs.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS fingerprint INT8;
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS story INT;
+
+CREATE INDEX IF NOT EXISTS article_story_idx ON Article (userid, story);
+CREATE INDEX IF NOT EXISTS article_retrieved_idx ON Article (userid, retrieved)
+    STORING (link, original_link, fingerprint, story);
+
+ALTER TABLE UserPrefs ADD COLUMN IF NOT EXISTS group_stories BOOL NOT NULL DEFAULT true;
+ALTER TABLE UserPrefs ADD COLUMN IF NOT EXISTS mark_story_read BOOL NOT NULL DEFAULT false;
@@ -0,0 +1,11 @@
+-- Add fingerprints of titles and summaries used to de-duplicate articles of a
+-- feed to Article, and indexes to look up the articles of a feed by link.
+
+SET DATABASE TO Goliath;
+
+ALTER TABLE Article ADD COLUMN IF NOT EXISTS dedup_fingerprint INT8;
+
+CREATE INDEX IF NOT EXISTS article_feed_link_idx ON Article (userid, feed, link)
+    STORING (original_link, read, dedup_fingerprint);
+CREATE INDEX IF NOT EXISTS article_feed_original_link_idx ON Article (userid, feed, original_link)
+    STORING (link, read, dedup_fingerprint);
@@ -0,0 +1,12 @@
+-- Add ServerSecret table to persist secrets generated by the server, such as
+-- the key used to sign image proxy URLs, across restarts.
+
+SET DATABASE TO Goliath;
+
+CREATE TABLE IF NOT EXISTS ServerSecret
+(
+    -- Key columns
+    name  STRING PRIMARY KEY,
+    -- Data columns
+    value BYTES NOT NULL
+);
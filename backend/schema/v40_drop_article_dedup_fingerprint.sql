@@ -0,0 +1,18 @@
+-- Drop the de-duplication fingerprints of Article. Articles of a feed are only
+-- de-duplicated if they share a link, so the link indexes already find the few
+-- candidates without scanning the feed, and their edit distance is computed
+-- exactly. SimHashes of short titles differ in as many bits after a single edit
+-- as between unrelated titles, so they could not keep the meaning of
+-- maxEditDedup anyway.
+
+SET DATABASE TO Goliath;
+
+DROP INDEX IF EXISTS Article@article_feed_link_idx;
+DROP INDEX IF EXISTS Article@article_feed_original_link_idx;
+
+ALTER TABLE Article DROP COLUMN IF EXISTS dedup_fingerprint;
+
+CREATE INDEX IF NOT EXISTS article_feed_link_idx ON Article (userid, feed, link)
+    STORING (original_link, read);
+CREATE INDEX IF NOT EXISTS article_feed_original_link_idx ON Article (userid, feed, original_link)
+    STORING (link, read);
@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"time"
 
 	log "github.com/golang/glog"
@@ -338,6 +340,59 @@ func (crdb *Crdb) DeleteMuteRegexForFeedForUser(u models.User, feedId int64, reg
 
 	return err
 }
+
+// GetStorySettingsForUser returns the story settings for the given user. If
+// none were set, the default settings are returned.
+func (crdb *Crdb) GetStorySettingsForUser(u models.User) (models.StorySettings, error) {
+	defer logElapsedTime(time.Now(), "GetStorySettingsForUser")
+
+	var s models.StorySettings
+
+	query := `SELECT group_stories, mark_story_read FROM UserPrefs WHERE userid = $1`
+	err := crdb.db.QueryRow(query, u.UserId).Scan(&s.Group, &s.MarkRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DefaultStorySettings, nil
+	}
+	return s, err
+}
+
+// UpdateStorySettingsForUser replaces the story settings for the given user.
+// If stories are no longer grouped, articles are removed from their stories.
+func (crdb *Crdb) UpdateStorySettingsForUser(u models.User, s models.StorySettings) error {
+	defer logElapsedTime(time.Now(), "UpdateStorySettingsForUser")
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxOperationTime)
+	defer cancel()
+	tx, err := crdb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollbackSilent(tx)
+
+	query := `
+		INSERT INTO UserPrefs (userid, group_stories, mark_story_read)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (userid) DO UPDATE SET
+			group_stories = excluded.group_stories,
+			mark_story_read = excluded.mark_story_read
+	`
+	if _, err = tx.ExecContext(ctx, query, u.UserId, s.Group, s.MarkRead); err != nil {
+		return fmt.Errorf("failed to update story settings: %w", err)
+	}
+
+	if !s.Group {
+		query = `UPDATE Article SET story = NULL WHERE userid = $1 AND story IS NOT NULL`
+		if _, err = tx.ExecContext(ctx, query, u.UserId); err != nil {
+			return fmt.Errorf("failed to ungroup stories: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 /*******************************************************************************
  * Retrieval cache
  ******************************************************************************/
@@ -437,34 +492,101 @@ func (crdb *Crdb) PersistAllRetrievalCaches(entries map[UserFeedKey][]byte) erro
 	return nil
 }
 
+/*******************************************************************************
+ * Server secrets
+ ******************************************************************************/
+
+// GetOrInsertServerSecret retrieves the server secret with the given name,
+// first storing the given value if there is no such secret yet.
+func (crdb *Crdb) GetOrInsertServerSecret(name string, value []byte) ([]byte, error) {
+	defer logElapsedTime(time.Now(), "GetOrInsertServerSecret")
+
+	query := `INSERT INTO ServerSecret (name, value) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING`
+	if _, err := crdb.db.Exec(query, name, value); err != nil {
+		return nil, fmt.Errorf("failed to insert server secret: %w", err)
+	}
+
+	var stored []byte
+	query = `SELECT value FROM ServerSecret WHERE name = $1`
+	if err := crdb.db.QueryRow(query, name).Scan(&stored); err != nil {
+		return nil, fmt.Errorf("failed to get server secret: %w", err)
+	}
+	return stored, nil
+}
+
 /*******************************************************************************
  * Content insertion
  ******************************************************************************/
 
-// InsertArticleForUser inserts the given article object into the database.
-func (crdb *Crdb) InsertArticleForUser(u models.User, a models.Article) error {
+// InsertArticleForUser inserts the given article object and its enclosures
+// into the database and returns its ID. If the article is a duplicate, a zero
+// ID is returned.
+func (crdb *Crdb) InsertArticleForUser(u models.User, a models.Article) (int64, error) {
 	defer logElapsedTime(time.Now(), "InsertArticleForUser")
 
+	ctx, cancel := context.WithTimeout(context.Background(), maxOperationTime)
+	defer cancel()
+	tx, err := crdb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollbackSilent(tx)
+
+	if a.StoryID != 0 {
+		// Join the story of the given article, which becomes the first article
+		// of a new story if it is not in one yet.
+		query := `
+			UPDATE Article SET story = COALESCE(story, id)
+			WHERE userid = $1 AND id = $2
+			RETURNING story
+		`
+		err = tx.QueryRowContext(ctx, query, u.UserId, a.StoryID).Scan(&a.StoryID)
+		if errors.Is(err, sql.ErrNoRows) {
+			a.StoryID = 0
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to join story: %w", err)
+		}
+	}
+
 	query := `
-		INSERT INTO Article (userid, folder, feed, hash, title, summary, content, parsed, link, read, saved, date, retrieved)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		INSERT INTO Article (userid, folder, feed, hash, title, summary, content, parsed, link, read, saved, date, retrieved, labels, priority, authors, categories, comments, thumbnail,
+			word_count, reading_time, language, original_link, fingerprint, story)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, NULLIF($23, ''), NULLIF($24, 0), NULLIF($25, 0))
 		ON CONFLICT (userid, feed, hash) DO NOTHING
 		RETURNING id
 	`
-	err := crdb.db.QueryRow(query,
+	err = tx.QueryRowContext(ctx, query,
 		u.UserId, a.FolderID, a.FeedID, a.Hash(), a.Title, a.Summary, a.Content, a.Parsed, a.Link, a.Read, a.Saved, a.Date, a.Retrieved,
+		pq.Array(a.Labels), a.Priority, pq.Array(a.Authors), pq.Array(a.Categories), a.CommentsURL, a.Thumbnail,
+		a.WordCount, int64(a.ReadingTime.Seconds()), a.Language, a.OriginalLink, int64(a.Fingerprint), a.StoryID,
 	).Scan(&a.ID)
 
 	if err != nil {
 		// If no rows were returned, it means a duplicate was found
 		if errors.Is(err, sql.ErrNoRows) {
 			log.V(2).Infof("Duplicate article entry, skipping (hash): %s", a.Hash())
-			return nil
+			return 0, nil
 		}
-		return fmt.Errorf("failed to insert article: %w", err)
+		return 0, fmt.Errorf("failed to insert article: %w", err)
 	}
 
-	return nil
+	query = `
+		INSERT INTO Enclosure (userid, article, idx, url, mime_type, length, duration, position)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	for i, e := range a.Enclosures {
+		_, err = tx.ExecContext(ctx, query,
+			u.UserId, a.ID, i, e.URL, e.Type, e.Length, int64(e.Duration.Seconds()), int64(e.Position.Seconds()))
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert enclosure: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return a.ID, nil
 }
 
 // InsertFaviconForUser inserts the given favicon and associated metadata into
@@ -596,6 +718,14 @@ func (crdb *Crdb) InsertFolderForUser(u models.User, f models.Folder, parentId i
 func (crdb *Crdb) DeleteArticlesForUser(u models.User, minTimestamp time.Time) (int64, error) {
 	defer logElapsedTime(time.Now(), "DeleteArticlesForUser")
 
+	ctx, cancel := context.WithTimeout(context.Background(), maxOperationTime)
+	defer cancel()
+	tx, err := crdb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return -1, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollbackSilent(tx)
+
 	query := `
 		DELETE FROM Article 
 		WHERE userid = $1 
@@ -603,7 +733,7 @@ func (crdb *Crdb) DeleteArticlesForUser(u models.User, minTimestamp time.Time) (
 		  AND not saved
 		  AND (retrieved IS NULL OR retrieved < $2)
 	`
-	result, err := crdb.db.Exec(query, u.UserId, minTimestamp)
+	result, err := tx.ExecContext(ctx, query, u.UserId, minTimestamp)
 	if err != nil {
 		return -1, fmt.Errorf("failed to delete articles: %w", err)
 	}
@@ -613,6 +743,15 @@ func (crdb *Crdb) DeleteArticlesForUser(u models.User, minTimestamp time.Time) (
 		return -1, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
+	if rowsAffected > 0 {
+		if err = regroupStoriesForUser(ctx, tx, u); err != nil {
+			return -1, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return -1, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return rowsAffected, nil
 }
 
@@ -620,9 +759,45 @@ func (crdb *Crdb) DeleteArticlesForUser(u models.User, minTimestamp time.Time) (
 func (crdb *Crdb) DeleteArticlesByIdForUser(u models.User, ids []int64) error {
 	defer logElapsedTime(time.Now(), "DeleteArticlesByIdForUser")
 
+	ctx, cancel := context.WithTimeout(context.Background(), maxOperationTime)
+	defer cancel()
+	tx, err := crdb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer rollbackSilent(tx)
+
 	query := `DELETE FROM Article WHERE userid = $1 AND id = ANY($2)`
-	_, err := crdb.db.Exec(query, u.UserId, pq.Array(ids))
-	return err
+	if _, err := tx.ExecContext(ctx, query, u.UserId, pq.Array(ids)); err != nil {
+		return err
+	}
+	if err := regroupStoriesForUser(ctx, tx, u); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// regroupStoriesForUser makes the earliest remaining article of each story
+// whose first article was deleted the first article of the story. It must run
+// in the transaction of the deletion so that no story is left without its
+// first article.
+func regroupStoriesForUser(ctx context.Context, tx *sql.Tx, u models.User) error {
+	defer logElapsedTime(time.Now(), "regroupStoriesForUser")
+
+	query := `
+		UPDATE Article AS a
+		SET story = (SELECT min(b.id) FROM Article AS b WHERE b.userid = a.userid AND b.story = a.story)
+		WHERE a.userid = $1 AND a.story IS NOT NULL
+		  AND NOT EXISTS (SELECT 1 FROM Article AS c WHERE c.userid = a.userid AND c.id = a.story)
+	`
+	if _, err := tx.ExecContext(ctx, query, u.UserId); err != nil {
+		return fmt.Errorf("failed to regroup stories: %w", err)
+	}
+	return nil
 }
 
 // DeleteFeedForUser deletes the specified feed and all articles under that feed.
@@ -651,10 +826,13 @@ func (crdb *Crdb) DeleteFeedForUser(u models.User, feedId int64, folderId int64)
 		return fmt.Errorf("failed to delete feed: %w", err)
 	}
 
+	if err := regroupStoriesForUser(ctx, tx, u); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
-
 	return nil
 }
 
@@ -674,9 +852,21 @@ func (crdb *Crdb) MarkArticleForUser(u models.User, articleId int64, mark models
 	var query string
 	switch markType {
 	case models.MarkTypeRead:
-		query = `UPDATE Article SET read = $1 WHERE userid = $2 AND id = $3`
+		// Clients only see the first article of a story, so it is marked along
+		// with the rest of the story.
+		query = `
+			UPDATE Article SET read = $1
+			WHERE userid = $2 AND (id = $3 OR story = (
+				SELECT story FROM Article WHERE userid = $2 AND id = $3 AND story = id
+			))
+		`
 	case models.MarkTypeSaved:
-		query = `UPDATE Article SET saved = $1 WHERE userid = $2 AND id = $3`
+		// Unsaving an article also drops its archived copy.
+		query = `
+			UPDATE Article SET saved = $1, saved_at = CASE WHEN $1 THEN now() ELSE NULL END,
+				archived = CASE WHEN $1 THEN archived ELSE NULL END
+			WHERE userid = $2 AND id = $3
+		`
 	default:
 		return fmt.Errorf("invalid mark type: %+v", mark)
 	}
@@ -699,7 +889,14 @@ func (crdb *Crdb) MarkFeedForUser(u models.User, feedId int64, mark models.MarkA
 		return 0, fmt.Errorf("invalid mark action: %+v", mark)
 	}
 
-	query := `UPDATE Article SET read = $1 WHERE userid = $2 AND feed = $3`
+	// Stories whose first article is in the feed are marked in full, since their
+	// other articles are only shown through the first one.
+	query := `
+		UPDATE Article SET read = $1
+		WHERE userid = $2 AND (feed = $3 OR story IN (
+			SELECT id FROM Article WHERE userid = $2 AND feed = $3 AND story = id
+		))
+	`
 	result, err := crdb.db.Exec(query, value, u.UserId, feedId)
 	if err != nil {
 		return 0, err
@@ -736,7 +933,8 @@ func (crdb *Crdb) MarkFolderForUser(u models.User, folderId int64, mark models.M
 
 	// Enumerate all descendant folders of folderId in a recursive CTE and then
 	// mark all articles in any of that set of folders (including the original
-	// folder itself) in one update.
+	// folder itself) in one update, along with the rest of the stories whose
+	// first article is in one of these folders.
 	query := `
 		WITH RECURSIVE RecursiveFolders AS (
 			SELECT child
@@ -754,6 +952,11 @@ func (crdb *Crdb) MarkFolderForUser(u models.User, folderId int64, mark models.M
 		  AND (
 			a.folder IN (SELECT child FROM RecursiveFolders)
 			OR a.folder = $2
+			OR a.story IN (
+				SELECT b.id FROM Article AS b
+				WHERE b.userid = $1 AND b.story = b.id
+				  AND (b.folder IN (SELECT child FROM RecursiveFolders) OR b.folder = $2)
+			)
 		  );
 	`
 	result, err := crdb.db.Exec(query, u.UserId, folderId, value)
@@ -824,15 +1027,123 @@ func (crdb *Crdb) UpdateFolderForFeedForUser(u models.User, feedId int64, folder
 	return err
 }
 
-// UpdateArticleParsedContentForUser updates the parsed content column of the article.
-func (crdb *Crdb) UpdateArticleParsedContentForUser(u models.User, articleID int64, parsed string) error {
+// UpdateCustomTitleForFeedForUser sets a user-assigned title for the given
+// feed that is kept in place of the feed's own title. An empty title clears it;
+// the feed's own title is then restored the next time its metadata is fetched.
+func (crdb *Crdb) UpdateCustomTitleForFeedForUser(u models.User, feedId int64, title string) error {
+	defer logElapsedTime(time.Now(), "UpdateCustomTitleForFeedForUser")
+
+	query := `
+		UPDATE Feed
+		SET custom_title = NULLIF($1, ''), title = COALESCE(NULLIF($1, ''), title)
+		WHERE userid = $2 AND id = $3
+	`
+	_, err := crdb.db.Exec(query, title, u.UserId, feedId)
+	return err
+}
+
+// UpdateFetchFullTextForFeedForUser sets whether the full text of new articles
+// in the given feed is extracted at fetch time.
+func (crdb *Crdb) UpdateFetchFullTextForFeedForUser(u models.User, feedId int64, enabled bool) error {
+	defer logElapsedTime(time.Now(), "UpdateFetchFullTextForFeedForUser")
+
+	query := `UPDATE Feed SET fetch_full_text = $1 WHERE userid = $2 AND id = $3`
+	_, err := crdb.db.Exec(query, enabled, u.UserId, feedId)
+	return err
+}
+
+// UpdateTransformersForFeedForUser sets the ordered list of transformers that
+// rewrite the content of new articles in the given feed.
+func (crdb *Crdb) UpdateTransformersForFeedForUser(u models.User, feedId int64, names []string) error {
+	defer logElapsedTime(time.Now(), "UpdateTransformersForFeedForUser")
+
+	query := `UPDATE Feed SET transformers = $1 WHERE userid = $2 AND id = $3`
+	_, err := crdb.db.Exec(query, pq.Array(names), u.UserId, feedId)
+	return err
+}
+
+// UpdateArticleParsedContentForUser updates the parsed content column of the
+// article along with the text stats computed from it.
+func (crdb *Crdb) UpdateArticleParsedContentForUser(u models.User, articleID int64, parsed string, stats models.TextStats) error {
 	defer logElapsedTime(time.Now(), "UpdateArticleParsedContentForUser")
 
-	query := `UPDATE Article SET parsed = $1 WHERE userid = $2 AND id = $3`
-	_, err := crdb.db.Exec(query, parsed, u.UserId, articleID)
+	query := `
+		UPDATE Article SET parsed = $1, word_count = $2, reading_time = $3, language = $4
+		WHERE userid = $5 AND id = $6
+	`
+	_, err := crdb.db.Exec(query, parsed, stats.WordCount, int64(stats.ReadingTime.Seconds()), stats.Language, u.UserId, articleID)
+	return err
+}
+
+// UpdateArticleThumbnailForUser sets the thumbnail of the article unless it
+// already has one.
+func (crdb *Crdb) UpdateArticleThumbnailForUser(u models.User, articleID int64, thumbnail string) error {
+	defer logElapsedTime(time.Now(), "UpdateArticleThumbnailForUser")
+
+	query := `
+		UPDATE Article SET thumbnail = $1
+		WHERE userid = $2 AND id = $3 AND COALESCE(thumbnail, '') = ''
+	`
+	_, err := crdb.db.Exec(query, thumbnail, u.UserId, articleID)
+	return err
+}
+
+// UpdateArticleLinkForUser replaces the link of the article with its
+// canonical link, keeping the first link it had as the original link.
+func (crdb *Crdb) UpdateArticleLinkForUser(u models.User, articleID int64, link string) error {
+	defer logElapsedTime(time.Now(), "UpdateArticleLinkForUser")
+
+	query := `
+		UPDATE Article SET link = $1, original_link = COALESCE(original_link, link)
+		WHERE userid = $2 AND id = $3 AND link <> $1
+	`
+	_, err := crdb.db.Exec(query, link, u.UserId, articleID)
+	return err
+}
+
+// UpdateArticleDateForUser replaces the publication date of the article.
+func (crdb *Crdb) UpdateArticleDateForUser(u models.User, articleID int64, date time.Time) error {
+	defer logElapsedTime(time.Now(), "UpdateArticleDateForUser")
+
+	query := `UPDATE Article SET date = $1 WHERE userid = $2 AND id = $3`
+	_, err := crdb.db.Exec(query, date, u.UserId, articleID)
+	return err
+}
+
+// UpdateArticleArchiveForUser stores the archived copy of the content of the
+// article if it is still saved.
+func (crdb *Crdb) UpdateArticleArchiveForUser(u models.User, articleID int64, archived string) error {
+	defer logElapsedTime(time.Now(), "UpdateArticleArchiveForUser")
+
+	query := `UPDATE Article SET archived = $1 WHERE userid = $2 AND id = $3 AND saved`
+	_, err := crdb.db.Exec(query, archived, u.UserId, articleID)
 	return err
 }
 
+// UpdateEnclosurePositionForUser saves the playback position of the
+// enclosure of the given article with the given URL.
+func (crdb *Crdb) UpdateEnclosurePositionForUser(u models.User, articleID int64, url string, position time.Duration) error {
+	defer logElapsedTime(time.Now(), "UpdateEnclosurePositionForUser")
+
+	query := `
+		UPDATE Enclosure SET position = $1, position_updated = now()
+		WHERE userid = $2 AND article = $3 AND url = $4
+	`
+	res, err := crdb.db.Exec(query, int64(position.Seconds()), u.UserId, articleID, url)
+	if err != nil {
+		return fmt.Errorf("failed to update enclosure position: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if n == 0 {
+		return errors.New("could not find enclosure")
+	}
+	return nil
+}
+
 /*******************************************************************************
  * Content retrieval
  ******************************************************************************/
@@ -897,7 +1208,8 @@ func (crdb *Crdb) GetAllFeedsForUser(u models.User) ([]models.Feed, error) {
 	var feeds []models.Feed
 
 	query := `
-		SELECT id, folder, title, description, url, link, latest, estimated_refresh_interval
+		SELECT id, folder, title, COALESCE(custom_title, ''), description, url, link, latest, estimated_refresh_interval,
+			COALESCE(fetch_full_text, false), transformers
 		FROM Feed
 		WHERE userid = $1
 	`
@@ -910,9 +1222,11 @@ func (crdb *Crdb) GetAllFeedsForUser(u models.User) ([]models.Feed, error) {
 
 	for rows.Next() {
 		f := models.Feed{}
-		if err = rows.Scan(&f.ID, &f.FolderID, &f.Title, &f.Description, &f.URL, &f.Link, &f.Latest, &f.EstimatedRefreshInterval); err != nil {
+		var transformers pq.StringArray
+		if err = rows.Scan(&f.ID, &f.FolderID, &f.Title, &f.CustomTitle, &f.Description, &f.URL, &f.Link, &f.Latest, &f.EstimatedRefreshInterval, &f.FetchFullText, &transformers); err != nil {
 			return feeds, err
 		}
+		f.Transformers = transformers
 		feeds = append(feeds, f)
 	}
 
@@ -996,7 +1310,7 @@ func (crdb *Crdb) GetFolderFeedTreeForUser(u models.User) (*models.Folder, error
 		folderMap[folders[id].ID] = &folders[id]
 	}
 
-	// Assemble the folder parent/child relationships
+	// Collect the folder parent/child relationships
 	query = `SELECT parent, child FROM FolderChildren WHERE userid = $1`
 	folderChildren, err := crdb.db.Query(query, u.UserId)
 	defer closeSilent(folderChildren)
@@ -1005,16 +1319,13 @@ func (crdb *Crdb) GetFolderFeedTreeForUser(u models.User) (*models.Folder, error
 		return nil, fmt.Errorf("failed to get folder hierarchy: %w", err)
 	}
 
+	children := make(map[int64][]int64)
 	for folderChildren.Next() {
 		var parentID, childID int64
 		if err := folderChildren.Scan(&parentID, &childID); err != nil {
 			return nil, fmt.Errorf("failed to scan folder child relationship: %w", err)
 		}
-		if parent, ok := folderMap[parentID]; ok {
-			if child, ok := folderMap[childID]; ok {
-				parent.Folders = append(parent.Folders, *child)
-			}
-		}
+		children[parentID] = append(children[parentID], childID)
 	}
 	if err = folderChildren.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over folder hierarchy: %w", err)
@@ -1032,12 +1343,26 @@ func (crdb *Crdb) GetFolderFeedTreeForUser(u models.User) (*models.Folder, error
 		}
 	}
 
-	rootFolder, ok := folderMap[rootId]
-	if !ok {
+	if _, ok := folderMap[rootId]; !ok {
 		return nil, fmt.Errorf("root folder not found in folder map for user %s", u.UserId)
 	}
 
-	return rootFolder, nil
+	// Child folders are copied into their parents, so assemble the tree only
+	// once all feeds are in place.
+	var assemble func(id int64, visited map[int64]bool) models.Folder
+	assemble = func(id int64, visited map[int64]bool) models.Folder {
+		folder := *folderMap[id]
+		visited[id] = true
+		for _, childID := range children[id] {
+			if _, ok := folderMap[childID]; ok && !visited[childID] {
+				folder.Folders = append(folder.Folders, assemble(childID, visited))
+			}
+		}
+		return folder
+	}
+
+	rootFolder := assemble(rootId, map[int64]bool{})
+	return &rootFolder, nil
 }
 
 // GetAllFaviconsForUser returns a map of feed ID to a base64 representation of
@@ -1074,6 +1399,8 @@ func (crdb *Crdb) GetAllFaviconsForUser(u models.User) (map[int64]string, error)
 
 // GetArticleMetaWithFilterForUser returns a list of <=`limit` articles with
 // `filter` after `sinceID`. Only metadata fields are returned, not content.
+// Articles in a story other than its first are not returned by the read,
+// unread and priority filters.
 func (crdb *Crdb) GetArticleMetaWithFilterForUser(u models.User, filter models.StreamFilter, limit int, sinceID int64) ([]models.ArticleMeta, error) {
 	defer logElapsedTime(time.Now(), "GetUnreadArticleMetaForUser")
 
@@ -1095,14 +1422,14 @@ func (crdb *Crdb) GetArticleMetaWithFilterForUser(u models.User, filter models.S
 		query = `
 		SELECT id, feed, folder, date
 		FROM Article
-		WHERE userid = $1 AND id > $2 AND read
+		WHERE userid = $1 AND id > $2 AND read AND (story IS NULL OR story = id)
 		ORDER BY id LIMIT $3
 	`
 	case models.StreamFilterUnread:
 		query = `
 		SELECT id, feed, folder, date
 		FROM Article
-		WHERE userid = $1 AND id > $2 AND NOT read
+		WHERE userid = $1 AND id > $2 AND NOT read AND (story IS NULL OR story = id)
 		ORDER BY id LIMIT $3
 	`
 	case models.StreamFilterSaved:
@@ -1119,6 +1446,13 @@ func (crdb *Crdb) GetArticleMetaWithFilterForUser(u models.User, filter models.S
 		WHERE userid = $1 AND id > $2 AND NOT saved
 		ORDER BY id LIMIT $3
 	`
+	case models.StreamFilterPriority:
+		query = `
+		SELECT id, feed, folder, date
+		FROM Article
+		WHERE userid = $1 AND id > $2 AND NOT read AND priority AND (story IS NULL OR story = id)
+		ORDER BY id LIMIT $3
+	`
 	default:
 		return articles, fmt.Errorf("invalid filter: %+v", filter)
 	}
@@ -1141,7 +1475,8 @@ func (crdb *Crdb) GetArticleMetaWithFilterForUser(u models.User, filter models.S
 	return articles, err
 }
 
-// GetArticlesForUser returns articles from the specified list.
+// GetArticlesForUser returns articles from the specified list. Articles that
+// are the first of a story have the others as their sources.
 func (crdb *Crdb) GetArticlesForUser(u models.User, ids []int64) ([]models.Article, error) {
 	defer logElapsedTime(time.Now(), "GetArticlesForUser")
 
@@ -1150,7 +1485,9 @@ func (crdb *Crdb) GetArticlesForUser(u models.User, ids []int64) ([]models.Artic
 	var err error
 
 	query := `
-		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, labels, COALESCE(priority, false),
+			authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, '')
 		FROM Article
 		WHERE userid = $1 AND id = ANY($2)
 	`
@@ -1163,17 +1500,116 @@ func (crdb *Crdb) GetArticlesForUser(u models.User, ids []int64) ([]models.Artic
 
 	for rows.Next() {
 		a := models.Article{}
+		var labels, authors, categories pq.StringArray
+		var readingTime int64
 		if err = rows.Scan(
-			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Date); err != nil {
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Date, &labels, &a.Priority,
+			&authors, &categories, &a.CommentsURL, &a.Thumbnail,
+			&a.WordCount, &readingTime, &a.Language, &a.Archived); err != nil {
 			return articles, err
 		}
+		a.ReadingTime = time.Duration(readingTime) * time.Second
+		a.Labels = labels
+		a.Authors = authors
+		a.Categories = categories
 		articles = append(articles, a)
 	}
+	if err == nil {
+		err = crdb.addEnclosuresForUser(u, articles)
+	}
+	if err == nil {
+		err = crdb.addStorySourcesForUser(u, articles)
+	}
 	return articles, err
 }
 
+// addStorySourcesForUser populates the sources of the given articles that are
+// the first of a story.
+func (crdb *Crdb) addStorySourcesForUser(u models.User, articles []models.Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	byID := map[int64]*models.Article{}
+	var ids []int64
+	for i := range articles {
+		byID[articles[i].ID] = &articles[i]
+		ids = append(ids, articles[i].ID)
+	}
+
+	query := `
+		SELECT a.story, a.id, a.feed, COALESCE(f.title, ''), COALESCE(a.title, ''), COALESCE(a.link, '')
+		FROM Article AS a
+		JOIN Feed AS f ON f.userid = a.userid AND f.id = a.feed
+		WHERE a.userid = $1 AND a.story = ANY($2) AND a.id <> a.story
+		ORDER BY a.story, a.id
+	`
+	rows, err := crdb.db.Query(query, u.UserId, pq.Array(ids))
+	defer closeSilent(rows)
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch story sources: %w", err)
+	}
+
+	for rows.Next() {
+		var story int64
+		s := models.StorySource{}
+		if err = rows.Scan(&story, &s.ArticleID, &s.FeedID, &s.FeedTitle, &s.Title, &s.Link); err != nil {
+			return fmt.Errorf("failed to scan story source: %w", err)
+		}
+		if a, ok := byID[story]; ok {
+			a.StoryID = story
+			a.Sources = append(a.Sources, s)
+		}
+	}
+	return rows.Err()
+}
+
+// addEnclosuresForUser populates the enclosures of the given articles.
+func (crdb *Crdb) addEnclosuresForUser(u models.User, articles []models.Article) error {
+	if len(articles) == 0 {
+		return nil
+	}
+
+	byID := map[int64]*models.Article{}
+	var ids []int64
+	for i := range articles {
+		byID[articles[i].ID] = &articles[i]
+		ids = append(ids, articles[i].ID)
+	}
+
+	query := `
+		SELECT article, url, COALESCE(mime_type, ''), length, duration, position
+		FROM Enclosure
+		WHERE userid = $1 AND article = ANY($2)
+		ORDER BY article, idx
+	`
+	rows, err := crdb.db.Query(query, u.UserId, pq.Array(ids))
+	defer closeSilent(rows)
+
+	if err != nil {
+		return fmt.Errorf("failed to fetch enclosures: %w", err)
+	}
+
+	for rows.Next() {
+		var articleID, duration, position int64
+		e := models.Enclosure{}
+		if err = rows.Scan(&articleID, &e.URL, &e.Type, &e.Length, &duration, &position); err != nil {
+			return fmt.Errorf("failed to scan enclosure: %w", err)
+		}
+		e.Duration = time.Duration(duration) * time.Second
+		e.Position = time.Duration(position) * time.Second
+		if a, ok := byID[articleID]; ok {
+			a.Enclosures = append(a.Enclosures, e)
+		}
+	}
+	return rows.Err()
+}
+
 // GetArticlesWithFilterForUser returns a list of <=`limit` articles with
-// `filter` after `sinceId`.
+// `filter` after `sinceId`. Articles in a story other than its first are not
+// returned by the read, unread and priority filters, and the first has the
+// others as its sources.
 func (crdb *Crdb) GetArticlesWithFilterForUser(u models.User, filter models.StreamFilter, limit int, sinceID int64) ([]models.Article, error) {
 	defer logElapsedTime(time.Now(), "GetUnreadArticlesForUser")
 
@@ -1193,32 +1629,44 @@ func (crdb *Crdb) GetArticlesWithFilterForUser(u models.User, filter models.Stre
 	switch filter {
 	case models.StreamFilterRead:
 		query = `
-		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), labels, COALESCE(priority, false)
 		FROM Article
-		WHERE userid = $1 AND id > $2 AND read
+		WHERE userid = $1 AND id > $2 AND read AND (story IS NULL OR story = id)
 		ORDER BY id LIMIT $3
 	`
 	case models.StreamFilterUnread:
 		query = `
-		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), labels, COALESCE(priority, false)
 		FROM Article
-		WHERE userid = $1 AND id > $2 AND NOT read
+		WHERE userid = $1 AND id > $2 AND NOT read AND (story IS NULL OR story = id)
 		ORDER BY id LIMIT $3
 	`
 	case models.StreamFilterSaved:
 		query = `
-		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), labels, COALESCE(priority, false)
 		FROM Article
 		WHERE userid = $1 AND id > $2 AND saved
 		ORDER BY id LIMIT $3
 	`
 	case models.StreamFilterUnsaved:
 		query = `
-		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), labels, COALESCE(priority, false)
 		FROM Article
 		WHERE userid = $1 AND id > $2 AND NOT saved
 		ORDER BY id LIMIT $3
 	`
+	case models.StreamFilterPriority:
+		query = `
+		SELECT id, feed, folder, title, summary, content, parsed, link, date, authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), labels, COALESCE(priority, false)
+		FROM Article
+		WHERE userid = $1 AND id > $2 AND NOT read AND priority AND (story IS NULL OR story = id)
+		ORDER BY id LIMIT $3
+	`
 	default:
 		return articles, fmt.Errorf("invalid filter: %+v", filter)
 	}
@@ -1232,12 +1680,26 @@ func (crdb *Crdb) GetArticlesWithFilterForUser(u models.User, filter models.Stre
 
 	for rows.Next() {
 		a := models.Article{}
+		var labels, authors, categories pq.StringArray
+		var readingTime int64
 		if err = rows.Scan(
-			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Date); err != nil {
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Date,
+			&authors, &categories, &a.CommentsURL, &a.Thumbnail,
+			&a.WordCount, &readingTime, &a.Language, &a.Archived, &labels, &a.Priority); err != nil {
 			return articles, err
 		}
+		a.ReadingTime = time.Duration(readingTime) * time.Second
+		a.Labels = labels
+		a.Authors = authors
+		a.Categories = categories
 		articles = append(articles, a)
 	}
+	if err == nil {
+		err = crdb.addEnclosuresForUser(u, articles)
+	}
+	if err == nil {
+		err = crdb.addStorySourcesForUser(u, articles)
+	}
 	return articles, err
 }
 
@@ -1251,7 +1713,9 @@ func (crdb *Crdb) GetArticlesForFeedForUser(u models.User, feedId int64) ([]mode
 	var err error
 
 	query := `
-		SELECT id, feed, folder, title, summary, content, parsed, link, read, saved, date
+		SELECT id, feed, folder, title, summary, content, parsed, link, read, saved, date, labels, COALESCE(priority, false),
+			authors, categories, COALESCE(comments, ''), COALESCE(thumbnail, ''),
+			word_count, reading_time, COALESCE(language, ''), COALESCE(archived, ''), COALESCE(original_link, '')
 		FROM Article
 		WHERE userid = $1 AND feed = $2
 	`
@@ -1264,54 +1728,967 @@ func (crdb *Crdb) GetArticlesForFeedForUser(u models.User, feedId int64) ([]mode
 
 	for rows.Next() {
 		a := models.Article{}
+		var labels, authors, categories pq.StringArray
+		var readingTime int64
 		if err = rows.Scan(
-			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Read, &a.Saved, &a.Date); err != nil {
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Read, &a.Saved, &a.Date, &labels, &a.Priority,
+			&authors, &categories, &a.CommentsURL, &a.Thumbnail,
+			&a.WordCount, &readingTime, &a.Language, &a.Archived, &a.OriginalLink); err != nil {
 			return articles, err
 		}
+		a.ReadingTime = time.Duration(readingTime) * time.Second
+		a.Labels = labels
+		a.Authors = authors
+		a.Categories = categories
 		articles = append(articles, a)
 	}
+	if err == nil {
+		err = crdb.addEnclosuresForUser(u, articles)
+	}
 	return articles, err
 }
 
-/*******************************************************************************
- * OPML
- ******************************************************************************/
+// GetArticlesWithLinksForFeedForUser returns the articles of the given feed
+// whose link or original link is one of the given links. Only the links, read
+// status, title and summary of the articles are returned.
+func (crdb *Crdb) GetArticlesWithLinksForFeedForUser(u models.User, feedId int64, links []string) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetArticlesWithLinksForFeedForUser")
+
+	var articles []models.Article
+
+	query := `
+		SELECT id, COALESCE(link, ''), COALESCE(original_link, ''), read, title, summary
+		FROM Article
+		WHERE userid = $1 AND feed = $2 AND (link = ANY($3) OR original_link = ANY($3))
+		LIMIT $4
+	`
+	rows, err := crdb.db.Query(query, u.UserId, feedId, pq.Array(links), maxFetchedRows)
+	defer closeSilent(rows)
 
-// ImportOpmlForUser inserts folders from the given OPML object into the
-// database for the given user.
-func (crdb *Crdb) ImportOpmlForUser(u models.User, opml *opml.Opml) error {
-	root := opml.Folders
-	rootID, err := crdb.InsertFolderForUser(u, root, 0)
 	if err != nil {
-		return err
+		return articles, err
 	}
-	root.ID = rootID
-
-	return importChildrenForUser(crdb, u, root)
-}
 
-func importChildrenForUser(crdb *Crdb, u models.User, parent models.Folder) error {
-	var err error
-	for _, f := range parent.Feed {
-		feedID, err := crdb.InsertFeedForUser(u, f, parent.ID)
-		if err != nil {
-			return err
+	for rows.Next() {
+		a := models.Article{FeedID: feedId}
+		if err = rows.Scan(&a.ID, &a.Link, &a.OriginalLink, &a.Read, &a.Title, &a.Summary); err != nil {
+			return articles, err
 		}
-		f.ID = feedID
+		articles = append(articles, a)
 	}
+	return articles, rows.Err()
+}
 
-	for _, child := range parent.Folders {
-		childID, err := crdb.InsertFolderForUser(u, child, parent.ID)
-		if err != nil {
-			return err
-		}
-		child.ID = childID
+// GetStoryCandidatesForUser returns the articles retrieved after `since` in
+// feeds other than `feedId` that new articles of that feed may be grouped
+// with. Only the link, fingerprint and story of the articles are returned.
+func (crdb *Crdb) GetStoryCandidatesForUser(u models.User, feedId int64, since time.Time) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetStoryCandidatesForUser")
 
-		if err = importChildrenForUser(crdb, u, child); err != nil {
-			return err
-		}
-	}
-	return err
+	var articles []models.Article
+
+	query := `
+		SELECT id, feed, COALESCE(link, ''), COALESCE(original_link, ''), COALESCE(fingerprint, 0), COALESCE(story, 0)
+		FROM Article
+		WHERE userid = $1 AND retrieved > $2 AND feed <> $3
+		ORDER BY id
+		LIMIT $4
+	`
+	rows, err := crdb.db.Query(query, u.UserId, since, feedId, maxFetchedRows)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{}
+		var fingerprint int64
+		if err = rows.Scan(&a.ID, &a.FeedID, &a.Link, &a.OriginalLink, &fingerprint, &a.StoryID); err != nil {
+			return articles, err
+		}
+		a.Fingerprint = uint64(fingerprint)
+		articles = append(articles, a)
+	}
+	return articles, rows.Err()
+}
+
+// GetRecentArticlesForUser returns up to `limit` of the user's most recently
+// retrieved articles, newest first.
+func (crdb *Crdb) GetRecentArticlesForUser(u models.User, limit int) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetRecentArticlesForUser")
+
+	var articles []models.Article
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, feed, folder, title, summary, content, parsed, link, read, saved, date, retrieved, authors, categories
+		FROM Article
+		WHERE userid = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	rows, err := crdb.db.Query(query, u.UserId, limit)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{}
+		var authors, categories pq.StringArray
+		if err = rows.Scan(
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Read, &a.Saved, &a.Date, &a.Retrieved,
+			&authors, &categories); err != nil {
+			return articles, err
+		}
+		a.Authors = authors
+		a.Categories = categories
+		articles = append(articles, a)
+	}
+	return articles, err
+}
+
+// GetSavedArticlesForUser returns up to `limit` saved articles, most recently
+// saved first. If `folderId` is non-zero, only articles in that folder are
+// returned.
+func (crdb *Crdb) GetSavedArticlesForUser(u models.User, folderId int64, limit int) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetSavedArticlesForUser")
+
+	var articles []models.Article
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, feed, folder, title, summary, content, parsed, COALESCE(archived, ''), link, date, retrieved, saved_at
+		FROM Article
+		WHERE userid = $1 AND saved AND ($2 = 0 OR folder = $2)
+		ORDER BY saved_at DESC NULLS LAST, date DESC
+		LIMIT $3
+	`
+	rows, err := crdb.db.Query(query, u.UserId, folderId, limit)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{Saved: true}
+		var savedAt sql.NullTime
+		if err = rows.Scan(
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Archived, &a.Link, &a.Date, &a.Retrieved, &savedAt); err != nil {
+			return articles, err
+		}
+		if savedAt.Valid {
+			a.SavedAt = savedAt.Time
+		}
+		articles = append(articles, a)
+	}
+	return articles, err
+}
+
+// GetUnarchivedSavedArticlesForUser returns up to `limit` saved articles that
+// are not archived yet, least recently saved first.
+func (crdb *Crdb) GetUnarchivedSavedArticlesForUser(u models.User, limit int) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetUnarchivedSavedArticlesForUser")
+
+	var articles []models.Article
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, feed, folder, title, summary, content, parsed, link, date
+		FROM Article
+		WHERE userid = $1 AND saved AND archived IS NULL
+		ORDER BY saved_at NULLS FIRST, id
+		LIMIT $2
+	`
+	rows, err := crdb.db.Query(query, u.UserId, limit)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{Saved: true}
+		if err = rows.Scan(
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Date); err != nil {
+			return articles, err
+		}
+		articles = append(articles, a)
+	}
+	return articles, err
+}
+
+// GetArticlesInStreamForUser returns up to `limit` articles selected by the
+// given stream, by feed and oldest first.
+func (crdb *Crdb) GetArticlesInStreamForUser(u models.User, s models.ArticleStream, limit int) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetArticlesInStreamForUser")
+
+	var articles []models.Article
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, feed, folder, title, summary, content, parsed, COALESCE(archived, ''), link, read, saved, date,
+			retrieved, authors, COALESCE(language, '')
+		FROM Article
+		WHERE userid = $1
+			AND (NOT $2 OR saved)
+			AND ($3 = '' OR $3 = ANY(labels))
+			AND (cardinality($4::INT[]) = 0 OR folder = ANY($4::INT[]))
+			AND ($5::TIMESTAMPTZ IS NULL OR retrieved >= $5)
+		ORDER BY feed, date, id
+		LIMIT $6
+	`
+	since := sql.NullTime{Time: s.Since, Valid: !s.Since.IsZero()}
+	rows, err := crdb.db.Query(query, u.UserId, s.Saved, s.Label, pq.Array(s.FolderIDs), since, limit)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{}
+		var authors pq.StringArray
+		if err = rows.Scan(
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Archived, &a.Link, &a.Read, &a.Saved, &a.Date,
+			&a.Retrieved, &authors, &a.Language); err != nil {
+			return articles, err
+		}
+		a.Authors = authors
+		articles = append(articles, a)
+	}
+	return articles, err
+}
+
+// GetArchivedArticleIdsForUser returns the IDs of all articles with an
+// archived copy.
+func (crdb *Crdb) GetArchivedArticleIdsForUser(u models.User) ([]int64, error) {
+	defer logElapsedTime(time.Now(), "GetArchivedArticleIdsForUser")
+
+	var ids []int64
+
+	query := `SELECT id FROM Article WHERE userid = $1 AND archived IS NOT NULL`
+	rows, err := crdb.db.Query(query, u.UserId)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return ids, err
+	}
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, err
+}
+
+/*******************************************************************************
+ * Starred feed tokens
+ ******************************************************************************/
+
+// InsertStarredFeedTokenForUser persists a new starred feed token.
+func (crdb *Crdb) InsertStarredFeedTokenForUser(u models.User, t models.StarredFeedToken) error {
+	defer logElapsedTime(time.Now(), "InsertStarredFeedTokenForUser")
+
+	query := `INSERT INTO StarredFeedToken (token, userid, folder) VALUES ($1, $2, $3)`
+	_, err := crdb.db.Exec(query, t.Token, u.UserId, t.FolderID)
+	if err != nil {
+		return fmt.Errorf("failed to insert starred feed token: %w", err)
+	}
+	return nil
+}
+
+// GetStarredFeedTokensForUser returns all starred feed tokens for the given
+// user.
+func (crdb *Crdb) GetStarredFeedTokensForUser(u models.User) ([]models.StarredFeedToken, error) {
+	defer logElapsedTime(time.Now(), "GetStarredFeedTokensForUser")
+
+	var tokens []models.StarredFeedToken
+
+	query := `SELECT token, folder, created FROM StarredFeedToken WHERE userid = $1 ORDER BY created`
+	rows, err := crdb.db.Query(query, u.UserId)
+	defer closeSilent(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		t := models.StarredFeedToken{}
+		if err = rows.Scan(&t.Token, &t.FolderID, &t.Created); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, err
+}
+
+// DeleteStarredFeedTokenForUser revokes the given starred feed token.
+func (crdb *Crdb) DeleteStarredFeedTokenForUser(u models.User, token string) error {
+	defer logElapsedTime(time.Now(), "DeleteStarredFeedTokenForUser")
+
+	query := `DELETE FROM StarredFeedToken WHERE userid = $1 AND token = $2`
+	result, err := crdb.db.Exec(query, u.UserId, token)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("could not find token")
+	}
+	return nil
+}
+
+// GetUserByStarredFeedToken returns the user and token metadata identified by
+// the given starred feed token.
+func (crdb *Crdb) GetUserByStarredFeedToken(token string) (models.User, models.StarredFeedToken, error) {
+	defer logElapsedTime(time.Now(), "GetUserByStarredFeedToken")
+
+	var u models.User
+	t := models.StarredFeedToken{Token: token}
+
+	query := `
+		SELECT u.id, u.username, u.key, u.hashpass, t.folder, t.created
+		FROM StarredFeedToken t
+		INNER JOIN UserTable u ON u.id = t.userid
+		WHERE t.token = $1
+	`
+	err := crdb.db.QueryRow(query, token).Scan(&u.UserId, &u.Username, &u.Key, &u.HashPass, &t.FolderID, &t.Created)
+
+	if !u.Valid() {
+		return models.User{}, models.StarredFeedToken{}, errors.New("could not find token")
+	}
+	return u, t, err
+}
+
+/*******************************************************************************
+ * Newsletter addresses
+ ******************************************************************************/
+
+// InsertNewsletterAddressForUser persists a new newsletter address token.
+func (crdb *Crdb) InsertNewsletterAddressForUser(u models.User, token string) error {
+	defer logElapsedTime(time.Now(), "InsertNewsletterAddressForUser")
+
+	query := `INSERT INTO NewsletterAddress (token, userid) VALUES ($1, $2)`
+	if _, err := crdb.db.Exec(query, token, u.UserId); err != nil {
+		return fmt.Errorf("failed to insert newsletter address: %w", err)
+	}
+	return nil
+}
+
+// GetNewsletterAddressesForUser returns all newsletter addresses for the given
+// user.
+func (crdb *Crdb) GetNewsletterAddressesForUser(u models.User) ([]models.NewsletterAddress, error) {
+	defer logElapsedTime(time.Now(), "GetNewsletterAddressesForUser")
+
+	var addresses []models.NewsletterAddress
+
+	query := `SELECT token, created FROM NewsletterAddress WHERE userid = $1 ORDER BY created`
+	rows, err := crdb.db.Query(query, u.UserId)
+	defer closeSilent(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		a := models.NewsletterAddress{}
+		if err = rows.Scan(&a.Token, &a.Created); err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+
+	return addresses, err
+}
+
+// DeleteNewsletterAddressForUser revokes the given newsletter address token.
+func (crdb *Crdb) DeleteNewsletterAddressForUser(u models.User, token string) error {
+	defer logElapsedTime(time.Now(), "DeleteNewsletterAddressForUser")
+
+	query := `DELETE FROM NewsletterAddress WHERE userid = $1 AND token = $2`
+	result, err := crdb.db.Exec(query, u.UserId, token)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("could not find address")
+	}
+	return nil
+}
+
+// GetUserByNewsletterAddress returns the user identified by the given
+// newsletter address token.
+func (crdb *Crdb) GetUserByNewsletterAddress(token string) (models.User, error) {
+	defer logElapsedTime(time.Now(), "GetUserByNewsletterAddress")
+
+	var u models.User
+
+	query := `
+		SELECT u.id, u.username, u.key, u.hashpass
+		FROM NewsletterAddress a
+		INNER JOIN UserTable u ON u.id = a.userid
+		WHERE a.token = $1
+	`
+	err := crdb.db.QueryRow(query, token).Scan(&u.UserId, &u.Username, &u.Key, &u.HashPass)
+
+	if !u.Valid() {
+		return models.User{}, errors.New("could not find address")
+	}
+	return u, err
+}
+
+/*******************************************************************************
+ * Rules
+ ******************************************************************************/
+
+// GetRulesForUser returns all rules for the given user in creation order.
+func (crdb *Crdb) GetRulesForUser(u models.User) ([]models.Rule, error) {
+	defer logElapsedTime(time.Now(), "GetRulesForUser")
+
+	var rules []models.Rule
+
+	query := `SELECT id, name, conditions, actions, created FROM Rule WHERE userid = $1 ORDER BY id`
+	rows, err := crdb.db.Query(query, u.UserId)
+	defer closeSilent(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var r models.Rule
+		var conditions, actions []byte
+		if err = rows.Scan(&r.ID, &r.Name, &conditions, &actions, &r.Created); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(conditions, &r.Conditions); err != nil {
+			return nil, fmt.Errorf("invalid conditions of rule %d: %w", r.ID, err)
+		}
+		if err = json.Unmarshal(actions, &r.Actions); err != nil {
+			return nil, fmt.Errorf("invalid actions of rule %d: %w", r.ID, err)
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, err
+}
+
+// InsertRuleForUser persists a new rule for the given user and returns its ID.
+func (crdb *Crdb) InsertRuleForUser(u models.User, r models.Rule) (int64, error) {
+	defer logElapsedTime(time.Now(), "InsertRuleForUser")
+
+	conditions, err := json.Marshal(r.Conditions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode conditions: %w", err)
+	}
+	actions, err := json.Marshal(r.Actions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode actions: %w", err)
+	}
+
+	var id int64
+	query := `INSERT INTO Rule (userid, name, conditions, actions) VALUES ($1, $2, $3, $4) RETURNING id`
+	if err = crdb.db.QueryRow(query, u.UserId, r.Name, conditions, actions).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert rule: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteRuleForUser deletes the rule with the given ID for the given user.
+func (crdb *Crdb) DeleteRuleForUser(u models.User, id int64) error {
+	defer logElapsedTime(time.Now(), "DeleteRuleForUser")
+
+	query := `DELETE FROM Rule WHERE userid = $1 AND id = $2`
+	result, err := crdb.db.Exec(query, u.UserId, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("could not find rule")
+	}
+	return nil
+}
+
+/*******************************************************************************
+ * Webhooks
+ ******************************************************************************/
+
+// GetWebhooksForUser returns all webhooks for the given user in creation order.
+func (crdb *Crdb) GetWebhooksForUser(u models.User) ([]models.Webhook, error) {
+	defer logElapsedTime(time.Now(), "GetWebhooksForUser")
+
+	var webhooks []models.Webhook
+
+	query := `SELECT id, url, secret, filter, template, created FROM Webhook WHERE userid = $1 ORDER BY id`
+	rows, err := crdb.db.Query(query, u.UserId)
+	defer closeSilent(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var w models.Webhook
+		var filter []byte
+		if err = rows.Scan(&w.ID, &w.URL, &w.Secret, &filter, &w.Template, &w.Created); err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(filter, &w.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter of webhook %d: %w", w.ID, err)
+		}
+		webhooks = append(webhooks, w)
+	}
+
+	return webhooks, err
+}
+
+// InsertWebhookForUser persists a new webhook for the given user and returns
+// its ID.
+func (crdb *Crdb) InsertWebhookForUser(u models.User, w models.Webhook) (int64, error) {
+	defer logElapsedTime(time.Now(), "InsertWebhookForUser")
+
+	filter, err := json.Marshal(w.Filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode filter: %w", err)
+	}
+
+	var id int64
+	query := `INSERT INTO Webhook (userid, url, secret, filter, template) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	if err = crdb.db.QueryRow(query, u.UserId, w.URL, w.Secret, filter, w.Template).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert webhook: %w", err)
+	}
+	return id, nil
+}
+
+// DeleteWebhookForUser deletes the webhook with the given ID for the given
+// user along with its deliveries.
+func (crdb *Crdb) DeleteWebhookForUser(u models.User, id int64) error {
+	defer logElapsedTime(time.Now(), "DeleteWebhookForUser")
+
+	query := `DELETE FROM Webhook WHERE userid = $1 AND id = $2`
+	result, err := crdb.db.Exec(query, u.UserId, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("could not find webhook")
+	}
+	return nil
+}
+
+// InsertWebhookDeliveryForUser persists a new webhook delivery for the given
+// user and returns its ID.
+func (crdb *Crdb) InsertWebhookDeliveryForUser(u models.User, d models.WebhookDelivery) (int64, error) {
+	defer logElapsedTime(time.Now(), "InsertWebhookDeliveryForUser")
+
+	var id int64
+	query := `
+		INSERT INTO WebhookDelivery (userid, webhook, article, payload, status, attempts, response_code, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id
+	`
+	err := crdb.db.QueryRow(query,
+		u.UserId, d.WebhookID, d.ArticleID, d.Payload, d.Status, d.Attempts, d.ResponseCode, d.Error,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert webhook delivery: %w", err)
+	}
+	return id, nil
+}
+
+// UpdateWebhookDeliveryForUser updates the status and result of the last
+// attempt of the given webhook delivery.
+func (crdb *Crdb) UpdateWebhookDeliveryForUser(u models.User, d models.WebhookDelivery) error {
+	defer logElapsedTime(time.Now(), "UpdateWebhookDeliveryForUser")
+
+	query := `
+		UPDATE WebhookDelivery
+		SET status = $3, attempts = $4, response_code = $5, error = $6, updated = now()
+		WHERE userid = $1 AND id = $2
+	`
+	_, err := crdb.db.Exec(query, u.UserId, d.ID, d.Status, d.Attempts, d.ResponseCode, d.Error)
+	return err
+}
+
+// GetWebhookDeliveriesForUser returns up to `limit` of the given user's most
+// recent webhook deliveries. If `status` is non-empty, only deliveries with
+// that status are returned.
+func (crdb *Crdb) GetWebhookDeliveriesForUser(u models.User, status string, limit int) ([]models.WebhookDelivery, error) {
+	defer logElapsedTime(time.Now(), "GetWebhookDeliveriesForUser")
+
+	var deliveries []models.WebhookDelivery
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, webhook, article, payload, status, attempts, response_code, error, created, updated
+		FROM WebhookDelivery
+		WHERE userid = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	rows, err := crdb.db.Query(query, u.UserId, status, limit)
+	defer closeSilent(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload sql.NullString
+		if err = rows.Scan(&d.ID, &d.WebhookID, &d.ArticleID, &payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &d.Created, &d.Updated); err != nil {
+			return nil, err
+		}
+		d.Payload = payload.String
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, err
+}
+
+/*******************************************************************************
+ * Digests
+ ******************************************************************************/
+
+// GetDigestSettingsForUser returns the digest settings for the given user. If
+// none were set, disabled zero-valued settings are returned.
+func (crdb *Crdb) GetDigestSettingsForUser(u models.User) (models.DigestSettings, error) {
+	defer logElapsedTime(time.Now(), "GetDigestSettingsForUser")
+
+	var s models.DigestSettings
+	var weekdays pq.Int64Array
+	var labels pq.StringArray
+	var lastSent sql.NullTime
+
+	query := `
+		SELECT enabled, email, time_of_day, weekdays, timezone, window_hours, labels, mark_read, last_sent
+		FROM DigestSettings
+		WHERE userid = $1
+	`
+	err := crdb.db.QueryRow(query, u.UserId).Scan(
+		&s.Enabled, &s.Email, &s.TimeOfDay, &weekdays, &s.Timezone, &s.WindowHours, &labels, &s.MarkRead, &lastSent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.DigestSettings{}, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	for _, d := range weekdays {
+		s.Weekdays = append(s.Weekdays, time.Weekday(d))
+	}
+	s.Labels = labels
+	if lastSent.Valid {
+		s.LastSent = lastSent.Time
+	}
+	return s, nil
+}
+
+// UpdateDigestSettingsForUser creates or replaces the digest settings for the
+// given user. The time the last digest was sent is kept, and set to the
+// current time for new settings so that no digest is sent before the next
+// scheduled time.
+func (crdb *Crdb) UpdateDigestSettingsForUser(u models.User, s models.DigestSettings) error {
+	defer logElapsedTime(time.Now(), "UpdateDigestSettingsForUser")
+
+	var weekdays []int64
+	for _, d := range s.Weekdays {
+		weekdays = append(weekdays, int64(d))
+	}
+
+	query := `
+		INSERT INTO DigestSettings
+			(userid, enabled, email, time_of_day, weekdays, timezone, window_hours, labels, mark_read, last_sent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now())
+		ON CONFLICT (userid) DO UPDATE SET
+			enabled = excluded.enabled,
+			email = excluded.email,
+			time_of_day = excluded.time_of_day,
+			weekdays = excluded.weekdays,
+			timezone = excluded.timezone,
+			window_hours = excluded.window_hours,
+			labels = excluded.labels,
+			mark_read = excluded.mark_read
+	`
+	_, err := crdb.db.Exec(query, u.UserId, s.Enabled, s.Email, s.TimeOfDay, pq.Array(weekdays), s.Timezone,
+		s.WindowHours, pq.Array(s.Labels), s.MarkRead)
+	return err
+}
+
+// UpdateDigestLastSentForUser records when the last scheduled digest was sent
+// to the given user.
+func (crdb *Crdb) UpdateDigestLastSentForUser(u models.User, t time.Time) error {
+	defer logElapsedTime(time.Now(), "UpdateDigestLastSentForUser")
+
+	query := `UPDATE DigestSettings SET last_sent = $2 WHERE userid = $1`
+	_, err := crdb.db.Exec(query, u.UserId, t)
+	return err
+}
+
+// GetDigestArticlesForUser returns up to `limit` articles retrieved since the
+// given time, oldest first. If labels are given, articles with any of them are
+// returned whether read or not. Otherwise, unread articles are returned.
+func (crdb *Crdb) GetDigestArticlesForUser(u models.User, since time.Time, labels []string, limit int) ([]models.Article, error) {
+	defer logElapsedTime(time.Now(), "GetDigestArticlesForUser")
+
+	var articles []models.Article
+
+	if limit <= 0 {
+		limit = maxFetchedRows
+	}
+
+	query := `
+		SELECT id, feed, folder, title, summary, content, parsed, link, read, saved, date, retrieved,
+			labels, COALESCE(priority, false)
+		FROM Article
+		WHERE userid = $1 AND retrieved >= $2
+			AND (CASE WHEN cardinality($3::STRING[]) = 0 THEN NOT read ELSE labels && $3::STRING[] END)
+		ORDER BY retrieved, id
+		LIMIT $4
+	`
+	rows, err := crdb.db.Query(query, u.UserId, since, pq.Array(labels), limit)
+	defer closeSilent(rows)
+
+	if err != nil {
+		return articles, err
+	}
+
+	for rows.Next() {
+		a := models.Article{}
+		var labels pq.StringArray
+		if err = rows.Scan(
+			&a.ID, &a.FeedID, &a.FolderID, &a.Title, &a.Summary, &a.Content, &a.Parsed, &a.Link, &a.Read, &a.Saved,
+			&a.Date, &a.Retrieved, &labels, &a.Priority); err != nil {
+			return articles, err
+		}
+		a.Labels = labels
+		articles = append(articles, a)
+	}
+	return articles, err
+}
+
+/*******************************************************************************
+ * OPML
+ ******************************************************************************/
+
+// ImportOpmlForUser inserts folders from the given OPML object into the
+// database for the given user and returns a report of what was created, merged
+// with existing entries, or skipped. Feeds are matched to existing feeds by URL
+// and folders by name.
+func (crdb *Crdb) ImportOpmlForUser(u models.User, o *opml.Opml) (opml.ImportReport, error) {
+	defer logElapsedTime(time.Now(), "ImportOpmlForUser")
+
+	imp := opmlImporter{
+		crdb:     crdb,
+		u:        u,
+		settings: o.Settings,
+		feeds:    map[string]bool{},
+		feedIDs:  map[string]int64{},
+		folders:  map[string]int64{},
+	}
+
+	feeds, err := crdb.GetAllFeedsForUser(u)
+	if err != nil {
+		return imp.report, fmt.Errorf("failed to get existing feeds: %w", err)
+	}
+	for _, f := range feeds {
+		imp.feeds[f.URL] = false
+		imp.feedIDs[f.URL] = f.ID
+	}
+
+	folders, err := crdb.GetAllFoldersForUser(u)
+	if err != nil {
+		return imp.report, fmt.Errorf("failed to get existing folders: %w", err)
+	}
+	for _, f := range folders {
+		imp.folders[f.Name] = f.ID
+	}
+
+	root := o.Folders
+	rootID, err := crdb.InsertFolderForUser(u, root, 0)
+	if err != nil {
+		return imp.report, err
+	}
+	root.ID = rootID
+	imp.folders[root.Name] = rootID
+
+	err = imp.importChildren(root)
+	return imp.report, err
+}
+
+// ExportOpmlForUser returns an OPML object with all folders and feeds for the
+// given user along with the Goliath settings of each feed.
+func (crdb *Crdb) ExportOpmlForUser(u models.User) (*opml.Opml, error) {
+	defer logElapsedTime(time.Now(), "ExportOpmlForUser")
+
+	tree, err := crdb.GetFolderFeedTreeForUser(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folder tree: %w", err)
+	}
+
+	feeds, err := crdb.GetAllFeedsForUser(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feeds: %w", err)
+	}
+	urls := map[int64]string{}
+	for _, f := range feeds {
+		urls[f.ID] = f.URL
+	}
+
+	settings := map[string]opml.FeedSettings{}
+	regexes, err := crdb.GetFeedMuteRegexesForUser(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feed mute regexes: %w", err)
+	}
+	for feedId, r := range regexes {
+		if feedURL, ok := urls[feedId]; ok {
+			s := settings[feedURL]
+			s.MuteRegexes = r
+			settings[feedURL] = s
+		}
+	}
+
+	unmuted, err := crdb.GetUnmuteFeedsForUser(u)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unmuted feeds: %w", err)
+	}
+	for _, feedId := range unmuted {
+		if feedURL, ok := urls[feedId]; ok {
+			s := settings[feedURL]
+			s.Unmuted = true
+			settings[feedURL] = s
+		}
+	}
+
+	return &opml.Opml{Folders: *tree, Settings: settings}, nil
+}
+
+type opmlImporter struct {
+	crdb     *Crdb
+	u        models.User
+	settings map[string]opml.FeedSettings
+	// feeds maps URLs of known feeds to whether they were seen in this import.
+	feeds map[string]bool
+	// feedIDs maps URLs of known feeds to their IDs.
+	feedIDs map[string]int64
+	// folders maps names of known folders to their IDs.
+	folders map[string]int64
+	report  opml.ImportReport
+}
+
+func (imp *opmlImporter) importChildren(parent models.Folder) error {
+	for _, f := range parent.Feed {
+		rf := opml.ReportFeed{Title: f.Title, URL: f.URL, Folder: parent.Name}
+
+		if u, err := url.Parse(f.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			rf.Reason = "invalid feed URL"
+			imp.report.SkippedFeeds = append(imp.report.SkippedFeeds, rf)
+			continue
+		}
+		if seen, ok := imp.feeds[f.URL]; ok {
+			if seen {
+				rf.Reason = "duplicate feed URL in import"
+				imp.report.SkippedFeeds = append(imp.report.SkippedFeeds, rf)
+			} else {
+				imp.feeds[f.URL] = true
+				rf.ID = imp.feedIDs[f.URL]
+				if err := imp.applySettings(rf.ID, f); err != nil {
+					return err
+				}
+				imp.report.MergedFeeds = append(imp.report.MergedFeeds, rf)
+			}
+			continue
+		}
+
+		feedID, err := imp.crdb.InsertFeedForUser(imp.u, f, parent.ID)
+		if err != nil {
+			return err
+		}
+		rf.ID = feedID
+		imp.feeds[f.URL] = true
+		imp.feedIDs[f.URL] = feedID
+		if err = imp.applySettings(feedID, f); err != nil {
+			return err
+		}
+		imp.report.CreatedFeeds = append(imp.report.CreatedFeeds, rf)
+	}
+
+	for _, child := range parent.Folders {
+		if child.Name == models.RootFolder {
+			// Nesting the root folder would create a cycle, so import its
+			// contents into the parent instead.
+			imp.report.SkippedFolders = append(imp.report.SkippedFolders,
+				opml.ReportFolder{Name: child.Name, Reason: "reserved folder name"})
+			child.ID = parent.ID
+			child.Name = parent.Name
+			if err := imp.importChildren(child); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, existed := imp.folders[child.Name]
+		childID, err := imp.crdb.InsertFolderForUser(imp.u, child, parent.ID)
+		if err != nil {
+			return err
+		}
+		child.ID = childID
+		imp.folders[child.Name] = childID
+
+		rf := opml.ReportFolder{ID: childID, Name: child.Name}
+		if existed {
+			imp.report.MergedFolders = append(imp.report.MergedFolders, rf)
+		} else {
+			imp.report.CreatedFolders = append(imp.report.CreatedFolders, rf)
+		}
+
+		if err = imp.importChildren(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applySettings stores the custom title and Goliath settings carried in the
+// import for the given feed. Settings are added to those of an existing feed.
+func (imp *opmlImporter) applySettings(feedID int64, f models.Feed) error {
+	if f.CustomTitle != "" {
+		if err := imp.crdb.UpdateCustomTitleForFeedForUser(imp.u, feedID, f.CustomTitle); err != nil {
+			return fmt.Errorf("failed to set custom title: %w", err)
+		}
+	}
+
+	s, ok := imp.settings[f.URL]
+	if !ok {
+		return nil
+	}
+	for _, r := range s.MuteRegexes {
+		if err := imp.crdb.AddMuteRegexForFeedForUser(imp.u, feedID, r); err != nil {
+			return fmt.Errorf("failed to add mute regex: %w", err)
+		}
+	}
+	if s.Unmuted {
+		if err := imp.crdb.UpdateUnmuteFeedsForUser(imp.u, []int64{feedID}); err != nil {
+			return fmt.Errorf("failed to unmute feed: %w", err)
+		}
+	}
+	return nil
 }
 
 /*******************************************************************************
@@ -60,15 +60,22 @@ type Database interface {
 	AddMuteRegexForFeedForUser(models.User, int64, string) error
 	DeleteMuteRegexForFeedForUser(models.User, int64, string) error
 
+	GetStorySettingsForUser(models.User) (models.StorySettings, error)
+	UpdateStorySettingsForUser(models.User, models.StorySettings) error
+
 	// Retrieval cache
 
 	GetActiveFeedKeys() (map[UserFeedKey]bool, error)
 	GetAllRetrievalCaches() (map[UserFeedKey]string, error)
 	PersistAllRetrievalCaches(map[UserFeedKey][]byte) error
 
+	// Server secrets
+
+	GetOrInsertServerSecret(string, []byte) ([]byte, error)
+
 	// Content insertion
 
-	InsertArticleForUser(models.User, models.Article) error
+	InsertArticleForUser(models.User, models.Article) (int64, error)
 	InsertFaviconForUser(models.User, int64, int64, string, []byte) error
 	InsertFeedForUser(models.User, models.Feed, int64) (int64, error)
 	InsertFolderForUser(models.User, models.Folder, int64) (int64, error)
@@ -91,7 +98,15 @@ type Database interface {
 	UpdateLatestTimeForFeedForUser(models.User, int64, int64, time.Time) error
 	UpdateEstimatedRefreshIntervalForFeedForUser(models.User, int64, int64, int) error
 	UpdateFolderForFeedForUser(models.User, int64, int64) error
-	UpdateArticleParsedContentForUser(models.User, int64, string) error
+	UpdateCustomTitleForFeedForUser(models.User, int64, string) error
+	UpdateFetchFullTextForFeedForUser(models.User, int64, bool) error
+	UpdateTransformersForFeedForUser(models.User, int64, []string) error
+	UpdateArticleParsedContentForUser(models.User, int64, string, models.TextStats) error
+	UpdateEnclosurePositionForUser(models.User, int64, string, time.Duration) error
+	UpdateArticleThumbnailForUser(models.User, int64, string) error
+	UpdateArticleArchiveForUser(models.User, int64, string) error
+	UpdateArticleLinkForUser(models.User, int64, string) error
+	UpdateArticleDateForUser(models.User, int64, time.Time) error
 
 	// Content retrieval
 
@@ -107,10 +122,54 @@ type Database interface {
 	GetArticlesForUser(models.User, []int64) ([]models.Article, error)
 	GetArticlesWithFilterForUser(models.User, models.StreamFilter, int, int64) ([]models.Article, error)
 	GetArticlesForFeedForUser(models.User, int64) ([]models.Article, error)
+	GetArticlesWithLinksForFeedForUser(models.User, int64, []string) ([]models.Article, error)
+	GetStoryCandidatesForUser(models.User, int64, time.Time) ([]models.Article, error)
+	GetSavedArticlesForUser(models.User, int64, int) ([]models.Article, error)
+	GetRecentArticlesForUser(models.User, int) ([]models.Article, error)
+	GetUnarchivedSavedArticlesForUser(models.User, int) ([]models.Article, error)
+	GetArticlesInStreamForUser(models.User, models.ArticleStream, int) ([]models.Article, error)
+	GetArchivedArticleIdsForUser(models.User) ([]int64, error)
+
+	// Starred feed tokens
+
+	InsertStarredFeedTokenForUser(models.User, models.StarredFeedToken) error
+	GetStarredFeedTokensForUser(models.User) ([]models.StarredFeedToken, error)
+	DeleteStarredFeedTokenForUser(models.User, string) error
+	GetUserByStarredFeedToken(string) (models.User, models.StarredFeedToken, error)
+
+	// Rules
+
+	GetRulesForUser(models.User) ([]models.Rule, error)
+	InsertRuleForUser(models.User, models.Rule) (int64, error)
+	DeleteRuleForUser(models.User, int64) error
+
+	// Webhooks
+
+	GetWebhooksForUser(models.User) ([]models.Webhook, error)
+	InsertWebhookForUser(models.User, models.Webhook) (int64, error)
+	DeleteWebhookForUser(models.User, int64) error
+	InsertWebhookDeliveryForUser(models.User, models.WebhookDelivery) (int64, error)
+	UpdateWebhookDeliveryForUser(models.User, models.WebhookDelivery) error
+	GetWebhookDeliveriesForUser(models.User, string, int) ([]models.WebhookDelivery, error)
+
+	// Digests
+
+	GetDigestSettingsForUser(models.User) (models.DigestSettings, error)
+	UpdateDigestSettingsForUser(models.User, models.DigestSettings) error
+	UpdateDigestLastSentForUser(models.User, time.Time) error
+	GetDigestArticlesForUser(models.User, time.Time, []string, int) ([]models.Article, error)
+
+	// Newsletter addresses
+
+	InsertNewsletterAddressForUser(models.User, string) error
+	GetNewsletterAddressesForUser(models.User) ([]models.NewsletterAddress, error)
+	DeleteNewsletterAddressForUser(models.User, string) error
+	GetUserByNewsletterAddress(string) (models.User, error)
 
 	// OPML
 
-	ImportOpmlForUser(models.User, *opml.Opml) error
+	ImportOpmlForUser(models.User, *opml.Opml) (opml.ImportReport, error)
+	ExportOpmlForUser(models.User) (*opml.Opml, error)
 }
 
 // Open creates a new database instance and returns a pointer to it.
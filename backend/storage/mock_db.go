@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"time"
 
 	"github.com/jrupac/goliath/models"
@@ -27,12 +28,50 @@ type MockDB struct {
 	// Function overrides
 	OnGetArticlesForFeedForUser func(u models.User, feedID int64) ([]models.Article, error)
 	OnGetArticlesForUser        func(u models.User, ids []int64) ([]models.Article, error)
-	OnUpdateArticleParsedContentForUser func(u models.User, articleID int64, parsed string) error
+	OnInsertArticleForUser      func(u models.User, a models.Article) (int64, error)
+	OnGetArticleMetaWithFilterForUser func(u models.User, filter models.StreamFilter, limit int, sinceID int64) ([]models.ArticleMeta, error)
+	OnGetArticlesWithLinksForFeedForUser func(u models.User, feedID int64, links []string) ([]models.Article, error)
+	OnGetStoryCandidatesForUser func(u models.User, feedID int64, since time.Time) ([]models.Article, error)
+	OnGetStorySettingsForUser   func(u models.User) (models.StorySettings, error)
+	OnUpdateArticleParsedContentForUser func(u models.User, articleID int64, parsed string, stats models.TextStats) error
+	OnUpdateEnclosurePositionForUser func(u models.User, articleID int64, url string, position time.Duration) error
+	OnUpdateArticleThumbnailForUser  func(u models.User, articleID int64, thumbnail string) error
+	OnUpdateArticleArchiveForUser    func(u models.User, articleID int64, archived string) error
+	OnUpdateArticleLinkForUser       func(u models.User, articleID int64, link string) error
+	OnUpdateArticleDateForUser       func(u models.User, articleID int64, date time.Time) error
+	OnGetUnarchivedSavedArticlesForUser func(u models.User, limit int) ([]models.Article, error)
+	OnGetArchivedArticleIdsForUser      func(u models.User) ([]int64, error)
+	OnGetArticlesInStreamForUser        func(u models.User, s models.ArticleStream, limit int) ([]models.Article, error)
 	OnGetAllUsers               func() ([]models.User, error)
 	OnGetAllFeedsForUser        func(u models.User) ([]models.Feed, error)
 	OnGetAllRetrievalCaches     func() (map[UserFeedKey]string, error)
 	OnGetActiveFeedKeys         func() (map[UserFeedKey]bool, error)
+	OnGetOrInsertServerSecret   func(name string, value []byte) ([]byte, error)
 	OnUpdateEstimatedRefreshIntervalForFeedForUser func(u models.User, folderId, id int64, interval int) error
+	OnGetAllFoldersForUser                         func(u models.User) ([]models.Folder, error)
+	OnGetFolderChildrenForUser                     func(u models.User, id int64) ([]int64, error)
+	OnGetSavedArticlesForUser                      func(u models.User, folderId int64, limit int) ([]models.Article, error)
+	OnGetUserByStarredFeedToken                    func(token string) (models.User, models.StarredFeedToken, error)
+	OnImportOpmlForUser                            func(u models.User, o *opml.Opml) (opml.ImportReport, error)
+	OnGetUserByKey                                 func(key string) (models.User, error)
+	OnExportOpmlForUser                            func(u models.User) (*opml.Opml, error)
+	OnGetAllFaviconsForUser                        func(u models.User) (map[int64]string, error)
+	OnGetMuteWordsForUser                          func(u models.User) ([]string, error)
+	OnUpdateMuteWordsForUser                       func(u models.User, words []string) error
+	OnMarkArticleForUser                           func(u models.User, id int64, mark models.MarkAction) error
+	OnGetRulesForUser                              func(u models.User) ([]models.Rule, error)
+	OnGetRecentArticlesForUser                     func(u models.User, limit int) ([]models.Article, error)
+	OnGetWebhooksForUser                           func(u models.User) ([]models.Webhook, error)
+	OnInsertWebhookDeliveryForUser                 func(u models.User, d models.WebhookDelivery) (int64, error)
+	OnUpdateWebhookDeliveryForUser                 func(u models.User, d models.WebhookDelivery) error
+	OnGetWebhookDeliveriesForUser                  func(u models.User, status string, limit int) ([]models.WebhookDelivery, error)
+	OnGetFolderFeedTreeForUser                     func(u models.User) (*models.Folder, error)
+	OnGetDigestSettingsForUser                     func(u models.User) (models.DigestSettings, error)
+	OnUpdateDigestLastSentForUser                  func(u models.User, t time.Time) error
+	OnGetDigestArticlesForUser                     func(u models.User, since time.Time, labels []string, limit int) ([]models.Article, error)
+	OnGetUserByNewsletterAddress                   func(token string) (models.User, error)
+	OnInsertFeedForUser                            func(u models.User, f models.Feed, folderId int64) (int64, error)
+	OnInsertFolderForUser                          func(u models.User, f models.Folder, parentId int64) (int64, error)
 }
 
 func (m *MockDB) Open(string) error            { return nil }
@@ -50,10 +89,26 @@ func (m *MockDB) GetAllUsers() ([]models.User, error) {
 	return nil, nil
 }
 
-func (m *MockDB) GetUserByKey(string) (models.User, error)            { return models.User{}, nil }
+func (m *MockDB) GetUserByKey(key string) (models.User, error) {
+	if m.OnGetUserByKey != nil {
+		return m.OnGetUserByKey(key)
+	}
+	return models.User{}, nil
+}
+
 func (m *MockDB) GetUserByUsername(string) (models.User, error)       { return models.User{}, nil }
-func (m *MockDB) GetMuteWordsForUser(models.User) ([]string, error)   { return nil, nil }
-func (m *MockDB) UpdateMuteWordsForUser(models.User, []string) error  { return nil }
+func (m *MockDB) GetMuteWordsForUser(u models.User) ([]string, error) {
+	if m.OnGetMuteWordsForUser != nil {
+		return m.OnGetMuteWordsForUser(u)
+	}
+	return nil, nil
+}
+func (m *MockDB) UpdateMuteWordsForUser(u models.User, words []string) error {
+	if m.OnUpdateMuteWordsForUser != nil {
+		return m.OnUpdateMuteWordsForUser(u, words)
+	}
+	return nil
+}
 func (m *MockDB) DeleteMuteWordsForUser(models.User, []string) error  { return nil }
 func (m *MockDB) GetUnmuteFeedsForUser(models.User) ([]int64, error)  { return nil, nil }
 func (m *MockDB) UpdateUnmuteFeedsForUser(models.User, []int64) error { return nil }
@@ -64,6 +119,14 @@ func (m *MockDB) GetMuteRegexesForFeedForUser(models.User, int64) ([]string, err
 func (m *MockDB) AddMuteRegexForFeedForUser(models.User, int64, string) error         { return nil }
 func (m *MockDB) DeleteMuteRegexForFeedForUser(models.User, int64, string) error      { return nil }
 
+func (m *MockDB) GetStorySettingsForUser(u models.User) (models.StorySettings, error) {
+	if m.OnGetStorySettingsForUser != nil {
+		return m.OnGetStorySettingsForUser(u)
+	}
+	return models.StorySettings{}, nil
+}
+func (m *MockDB) UpdateStorySettingsForUser(models.User, models.StorySettings) error { return nil }
+
 func (m *MockDB) GetActiveFeedKeys() (map[UserFeedKey]bool, error) {
 	if m.OnGetActiveFeedKeys != nil {
 		return m.OnGetActiveFeedKeys()
@@ -77,16 +140,31 @@ func (m *MockDB) GetAllRetrievalCaches() (map[UserFeedKey]string, error) {
 	return nil, nil
 }
 func (m *MockDB) PersistAllRetrievalCaches(map[UserFeedKey][]byte) error { return nil }
-func (m *MockDB) InsertFeedForUser(models.User, models.Feed, int64) (int64, error) {
+func (m *MockDB) GetOrInsertServerSecret(name string, value []byte) ([]byte, error) {
+	if m.OnGetOrInsertServerSecret != nil {
+		return m.OnGetOrInsertServerSecret(name, value)
+	}
+	return value, nil
+}
+func (m *MockDB) InsertFeedForUser(u models.User, f models.Feed, folderId int64) (int64, error) {
+	if m.OnInsertFeedForUser != nil {
+		return m.OnInsertFeedForUser(u, f, folderId)
+	}
 	return 0, nil
 }
-func (m *MockDB) InsertFolderForUser(models.User, models.Folder, int64) (int64, error) {
+func (m *MockDB) InsertFolderForUser(u models.User, f models.Folder, parentId int64) (int64, error) {
+	if m.OnInsertFolderForUser != nil {
+		return m.OnInsertFolderForUser(u, f, parentId)
+	}
 	return 0, nil
 }
 func (m *MockDB) DeleteArticlesForUser(models.User, time.Time) (int64, error) { return 0, nil }
 func (m *MockDB) DeleteArticlesByIdForUser(models.User, []int64) error        { return nil }
 func (m *MockDB) DeleteFeedForUser(models.User, int64, int64) error           { return nil }
-func (m *MockDB) MarkArticleForUser(models.User, int64, models.MarkAction) error {
+func (m *MockDB) MarkArticleForUser(u models.User, id int64, mark models.MarkAction) error {
+	if m.OnMarkArticleForUser != nil {
+		return m.OnMarkArticleForUser(u, id, mark)
+	}
 	return nil
 }
 func (m *MockDB) MarkFeedForUser(models.User, int64, models.MarkAction) (int64, error) {
@@ -105,10 +183,21 @@ func (m *MockDB) UpdateEstimatedRefreshIntervalForFeedForUser(u models.User, fol
 	return nil
 }
 func (m *MockDB) UpdateFolderForFeedForUser(models.User, int64, int64) error { return nil }
-func (m *MockDB) GetFolderChildrenForUser(models.User, int64) ([]int64, error) {
+func (m *MockDB) UpdateCustomTitleForFeedForUser(models.User, int64, string) error { return nil }
+func (m *MockDB) UpdateFetchFullTextForFeedForUser(models.User, int64, bool) error { return nil }
+func (m *MockDB) UpdateTransformersForFeedForUser(models.User, int64, []string) error { return nil }
+func (m *MockDB) GetFolderChildrenForUser(u models.User, id int64) ([]int64, error) {
+	if m.OnGetFolderChildrenForUser != nil {
+		return m.OnGetFolderChildrenForUser(u, id)
+	}
+	return nil, nil
+}
+func (m *MockDB) GetAllFoldersForUser(u models.User) ([]models.Folder, error) {
+	if m.OnGetAllFoldersForUser != nil {
+		return m.OnGetAllFoldersForUser(u)
+	}
 	return nil, nil
 }
-func (m *MockDB) GetAllFoldersForUser(models.User) ([]models.Folder, error) { return nil, nil }
 
 func (m *MockDB) GetAllFeedsForUser(u models.User) ([]models.Feed, error) {
 	if m.OnGetAllFeedsForUser != nil {
@@ -123,13 +212,22 @@ func (m *MockDB) GetFeedsInFolderForUser(models.User, int64) ([]models.Feed, err
 func (m *MockDB) GetFeedsPerFolderForUser(models.User) (map[int64][]int64, error) {
 	return nil, nil
 }
-func (m *MockDB) GetFolderFeedTreeForUser(models.User) (*models.Folder, error) {
+func (m *MockDB) GetFolderFeedTreeForUser(u models.User) (*models.Folder, error) {
+	if m.OnGetFolderFeedTreeForUser != nil {
+		return m.OnGetFolderFeedTreeForUser(u)
+	}
 	return nil, nil
 }
-func (m *MockDB) GetAllFaviconsForUser(models.User) (map[int64]string, error) {
+func (m *MockDB) GetAllFaviconsForUser(u models.User) (map[int64]string, error) {
+	if m.OnGetAllFaviconsForUser != nil {
+		return m.OnGetAllFaviconsForUser(u)
+	}
 	return nil, nil
 }
-func (m *MockDB) GetArticleMetaWithFilterForUser(models.User, models.StreamFilter, int, int64) ([]models.ArticleMeta, error) {
+func (m *MockDB) GetArticleMetaWithFilterForUser(u models.User, filter models.StreamFilter, limit int, sinceID int64) ([]models.ArticleMeta, error) {
+	if m.OnGetArticleMetaWithFilterForUser != nil {
+		return m.OnGetArticleMetaWithFilterForUser(u, filter, limit, sinceID)
+	}
 	return nil, nil
 }
 func (m *MockDB) GetArticlesForUser(u models.User, ids []int64) ([]models.Article, error) {
@@ -141,7 +239,113 @@ func (m *MockDB) GetArticlesForUser(u models.User, ids []int64) ([]models.Articl
 func (m *MockDB) GetArticlesWithFilterForUser(models.User, models.StreamFilter, int, int64) ([]models.Article, error) {
 	return nil, nil
 }
-func (m *MockDB) ImportOpmlForUser(models.User, *opml.Opml) error { return nil }
+func (m *MockDB) GetSavedArticlesForUser(u models.User, folderId int64, limit int) ([]models.Article, error) {
+	if m.OnGetSavedArticlesForUser != nil {
+		return m.OnGetSavedArticlesForUser(u, folderId, limit)
+	}
+	return nil, nil
+}
+func (m *MockDB) ImportOpmlForUser(u models.User, o *opml.Opml) (opml.ImportReport, error) {
+	if m.OnImportOpmlForUser != nil {
+		return m.OnImportOpmlForUser(u, o)
+	}
+	return opml.ImportReport{}, nil
+}
+func (m *MockDB) ExportOpmlForUser(u models.User) (*opml.Opml, error) {
+	if m.OnExportOpmlForUser != nil {
+		return m.OnExportOpmlForUser(u)
+	}
+	return &opml.Opml{}, nil
+}
+
+func (m *MockDB) GetRecentArticlesForUser(u models.User, limit int) ([]models.Article, error) {
+	if m.OnGetRecentArticlesForUser != nil {
+		return m.OnGetRecentArticlesForUser(u, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) GetRulesForUser(u models.User) ([]models.Rule, error) {
+	if m.OnGetRulesForUser != nil {
+		return m.OnGetRulesForUser(u)
+	}
+	return nil, nil
+}
+func (m *MockDB) InsertRuleForUser(models.User, models.Rule) (int64, error) { return 0, nil }
+func (m *MockDB) DeleteRuleForUser(models.User, int64) error               { return nil }
+
+func (m *MockDB) GetWebhooksForUser(u models.User) ([]models.Webhook, error) {
+	if m.OnGetWebhooksForUser != nil {
+		return m.OnGetWebhooksForUser(u)
+	}
+	return nil, nil
+}
+func (m *MockDB) InsertWebhookForUser(models.User, models.Webhook) (int64, error) { return 0, nil }
+func (m *MockDB) DeleteWebhookForUser(models.User, int64) error                  { return nil }
+func (m *MockDB) InsertWebhookDeliveryForUser(u models.User, d models.WebhookDelivery) (int64, error) {
+	if m.OnInsertWebhookDeliveryForUser != nil {
+		return m.OnInsertWebhookDeliveryForUser(u, d)
+	}
+	return 0, nil
+}
+func (m *MockDB) UpdateWebhookDeliveryForUser(u models.User, d models.WebhookDelivery) error {
+	if m.OnUpdateWebhookDeliveryForUser != nil {
+		return m.OnUpdateWebhookDeliveryForUser(u, d)
+	}
+	return nil
+}
+func (m *MockDB) GetWebhookDeliveriesForUser(u models.User, status string, limit int) ([]models.WebhookDelivery, error) {
+	if m.OnGetWebhookDeliveriesForUser != nil {
+		return m.OnGetWebhookDeliveriesForUser(u, status, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) GetDigestSettingsForUser(u models.User) (models.DigestSettings, error) {
+	if m.OnGetDigestSettingsForUser != nil {
+		return m.OnGetDigestSettingsForUser(u)
+	}
+	return models.DigestSettings{}, nil
+}
+func (m *MockDB) UpdateDigestSettingsForUser(models.User, models.DigestSettings) error { return nil }
+func (m *MockDB) UpdateDigestLastSentForUser(u models.User, t time.Time) error {
+	if m.OnUpdateDigestLastSentForUser != nil {
+		return m.OnUpdateDigestLastSentForUser(u, t)
+	}
+	return nil
+}
+func (m *MockDB) GetDigestArticlesForUser(u models.User, since time.Time, labels []string, limit int) ([]models.Article, error) {
+	if m.OnGetDigestArticlesForUser != nil {
+		return m.OnGetDigestArticlesForUser(u, since, labels, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) InsertNewsletterAddressForUser(models.User, string) error { return nil }
+func (m *MockDB) GetNewsletterAddressesForUser(models.User) ([]models.NewsletterAddress, error) {
+	return nil, nil
+}
+func (m *MockDB) DeleteNewsletterAddressForUser(models.User, string) error { return nil }
+func (m *MockDB) GetUserByNewsletterAddress(token string) (models.User, error) {
+	if m.OnGetUserByNewsletterAddress != nil {
+		return m.OnGetUserByNewsletterAddress(token)
+	}
+	return models.User{}, errors.New("could not find address")
+}
+
+func (m *MockDB) InsertStarredFeedTokenForUser(models.User, models.StarredFeedToken) error {
+	return nil
+}
+func (m *MockDB) GetStarredFeedTokensForUser(models.User) ([]models.StarredFeedToken, error) {
+	return nil, nil
+}
+func (m *MockDB) DeleteStarredFeedTokenForUser(models.User, string) error { return nil }
+func (m *MockDB) GetUserByStarredFeedToken(token string) (models.User, models.StarredFeedToken, error) {
+	if m.OnGetUserByStarredFeedToken != nil {
+		return m.OnGetUserByStarredFeedToken(token)
+	}
+	return models.User{}, models.StarredFeedToken{}, errors.New("could not find token")
+}
 
 // Methods with mock implementations
 
@@ -155,12 +359,15 @@ func (m *MockDB) InsertFaviconForUser(u models.User, folderId, id int64, mime st
 	return m.InsertFaviconForUserErr
 }
 
-func (m *MockDB) InsertArticleForUser(u models.User, a models.Article) error {
+func (m *MockDB) InsertArticleForUser(u models.User, a models.Article) (int64, error) {
+	if m.OnInsertArticleForUser != nil {
+		return m.OnInsertArticleForUser(u, a)
+	}
 	m.InsertedArticles = append(m.InsertedArticles, a)
 	if m.ProcessItemsCalled != nil {
 		m.ProcessItemsCalled <- true
 	}
-	return nil
+	return int64(len(m.InsertedArticles)), nil
 }
 
 func (m *MockDB) GetArticlesForFeedForUser(u models.User, feedID int64) ([]models.Article, error) {
@@ -170,9 +377,79 @@ func (m *MockDB) GetArticlesForFeedForUser(u models.User, feedID int64) ([]model
 	return []models.Article{}, nil
 }
 
-func (m *MockDB) UpdateArticleParsedContentForUser(u models.User, articleID int64, parsed string) error {
+func (m *MockDB) GetArticlesWithLinksForFeedForUser(u models.User, feedID int64, links []string) ([]models.Article, error) {
+	if m.OnGetArticlesWithLinksForFeedForUser != nil {
+		return m.OnGetArticlesWithLinksForFeedForUser(u, feedID, links)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) GetStoryCandidatesForUser(u models.User, feedID int64, since time.Time) ([]models.Article, error) {
+	if m.OnGetStoryCandidatesForUser != nil {
+		return m.OnGetStoryCandidatesForUser(u, feedID, since)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) UpdateArticleParsedContentForUser(u models.User, articleID int64, parsed string, stats models.TextStats) error {
 	if m.OnUpdateArticleParsedContentForUser != nil {
-		return m.OnUpdateArticleParsedContentForUser(u, articleID, parsed)
+		return m.OnUpdateArticleParsedContentForUser(u, articleID, parsed, stats)
+	}
+	return nil
+}
+
+func (m *MockDB) UpdateEnclosurePositionForUser(u models.User, articleID int64, url string, position time.Duration) error {
+	if m.OnUpdateEnclosurePositionForUser != nil {
+		return m.OnUpdateEnclosurePositionForUser(u, articleID, url, position)
 	}
 	return nil
 }
+
+func (m *MockDB) UpdateArticleThumbnailForUser(u models.User, articleID int64, thumbnail string) error {
+	if m.OnUpdateArticleThumbnailForUser != nil {
+		return m.OnUpdateArticleThumbnailForUser(u, articleID, thumbnail)
+	}
+	return nil
+}
+
+func (m *MockDB) UpdateArticleArchiveForUser(u models.User, articleID int64, archived string) error {
+	if m.OnUpdateArticleArchiveForUser != nil {
+		return m.OnUpdateArticleArchiveForUser(u, articleID, archived)
+	}
+	return nil
+}
+
+func (m *MockDB) UpdateArticleLinkForUser(u models.User, articleID int64, link string) error {
+	if m.OnUpdateArticleLinkForUser != nil {
+		return m.OnUpdateArticleLinkForUser(u, articleID, link)
+	}
+	return nil
+}
+
+func (m *MockDB) UpdateArticleDateForUser(u models.User, articleID int64, date time.Time) error {
+	if m.OnUpdateArticleDateForUser != nil {
+		return m.OnUpdateArticleDateForUser(u, articleID, date)
+	}
+	return nil
+}
+
+func (m *MockDB) GetUnarchivedSavedArticlesForUser(u models.User, limit int) ([]models.Article, error) {
+	if m.OnGetUnarchivedSavedArticlesForUser != nil {
+		return m.OnGetUnarchivedSavedArticlesForUser(u, limit)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) GetArchivedArticleIdsForUser(u models.User) ([]int64, error) {
+	if m.OnGetArchivedArticleIdsForUser != nil {
+		return m.OnGetArchivedArticleIdsForUser(u)
+	}
+	return nil, nil
+}
+
+func (m *MockDB) GetArticlesInStreamForUser(u models.User, s models.ArticleStream, limit int) ([]models.Article, error) {
+	if m.OnGetArticlesInStreamForUser != nil {
+		return m.OnGetArticlesInStreamForUser(u, s, limit)
+	}
+	return nil, nil
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPrivateIP(t *testing.T) {
+	tests := []struct {
+		ip   net.IP
+		want bool
+	}{
+		{net.ParseIP("127.0.0.1"), true},
+		{net.ParseIP("::1"), true},
+		{net.ParseIP("10.0.0.1"), true},
+		{net.ParseIP("172.16.0.1"), true},
+		{net.ParseIP("192.168.1.1"), true},
+		{net.ParseIP("100.64.0.1"), true},
+		{net.ParseIP("100.127.255.255"), true},
+		{net.ParseIP("100.128.0.1"), false},
+		{net.ParseIP("8.8.8.8"), false},
+		{net.ParseIP("1.1.1.1"), false},
+		{nil, true},
+	}
+
+	for _, tt := range tests {
+		got := IsPrivateIP(tt.ip)
+		if got != tt.want {
+			t.Errorf("IsPrivateIP(%v) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var addRuleCmd = &cobra.Command{
+	Use:   "add-rule",
+	Short: "Add a rule applied to new articles, or test one against recent articles",
+	Long: `Add a rule applied to new articles as they are fetched. A rule matches an
+article if all of its conditions match, and takes all of its actions on the
+matching articles.
+
+With --test, the rule is not added but is instead tested against the most
+recently retrieved articles, and the matching articles are listed.`,
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		flags := cmd.Flags()
+		name, _ := flags.GetString("name")
+		feedIDs, _ := flags.GetInt64Slice("feed-id")
+		folderIDs, _ := flags.GetInt64Slice("folder-id")
+		titleRegex, _ := flags.GetString("title-regex")
+		contentRegex, _ := flags.GetString("content-regex")
+		linkDomains, _ := flags.GetStringSlice("link-domain")
+		authorRegex, _ := flags.GetString("author-regex")
+		categories, _ := flags.GetStringSlice("category")
+		minAge, _ := flags.GetDuration("min-age")
+		mute, _ := flags.GetBool("mute")
+		markRead, _ := flags.GetBool("mark-read")
+		star, _ := flags.GetBool("star")
+		labels, _ := flags.GetStringSlice("label")
+		priority, _ := flags.GetBool("priority")
+		fetchFullText, _ := flags.GetBool("fetch-full-text")
+		test, _ := flags.GetBool("test")
+		testLimit, _ := flags.GetInt32("test-limit")
+
+		if name == "" {
+			name = promptForInput("Enter rule name:")
+			if name == "" {
+				fmt.Println("No name provided. Aborting.")
+				return
+			}
+		}
+
+		rule := &admin.Rule{
+			Name:          name,
+			FeedId:        feedIDs,
+			FolderId:      folderIDs,
+			TitleRegex:    titleRegex,
+			ContentRegex:  contentRegex,
+			LinkDomain:    linkDomains,
+			AuthorRegex:   authorRegex,
+			Category:      categories,
+			Mute:          mute,
+			MarkRead:      markRead,
+			Star:          star,
+			Label:         labels,
+			Priority:      priority,
+			FetchFullText: fetchFullText,
+		}
+		if minAge > 0 {
+			rule.MinAge = minAge.String()
+		}
+
+		if test {
+			res, err := client.TestRule(context.Background(), &admin.TestRuleRequest{
+				Username: user,
+				Rule:     rule,
+				Limit:    testLimit,
+			})
+			if err != nil {
+				fmt.Printf("Error calling TestRule: %v\n", err)
+				return
+			}
+
+			fmt.Printf("Rule matched %d of %d recent articles for user: %s\n", len(res.Matched), res.Tested, user)
+			for _, a := range res.Matched {
+				fmt.Printf("  - [%s] %s (feed %d)\n    %s\n",
+					time.Unix(a.Date, 0).Format(time.DateOnly), a.Title, a.FeedId, a.Link)
+			}
+			return
+		}
+
+		res, err := client.AddRule(context.Background(), &admin.AddRuleRequest{Username: user, Rule: rule})
+		if err != nil {
+			fmt.Printf("Error calling AddRule: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Successfully added rule %q (ID: %d) for user: %s\n", name, res.Id, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addRuleCmd)
+	addGrpcAddressFlag(addRuleCmd)
+	addUserFlag(addRuleCmd)
+
+	flags := addRuleCmd.Flags()
+	flags.String("name", "", "Name of the rule")
+	flags.Int64Slice("feed-id", nil, "Match articles in these feeds")
+	flags.Int64Slice("folder-id", nil, "Match articles in feeds directly under these folders")
+	flags.String("title-regex", "", "Match articles whose title matches this case-insensitive regex")
+	flags.String("content-regex", "", "Match articles whose contents match this case-insensitive regex")
+	flags.StringSlice("link-domain", nil, "Match articles linking to these domains or their subdomains")
+	flags.String("author-regex", "", "Match articles with an author matching this case-insensitive regex")
+	flags.StringSlice("category", nil, "Match articles in any of these feed categories")
+	flags.Duration("min-age", 0, "Match articles published longer ago than this duration")
+	flags.Bool("mute", false, "Drop matching articles")
+	flags.Bool("mark-read", false, "Mark matching articles as read")
+	flags.Bool("star", false, "Mark matching articles as saved")
+	flags.StringSlice("label", nil, "Add these labels to matching articles")
+	flags.Bool("priority", false, "Mark matching articles as priority, shown in the Priority label of GReader clients")
+	flags.Bool("fetch-full-text", false, "Extract the full text of matching articles")
+	flags.Bool("test", false, "Test the rule against recent articles instead of adding it")
+	flags.Int32("test-limit", 100, "Number of recent articles to test the rule against")
+}
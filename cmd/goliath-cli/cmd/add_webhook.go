@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var addWebhookCmd = &cobra.Command{
+	Use:   "add-webhook",
+	Short: "Add an outgoing webhook fired for new articles",
+	Long: `Add an outgoing webhook that is fired for each new article matching its
+filter as the article is fetched. An article matches if all of the given
+filter conditions match, and a webhook without conditions fires for every
+article.
+
+Payloads are posted as JSON unless a template is given, and are signed with
+HMAC-SHA256 using the webhook's secret in the X-Goliath-Signature header.`,
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		flags := cmd.Flags()
+		url, _ := flags.GetString("url")
+		secret, _ := flags.GetString("secret")
+		feedIDs, _ := flags.GetInt64Slice("feed-id")
+		folderIDs, _ := flags.GetInt64Slice("folder-id")
+		keywords, _ := flags.GetStringSlice("keyword")
+		ruleIDs, _ := flags.GetInt64Slice("rule-id")
+		templateFile, _ := flags.GetString("template-file")
+
+		if url == "" {
+			url = promptForInput("Enter webhook URL:")
+			if url == "" {
+				fmt.Println("No URL provided. Aborting.")
+				return
+			}
+		}
+
+		var template string
+		if templateFile != "" {
+			b, err := os.ReadFile(templateFile)
+			if err != nil {
+				fmt.Printf("Error reading template file: %v\n", err)
+				return
+			}
+			template = string(b)
+		}
+
+		res, err := client.AddWebhook(context.Background(), &admin.AddWebhookRequest{
+			Username: user,
+			Webhook: &admin.Webhook{
+				URL:      url,
+				Secret:   secret,
+				FeedId:   feedIDs,
+				FolderId: folderIDs,
+				Keyword:  keywords,
+				RuleId:   ruleIDs,
+				Template: template,
+			},
+		})
+		if err != nil {
+			fmt.Printf("Error calling AddWebhook: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Successfully added webhook (ID: %d) for user: %s\n", res.Id, user)
+		if secret == "" {
+			fmt.Printf("Signing secret: %s\n", res.Secret)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addWebhookCmd)
+	addGrpcAddressFlag(addWebhookCmd)
+	addUserFlag(addWebhookCmd)
+
+	flags := addWebhookCmd.Flags()
+	flags.String("url", "", "URL that payloads are posted to")
+	flags.String("secret", "", "Secret used to sign payloads (generated if not given)")
+	flags.Int64Slice("feed-id", nil, "Fire for articles in these feeds")
+	flags.Int64Slice("folder-id", nil, "Fire for articles in feeds directly under these folders")
+	flags.StringSlice("keyword", nil, "Fire for articles containing any of these keywords")
+	flags.Int64Slice("rule-id", nil, "Fire for articles matching any of these rules")
+	flags.String("template-file", "", "Path to a Go text/template file that renders the payload")
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var createNewsletterAddressCmd = &cobra.Command{
+	Use:     "create-newsletter-address",
+	Short:   "Create an address at which a user receives email newsletters",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.CreateNewsletterAddress(context.Background(), &admin.CreateNewsletterAddressRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error creating newsletter address: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Created newsletter address for user: %s\n", user)
+		fmt.Printf("  Address: %s\n", res.Address)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(createNewsletterAddressCmd)
+	addGrpcAddressFlag(createNewsletterAddressCmd)
+	addUserFlag(createNewsletterAddressCmd)
+}
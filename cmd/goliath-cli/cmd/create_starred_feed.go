@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var createStarredFeedCmd = &cobra.Command{
+	Use:     "create-starred-feed",
+	Short:   "Create a private Atom feed of saved articles for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		folder, _ := cmd.Flags().GetString("folder")
+
+		res, err := client.CreateStarredFeedToken(context.Background(), &admin.CreateStarredFeedTokenRequest{
+			Username: user,
+			Folder:   folder,
+		})
+		if err != nil {
+			fmt.Printf("Error creating starred feed: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Created starred feed for user: %s\n", user)
+		fmt.Printf("  Token: %s\n", res.Token)
+		fmt.Printf("  Path:  %s\n", res.Path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(createStarredFeedCmd)
+	addGrpcAddressFlag(createStarredFeedCmd)
+	addUserFlag(createStarredFeedCmd)
+	createStarredFeedCmd.Flags().String("folder", "", "Only include saved articles in this folder")
+}
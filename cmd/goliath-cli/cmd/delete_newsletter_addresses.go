@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var deleteNewsletterAddressesCmd = &cobra.Command{
+	Use:     "delete-newsletter-addresses",
+	Short:   "Delete one or more addresses at which a user receives email newsletters",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		var selectedTokens []string
+		if address, _ := cmd.Flags().GetString("address"); address != "" {
+			selectedTokens = []string{address}
+		} else {
+			res, err := client.GetNewsletterAddresses(context.Background(), &admin.GetNewsletterAddressesRequest{Username: user})
+			if err != nil {
+				fmt.Printf("Error fetching newsletter addresses: %v\n", err)
+				return
+			}
+
+			if len(res.Addresses) == 0 {
+				fmt.Println("No newsletter addresses found for user:", user)
+				return
+			}
+
+			var choices []string
+			choiceToToken := make(map[string]string)
+			for _, a := range res.Addresses {
+				choices = append(choices, a.Address)
+				choiceToToken[a.Address] = a.Token
+			}
+
+			selectedChoices := promptForChecklist("Select newsletter addresses to delete:", choices)
+			if len(selectedChoices) == 0 {
+				fmt.Println("No newsletter addresses selected. Aborting.")
+				return
+			}
+			for _, choice := range selectedChoices {
+				selectedTokens = append(selectedTokens, choiceToToken[choice])
+			}
+		}
+
+		successCount := 0
+		for _, token := range selectedTokens {
+			_, err := client.DeleteNewsletterAddress(context.Background(), &admin.DeleteNewsletterAddressRequest{
+				Username: user,
+				Token:    token,
+			})
+			if err != nil {
+				fmt.Printf("Error deleting newsletter address %s: %v\n", token, err)
+				continue
+			}
+			successCount++
+		}
+
+		fmt.Printf("Successfully deleted %d newsletter address(es) for user: %s\n", successCount, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteNewsletterAddressesCmd)
+	addGrpcAddressFlag(deleteNewsletterAddressesCmd)
+	addUserFlag(deleteNewsletterAddressesCmd)
+	deleteNewsletterAddressesCmd.Flags().String("address", "", "Newsletter address (or its token) to delete")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var deleteRulesCmd = &cobra.Command{
+	Use:     "delete-rules",
+	Short:   "Delete one or more rules applied to new articles",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		var ids []int64
+		if id, _ := cmd.Flags().GetInt64("id"); id != 0 {
+			ids = []int64{id}
+		} else {
+			res, err := client.GetRules(context.Background(), &admin.GetRulesRequest{Username: user})
+			if err != nil {
+				fmt.Printf("Error fetching rules: %v\n", err)
+				return
+			}
+
+			if len(res.Rules) == 0 {
+				fmt.Println("No rules found for user:", user)
+				return
+			}
+
+			var choices []string
+			choiceToID := make(map[string]int64)
+			for _, r := range res.Rules {
+				choice := fmt.Sprintf("%s (ID: %d): if %s then %s", r.Name, r.Id, describeRuleConditions(r), describeRuleActions(r))
+				choices = append(choices, choice)
+				choiceToID[choice] = r.Id
+			}
+
+			selectedChoices := promptForChecklist("Select rules to delete:", choices)
+			if len(selectedChoices) == 0 {
+				fmt.Println("No rules selected. Aborting.")
+				return
+			}
+			for _, choice := range selectedChoices {
+				ids = append(ids, choiceToID[choice])
+			}
+		}
+
+		successCount := 0
+		for _, id := range ids {
+			_, err := client.DeleteRule(context.Background(), &admin.DeleteRuleRequest{Username: user, Id: id})
+			if err != nil {
+				fmt.Printf("Error deleting rule %d: %v\n", id, err)
+				continue
+			}
+			successCount++
+		}
+
+		fmt.Printf("Successfully deleted %d rules for user: %s\n", successCount, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteRulesCmd)
+	addGrpcAddressFlag(deleteRulesCmd)
+	addUserFlag(deleteRulesCmd)
+	deleteRulesCmd.Flags().Int64("id", 0, "ID of the rule to delete")
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var deleteWebhooksCmd = &cobra.Command{
+	Use:     "delete-webhooks",
+	Short:   "Delete one or more outgoing webhooks",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		var ids []int64
+		if id, _ := cmd.Flags().GetInt64("id"); id != 0 {
+			ids = []int64{id}
+		} else {
+			res, err := client.GetWebhooks(context.Background(), &admin.GetWebhooksRequest{Username: user})
+			if err != nil {
+				fmt.Printf("Error fetching webhooks: %v\n", err)
+				return
+			}
+
+			if len(res.Webhooks) == 0 {
+				fmt.Println("No webhooks found for user:", user)
+				return
+			}
+
+			var choices []string
+			choiceToID := make(map[string]int64)
+			for _, w := range res.Webhooks {
+				choice := fmt.Sprintf("%s (ID: %d): for %s", w.URL, w.Id, describeWebhookFilter(w))
+				choices = append(choices, choice)
+				choiceToID[choice] = w.Id
+			}
+
+			selectedChoices := promptForChecklist("Select webhooks to delete:", choices)
+			if len(selectedChoices) == 0 {
+				fmt.Println("No webhooks selected. Aborting.")
+				return
+			}
+			for _, choice := range selectedChoices {
+				ids = append(ids, choiceToID[choice])
+			}
+		}
+
+		successCount := 0
+		for _, id := range ids {
+			_, err := client.DeleteWebhook(context.Background(), &admin.DeleteWebhookRequest{Username: user, Id: id})
+			if err != nil {
+				fmt.Printf("Error deleting webhook %d: %v\n", id, err)
+				continue
+			}
+			successCount++
+		}
+
+		fmt.Printf("Successfully deleted %d webhooks for user: %s\n", successCount, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteWebhooksCmd)
+	addGrpcAddressFlag(deleteWebhooksCmd)
+	addUserFlag(deleteWebhooksCmd)
+	deleteWebhooksCmd.Flags().Int64("id", 0, "ID of the webhook to delete")
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var exportAccountCmd = &cobra.Command{
+	Use:     "export-account",
+	Short:   "Export an archive of subscriptions, articles and preferences for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			path = promptForInput("Enter path to write the archive to:")
+			if path == "" {
+				fmt.Println("No file provided. Aborting.")
+				return
+			}
+		}
+
+		stream, err := client.ExportAccount(context.Background(), &admin.ExportAccountRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error exporting account: %v\n", err)
+			return
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Printf("Error creating archive file: %v\n", err)
+			return
+		}
+		defer f.Close()
+
+		var size int
+		for {
+			res, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				fmt.Printf("Error exporting account: %v\n", err)
+				return
+			}
+			if _, err = f.Write(res.Data); err != nil {
+				fmt.Printf("Error writing archive file: %v\n", err)
+				return
+			}
+			size += len(res.Data)
+		}
+
+		fmt.Printf("Exported account for user %s to %s (%d bytes)\n", user, path, size)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportAccountCmd)
+	addGrpcAddressFlag(exportAccountCmd)
+	addUserFlag(exportAccountCmd)
+	exportAccountCmd.Flags().String("file", "", "Path to write the archive to")
+}
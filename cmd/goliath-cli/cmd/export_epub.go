@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var exportEpubCmd = &cobra.Command{
+	Use:     "export-epub",
+	Short:   "Export saved, labeled or folder articles for a user as an EPUB book",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		saved, _ := cmd.Flags().GetBool("saved")
+		label, _ := cmd.Flags().GetString("label")
+		folders, _ := cmd.Flags().GetInt64Slice("folder")
+		days, _ := cmd.Flags().GetInt32("days")
+		title, _ := cmd.Flags().GetString("title")
+		if !saved && label == "" && len(folders) == 0 {
+			fmt.Println("Command aborted. One of --saved, --label or --folder is required.")
+			return
+		}
+
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			path = promptForInput("Enter path to write the book to:")
+			if path == "" {
+				fmt.Println("No file provided. Aborting.")
+				return
+			}
+		}
+
+		stream, err := client.ExportEpub(context.Background(), &admin.ExportEpubRequest{
+			Username: user,
+			Saved:    saved,
+			Label:    label,
+			FolderId: folders,
+			Days:     days,
+			Title:    title,
+		})
+		if err != nil {
+			fmt.Printf("Error exporting EPUB: %v\n", err)
+			return
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Printf("Error creating book file: %v\n", err)
+			return
+		}
+		defer f.Close()
+
+		var size int
+		for {
+			res, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				fmt.Printf("Error exporting EPUB: %v\n", err)
+				return
+			}
+			if _, err = f.Write(res.Data); err != nil {
+				fmt.Printf("Error writing book file: %v\n", err)
+				return
+			}
+			size += len(res.Data)
+		}
+
+		fmt.Printf("Exported EPUB for user %s to %s (%d bytes)\n", user, path, size)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportEpubCmd)
+	addGrpcAddressFlag(exportEpubCmd)
+	addUserFlag(exportEpubCmd)
+	exportEpubCmd.Flags().Bool("saved", false, "Only export saved articles")
+	exportEpubCmd.Flags().String("label", "", "Only export articles with this label")
+	exportEpubCmd.Flags().Int64Slice("folder", nil, "Only export articles in these folder IDs (and their subfolders)")
+	exportEpubCmd.Flags().Int32("days", 0, "Only export articles retrieved in this many last days")
+	exportEpubCmd.Flags().String("title", "", "Title of the book")
+	exportEpubCmd.Flags().String("file", "", "Path to write the book to")
+}
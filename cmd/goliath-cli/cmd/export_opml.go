@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var exportOpmlCmd = &cobra.Command{
+	Use:     "export-opml",
+	Short:   "Export feeds and folders for a user as OPML",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.ExportOpml(context.Background(), &admin.ExportOpmlRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error exporting OPML: %v\n", err)
+			return
+		}
+
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			_, _ = os.Stdout.Write(res.Opml)
+			return
+		}
+
+		if err = os.WriteFile(path, res.Opml, 0644); err != nil {
+			fmt.Printf("Error writing OPML file: %v\n", err)
+			return
+		}
+		fmt.Printf("Exported OPML for user %s to %s\n", user, path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportOpmlCmd)
+	addGrpcAddressFlag(exportOpmlCmd)
+	addUserFlag(exportOpmlCmd)
+	exportOpmlCmd.Flags().String("file", "", "Path to write the OPML file to (default: stdout)")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+// importChunkSize is the size of archive chunks sent to the server.
+const importChunkSize = 256 << 10
+
+var importAccountCmd = &cobra.Command{
+	Use:     "import-account",
+	Short:   "Restore an archive written by export-account for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			path = promptForInput("Enter path to the archive:")
+			if path == "" {
+				fmt.Println("No file provided. Aborting.")
+				return
+			}
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error opening archive file: %v\n", err)
+			return
+		}
+		defer f.Close()
+
+		stream, err := client.ImportAccount(context.Background())
+		if err != nil {
+			fmt.Printf("Error importing account: %v\n", err)
+			return
+		}
+
+		req := &admin.ImportAccountRequest{Username: user}
+		buf := make([]byte, importChunkSize)
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				req.Data = buf[:n]
+				if err := stream.Send(req); err != nil {
+					// The server's status is returned by CloseAndRecv below.
+					break
+				}
+				req = &admin.ImportAccountRequest{}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				fmt.Printf("Error reading archive file: %v\n", err)
+				return
+			}
+		}
+
+		res, err := stream.CloseAndRecv()
+		if err != nil {
+			fmt.Printf("Error importing account: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Imported account for user: %s\n\n", user)
+		if sub := res.Subscriptions; sub != nil {
+			printImportedFolders("Created folders", sub.CreatedFolders)
+			printImportedFolders("Merged folders", sub.MergedFolders)
+			printImportedFolders("Skipped folders", sub.SkippedFolders)
+			printImportedFeeds("Created feeds", sub.CreatedFeeds)
+			printImportedFeeds("Merged feeds", sub.MergedFeeds)
+			printImportedFeeds("Skipped feeds", sub.SkippedFeeds)
+		}
+		fmt.Printf("Articles: %d created, %d updated, %d skipped\n",
+			res.CreatedArticles, res.UpdatedArticles, res.SkippedArticles)
+		fmt.Printf("Favicons: %d\n", res.Favicons)
+		fmt.Printf("Mute words: %d\n", res.MuteWords)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importAccountCmd)
+	addGrpcAddressFlag(importAccountCmd)
+	addUserFlag(importAccountCmd)
+	importAccountCmd.Flags().String("file", "", "Path to the archive to import")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var importOpmlCmd = &cobra.Command{
+	Use:     "import-opml",
+	Short:   "Import feeds and folders from an OPML file for a user",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		path, _ := cmd.Flags().GetString("file")
+		if path == "" {
+			path = promptForInput("Enter path to OPML file:")
+			if path == "" {
+				fmt.Println("No file provided. Aborting.")
+				return
+			}
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading OPML file: %v\n", err)
+			return
+		}
+
+		res, err := client.ImportOpml(context.Background(), &admin.ImportOpmlRequest{
+			Username: user,
+			Opml:     content,
+		})
+		if err != nil {
+			fmt.Printf("Error importing OPML: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Imported OPML for user: %s\n\n", user)
+		printImportedFolders("Created folders", res.CreatedFolders)
+		printImportedFolders("Merged folders", res.MergedFolders)
+		printImportedFolders("Skipped folders", res.SkippedFolders)
+		printImportedFeeds("Created feeds", res.CreatedFeeds)
+		printImportedFeeds("Merged feeds", res.MergedFeeds)
+		printImportedFeeds("Skipped feeds", res.SkippedFeeds)
+	},
+}
+
+func printImportedFolders(heading string, folders []*admin.OpmlImportFolder) {
+	fmt.Printf("%s (%d):\n", heading, len(folders))
+	for _, f := range folders {
+		if f.Reason != "" {
+			fmt.Printf("  - %s: %s\n", f.Name, f.Reason)
+		} else {
+			fmt.Printf("  - %s\n", f.Name)
+		}
+	}
+	fmt.Println()
+}
+
+func printImportedFeeds(heading string, feeds []*admin.OpmlImportFeed) {
+	fmt.Printf("%s (%d):\n", heading, len(feeds))
+	for _, f := range feeds {
+		if f.Reason != "" {
+			fmt.Printf("  - %s [%s] (%s): %s\n", f.Title, f.Folder, f.URL, f.Reason)
+		} else {
+			fmt.Printf("  - %s [%s] (%s)\n", f.Title, f.Folder, f.URL)
+		}
+	}
+	fmt.Println()
+}
+
+func init() {
+	rootCmd.AddCommand(importOpmlCmd)
+	addGrpcAddressFlag(importOpmlCmd)
+	addUserFlag(importOpmlCmd)
+	importOpmlCmd.Flags().String("file", "", "Path to the OPML file to import")
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/jrupac/goliath/admin"
 	"github.com/spf13/cobra"
@@ -39,7 +40,18 @@ var listFeedsCmd = &cobra.Command{
 
 		fmt.Println("Feeds for", user, ":")
 		for _, feed := range res.Feeds {
-			fmt.Printf("  ID: %d, Title: %s\n", feed.Id, feed.Title)
+			var notes []string
+			if feed.FetchFullText {
+				notes = append(notes, "full text")
+			}
+			if len(feed.Transformer) > 0 {
+				notes = append(notes, "transformers: "+strings.Join(feed.Transformer, ", "))
+			}
+			if len(notes) > 0 {
+				fmt.Printf("  ID: %d, Title: %s (%s)\n", feed.Id, feed.Title, strings.Join(notes, "; "))
+			} else {
+				fmt.Printf("  ID: %d, Title: %s\n", feed.Id, feed.Title)
+			}
 		}
 	},
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listNewsletterAddressesCmd = &cobra.Command{
+	Use:     "list-newsletter-addresses",
+	Short:   "List addresses at which a user receives email newsletters",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetNewsletterAddresses(context.Background(), &admin.GetNewsletterAddressesRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching newsletter addresses: %v\n", err)
+			return
+		}
+
+		if len(res.Addresses) == 0 {
+			fmt.Println("No newsletter addresses found for user:", user)
+			return
+		}
+
+		fmt.Printf("Newsletter addresses for user: %s\n\n", user)
+		for _, a := range res.Addresses {
+			fmt.Printf("%s\n", a.Address)
+			fmt.Printf("  Created: %s\n", time.Unix(a.Created, 0).Format(time.RFC1123))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listNewsletterAddressesCmd)
+	addGrpcAddressFlag(listNewsletterAddressesCmd)
+	addUserFlag(listNewsletterAddressesCmd)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listRulesCmd = &cobra.Command{
+	Use:     "list-rules",
+	Short:   "List rules applied to new articles for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetRules(context.Background(), &admin.GetRulesRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching rules: %v\n", err)
+			return
+		}
+
+		if len(res.Rules) == 0 {
+			fmt.Println("No rules found for user:", user)
+			return
+		}
+
+		fmt.Printf("Rules for user: %s\n\n", user)
+		for _, r := range res.Rules {
+			fmt.Printf("%s (ID: %d):\n", r.Name, r.Id)
+			fmt.Printf("  if:   %s\n", describeRuleConditions(r))
+			fmt.Printf("  then: %s\n\n", describeRuleActions(r))
+		}
+	},
+}
+
+func describeRuleConditions(r *admin.Rule) string {
+	var conds []string
+	if len(r.FeedId) > 0 {
+		conds = append(conds, fmt.Sprintf("feed in %v", r.FeedId))
+	}
+	if len(r.FolderId) > 0 {
+		conds = append(conds, fmt.Sprintf("folder in %v", r.FolderId))
+	}
+	if r.TitleRegex != "" {
+		conds = append(conds, fmt.Sprintf("title matches %q", r.TitleRegex))
+	}
+	if r.ContentRegex != "" {
+		conds = append(conds, fmt.Sprintf("content matches %q", r.ContentRegex))
+	}
+	if r.AuthorRegex != "" {
+		conds = append(conds, fmt.Sprintf("author matches %q", r.AuthorRegex))
+	}
+	if len(r.Category) > 0 {
+		conds = append(conds, fmt.Sprintf("category in %v", r.Category))
+	}
+	if len(r.LinkDomain) > 0 {
+		conds = append(conds, fmt.Sprintf("link domain in %v", r.LinkDomain))
+	}
+	if r.MinAge != "" {
+		conds = append(conds, fmt.Sprintf("older than %s", r.MinAge))
+	}
+	if len(conds) == 0 {
+		return "any article"
+	}
+	return strings.Join(conds, " and ")
+}
+
+func describeRuleActions(r *admin.Rule) string {
+	var actions []string
+	if r.Mute {
+		actions = append(actions, "mute")
+	}
+	if r.MarkRead {
+		actions = append(actions, "mark read")
+	}
+	if r.Star {
+		actions = append(actions, "star")
+	}
+	if len(r.Label) > 0 {
+		actions = append(actions, fmt.Sprintf("label %v", r.Label))
+	}
+	if r.Priority {
+		actions = append(actions, "priority")
+	}
+	if r.FetchFullText {
+		actions = append(actions, "fetch full text")
+	}
+	if len(actions) == 0 {
+		return "nothing"
+	}
+	return strings.Join(actions, ", ")
+}
+
+func init() {
+	rootCmd.AddCommand(listRulesCmd)
+	addGrpcAddressFlag(listRulesCmd)
+	addUserFlag(listRulesCmd)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listStarredFeedsCmd = &cobra.Command{
+	Use:     "list-starred-feeds",
+	Short:   "List private Atom feeds of saved articles for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetStarredFeedTokens(context.Background(), &admin.GetStarredFeedTokensRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching starred feeds: %v\n", err)
+			return
+		}
+
+		if len(res.Tokens) == 0 {
+			fmt.Println("No starred feeds found for user:", user)
+			return
+		}
+
+		fmt.Printf("Starred feeds for user: %s\n\n", user)
+		for _, t := range res.Tokens {
+			folder := t.Folder
+			if folder == "" {
+				folder = "(all folders)"
+			}
+			fmt.Printf("%s\n", t.Path)
+			fmt.Printf("  Folder:  %s\n", folder)
+			fmt.Printf("  Created: %s\n", time.Unix(t.Created, 0).Format(time.RFC1123))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listStarredFeedsCmd)
+	addGrpcAddressFlag(listStarredFeedsCmd)
+	addUserFlag(listStarredFeedsCmd)
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listTransformersCmd = &cobra.Command{
+	Use:     "list-transformers",
+	Short:   "List the transformers that can rewrite the content of new articles of feeds",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		res, err := client.GetTransformers(context.Background(), &admin.GetTransformersRequest{})
+		if err != nil {
+			fmt.Printf("Error calling GetTransformers: %v\n", err)
+			return
+		}
+
+		fmt.Println("Transformers:")
+		for _, t := range res.Transformers {
+			fmt.Printf("  %s: %s\n", t.Name, t.Description)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listTransformersCmd)
+	addGrpcAddressFlag(listTransformersCmd)
+}
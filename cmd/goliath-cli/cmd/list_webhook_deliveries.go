@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listWebhookDeliveriesCmd = &cobra.Command{
+	Use:     "list-webhook-deliveries",
+	Short:   "List recent webhook deliveries, or only those that were given up on",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		dead, _ := cmd.Flags().GetBool("dead")
+		limit, _ := cmd.Flags().GetInt32("limit")
+		showPayload, _ := cmd.Flags().GetBool("payload")
+
+		res, err := client.GetWebhookDeliveries(context.Background(), &admin.GetWebhookDeliveriesRequest{
+			Username: user,
+			DeadOnly: dead,
+			Limit:    limit,
+		})
+		if err != nil {
+			fmt.Printf("Error fetching webhook deliveries: %v\n", err)
+			return
+		}
+
+		if len(res.Deliveries) == 0 {
+			fmt.Println("No webhook deliveries found for user:", user)
+			return
+		}
+
+		fmt.Printf("Webhook deliveries for user: %s\n\n", user)
+		for _, d := range res.Deliveries {
+			fmt.Printf("%d: webhook %d, article %d: %s after %d attempts (last at %s)\n",
+				d.Id, d.WebhookId, d.ArticleId, d.Status, d.Attempts,
+				time.Unix(d.Updated, 0).Format(time.DateTime))
+			if d.ResponseCode != 0 {
+				fmt.Printf("  response: HTTP %d\n", d.ResponseCode)
+			}
+			if d.Error != "" {
+				fmt.Printf("  error: %s\n", d.Error)
+			}
+			if showPayload {
+				fmt.Printf("  payload: %s\n", d.Payload)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listWebhookDeliveriesCmd)
+	addGrpcAddressFlag(listWebhookDeliveriesCmd)
+	addUserFlag(listWebhookDeliveriesCmd)
+
+	flags := listWebhookDeliveriesCmd.Flags()
+	flags.Bool("dead", false, "Only list deliveries that were given up on")
+	flags.Int32("limit", 100, "Maximum number of deliveries to list")
+	flags.Bool("payload", false, "Also print the payload of each delivery")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var listWebhooksCmd = &cobra.Command{
+	Use:     "list-webhooks",
+	Short:   "List outgoing webhooks for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetWebhooks(context.Background(), &admin.GetWebhooksRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching webhooks: %v\n", err)
+			return
+		}
+
+		if len(res.Webhooks) == 0 {
+			fmt.Println("No webhooks found for user:", user)
+			return
+		}
+
+		fmt.Printf("Webhooks for user: %s\n\n", user)
+		for _, w := range res.Webhooks {
+			fmt.Printf("%s (ID: %d):\n", w.URL, w.Id)
+			fmt.Printf("  for: %s\n", describeWebhookFilter(w))
+			if w.Template != "" {
+				fmt.Printf("  template:\n%s\n", w.Template)
+			}
+			fmt.Println()
+		}
+	},
+}
+
+func describeWebhookFilter(w *admin.Webhook) string {
+	var conds []string
+	if len(w.FeedId) > 0 {
+		conds = append(conds, fmt.Sprintf("feed in %v", w.FeedId))
+	}
+	if len(w.FolderId) > 0 {
+		conds = append(conds, fmt.Sprintf("folder in %v", w.FolderId))
+	}
+	if len(w.Keyword) > 0 {
+		conds = append(conds, fmt.Sprintf("keyword in %q", w.Keyword))
+	}
+	if len(w.RuleId) > 0 {
+		conds = append(conds, fmt.Sprintf("matched rule in %v", w.RuleId))
+	}
+	if len(conds) == 0 {
+		return "any article"
+	}
+	return strings.Join(conds, " and ")
+}
+
+func init() {
+	rootCmd.AddCommand(listWebhooksCmd)
+	addGrpcAddressFlag(listWebhooksCmd)
+	addUserFlag(listWebhooksCmd)
+}
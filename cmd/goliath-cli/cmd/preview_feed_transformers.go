@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var previewFeedTransformersCmd = &cobra.Command{
+	Use:     "preview-feed-transformers",
+	Short:   "Show the content of a sample item of a feed before and after transformers rewrite it",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		feedID, ok := getFeedID(cmd)
+		if !ok {
+			return
+		}
+
+		names, _ := cmd.Flags().GetStringSlice("transformer")
+		link, _ := cmd.Flags().GetString("link")
+
+		res, err := client.PreviewFeedTransformers(context.Background(), &admin.PreviewFeedTransformersRequest{
+			Username:    user,
+			FeedId:      feedID,
+			Transformer: names,
+			Link:        link,
+		})
+		if err != nil {
+			fmt.Printf("Error calling PreviewFeedTransformers: %v\n", err)
+			return
+		}
+
+		applied := "(none)"
+		if len(res.Transformer) > 0 {
+			applied = strings.Join(res.Transformer, ", ")
+		}
+		fmt.Printf("Item: %s\nLink: %s\nTransformers: %s\n", res.Title, res.Link, applied)
+		fmt.Printf("\n--- Before ---\n%s\n", res.Before)
+		fmt.Printf("\n--- After ---\n%s\n", res.After)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(previewFeedTransformersCmd)
+	addGrpcAddressFlag(previewFeedTransformersCmd)
+	addUserFlag(previewFeedTransformersCmd)
+	previewFeedTransformersCmd.Flags().Int64("feed-id", 0, "Feed ID to preview")
+	previewFeedTransformersCmd.Flags().StringSlice("transformer", nil, "Names of transformers to preview in order (defaults to those of the feed)")
+	previewFeedTransformersCmd.Flags().String("link", "", "Link of the item to preview (defaults to the first item with content)")
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var revokeStarredFeedsCmd = &cobra.Command{
+	Use:     "revoke-starred-feeds",
+	Short:   "Revoke one or more private Atom feeds of saved articles",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		var selectedTokens []string
+		if token, _ := cmd.Flags().GetString("token"); token != "" {
+			selectedTokens = []string{token}
+		} else {
+			res, err := client.GetStarredFeedTokens(context.Background(), &admin.GetStarredFeedTokensRequest{Username: user})
+			if err != nil {
+				fmt.Printf("Error fetching starred feeds: %v\n", err)
+				return
+			}
+
+			if len(res.Tokens) == 0 {
+				fmt.Println("No starred feeds found for user:", user)
+				return
+			}
+
+			var choices []string
+			choiceToToken := make(map[string]string)
+			for _, t := range res.Tokens {
+				folder := t.Folder
+				if folder == "" {
+					folder = "all folders"
+				}
+				choice := fmt.Sprintf("%s (%s)", t.Path, folder)
+				choices = append(choices, choice)
+				choiceToToken[choice] = t.Token
+			}
+
+			selectedChoices := promptForChecklist("Select starred feeds to revoke:", choices)
+			if len(selectedChoices) == 0 {
+				fmt.Println("No starred feeds selected. Aborting.")
+				return
+			}
+			for _, choice := range selectedChoices {
+				selectedTokens = append(selectedTokens, choiceToToken[choice])
+			}
+		}
+
+		successCount := 0
+		for _, token := range selectedTokens {
+			_, err := client.RevokeStarredFeedToken(context.Background(), &admin.RevokeStarredFeedTokenRequest{
+				Username: user,
+				Token:    token,
+			})
+			if err != nil {
+				fmt.Printf("Error revoking starred feed %s: %v\n", token, err)
+				continue
+			}
+			successCount++
+		}
+
+		fmt.Printf("Successfully revoked %d starred feed(s) for user: %s\n", successCount, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(revokeStarredFeedsCmd)
+	addGrpcAddressFlag(revokeStarredFeedsCmd)
+	addUserFlag(revokeStarredFeedsCmd)
+	revokeStarredFeedsCmd.Flags().String("token", "", "Token of the starred feed to revoke")
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var sendDigestCmd = &cobra.Command{
+	Use:     "send-digest",
+	Short:   "Send an email digest to a user now, regardless of its schedule",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.SendDigest(context.Background(), &admin.SendDigestRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error calling SendDigest: %v\n", err)
+			return
+		}
+
+		if res.Count == 0 {
+			fmt.Println("No articles to include in a digest for user:", user)
+			return
+		}
+		fmt.Printf("Successfully sent digest of %d articles to user: %s\n", res.Count, user)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sendDigestCmd)
+	addGrpcAddressFlag(sendDigestCmd)
+	addUserFlag(sendDigestCmd)
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var setDigestCmd = &cobra.Command{
+	Use:   "set-digest",
+	Short: "Set up scheduled email digests of unread articles",
+	Long: `Set up scheduled email digests of unread articles, or of articles with any
+of the given labels. Only flags that are given are changed from the current
+settings, and digests are enabled unless --disable is given.`,
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetDigestSettings(context.Background(), &admin.GetDigestSettingsRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching digest settings: %v\n", err)
+			return
+		}
+		settings := res.Settings
+		if settings == nil {
+			settings = &admin.DigestSettings{}
+		}
+
+		flags := cmd.Flags()
+		disable, _ := flags.GetBool("disable")
+		settings.Enabled = !disable
+		if flags.Changed("email") {
+			settings.Email, _ = flags.GetString("email")
+		}
+		if flags.Changed("time") {
+			settings.Time, _ = flags.GetString("time")
+		}
+		if flags.Changed("weekday") {
+			settings.Weekday, _ = flags.GetStringSlice("weekday")
+		}
+		if flags.Changed("timezone") {
+			settings.Timezone, _ = flags.GetString("timezone")
+		}
+		if flags.Changed("window-hours") {
+			settings.WindowHours, _ = flags.GetInt32("window-hours")
+		}
+		if flags.Changed("label") {
+			settings.Label, _ = flags.GetStringSlice("label")
+		}
+		if flags.Changed("mark-read") {
+			settings.MarkRead, _ = flags.GetBool("mark-read")
+		}
+
+		if settings.Email == "" {
+			settings.Email = promptForInput("Enter email address:")
+			if settings.Email == "" {
+				fmt.Println("No email address provided. Aborting.")
+				return
+			}
+		}
+
+		_, err = client.SetDigestSettings(context.Background(), &admin.SetDigestSettingsRequest{
+			Username: user,
+			Settings: settings,
+		})
+		if err != nil {
+			fmt.Printf("Error calling SetDigestSettings: %v\n", err)
+			return
+		}
+
+		if disable {
+			fmt.Printf("Successfully disabled digests for user: %s\n", user)
+		} else {
+			fmt.Printf("Successfully set up digests to %s for user: %s\n", settings.Email, user)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setDigestCmd)
+	addGrpcAddressFlag(setDigestCmd)
+	addUserFlag(setDigestCmd)
+
+	flags := setDigestCmd.Flags()
+	flags.String("email", "", "Address to send digests to")
+	flags.String("time", "07:00", "Local time of day to send digests at")
+	flags.StringSlice("weekday", nil, "Days of the week to send digests on (default every day)")
+	flags.String("timezone", "UTC", "IANA time zone of the schedule")
+	flags.Int32("window-hours", 24, "Include articles retrieved in this many hours before sending")
+	flags.StringSlice("label", nil, "Include articles with these labels instead of unread articles")
+	flags.Bool("mark-read", false, "Mark articles as read once a digest is sent")
+	flags.Bool("disable", false, "Disable digests")
+}
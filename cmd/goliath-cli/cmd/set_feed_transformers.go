@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var setFeedTransformersCmd = &cobra.Command{
+	Use:     "set-feed-transformers",
+	Short:   "Set the ordered list of transformers that rewrite the content of new articles of a feed",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		feedID, ok := getFeedID(cmd)
+		if !ok {
+			return
+		}
+
+		names, _ := cmd.Flags().GetStringSlice("transformer")
+		clearAll, _ := cmd.Flags().GetBool("clear")
+		if len(names) == 0 && !clearAll {
+			res, err := client.GetTransformers(context.Background(), &admin.GetTransformersRequest{})
+			if err != nil {
+				fmt.Printf("Error fetching transformers: %v\n", err)
+				return
+			}
+			var choices []string
+			for _, t := range res.Transformers {
+				choices = append(choices, t.Name)
+			}
+			// Selected transformers run in the order they are listed.
+			names = promptForChecklist("Select transformers for the feed:", choices)
+			if len(names) == 0 {
+				fmt.Println("No transformers selected. Use --clear to remove all transformers. Aborting.")
+				return
+			}
+		}
+
+		req := &admin.SetFeedTransformersRequest{
+			Username:    user,
+			FeedId:      feedID,
+			Transformer: names,
+		}
+
+		if _, err := client.SetFeedTransformers(context.Background(), req); err != nil {
+			fmt.Printf("Error calling SetFeedTransformers: %v\n", err)
+			return
+		}
+
+		if len(names) == 0 {
+			fmt.Printf("Successfully removed transformers of feed %d for user: %s\n", feedID, user)
+		} else {
+			fmt.Printf("Successfully set transformers of feed %d for user %s to: %s\n", feedID, user, strings.Join(names, ", "))
+		}
+	},
+}
+
+// getFeedID returns the feed ID given as a flag or prompted for, and false if
+// none was given.
+func getFeedID(cmd *cobra.Command) (int64, bool) {
+	feedID, _ := cmd.Flags().GetInt64("feed-id")
+	if feedID != 0 {
+		return feedID, true
+	}
+	input := promptForInput("Enter feed ID:")
+	if input == "" {
+		fmt.Println("No feed ID provided. Aborting.")
+		return 0, false
+	}
+	feedID, err := strconv.ParseInt(input, 10, 64)
+	if err != nil {
+		fmt.Printf("Invalid feed ID %q. Aborting.\n", input)
+		return 0, false
+	}
+	return feedID, true
+}
+
+func init() {
+	rootCmd.AddCommand(setFeedTransformersCmd)
+	addGrpcAddressFlag(setFeedTransformersCmd)
+	addUserFlag(setFeedTransformersCmd)
+	setFeedTransformersCmd.Flags().Int64("feed-id", 0, "Feed ID to set transformers for")
+	setFeedTransformersCmd.Flags().StringSlice("transformer", nil, "Names of transformers in the order they should run")
+	setFeedTransformersCmd.Flags().Bool("clear", false, "Remove all transformers of the feed")
+}
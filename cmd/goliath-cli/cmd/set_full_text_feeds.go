@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var setFullTextFeedsCmd = &cobra.Command{
+	Use:     "set-full-text-feeds",
+	Short:   "Enable or disable full-text extraction at fetch time for feeds of a user",
+	GroupID: "user_feed",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		disable, _ := cmd.Flags().GetBool("disable")
+
+		allFeedsRes, err := client.GetFeeds(context.Background(), &admin.GetFeedsRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching feeds: %v\n", err)
+			return
+		}
+
+		// Only offer feeds whose setting would change.
+		var feedTitles []string
+		feedTitleToID := make(map[string]int64)
+		for _, feed := range allFeedsRes.Feeds {
+			if feed.FetchFullText == disable {
+				feedTitles = append(feedTitles, feed.Title)
+				feedTitleToID[feed.Title] = feed.Id
+			}
+		}
+
+		if len(feedTitles) == 0 {
+			fmt.Println("No matching feeds found for user:", user)
+			return
+		}
+
+		prompt := "Select feeds to fetch full text for:"
+		if disable {
+			prompt = "Select feeds to stop fetching full text for:"
+		}
+		selectedTitles := promptForChecklist(prompt, feedTitles)
+
+		if len(selectedTitles) == 0 {
+			fmt.Println("No feeds selected. Aborting.")
+			return
+		}
+
+		var ids []int64
+		for _, title := range selectedTitles {
+			ids = append(ids, feedTitleToID[title])
+		}
+
+		req := &admin.SetFeedFetchFullTextRequest{
+			Username: user,
+			FeedId:   ids,
+			Enabled:  !disable,
+		}
+
+		_, err = client.SetFeedFetchFullText(context.Background(), req)
+		if err != nil {
+			fmt.Printf("Error calling SetFeedFetchFullText: %v\n", err)
+			return
+		}
+
+		if disable {
+			fmt.Printf("Successfully disabled full-text extraction for %d feeds for user: %s\n", len(ids), user)
+		} else {
+			fmt.Printf("Successfully enabled full-text extraction for %d feeds for user: %s\n", len(ids), user)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setFullTextFeedsCmd)
+	addGrpcAddressFlag(setFullTextFeedsCmd)
+	addUserFlag(setFullTextFeedsCmd)
+	setFullTextFeedsCmd.Flags().Bool("disable", false, "Disable rather than enable full-text extraction")
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var setStoriesCmd = &cobra.Command{
+	Use:   "set-stories",
+	Short: "Set how near-duplicate articles from different feeds are shown",
+	Long: `Set how near-duplicate articles from different feeds, which are grouped into
+stories, are shown. Only flags that are given are changed from the current
+settings.`,
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetStorySettings(context.Background(), &admin.GetStorySettingsRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching story settings: %v\n", err)
+			return
+		}
+		settings := res.Settings
+		if settings == nil {
+			settings = &admin.StorySettings{}
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("group") {
+			settings.Group, _ = flags.GetBool("group")
+		}
+		if flags.Changed("mark-read") {
+			settings.MarkRead, _ = flags.GetBool("mark-read")
+		}
+
+		_, err = client.SetStorySettings(context.Background(), &admin.SetStorySettingsRequest{
+			Username: user,
+			Settings: settings,
+		})
+		if err != nil {
+			fmt.Printf("Error calling SetStorySettings: %v\n", err)
+			return
+		}
+
+		fmt.Printf("Story settings for user: %s\n\n", user)
+		fmt.Printf("  group:     %t\n", settings.Group)
+		fmt.Printf("  mark read: %t\n", settings.MarkRead)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setStoriesCmd)
+	addGrpcAddressFlag(setStoriesCmd)
+	addUserFlag(setStoriesCmd)
+
+	flags := setStoriesCmd.Flags()
+	flags.Bool("group", true, "Show each story as one article with the others as its sources")
+	flags.Bool("mark-read", false, "Mark articles read when they join an existing story")
+}
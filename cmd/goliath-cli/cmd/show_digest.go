@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jrupac/goliath/admin"
+	"github.com/spf13/cobra"
+)
+
+var showDigestCmd = &cobra.Command{
+	Use:     "show-digest",
+	Short:   "Show email digest settings for a user",
+	GroupID: "user_pref",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := getAdminClient(cmd)
+		defer conn.Close()
+
+		user := getUser(cmd)
+		if user == "" {
+			fmt.Println("Command aborted. User is required.")
+			return
+		}
+
+		res, err := client.GetDigestSettings(context.Background(), &admin.GetDigestSettingsRequest{Username: user})
+		if err != nil {
+			fmt.Printf("Error fetching digest settings: %v\n", err)
+			return
+		}
+
+		s := res.Settings
+		if s == nil {
+			fmt.Println("No digest settings found for user:", user)
+			return
+		}
+
+		days := "every day"
+		if len(s.Weekday) > 0 {
+			days = strings.Join(s.Weekday, ", ")
+		}
+		articles := "unread articles"
+		if len(s.Label) > 0 {
+			articles = fmt.Sprintf("articles labeled %v", s.Label)
+		}
+
+		fmt.Printf("Digest settings for user: %s\n\n", user)
+		fmt.Printf("  enabled:   %t\n", s.Enabled)
+		fmt.Printf("  email:     %s\n", s.Email)
+		fmt.Printf("  schedule:  %s %s, %s\n", s.Time, s.Timezone, days)
+		fmt.Printf("  includes:  %s from the past %d hours\n", articles, s.WindowHours)
+		fmt.Printf("  mark read: %t\n", s.MarkRead)
+		if s.LastSent != 0 {
+			fmt.Printf("  last sent: %s\n", time.Unix(s.LastSent, 0).Format(time.DateTime))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(showDigestCmd)
+	addGrpcAddressFlag(showDigestCmd)
+	addUserFlag(showDigestCmd)
+}
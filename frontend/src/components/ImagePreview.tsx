@@ -1,6 +1,6 @@
 import React, { memo, useEffect, useRef, useState } from 'react';
 import { ArticleView, ArticleId } from '../models/article';
-import { getPreviewImage } from '../utils/helpers';
+import { getPreviewImage, resizedImageUrl } from '../utils/helpers';
 import { Skeleton } from '@mui/material';
 import { ArticleImagePreview } from '../utils/types';
 
@@ -108,6 +108,7 @@ const ImagePreview: React.FC<ImagePreviewProps> = ({ article }) => {
           <img
             className="GoliathArticleListImagePreview"
             src={imgSrc}
+            srcSet={`${resizedImageUrl(imgSrc, 110)} 1x, ${resizedImageUrl(imgSrc, 220)} 2x`}
             alt={`Preview for ${article.title}`}
           />
         </figure>
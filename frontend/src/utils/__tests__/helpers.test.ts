@@ -7,6 +7,7 @@ import {
   getAdjacentFolder,
   getFeedInitials,
   hashToSwatchIndex,
+  resizedImageUrl,
   scopeArticleHtml,
 } from '../helpers';
 import { NavigationDirection } from '../types';
@@ -388,3 +389,23 @@ describe('scopeArticleHtml', () => {
     expect(scopeArticleHtml('', '12345')).toBe('');
   });
 });
+
+describe('resizedImageUrl', () => {
+  it('adds the width to proxied image URLs', () => {
+    const url = new URL(
+      resizedImageUrl('https://goliath.example.com/cache?sig=abc&url=x', 220)
+    );
+    expect(url.pathname).toBe('/cache');
+    expect(url.searchParams.get('w')).toBe('220');
+    expect(url.searchParams.get('sig')).toBe('abc');
+  });
+
+  it('leaves other URLs unchanged', () => {
+    expect(resizedImageUrl('http://example.com/image.png', 220)).toBe(
+      'http://example.com/image.png'
+    );
+    expect(resizedImageUrl('data:image/png;base64,AAAA', 220)).toBe(
+      'data:image/png;base64,AAAA'
+    );
+  });
+});
@@ -228,6 +228,22 @@ export function hashToSwatchIndex(id: string): number {
   return Math.abs(h) % 8;
 }
 
+// resizedImageUrl returns the URL of a variant of an image served by the image
+// proxy resized to the given width, or the URL itself if it is not proxied.
+export function resizedImageUrl(src: string, width: number): string {
+  let url: URL;
+  try {
+    url = new URL(src, window.location.href);
+  } catch {
+    return src;
+  }
+  if (!url.pathname.endsWith('/cache') || !url.searchParams.has('sig')) {
+    return src;
+  }
+  url.searchParams.set('w', String(Math.round(width)));
+  return url.toString();
+}
+
 export async function getPreviewImage(
   article: ArticleView
 ): Promise<ArticleImagePreview | undefined> {